@@ -0,0 +1,189 @@
+package azurecvm
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/sevsnp"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
+
+	snpabi "github.com/google/go-sev-guest/abi"
+	snppb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// AzureCVM reflects our expectations about Azure confidential VM.
+//
+// On Azure CVMs the guest does not have the access to the hardware report
+// directly. Instead, Azure paravisor (HCL) exposes a vTPM, and stores the
+// hardware report wrapped into HCL report in vTPM NV. The login carries the
+// HCL report and TPM 2.0 attestation generated with the attestation key of
+// vTPM over the nonce. The attestation key must be the one bound into the
+// runtime claims of HCL report (so that vTPM is bound to the hardware).
+//
+// On SEV-SNP CVMs the hardware report is verified as-is, while on TDX CVMs
+// the TDREPORT must be converted into a quote first (which is done by the
+// client with the help of Azure IMDS).
+type AzureCVM struct {
+	tokenutil.TokenParams `mapstructure:"-" structs:"-"`
+
+	// Name is the name of trusted domain.
+	Name string `json:"-" mapstructure:"-" structs:"-"`
+
+	// TOTPSecret is the secret used to generate initial TOTP codes.
+	TOTPSecret string `json:"totp_secret" mapstructure:"totp_secret" structs:"totp_secret"`
+
+	// SEVSNP is the policy that SEV-SNP attestation report must satisfy (on
+	// SEV-SNP CVMs).
+	SEVSNP *sevsnp.SEVSNP `json:"sevsnp" mapstructure:"-" structs:"-"`
+
+	// TDX is the policy that TDX quote must satisfy (on TDX CVMs).
+	TDX *tdx.TDX `json:"tdx" mapstructure:"-" structs:"-"`
+
+	// TPM2 is the policy that TPM 2.0 attestation must satisfy.
+	TPM2 *tpm2.TPM2 `json:"tpm2" mapstructure:"-" structs:"-"`
+}
+
+// HardwareReport is the hardware report of Azure CVM (that is either SEV-SNP
+// attestation report, or TDX quote).
+type HardwareReport struct {
+	SEVSNP *snppb.Attestation
+	TDX    *tdx.Quote
+}
+
+var (
+	errAzureCVMMissingSEVSNP         = errors.New("azure-cvm domain has no sevsnp policy")
+	errAzureCVMMissingTDX            = errors.New("azure-cvm domain has no tdx policy")
+	errAzureCVMMissingTPM2           = errors.New("azure-cvm domain has no tpm2 policy")
+	errAzureCVMMissingTDXQuote       = errors.New("tdx quote is required for tdx-based azure cvm")
+	errAzureCVMReportIsNil           = errors.New("azure cvm hardware report is nil")
+	errAzureCVMQuoteMismatchTDReport = errors.New("tdx quote does not match hcl tdreport")
+)
+
+// ParseHardwareReport parses the hardware report of HCL report (SEV-SNP), or
+// the TDX quote that was generated from it (TDX), and verifies that it is
+// bound to the runtime claims of HCL report.
+func ParseHardwareReport(hcl *HCLReport, quote []byte) (*HardwareReport, error) {
+	switch hcl.ReportType {
+	case ReportTypeSEVSNP:
+		report, err := snpabi.ReportToProto(hcl.HardwareReport)
+		if err != nil {
+			return nil, err
+		}
+		if err := hcl.MatchesReportData(report.ReportData); err != nil {
+			return nil, err
+		}
+		return &HardwareReport{
+			SEVSNP: &snppb.Attestation{
+				Report:           report,
+				CertificateChain: &snppb.CertificateChain{},
+			},
+		}, nil
+
+	case ReportTypeTDX:
+		if len(quote) == 0 {
+			return nil, errAzureCVMMissingTDXQuote
+		}
+		q, err := tdx.ParseQuote(quote)
+		if err != nil {
+			return nil, err
+		}
+		if subtle.ConstantTimeCompare(hcl.TDReportData(), q.Body.ReportData) != 1 {
+			return nil, errAzureCVMQuoteMismatchTDReport
+		}
+		if err := hcl.MatchesReportData(q.Body.ReportData); err != nil {
+			return nil, err
+		}
+		return &HardwareReport{
+			TDX: q,
+		}, nil
+	}
+
+	return nil, fmt.Errorf("%w: %d",
+		errHCLReportUnexpectedType, hcl.ReportType,
+	)
+}
+
+// SetName sets the name of the domain (and of its policies).
+func (td *AzureCVM) SetName(name string) {
+	td.Name = name
+	if td.SEVSNP != nil {
+		td.SEVSNP.Name = name
+	}
+	if td.TDX != nil {
+		td.TDX.Name = name
+	}
+	if td.TPM2 != nil {
+		td.TPM2.Name = name
+	}
+}
+
+// Matches evaluates the policy of the hardware report together with TPM 2.0
+// policy.
+func (td *AzureCVM) Matches(
+	report *HardwareReport,
+	attestation *attest.PlatformParameters,
+) (
+	[]error, []error,
+) {
+	{ // pre-flight checks
+		if report == nil {
+			return []error{
+				errAzureCVMReportIsNil,
+			}, nil
+		}
+		if td.TPM2 == nil {
+			return []error{
+				errAzureCVMMissingTPM2,
+			}, nil
+		}
+	}
+
+	var errs, dump []error
+
+	switch {
+	case report.SEVSNP != nil:
+		if td.SEVSNP == nil {
+			return []error{
+				errAzureCVMMissingSEVSNP,
+			}, nil
+		}
+		errs, dump = td.SEVSNP.MatchesReport(report.SEVSNP.Report)
+
+	case report.TDX != nil:
+		if td.TDX == nil {
+			return []error{
+				errAzureCVMMissingTDX,
+			}, nil
+		}
+		errs, dump = td.TDX.MatchesQuote(report.TDX)
+
+	default:
+		return []error{
+			errAzureCVMReportIsNil,
+		}, nil
+	}
+
+	errsTPM2, dumpTPM2 := td.TPM2.MatchesAttestation(attestation)
+
+	return append(errs, errsTPM2...), append(dump, dumpTPM2...)
+}
+
+func (td *AzureCVM) GetName() string {
+	return td.Name
+}
+
+func (td *AzureCVM) AttestationType() string {
+	return "azure-cvm"
+}
+
+func (td *AzureCVM) GetTOTPSecret() string {
+	return td.TOTPSecret
+}
+
+func (td *AzureCVM) SetTOTPSecret(totpSecret string) {
+	td.TOTPSecret = totpSecret
+}
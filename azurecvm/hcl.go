@@ -0,0 +1,233 @@
+package azurecvm
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/google/go-attestation/attest"
+)
+
+// HCLReport is the parsed attestation report of Azure paravisor (HCL).
+//
+// HCL report wraps the hardware report (SEV-SNP attestation report or TDX
+// TDREPORT) together with the runtime claims of the VM. The hash of the
+// runtime claims is put into the report data of the hardware report, and the
+// runtime claims carry the public part of the attestation key of vTPM. This
+// is what binds vTPM to the confidential VM.
+//
+// See also:
+//
+//   - https://learn.microsoft.com/en-us/azure/confidential-computing/guest-attestation-confidential-vms
+//   - https://github.com/kinvolk/azure-cvm-tooling/tree/main/az-cvm-vtpm/src/hcl
+type HCLReport struct {
+	// ReportType is the type of the hardware report (ReportTypeSEVSNP or
+	// ReportTypeTDX).
+	ReportType uint32
+
+	// HardwareReport is the raw hardware report (SEV-SNP attestation report,
+	// or TDX TDREPORT).
+	HardwareReport []byte
+
+	// RuntimeData is the raw JSON of the runtime claims.
+	RuntimeData []byte
+
+	hashType uint32
+}
+
+const (
+	// ReportTypeSEVSNP is the type of HCL report that wraps SEV-SNP
+	// attestation report.
+	ReportTypeSEVSNP = 2
+	// ReportTypeTDX is the type of HCL report that wraps TDX TDREPORT.
+	ReportTypeTDX = 4
+
+	hashTypeSHA256 = 1
+	hashTypeSHA384 = 2
+	hashTypeSHA512 = 3
+
+	hclSignature = "HCLA"
+
+	keyIDAK = "HCLAkPub"
+
+	sizeHCLHeader      = 32
+	sizeHardwareReport = 1184
+	sizeRequestHeader  = 20
+	sizeTDReport       = 1024
+
+	offsetTDReportData = 128
+	sizeTDReportData   = 64
+)
+
+var (
+	errHCLReportTooShort           = errors.New("hcl report is too short")
+	errHCLReportInvalidSignature   = errors.New("invalid hcl report signature")
+	errHCLReportUnexpectedType     = errors.New("unexpected hcl report type")
+	errHCLReportUnexpectedHash     = errors.New("unexpected hcl report data hash type")
+	errHCLReportInvalidClaims      = errors.New("invalid hcl runtime claims")
+	errHCLReportMissingAK          = errors.New("hcl runtime claims have no attestation key")
+	errHCLReportReportDataMismatch = errors.New("hardware report data does not match hcl runtime claims")
+	errHCLReportAKMismatch         = errors.New("tpm2 attestation key does not match hcl runtime claims")
+)
+
+// ParseHCLReport parses the raw HCL report (as it is stored in vTPM NV).
+func ParseHCLReport(raw []byte) (*HCLReport, error) {
+	if len(raw) < sizeHCLHeader+sizeHardwareReport+sizeRequestHeader {
+		return nil, fmt.Errorf("%w: %d",
+			errHCLReportTooShort, len(raw),
+		)
+	}
+
+	if !bytes.Equal(raw[:4], []byte(hclSignature)) {
+		return nil, errHCLReportInvalidSignature
+	}
+
+	request := raw[sizeHCLHeader+sizeHardwareReport:]
+
+	r := &HCLReport{
+		ReportType: binary.LittleEndian.Uint32(request[8:12]),
+		hashType:   binary.LittleEndian.Uint32(request[12:16]),
+	}
+
+	switch r.ReportType {
+	case ReportTypeSEVSNP:
+		r.HardwareReport = clone(raw[sizeHCLHeader : sizeHCLHeader+sizeHardwareReport])
+	case ReportTypeTDX:
+		r.HardwareReport = clone(raw[sizeHCLHeader : sizeHCLHeader+sizeTDReport])
+	default:
+		return nil, fmt.Errorf("%w: %d",
+			errHCLReportUnexpectedType, r.ReportType,
+		)
+	}
+
+	switch r.hashType {
+	case hashTypeSHA256, hashTypeSHA384, hashTypeSHA512:
+	default:
+		return nil, fmt.Errorf("%w: %d",
+			errHCLReportUnexpectedHash, r.hashType,
+		)
+	}
+
+	size := binary.LittleEndian.Uint32(request[16:20])
+	if uint64(len(request)) < sizeRequestHeader+uint64(size) {
+		return nil, fmt.Errorf("%w: runtime claims: %d < %d",
+			errHCLReportTooShort, len(request)-sizeRequestHeader, size,
+		)
+	}
+	r.RuntimeData = clone(request[sizeRequestHeader : sizeRequestHeader+size])
+
+	return r, nil
+}
+
+// TDReportData returns the report data of TDREPORT (nil for SEV-SNP).
+func (r *HCLReport) TDReportData() []byte {
+	if r.ReportType != ReportTypeTDX {
+		return nil
+	}
+	return r.HardwareReport[offsetTDReportData : offsetTDReportData+sizeTDReportData]
+}
+
+// MatchesReportData verifies that the report data of the hardware report is
+// the hash of the runtime claims.
+func (r *HCLReport) MatchesReportData(reportData []byte) error {
+	var digest []byte
+	switch r.hashType {
+	case hashTypeSHA256:
+		h := sha256.Sum256(r.RuntimeData)
+		digest = h[:]
+	case hashTypeSHA384:
+		h := sha512.Sum384(r.RuntimeData)
+		digest = h[:]
+	case hashTypeSHA512:
+		h := sha512.Sum512(r.RuntimeData)
+		digest = h[:]
+	}
+
+	if len(reportData) < len(digest) {
+		return errHCLReportReportDataMismatch
+	}
+	if subtle.ConstantTimeCompare(digest, reportData[:len(digest)]) != 1 {
+		return errHCLReportReportDataMismatch
+	}
+
+	return nil
+}
+
+// AKPublic returns the public part of vTPM attestation key from the runtime
+// claims.
+func (r *HCLReport) AKPublic() (*rsa.PublicKey, error) {
+	claims := struct {
+		Keys []struct {
+			KeyID   string `json:"kid"`
+			KeyType string `json:"kty"`
+			N       string `json:"n"`
+			E       string `json:"e"`
+		} `json:"keys"`
+	}{}
+	if err := json.Unmarshal(r.RuntimeData, &claims); err != nil {
+		return nil, fmt.Errorf("%w: %w", errHCLReportInvalidClaims, err)
+	}
+
+	for _, key := range claims.Keys {
+		if key.KeyID != keyIDAK {
+			continue
+		}
+		if key.KeyType != "RSA" {
+			return nil, fmt.Errorf("%w: unexpected key type: %s",
+				errHCLReportInvalidClaims, key.KeyType,
+			)
+		}
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errHCLReportInvalidClaims, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", errHCLReportInvalidClaims, err)
+		}
+		if len(e) == 0 || len(e) > 4 {
+			return nil, fmt.Errorf("%w: invalid exponent", errHCLReportInvalidClaims)
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	}
+
+	return nil, errHCLReportMissingAK
+}
+
+// MatchesAKPublic verifies that TPM 2.0 attestation key (encoded TPMT_PUBLIC)
+// is the one from the runtime claims.
+func (r *HCLReport) MatchesAKPublic(akPublic []byte) error {
+	expected, err := r.AKPublic()
+	if err != nil {
+		return err
+	}
+
+	ak, err := attest.ParseAKPublic(attest.TPMVersion20, akPublic)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errHCLReportAKMismatch, err)
+	}
+
+	actual, ok := ak.Public.(*rsa.PublicKey)
+	if !ok || !expected.Equal(actual) {
+		return errHCLReportAKMismatch
+	}
+
+	return nil
+}
+
+func clone(b []byte) []byte {
+	res := make([]byte, len(b))
+	copy(res, b)
+	return res
+}
@@ -0,0 +1,185 @@
+package azurecvm_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/flashbots/vault-auth-plugin-attest/azurecvm"
+	"github.com/flashbots/vault-auth-plugin-attest/sevsnp"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/stretchr/testify/assert"
+
+	snptestdata "github.com/google/go-sev-guest/verify/testdata"
+	tpm "github.com/google/go-tpm/legacy/tpm2"
+)
+
+const offsetSNPReportData = 0x50
+
+func runtimeClaims(t *testing.T, ak *rsa.PublicKey) []byte {
+	e := make([]byte, 4)
+	binary.BigEndian.PutUint32(e, uint32(ak.E))
+
+	claims, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]interface{}{
+			{
+				"kid":     "HCLAkPub",
+				"key_ops": []string{"sign"},
+				"kty":     "RSA",
+				"e":       base64.RawURLEncoding.EncodeToString(e[1:]),
+				"n":       base64.RawURLEncoding.EncodeToString(ak.N.Bytes()),
+			},
+		},
+		"vm-configuration": map[string]interface{}{
+			"secure-boot": true,
+			"tpm-enabled": true,
+		},
+		"user-data": "",
+	})
+	assert.NoError(t, err)
+
+	return claims
+}
+
+// newHCLReport wraps the recorded sev-snp report (see go-sev-guest testdata)
+// into hcl report the same way azure paravisor does.
+func newHCLReport(claims []byte) []byte {
+	hwReport := make([]byte, 1184)
+	copy(hwReport, snptestdata.AttestationBytes)
+	digest := sha256.Sum256(claims)
+	copy(hwReport[offsetSNPReportData:], digest[:])
+
+	header := make([]byte, 32)
+	copy(header, "HCLA")
+	binary.LittleEndian.PutUint32(header[4:], 2) // version
+	binary.LittleEndian.PutUint32(header[8:], 1184+20+uint32(len(claims)))
+
+	request := make([]byte, 20)
+	binary.LittleEndian.PutUint32(request[0:], 20+uint32(len(claims))) // data size
+	binary.LittleEndian.PutUint32(request[4:], 1)                      // version
+	binary.LittleEndian.PutUint32(request[8:], azurecvm.ReportTypeSEVSNP)
+	binary.LittleEndian.PutUint32(request[12:], 1) // sha256
+	binary.LittleEndian.PutUint32(request[16:], uint32(len(claims)))
+
+	res := append(header, hwReport...)
+	res = append(res, request...)
+	res = append(res, claims...)
+	return append(res, make([]byte, 64)...) // nv index is padded with zeroes
+}
+
+func tpmAKPublic(t *testing.T, ak *rsa.PublicKey) []byte {
+	public, err := tpm.Public{
+		Type:       tpm.AlgRSA,
+		NameAlg:    tpm.AlgSHA256,
+		Attributes: tpm.FlagSignerDefault,
+		RSAParameters: &tpm.RSAParams{
+			Sign: &tpm.SigScheme{
+				Alg:  tpm.AlgRSASSA,
+				Hash: tpm.AlgSHA256,
+			},
+			KeyBits:    2048,
+			ModulusRaw: ak.N.Bytes(),
+		},
+	}.Encode()
+	assert.NoError(t, err)
+	return public
+}
+
+func TestParseHCLReport(t *testing.T) {
+	ak, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	claims := runtimeClaims(t, &ak.PublicKey)
+
+	{ // valid
+		hcl, err := azurecvm.ParseHCLReport(newHCLReport(claims))
+		assert.NoError(t, err)
+		assert.Equal(t, uint32(azurecvm.ReportTypeSEVSNP), hcl.ReportType)
+		assert.Equal(t, claims, hcl.RuntimeData)
+
+		akPublic, err := hcl.AKPublic()
+		assert.NoError(t, err)
+		assert.True(t, ak.PublicKey.Equal(akPublic))
+
+		report, err := azurecvm.ParseHardwareReport(hcl, nil)
+		assert.NoError(t, err)
+		assert.NotNil(t, report.SEVSNP)
+		assert.Nil(t, report.TDX)
+	}
+
+	{ // invalid signature
+		raw := newHCLReport(claims)
+		raw[0] = 'X'
+		_, err := azurecvm.ParseHCLReport(raw)
+		assert.Error(t, err)
+	}
+
+	{ // truncated
+		raw := newHCLReport(claims)
+		_, err := azurecvm.ParseHCLReport(raw[:1000])
+		assert.Error(t, err)
+	}
+
+	{ // runtime claims are not bound to the hardware report
+		raw := newHCLReport(claims)
+		raw[len(raw)-64-2] ^= 0xff
+		hcl, err := azurecvm.ParseHCLReport(raw)
+		assert.NoError(t, err)
+		_, err = azurecvm.ParseHardwareReport(hcl, nil)
+		assert.Error(t, err)
+	}
+}
+
+func TestMatchesAKPublic(t *testing.T) {
+	ak, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	hcl, err := azurecvm.ParseHCLReport(newHCLReport(runtimeClaims(t, &ak.PublicKey)))
+	assert.NoError(t, err)
+
+	assert.NoError(t, hcl.MatchesAKPublic(tpmAKPublic(t, &ak.PublicKey)))
+	assert.Error(t, hcl.MatchesAKPublic(tpmAKPublic(t, &other.PublicKey)))
+	assert.Error(t, hcl.MatchesAKPublic([]byte("garbage")))
+}
+
+func TestMatches(t *testing.T) {
+	ak, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.NoError(t, err)
+
+	hcl, err := azurecvm.ParseHCLReport(newHCLReport(runtimeClaims(t, &ak.PublicKey)))
+	assert.NoError(t, err)
+	report, err := azurecvm.ParseHardwareReport(hcl, nil)
+	assert.NoError(t, err)
+
+	{ // no sevsnp policy
+		td := &azurecvm.AzureCVM{TPM2: &tpm2.TPM2{}}
+		reported, _ := td.Matches(report, nil)
+		assert.Len(t, reported, 1)
+	}
+
+	{ // measurement mismatch
+		td := &azurecvm.AzureCVM{
+			SEVSNP: &sevsnp.SEVSNP{Measurement: &types.Byte48{}},
+			TPM2:   &tpm2.TPM2{},
+		}
+		reported, _ := td.Matches(report, nil)
+		assert.Error(t, reported[0])
+		assert.NotEmpty(t, failures(reported))
+	}
+}
+
+func failures(errs []error) []error {
+	res := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+	return res
+}
@@ -0,0 +1,253 @@
+package azurecvm
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/flashbots/vault-auth-plugin-attest/sevsnp"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/google/go-attestation/attest"
+	"github.com/google/go-tpm/tpmutil"
+
+	tpm "github.com/google/go-tpm/legacy/tpm2"
+)
+
+const (
+	// HCLReportNVIndex is the index of vTPM NV space where Azure paravisor
+	// stores HCL report.
+	HCLReportNVIndex = tpmutil.Handle(0x01400001)
+
+	// AKHandle is the persistent handle of vTPM attestation key that is
+	// provisioned by Azure paravisor.
+	AKHandle = tpmutil.Handle(0x81000003)
+
+	// IMDSTDQuoteURL is the endpoint of Azure IMDS that converts TDX TDREPORT
+	// into a quote.
+	IMDSTDQuoteURL = "http://169.254.169.254/acc/tdquote"
+
+	eventLogPath = "/sys/kernel/security/tpm0/binary_bios_measurements"
+
+	numPCRs = 24
+)
+
+var (
+	errIMDSEmptyQuote = errors.New("azure imds returned empty tdx quote")
+)
+
+// ReadHCLReport reads the raw HCL report from vTPM NV.
+func ReadHCLReport() ([]byte, error) {
+	rwc, err := tpm.OpenTPM()
+	if err != nil {
+		return nil, err
+	}
+	defer rwc.Close()
+
+	return tpm.NVReadEx(rwc, HCLReportNVIndex, tpm.HandleOwner, "", 0)
+}
+
+// AttestPlatform generates TPM 2.0 attestation (SHA256 PCRs quoted with the
+// attestation key of vTPM over the nonce) in the format that is understood
+// by go-attestation.
+func AttestPlatform(nonce []byte) (*attest.PlatformParameters, error) {
+	rwc, err := tpm.OpenTPM()
+	if err != nil {
+		return nil, err
+	}
+	defer rwc.Close()
+
+	akPublic, _, _, err := tpm.ReadPublic(rwc, AKHandle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attestation key: %w", err)
+	}
+	public, err := akPublic.Encode()
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode attestation key: %w", err)
+	}
+
+	pcrs, err := readPCRs(rwc)
+	if err != nil {
+		return nil, err
+	}
+
+	sel := tpm.PCRSelection{Hash: tpm.AlgSHA256}
+	for idx := 0; idx < numPCRs; idx++ {
+		sel.PCRs = append(sel.PCRs, idx)
+	}
+	quote, sig, err := tpm.Quote(rwc, AKHandle, "", "", nonce, sel, tpm.AlgNull)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate tpm2 quote: %w", err)
+	}
+	if sig.RSA == nil {
+		return nil, fmt.Errorf("unexpected tpm2 quote signature algorithm: %s", sig.Alg)
+	}
+	rawSig, err := tpmutil.Pack(sig.Alg, sig.RSA.HashAlg, sig.RSA.Signature)
+	if err != nil {
+		return nil, err
+	}
+
+	eventLog, err := os.ReadFile(eventLogPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event log: %w", err)
+	}
+
+	return &attest.PlatformParameters{
+		TPMVersion: attest.TPMVersion20,
+		Public:     public,
+		Quotes: []attest.Quote{{
+			Version:   attest.TPMVersion20,
+			Quote:     quote,
+			Signature: rawSig,
+		}},
+		PCRs:     pcrs,
+		EventLog: eventLog,
+	}, nil
+}
+
+// GetTDXQuote converts TDX TDREPORT into a quote with the help of Azure IMDS.
+func GetTDXQuote(ctx context.Context, tdReport []byte) ([]byte, error) {
+	body, err := json.Marshal(map[string]string{
+		"report": base64.RawURLEncoding.EncodeToString(tdReport),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, IMDSTDQuoteURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	raw, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected response from azure imds: %d: %s",
+			res.StatusCode, string(raw),
+		)
+	}
+
+	quote := struct {
+		Quote string `json:"quote"`
+	}{}
+	if err := json.Unmarshal(raw, &quote); err != nil {
+		return nil, err
+	}
+	if quote.Quote == "" {
+		return nil, errIMDSEmptyQuote
+	}
+
+	return base64.RawURLEncoding.DecodeString(quote.Quote)
+}
+
+// FromPlatform creates new AzureCVM instance from the parameters of the
+// platform we are currently running on.
+func FromPlatform(ctx context.Context) (*AzureCVM, error) {
+	raw, err := ReadHCLReport()
+	if err != nil {
+		return nil, err
+	}
+
+	hcl, err := ParseHCLReport(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	var quote []byte
+	if hcl.ReportType == ReportTypeTDX {
+		quote, err = GetTDXQuote(ctx, hcl.HardwareReport)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	report, err := ParseHardwareReport(hcl, quote)
+	if err != nil {
+		return nil, err
+	}
+
+	rwc, err := tpm.OpenTPM()
+	if err != nil {
+		return nil, err
+	}
+	defer rwc.Close()
+
+	pcrs, err := readPCRs(rwc)
+	if err != nil {
+		return nil, err
+	}
+
+	td := &AzureCVM{
+		TPM2: &tpm2.TPM2{},
+	}
+	for _, pcr := range pcrs {
+		td.TPM2.PCRs[pcr.Index] = (*types.Byte32)(pcr.Digest)
+	}
+
+	switch {
+	case report.SEVSNP != nil:
+		td.SEVSNP, err = sevsnp.FromReport(report.SEVSNP.Report)
+	case report.TDX != nil:
+		td.TDX, err = tdx.FromQuote(report.TDX)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return td, nil
+}
+
+// readPCRs reads all SHA256 PCRs (TPM may return less PCRs than requested, so
+// the reads are repeated until we get all of them).
+func readPCRs(rwc io.ReadWriter) ([]attest.PCR, error) {
+	values := make(map[int][]byte, numPCRs)
+
+	for attempt := 0; attempt < numPCRs && len(values) < numPCRs; attempt++ {
+		sel := tpm.PCRSelection{Hash: tpm.AlgSHA256}
+		for idx := 0; idx < numPCRs; idx++ {
+			if _, ok := values[idx]; !ok {
+				sel.PCRs = append(sel.PCRs, idx)
+			}
+		}
+
+		res, err := tpm.ReadPCRs(rwc, sel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read pcrs: %w", err)
+		}
+		for idx, digest := range res {
+			values[idx] = digest
+		}
+	}
+
+	if len(values) != numPCRs {
+		return nil, fmt.Errorf("failed to read pcrs: only read %d", len(values))
+	}
+
+	pcrs := make([]attest.PCR, 0, numPCRs)
+	for idx := 0; idx < numPCRs; idx++ {
+		pcrs = append(pcrs, attest.PCR{
+			Index:     idx,
+			Digest:    values[idx],
+			DigestAlg: crypto.SHA256,
+		})
+	}
+
+	return pcrs, nil
+}
@@ -0,0 +1,237 @@
+package cca
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
+
+	tsm "github.com/google/go-configfs-tsm/configfs/linuxtsm"
+	tsmreport "github.com/google/go-configfs-tsm/report"
+)
+
+// CCA reflects our expectations about Arm CCA realm.
+//
+// For the reference see Arm CCA Realm Management Monitor specification (rev
+// 1.0-rel0, 2023/07).
+//
+// See also:
+//
+//   - https://developer.arm.com/documentation/den0137/latest
+//   - https://datatracker.ietf.org/doc/draft-ffm-rats-cca-token/
+type CCA struct {
+	tokenutil.TokenParams `mapstructure:"-" structs:"-"`
+
+	// Name is the name of trusted domain.
+	Name string `json:"-" mapstructure:"-" structs:"-"`
+
+	// TOTPSecret is the secret used to generate initial TOTP codes.
+	TOTPSecret string `json:"totp_secret" mapstructure:"totp_secret" structs:"totp_secret"`
+
+	// RIM is the expected realm initial measurement.
+	RIM types.Bytes `json:"cca_rim,omitempty" mapstructure:"cca_rim,omitempty" structs:"cca_rim,omitempty"`
+
+	// REM0 is the expected realm extensible measurement #0.
+	REM0 types.Bytes `json:"cca_rem0,omitempty" mapstructure:"cca_rem0,omitempty" structs:"cca_rem0,omitempty"`
+
+	// REM1 is the expected realm extensible measurement #1.
+	REM1 types.Bytes `json:"cca_rem1,omitempty" mapstructure:"cca_rem1,omitempty" structs:"cca_rem1,omitempty"`
+
+	// REM2 is the expected realm extensible measurement #2.
+	REM2 types.Bytes `json:"cca_rem2,omitempty" mapstructure:"cca_rem2,omitempty" structs:"cca_rem2,omitempty"`
+
+	// REM3 is the expected realm extensible measurement #3.
+	REM3 types.Bytes `json:"cca_rem3,omitempty" mapstructure:"cca_rem3,omitempty" structs:"cca_rem3,omitempty"`
+
+	// PersonalizationValue is the expected realm personalization value (RPV),
+	// provided by the host at realm creation.
+	PersonalizationValue types.Bytes `json:"cca_personalization_value,omitempty" mapstructure:"cca_personalization_value,omitempty" structs:"cca_personalization_value,omitempty"`
+
+	// PlatformImplementationID is the expected implementation id of the CCA
+	// platform.
+	PlatformImplementationID *types.Byte32 `json:"cca_platform_implementation_id,omitempty" mapstructure:"cca_platform_implementation_id,omitempty" structs:"cca_platform_implementation_id,omitempty"`
+
+	// CPAKs is the PEM-encoded bundle of CCA platform attestation keys (or of
+	// the certificates endorsing them) that are trusted to sign the platform
+	// token.
+	CPAKs string `json:"cca_cpaks,omitempty" mapstructure:"cca_cpaks,omitempty" structs:"cca_cpaks,omitempty"`
+}
+
+var (
+	errCCATokenIsNil               = errors.New("cca token is nil")
+	errCCATokenMismatchRIM         = errors.New("cca rim mismatch")
+	errCCATokenMismatchREM0        = errors.New("cca rem[0] mismatch")
+	errCCATokenMismatchREM1        = errors.New("cca rem[1] mismatch")
+	errCCATokenMismatchREM2        = errors.New("cca rem[2] mismatch")
+	errCCATokenMismatchREM3        = errors.New("cca rem[3] mismatch")
+	errCCATokenMismatchRPV         = errors.New("cca personalization value mismatch")
+	errCCATokenMismatchImplementID = errors.New("cca platform implementation id mismatch")
+	errCCATokenUnexpectedREMs      = errors.New("cca token has unexpected count of rems")
+	errCCANoCPAKs                  = errors.New("no cca cpaks are configured")
+)
+
+// GetToken generates CCA attestation token with provided challenge.
+//
+// It relies on configfs-tsm interface of the linux kernel.
+func GetToken(challenge [globals.CCANonceSize]byte) ([]byte, error) {
+	res, err := tsm.GetReport(&tsmreport.Request{
+		InBlob: challenge[:],
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.OutBlob, nil
+}
+
+// FromPlatform creates new CCA instance from the parameters of the realm we
+// are currently running in.
+func FromPlatform() (*CCA, error) {
+	raw, err := GetToken([globals.CCANonceSize]byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := ParseToken(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(token.Realm.ExtensibleMeasurements) != 4 {
+		return nil, errCCATokenUnexpectedREMs
+	}
+
+	res := &CCA{
+		RIM:                  token.Realm.InitialMeasurement,
+		REM0:                 token.Realm.ExtensibleMeasurements[0],
+		REM1:                 token.Realm.ExtensibleMeasurements[1],
+		REM2:                 token.Realm.ExtensibleMeasurements[2],
+		REM3:                 token.Realm.ExtensibleMeasurements[3],
+		PersonalizationValue: token.Realm.PersonalizationValue,
+	}
+	if len(token.Platform.ImplementationID) == 32 {
+		res.PlatformImplementationID = (*types.Byte32)(token.Platform.ImplementationID)
+	}
+
+	return res, nil
+}
+
+// Verify verifies the genuineness of the token against configured CPAKs.
+func (td *CCA) Verify(token *Token) error {
+	cpaks, err := ParseCPAKs(td.CPAKs)
+	if err != nil {
+		return err
+	}
+	if len(cpaks) == 0 {
+		return errCCANoCPAKs
+	}
+
+	return token.Verify(cpaks)
+}
+
+func (td *CCA) MatchesToken(token *Token) (
+	[]error, []error,
+) {
+	type test struct {
+		expect []byte
+		actual []byte
+		err    error
+	}
+
+	{ // pre-flight checks
+		if token == nil {
+			return []error{
+				errCCATokenIsNil,
+			}, nil
+		}
+		if len(token.Realm.ExtensibleMeasurements) != 4 {
+			return []error{
+				errCCATokenUnexpectedREMs,
+			}, nil
+		}
+	}
+
+	tests := []test{
+		{ // rim
+			expect: td.RIM,
+			actual: token.Realm.InitialMeasurement,
+			err:    errCCATokenMismatchRIM,
+		},
+		{ // rem[0]
+			expect: td.REM0,
+			actual: token.Realm.ExtensibleMeasurements[0],
+			err:    errCCATokenMismatchREM0,
+		},
+		{ // rem[1]
+			expect: td.REM1,
+			actual: token.Realm.ExtensibleMeasurements[1],
+			err:    errCCATokenMismatchREM1,
+		},
+		{ // rem[2]
+			expect: td.REM2,
+			actual: token.Realm.ExtensibleMeasurements[2],
+			err:    errCCATokenMismatchREM2,
+		},
+		{ // rem[3]
+			expect: td.REM3,
+			actual: token.Realm.ExtensibleMeasurements[3],
+			err:    errCCATokenMismatchREM3,
+		},
+		{ // rpv
+			expect: td.PersonalizationValue,
+			actual: token.Realm.PersonalizationValue,
+			err:    errCCATokenMismatchRPV,
+		},
+		{ // implementation id
+			actual: token.Platform.ImplementationID,
+			err:    errCCATokenMismatchImplementID,
+		},
+	}
+	if td.PlatformImplementationID != nil {
+		tests[6].expect = td.PlatformImplementationID[:]
+	}
+
+	errs := make([]error, 0, len(tests))
+	dump := make([]error, 0, len(tests))
+
+	for _, t := range tests {
+		// make sure the time is constant regardless of the config
+		if t.expect != nil {
+			if subtle.ConstantTimeCompare(t.expect, t.actual) != 1 {
+				errs = append(errs, t.err)
+			} else {
+				errs = append(errs, nil)
+			}
+		} else {
+			dummy := make([]byte, len(t.actual))
+			if subtle.ConstantTimeCompare(dummy, t.actual) != 1 {
+				dump = append(dump, t.err)
+			} else {
+				dump = append(dump, nil)
+			}
+		}
+	}
+
+	return errs, dump
+}
+
+func (td *CCA) GetName() string {
+	return td.Name
+}
+
+func (td *CCA) SetName(name string) {
+	td.Name = name
+}
+
+func (td *CCA) AttestationType() string {
+	return "cca"
+}
+
+func (td *CCA) GetTOTPSecret() string {
+	return td.TOTPSecret
+}
+
+func (td *CCA) SetTOTPSecret(totpSecret string) {
+	td.TOTPSecret = totpSecret
+}
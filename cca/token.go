@@ -0,0 +1,237 @@
+package cca
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// Token is the parsed Arm CCA attestation token, i.e. the collection of the
+// platform token and of the realm token.
+//
+// For the reference see Arm CCA Realm Management Monitor specification (rev
+// 1.0-rel0, 2023/07), section A7.2 "Realm attestation token".
+type Token struct {
+	Platform PlatformClaims
+	Realm    RealmClaims
+
+	platform *cose.Sign1Message
+	realm    *cose.Sign1Message
+}
+
+// PlatformClaims are the claims of CCA platform token (signed by CPAK).
+type PlatformClaims struct {
+	Profile          string `cbor:"265,keyasint,omitempty"`
+	Challenge        []byte `cbor:"10,keyasint"`
+	InstanceID       []byte `cbor:"256,keyasint"`
+	LifeCycle        uint16 `cbor:"2395,keyasint"`
+	ImplementationID []byte `cbor:"2396,keyasint"`
+	Config           []byte `cbor:"2401,keyasint"`
+	HashAlgorithm    string `cbor:"2402,keyasint"`
+}
+
+// RealmClaims are the claims of CCA realm token (signed by RAK).
+type RealmClaims struct {
+	Profile                string   `cbor:"265,keyasint,omitempty"`
+	Challenge              []byte   `cbor:"10,keyasint"`
+	PersonalizationValue   []byte   `cbor:"44235,keyasint"`
+	HashAlgorithm          string   `cbor:"44236,keyasint"`
+	PublicKey              []byte   `cbor:"44237,keyasint"`
+	InitialMeasurement     []byte   `cbor:"44238,keyasint"`
+	ExtensibleMeasurements [][]byte `cbor:"44239,keyasint"`
+	PublicKeyHashAlgorithm string   `cbor:"44240,keyasint"`
+}
+
+type collection struct {
+	Platform []byte `cbor:"44234,keyasint"`
+	Realm    []byte `cbor:"44241,keyasint"`
+}
+
+const (
+	tagCollection = 399
+
+	sizeRealmPublicKeyRaw = 97 // 0x04 || X || Y on P-384
+)
+
+var (
+	errTokenInvalidCollection   = errors.New("invalid cca token collection")
+	errTokenInvalidPlatform     = errors.New("invalid cca platform token")
+	errTokenInvalidRealm        = errors.New("invalid cca realm token")
+	errTokenInvalidRAK          = errors.New("invalid cca realm attestation key")
+	errTokenUnknownHashAlg      = errors.New("unknown cca hash algorithm")
+	errTokenRAKNotBound         = errors.New("cca platform token does not bind realm attestation key")
+	errTokenUntrustedPlatform   = errors.New("cca platform token is not signed by any of trusted cpaks")
+	errCPAKsInvalid             = errors.New("invalid cca cpak bundle")
+	errCPAKsUnexpectedBlockType = errors.New("unexpected pem block type in cca cpak bundle")
+)
+
+// ParseToken parses CBOR-encoded CCA attestation token (tagged or untagged
+// collection of platform and realm tokens).
+func ParseToken(raw []byte) (*Token, error) {
+	var tagged cbor.RawTag
+	if err := cbor.Unmarshal(raw, &tagged); err == nil {
+		if tagged.Number != tagCollection {
+			return nil, fmt.Errorf("%w: unexpected tag %d != %d",
+				errTokenInvalidCollection, tagged.Number, tagCollection,
+			)
+		}
+		raw = tagged.Content
+	}
+
+	c := collection{}
+	if err := cbor.Unmarshal(raw, &c); err != nil {
+		return nil, fmt.Errorf("%w: %w", errTokenInvalidCollection, err)
+	}
+
+	t := &Token{
+		platform: cose.NewSign1Message(),
+		realm:    cose.NewSign1Message(),
+	}
+
+	if err := t.platform.UnmarshalCBOR(c.Platform); err != nil {
+		return nil, fmt.Errorf("%w: %w", errTokenInvalidPlatform, err)
+	}
+	if err := cbor.Unmarshal(t.platform.Payload, &t.Platform); err != nil {
+		return nil, fmt.Errorf("%w: %w", errTokenInvalidPlatform, err)
+	}
+
+	if err := t.realm.UnmarshalCBOR(c.Realm); err != nil {
+		return nil, fmt.Errorf("%w: %w", errTokenInvalidRealm, err)
+	}
+	if err := cbor.Unmarshal(t.realm.Payload, &t.Realm); err != nil {
+		return nil, fmt.Errorf("%w: %w", errTokenInvalidRealm, err)
+	}
+
+	return t, nil
+}
+
+// Verify verifies the genuineness of the token, i.e.:
+//
+//   - realm token is signed by RAK;
+//   - platform token binds RAK (via its challenge);
+//   - platform token is signed by one of the trusted CPAKs.
+func (t *Token) Verify(cpaks []crypto.PublicKey) error {
+	{ // realm token
+		rak, err := t.realmPublicKey()
+		if err != nil {
+			return fmt.Errorf("%w: %w", errTokenInvalidRAK, err)
+		}
+		if err := verifySign1(t.realm, rak); err != nil {
+			return fmt.Errorf("%w: %w", errTokenInvalidRealm, err)
+		}
+	}
+
+	{ // rak binding
+		h, err := hashFor(t.Realm.PublicKeyHashAlgorithm)
+		if err != nil {
+			return err
+		}
+		h.Write(t.Realm.PublicKey)
+		if !bytes.Equal(h.Sum(nil), t.Platform.Challenge) {
+			return errTokenRAKNotBound
+		}
+	}
+
+	{ // platform token
+		for _, cpak := range cpaks {
+			if err := verifySign1(t.platform, cpak); err == nil {
+				return nil
+			}
+		}
+		return errTokenUntrustedPlatform
+	}
+}
+
+// ParseCPAKs parses the bundle of PEM-encoded CPAKs (either as public keys,
+// or as certificates endorsing them).
+func ParseCPAKs(bundle string) ([]crypto.PublicKey, error) {
+	res := make([]crypto.PublicKey, 0)
+
+	for rest := []byte(bundle); len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		switch block.Type {
+		case "PUBLIC KEY":
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", errCPAKsInvalid, err)
+			}
+			res = append(res, key)
+		case "CERTIFICATE":
+			cert, err := x509.ParseCertificate(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", errCPAKsInvalid, err)
+			}
+			res = append(res, cert.PublicKey)
+		default:
+			return nil, fmt.Errorf("%w: %s",
+				errCPAKsUnexpectedBlockType, block.Type,
+			)
+		}
+	}
+
+	return res, nil
+}
+
+// realmPublicKey decodes RAK that is either raw uncompressed point on P-384
+// curve, or COSE_Key.
+func (t *Token) realmPublicKey() (crypto.PublicKey, error) {
+	raw := t.Realm.PublicKey
+
+	if len(raw) == sizeRealmPublicKeyRaw && raw[0] == 0x04 {
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P384(),
+			X:     new(big.Int).SetBytes(raw[1:49]),
+			Y:     new(big.Int).SetBytes(raw[49:]),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("point is not on p-384 curve")
+		}
+		return key, nil
+	}
+
+	key := &cose.Key{}
+	if err := key.UnmarshalCBOR(raw); err != nil {
+		return nil, err
+	}
+	return key.PublicKey()
+}
+
+func verifySign1(msg *cose.Sign1Message, key crypto.PublicKey) error {
+	alg, err := msg.Headers.Protected.Algorithm()
+	if err != nil {
+		return err
+	}
+	verifier, err := cose.NewVerifier(alg, key)
+	if err != nil {
+		return err
+	}
+	return msg.Verify(nil, verifier)
+}
+
+func hashFor(alg string) (hash.Hash, error) {
+	switch alg {
+	case "sha-256":
+		return sha256.New(), nil
+	case "sha-384":
+		return sha512.New384(), nil
+	case "sha-512":
+		return sha512.New(), nil
+	}
+	return nil, fmt.Errorf("%w: %s", errTokenUnknownHashAlg, alg)
+}
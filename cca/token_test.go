@@ -0,0 +1,176 @@
+package cca_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+
+	"github.com/flashbots/vault-auth-plugin-attest/cca"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/veraison/go-cose"
+)
+
+type platform struct {
+	cpak  *ecdsa.PrivateKey
+	cpaks string
+}
+
+func newPlatform(t *testing.T) *platform {
+	cpak, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&cpak.PublicKey)
+	assert.NoError(t, err)
+	return &platform{
+		cpak:  cpak,
+		cpaks: string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})),
+	}
+}
+
+func sign1(t *testing.T, key *ecdsa.PrivateKey, claims interface{}) []byte {
+	payload, err := cbor.Marshal(claims)
+	assert.NoError(t, err)
+	signer, err := cose.NewSigner(cose.AlgorithmES384, key)
+	assert.NoError(t, err)
+	res, err := cose.Sign1(rand.Reader, signer, cose.Headers{
+		Protected: cose.ProtectedHeader{cose.HeaderLabelAlgorithm: cose.AlgorithmES384},
+	}, payload, nil)
+	assert.NoError(t, err)
+	return res
+}
+
+// newToken assembles cca attestation token as rmm would (with raw rak).
+func newToken(t *testing.T, p *platform, realm cca.RealmClaims, bindRAK bool) []byte {
+	rak, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	assert.NoError(t, err)
+
+	rakPublic, err := rak.PublicKey.ECDH()
+	assert.NoError(t, err)
+
+	realm.PublicKey = rakPublic.Bytes() // 0x04 || X || Y
+	realm.PublicKeyHashAlgorithm = "sha-256"
+	realm.HashAlgorithm = "sha-256"
+
+	rakHash := sha256.Sum256(realm.PublicKey)
+	if !bindRAK {
+		rakHash[0] ^= 0xff
+	}
+
+	platformClaims := cca.PlatformClaims{
+		Challenge:        rakHash[:],
+		InstanceID:       make([]byte, 33),
+		ImplementationID: make([]byte, 32),
+		LifeCycle:        0x3000,
+		HashAlgorithm:    "sha-256",
+	}
+	platformClaims.ImplementationID[0] = 0x42
+
+	res, err := cbor.Marshal(cbor.Tag{
+		Number: 399,
+		Content: map[int][]byte{
+			44234: sign1(t, p.cpak, platformClaims),
+			44241: sign1(t, rak, realm),
+		},
+	})
+	assert.NoError(t, err)
+	return res
+}
+
+func newRealmClaims(rim byte) cca.RealmClaims {
+	res := cca.RealmClaims{
+		Challenge:              make([]byte, 64),
+		PersonalizationValue:   make([]byte, 64),
+		InitialMeasurement:     make([]byte, 32),
+		ExtensibleMeasurements: [][]byte{make([]byte, 32), make([]byte, 32), make([]byte, 32), make([]byte, 32)},
+	}
+	res.InitialMeasurement[0] = rim
+	return res
+}
+
+func TestVerify(t *testing.T) {
+	p := newPlatform(t)
+
+	{ // genuine token
+		token, err := cca.ParseToken(newToken(t, p, newRealmClaims(0x11), true))
+		assert.NoError(t, err)
+		td := &cca.CCA{CPAKs: p.cpaks}
+		assert.NoError(t, td.Verify(token))
+	}
+
+	{ // untrusted platform
+		token, err := cca.ParseToken(newToken(t, newPlatform(t), newRealmClaims(0x11), true))
+		assert.NoError(t, err)
+		td := &cca.CCA{CPAKs: p.cpaks}
+		assert.Error(t, td.Verify(token))
+	}
+
+	{ // multiple cpaks
+		token, err := cca.ParseToken(newToken(t, p, newRealmClaims(0x11), true))
+		assert.NoError(t, err)
+		td := &cca.CCA{CPAKs: newPlatform(t).cpaks + p.cpaks}
+		assert.NoError(t, td.Verify(token))
+	}
+
+	{ // no cpaks
+		token, err := cca.ParseToken(newToken(t, p, newRealmClaims(0x11), true))
+		assert.NoError(t, err)
+		td := &cca.CCA{}
+		assert.Error(t, td.Verify(token))
+	}
+
+	{ // rak is not bound
+		token, err := cca.ParseToken(newToken(t, p, newRealmClaims(0x11), false))
+		assert.NoError(t, err)
+		td := &cca.CCA{CPAKs: p.cpaks}
+		assert.Error(t, td.Verify(token))
+	}
+
+	{ // garbage
+		_, err := cca.ParseToken([]byte{0xde, 0xad, 0xbe, 0xef})
+		assert.Error(t, err)
+	}
+}
+
+func TestMatchesToken(t *testing.T) {
+	p := newPlatform(t)
+	token, err := cca.ParseToken(newToken(t, p, newRealmClaims(0x11), true))
+	assert.NoError(t, err)
+
+	implementationID := types.Byte32{0x42}
+
+	{ // matching realm
+		td := &cca.CCA{
+			RIM:                      token.Realm.InitialMeasurement,
+			REM0:                     make([]byte, 32),
+			PersonalizationValue:     make([]byte, 64),
+			PlatformImplementationID: &implementationID,
+		}
+		reported, _ := td.MatchesToken(token)
+		assert.Empty(t, failures(reported))
+	}
+
+	{ // mismatching realm
+		td := &cca.CCA{
+			RIM:                      make([]byte, 32),
+			REM3:                     []byte{0x01},
+			PlatformImplementationID: &types.Byte32{},
+		}
+		reported, _ := td.MatchesToken(token)
+		assert.Len(t, failures(reported), 3)
+	}
+}
+
+func failures(errs []error) []error {
+	res := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+	return res
+}
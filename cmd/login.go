@@ -63,6 +63,29 @@ func CommandLogin(cfg *config.Config) *cli.Command {
 			Value:       ".totp-secret",
 		},
 
+		&cli.StringFlag{ // --td-instance-key
+			Category:    strings.ToUpper(categoryTD),
+			Destination: &cfg.TD.InstanceKey,
+			Name:        categoryTD + "-instance-key",
+			Usage:       "`path` to the instance key to login with instead of totp (the key is generated and enrolled if the file does not exist yet)",
+		},
+
+		&cli.BoolFlag{ // --td-tls-binding
+			Category:    strings.ToUpper(categoryTD),
+			Destination: &cfg.TD.TLSBinding,
+			Name:        categoryTD + "-tls-binding",
+			Usage:       "bind the attestation quote to the public key of the tls client certificate (see --client-cert)",
+			Value:       false,
+		},
+
+		&cli.BoolFlag{ // --td-ratls
+			Category:    strings.ToUpper(categoryTD),
+			Destination: &cfg.TD.RATLS,
+			Name:        categoryTD + "-ratls",
+			Usage:       "login with ra-tls client certificate (see --client-cert and `ratls` command)",
+			Value:       false,
+		},
+
 		&cli.StringFlag{ // --td-tpm2-ak-private-blob
 			Category:    strings.ToUpper(categoryTD),
 			Destination: &cfg.TD.TPM2AKPrivateBlob,
@@ -26,6 +26,7 @@ const (
 func main() {
 	cfg := &config.Config{
 		HTTP:    &config.HTTP{},
+		RATLS:   &config.RATLS{},
 		TD:      &config.TD{},
 		Vault:   &config.Vault{},
 		Version: version,
@@ -91,6 +92,7 @@ func main() {
 		CommandPlugin(cfg),
 		CommandLogin(cfg),
 		CommandQuote(cfg),
+		CommandRATLS(cfg),
 		CommandHelp(),
 	}
 
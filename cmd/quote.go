@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"slices"
 	"strings"
 
+	"github.com/flashbots/vault-auth-plugin-attest/azurecvm"
+	"github.com/flashbots/vault-auth-plugin-attest/cca"
 	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
 	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"github.com/flashbots/vault-auth-plugin-attest/nitro"
+	"github.com/flashbots/vault-auth-plugin-attest/sevsnp"
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
 	"github.com/flashbots/vault-auth-plugin-attest/tdx"
 	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
 	"github.com/urfave/cli/v2"
@@ -64,51 +71,184 @@ func CommandQuote(cfg *config.Config) *cli.Command {
 				return fmt.Errorf("unknown attestation type: %s", cfg.TD.AttestationType)
 
 			case "tdx":
-				td, err := tdx.FromPlatform()
+				quote, err := tdx.GetQuote([globals.TDXNonceSize]byte{})
+				if err != nil {
+					return err
+				}
+				td, err := tdx.FromQuote(quote)
+				if err != nil {
+					return err
+				}
+				printTDX(quote, td)
+
+			case "tpm2":
+				td, err := tpm2.FromPlatform()
+				if err != nil {
+					return err
+				}
+				printTPM2(td)
+
+			case "tdxtpm2":
+				quote, err := tdx.GetQuote([globals.TDXNonceSize]byte{})
+				if err != nil {
+					return err
+				}
+				tdTDX, err := tdx.FromQuote(quote)
+				if err != nil {
+					return err
+				}
+				tdTPM2, err := tpm2.FromPlatform()
+				if err != nil {
+					return err
+				}
+				printTDX(quote, tdTDX)
+				printTPM2(tdTPM2)
+				fmt.Printf("\n")
+
+			case "sevsnp":
+				td, err := sevsnp.FromPlatform()
+				if err != nil {
+					return err
+				}
+				printSEVSNP(td)
+
+			case "sgx":
+				td, err := sgx.FromPlatform()
 				if err != nil {
 					return err
 				}
 				fmt.Printf("\n")
 				fmt.Printf("Field                 Value\n")
 				fmt.Printf("--------------------  ----------------------------------------------------------------\n")
-				fmt.Printf("MROWNER:              %s\n", td.MrOwner)
-				fmt.Printf("MROWNERCONFIG:        %s\n", td.MrOwnerConfig)
-				fmt.Printf("MRCONFIGID:           %s\n", td.MrConfigID)
-				fmt.Printf("MRTD:                 %s\n", td.MrTD)
-				fmt.Printf("RTMR[0]:              %s\n", td.RTMR0)
-				fmt.Printf("RTMR[1]:              %s\n", td.RTMR1)
-				fmt.Printf("RTMR[2]:              %s\n", td.RTMR2)
-				fmt.Printf("RTMR[3]:              %s\n", td.RTMR3)
-				fmt.Printf("TUD.DEBUG:            %t\n", td.CheckDebug)
-				fmt.Printf("SEC.SEPT_VE_DISABLE:  %t\n", td.CheckSeptVeDisable)
+				fmt.Printf("MRENCLAVE:            %s\n", td.MrEnclave[0])
+				fmt.Printf("MRSIGNER:             %s\n", td.MrSigner[0])
+				fmt.Printf("ISVPRODID:            %d\n", *td.IsvProdID)
+				fmt.Printf("ISVSVN:               %d\n", td.MinIsvSVN)
+				fmt.Printf("ATTRIBUTES.DEBUG:     %t\n", !td.CheckDebug)
 				fmt.Printf("\n")
 
-			case "tpm2":
-				td, err := tpm2.FromPlatform()
+			case "cca":
+				td, err := cca.FromPlatform()
 				if err != nil {
 					return err
 				}
-				akPublic := td.AKPublic.String()
-				akPrivateBlob := td.AKPrivateBlob.String()
 				fmt.Printf("\n")
-				fmt.Printf("Field        Value\n")
-				fmt.Printf("-----------  ----------------------------------------------------------------\n")
-				fmt.Printf("AKPub:       %s\n", akPublic[:64])
-				for pos := 64; pos < len(akPublic); pos += 64 {
-					fmt.Printf("             %s\n", akPublic[pos:min(pos+64, len(akPublic))])
+				fmt.Printf("Field                 Value\n")
+				fmt.Printf("--------------------  ----------------------------------------------------------------\n")
+				fmt.Printf("RIM:                  %s\n", td.RIM)
+				fmt.Printf("REM[0]:               %s\n", td.REM0)
+				fmt.Printf("REM[1]:               %s\n", td.REM1)
+				fmt.Printf("REM[2]:               %s\n", td.REM2)
+				fmt.Printf("REM[3]:               %s\n", td.REM3)
+				fmt.Printf("RPV:                  %s\n", td.PersonalizationValue)
+				fmt.Printf("IMPLEMENTATION_ID:    %s\n", td.PlatformImplementationID)
+				fmt.Printf("\n")
+
+			case "nitro":
+				td, err := nitro.FromPlatform()
+				if err != nil {
+					return err
+				}
+				fmt.Printf("\n")
+				fmt.Printf("Field                 Value\n")
+				fmt.Printf("--------------------  ----------------------------------------------------------------\n")
+				fmt.Printf("PCR0:                 %s\n", td.PCR0)
+				fmt.Printf("PCR1:                 %s\n", td.PCR1)
+				fmt.Printf("PCR2:                 %s\n", td.PCR2)
+				fmt.Printf("PCR3:                 %s\n", td.PCR3)
+				fmt.Printf("PCR4:                 %s\n", td.PCR4)
+				fmt.Printf("PCR5:                 %s\n", td.PCR5)
+				fmt.Printf("PCR6:                 %s\n", td.PCR6)
+				fmt.Printf("PCR7:                 %s\n", td.PCR7)
+				fmt.Printf("PCR8:                 %s\n", td.PCR8)
+				fmt.Printf("\n")
+
+			case "azure-cvm":
+				td, err := azurecvm.FromPlatform(context.Background())
+				if err != nil {
+					return err
 				}
-				fmt.Printf("AKPrivBlob:  %s\n", akPrivateBlob[:64])
-				for pos := 64; pos < len(akPrivateBlob); pos += 64 {
-					fmt.Printf("             %s\n", akPrivateBlob[pos:min(pos+64, len(akPrivateBlob))])
+				switch {
+				case td.SEVSNP != nil:
+					printSEVSNP(td.SEVSNP)
+				case td.TDX != nil:
+					printTDX(nil, td.TDX)
 				}
-				for idx, pcr := range td.PCRs {
+				fmt.Printf("Field        Value\n")
+				fmt.Printf("-----------  ----------------------------------------------------------------\n")
+				for idx, pcr := range td.TPM2.PCRs {
 					if pcr != nil {
 						fmt.Printf("PCR[%02d]:     %s\n", idx, pcr)
 					}
 				}
+				fmt.Printf("\n")
 			}
 
 			return nil
 		},
 	}
 }
+
+func printTDX(quote *tdx.Quote, td *tdx.TDX) {
+	fmt.Printf("\n")
+	if quote != nil {
+		fmt.Printf("Quote version: %d\n", quote.Version)
+		fmt.Printf("\n")
+	}
+	fmt.Printf("Field                 Value\n")
+	fmt.Printf("--------------------  ----------------------------------------------------------------\n")
+	fmt.Printf("MROWNER:              %s\n", td.MrOwner)
+	fmt.Printf("MROWNERCONFIG:        %s\n", td.MrOwnerConfig)
+	fmt.Printf("MRCONFIGID:           %s\n", td.MrConfigID)
+	fmt.Printf("MRTD:                 %s\n", td.MrTD)
+	fmt.Printf("RTMR[0]:              %s\n", td.RTMR0)
+	fmt.Printf("RTMR[1]:              %s\n", td.RTMR1)
+	fmt.Printf("RTMR[2]:              %s\n", td.RTMR2)
+	fmt.Printf("RTMR[3]:              %s\n", td.RTMR3)
+	if td.MrServiceTD != nil {
+		fmt.Printf("MRSERVICETD:          %s\n", td.MrServiceTD)
+	}
+	if td.MinTeeTcbSvn2 != nil {
+		fmt.Printf("TEE_TCB_SVN2:         %s\n", td.MinTeeTcbSvn2)
+	}
+	fmt.Printf("TUD.DEBUG:            %t\n", td.CheckDebug)
+	fmt.Printf("SEC.SEPT_VE_DISABLE:  %t\n", td.CheckSeptVeDisable)
+	fmt.Printf("\n")
+}
+
+func printTPM2(td *tpm2.TPM2) {
+	akPublic := td.AKPublic.String()
+	akPrivateBlob := td.AKPrivateBlob.String()
+	fmt.Printf("\n")
+	fmt.Printf("Field        Value\n")
+	fmt.Printf("-----------  ----------------------------------------------------------------\n")
+	fmt.Printf("AKPub:       %s\n", akPublic[:64])
+	for pos := 64; pos < len(akPublic); pos += 64 {
+		fmt.Printf("             %s\n", akPublic[pos:min(pos+64, len(akPublic))])
+	}
+	fmt.Printf("AKPrivBlob:  %s\n", akPrivateBlob[:64])
+	for pos := 64; pos < len(akPrivateBlob); pos += 64 {
+		fmt.Printf("             %s\n", akPrivateBlob[pos:min(pos+64, len(akPrivateBlob))])
+	}
+	for idx, pcr := range td.PCRs {
+		if pcr != nil {
+			fmt.Printf("PCR[%02d]:     %s\n", idx, pcr)
+		}
+	}
+}
+
+func printSEVSNP(td *sevsnp.SEVSNP) {
+	fmt.Printf("\n")
+	fmt.Printf("Field                 Value\n")
+	fmt.Printf("--------------------  ----------------------------------------------------------------\n")
+	fmt.Printf("MEASUREMENT:          %s\n", td.Measurement)
+	fmt.Printf("HOST_DATA:            %s\n", td.HostData)
+	fmt.Printf("ID_KEY_DIGEST:        %s\n", td.IDKeyDigest)
+	fmt.Printf("POLICY.DEBUG:         %t\n", !td.CheckDebug)
+	fmt.Printf("POLICY.MIGRATE_MA:    %t\n", !td.CheckMigrateMA)
+	fmt.Printf("TCB.BOOT_LOADER:      %d\n", td.MinTCBBootloader)
+	fmt.Printf("TCB.TEE:              %d\n", td.MinTCBTEE)
+	fmt.Printf("TCB.SNP:              %d\n", td.MinTCBSNP)
+	fmt.Printf("TCB.MICROCODE:        %d\n", td.MinTCBMicrocode)
+	fmt.Printf("\n")
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/urfave/cli/v2"
+	"go.uber.org/zap"
+)
+
+const (
+	categoryRATLS = "ratls"
+)
+
+func CommandRATLS(cfg *config.Config) *cli.Command {
+	flagsGeneral := []cli.Flag{
+		&cli.BoolFlag{ // --verbose
+			Destination: &cfg.Verbose,
+			Name:        "verbose",
+			Usage:       "log the detailed command execution progress",
+			Value:       false,
+		},
+	}
+
+	flagsRATLS := []cli.Flag{
+		&cli.StringFlag{ // --ratls-cert
+			Category:    strings.ToUpper(categoryRATLS),
+			Destination: &cfg.RATLS.Cert,
+			Name:        categoryRATLS + "-cert",
+			Usage:       "`path` where to write PEM-encoded ra-tls certificate",
+			Value:       "ratls.crt",
+		},
+
+		&cli.StringFlag{ // --ratls-key
+			Category:    strings.ToUpper(categoryRATLS),
+			Destination: &cfg.RATLS.Key,
+			Name:        categoryRATLS + "-key",
+			Usage:       "`path` where to write PEM-encoded private key of ra-tls certificate",
+			Value:       "ratls.key",
+		},
+
+		&cli.StringFlag{ // --ratls-common-name
+			Category:    strings.ToUpper(categoryRATLS),
+			Destination: &cfg.RATLS.CommonName,
+			Name:        categoryRATLS + "-common-name",
+			Usage:       "common `name` of ra-tls certificate subject",
+			Value:       "vault-auth-plugin-attest",
+		},
+
+		&cli.DurationFlag{ // --ratls-validity
+			Category:    strings.ToUpper(categoryRATLS),
+			Destination: &cfg.RATLS.Validity,
+			Name:        categoryRATLS + "-validity",
+			Usage:       "validity `duration` of ra-tls certificate",
+			Value:       24 * time.Hour,
+		},
+	}
+
+	return &cli.Command{
+		Name:  "ratls",
+		Usage: "generate ra-tls certificate with embedded tdx attestation quote",
+
+		Flags: slices.Concat(
+			flagsGeneral,
+			flagsRATLS,
+		),
+
+		Before: func(clictx *cli.Context) error {
+			return cfg.RATLS.Preprocess()
+		},
+
+		Action: func(_ *cli.Context) error {
+			// setup
+
+			if cfg.Verbose {
+				l, err := logger.New()
+				if err != nil {
+					return err
+				}
+				zap.ReplaceGlobals(l)
+			}
+
+			// generate certificate
+
+			zap.L().Debug("Generating ra-tls key")
+
+			key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+			if err != nil {
+				return err
+			}
+			keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+			if err != nil {
+				return err
+			}
+
+			zap.L().Debug("Generating ra-tls certificate")
+
+			certDER, err := tdx.NewRATLSCertificate(key, cfg.RATLS.CommonName, cfg.RATLS.Validity)
+			if err != nil {
+				return err
+			}
+
+			// persist
+
+			keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+			if err := os.WriteFile(cfg.RATLS.Key, keyPEM, 0o600); err != nil {
+				return err
+			}
+
+			certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER})
+			if err := os.WriteFile(cfg.RATLS.Cert, certPEM, 0o644); err != nil {
+				return err
+			}
+
+			fmt.Printf("\n")
+			fmt.Printf("Field        Value\n")
+			fmt.Printf("-----------  ----------------------------------------------------------------\n")
+			fmt.Printf("Certificate: %s\n", cfg.RATLS.Cert)
+			fmt.Printf("Key:         %s\n", cfg.RATLS.Key)
+			fmt.Printf("Valid till:  %s\n", time.Now().Add(cfg.RATLS.Validity).UTC().Format(time.RFC3339))
+			fmt.Printf("\n")
+
+			return nil
+		},
+	}
+}
@@ -6,6 +6,12 @@ var (
 	AttestationTypes = []string{
 		"tdx",
 		"tpm2",
+		"tdxtpm2",
+		"sevsnp",
+		"sgx",
+		"cca",
+		"nitro",
+		"azure-cvm",
 	}
 )
 
@@ -14,6 +14,7 @@ type Config struct {
 	TD *TD `yaml:"trusted_domain"`
 
 	HTTP  *HTTP  `yaml:"http"`
+	RATLS *RATLS `yaml:"ratls"`
 	Vault *Vault `yaml:"vault"`
 
 	Format  string `yaml:"-"`
@@ -21,6 +22,11 @@ type Config struct {
 	Verbose bool   `yaml:"-"`
 }
 
+var (
+	errTLSBindingWithoutClientCert = errors.New("flag --td-tls-binding requires --client-cert")
+	errRATLSWithoutClientCert      = errors.New("flag --td-ratls requires --client-cert")
+)
+
 var (
 	Formats = slices.Collect(maps.Keys(
 		vaultcmd.Formatters,
@@ -52,6 +58,18 @@ func (cfg *Config) Preprocess() error {
 		errs = append(errs, err)
 	}
 
+	{ // --td-tls-binding && --client-cert
+		if cfg.TD.TLSBinding && cfg.HTTP.ClientCert == "" {
+			errs = append(errs, errTLSBindingWithoutClientCert)
+		}
+	}
+
+	{ // --td-ratls && --client-cert
+		if cfg.TD.RATLS && cfg.HTTP.ClientCert == "" {
+			errs = append(errs, errRATLSWithoutClientCert)
+		}
+	}
+
 	switch len(errs) {
 	default:
 		return errors.Join(errs...)
@@ -0,0 +1,30 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+type RATLS struct {
+	Cert       string        `yaml:"cert"`
+	CommonName string        `yaml:"common_name"`
+	Key        string        `yaml:"key"`
+	Validity   time.Duration `yaml:"validity"`
+}
+
+var (
+	errRATLSValidityIsInvalid = errors.New("invalid ra-tls certificate validity")
+)
+
+func (cfg *RATLS) Preprocess() error {
+	{ // --ratls-validity
+		if cfg.Validity <= 0 {
+			return fmt.Errorf("%w: %s",
+				errRATLSValidityIsInvalid, cfg.Validity,
+			)
+		}
+	}
+
+	return nil
+}
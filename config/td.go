@@ -14,10 +14,15 @@ type TD struct {
 	VaultPath         string `yaml:"vault_path"`
 	TOTPSecret        string `yaml:"totp_secret"`
 	TPM2AKPrivateBlob string `yaml:"tpm2_ak_private_blob"`
+	InstanceKey       string `yaml:"instance_key"`
+	TLSBinding        bool   `yaml:"tls_binding"`
+	RATLS             bool   `yaml:"ratls"`
 }
 
 var (
 	errTDAttestationTypeInvalid = errors.New("invalid attestation type")
+	errTDInstanceKeyIsInvalid   = errors.New("invalid instance key")
+	errTDRATLSIsInvalid         = errors.New("invalid ra-tls setup")
 	errTDTOTPSecretIsInvalid    = errors.New("invalid totp secret")
 	errTDTPM2AKPrivateBlob      = errors.New("invalid tpm2 attestation key private blob")
 )
@@ -33,7 +38,35 @@ func (cfg *TD) Preprocess() error {
 		}
 	}
 
-	{ // --td-totp-secret
+	{ // --td-ratls
+		if cfg.RATLS && cfg.AttestationType != "tdx" {
+			return fmt.Errorf("%w: ra-tls is only supported with 'tdx' attestation type",
+				errTDRATLSIsInvalid,
+			)
+		}
+	}
+
+	{ // --td-instance-key
+		if cfg.InstanceKey != "" {
+			if cfg.AttestationType != "tdx" {
+				return fmt.Errorf("%w: instance enrollment is only supported with 'tdx' attestation type",
+					errTDInstanceKeyIsInvalid,
+				)
+			}
+			if cfg.RATLS {
+				return fmt.Errorf("%w: instance enrollment can not be combined with ra-tls",
+					errTDInstanceKeyIsInvalid,
+				)
+			}
+			if info, err := os.Stat(cfg.InstanceKey); err == nil && info.IsDir() {
+				return fmt.Errorf("%w: %s is a directory",
+					errTDInstanceKeyIsInvalid, cfg.InstanceKey,
+				)
+			}
+		}
+	}
+
+	if cfg.InstanceKey == "" { // --td-totp-secret
 		if _, err := base64.StdEncoding.DecodeString(cfg.TOTPSecret); err != nil {
 			if info, err := os.Stat(cfg.TOTPSecret); err == nil && !info.IsDir() {
 				if b, err := os.ReadFile(cfg.TOTPSecret); err == nil {
@@ -49,7 +82,7 @@ func (cfg *TD) Preprocess() error {
 	}
 
 	{ // --td-tpm2-ak-private-blob
-		if cfg.AttestationType == "tpm2" {
+		if cfg.AttestationType == "tpm2" || cfg.AttestationType == "tdxtpm2" {
 			if _, err := base64.StdEncoding.DecodeString(cfg.TPM2AKPrivateBlob); err != nil {
 				if info, err := os.Stat(cfg.TPM2AKPrivateBlob); err == nil && !info.IsDir() {
 					if b, err := os.ReadFile(cfg.TPM2AKPrivateBlob); err == nil {
@@ -13,6 +13,25 @@ const (
 	TOTPDigits    = 8
 	TOTPPeriod    = 1 * time.Second // note: this must be in whole seconds
 
-	TDXNonceSize  = 64
-	TPM2NonceSize = 20 // some TPMs don't support nonces longer than 20 bytes
+	TDXNonceSize    = 64
+	SEVSNPNonceSize = 64
+	SGXNonceSize    = 64
+	CCANonceSize    = 64
+	NitroNonceSize  = 64
+	TPM2NonceSize   = 20 // some TPMs don't support nonces longer than 20 bytes
+
+	DomainHistorySize = 100 // older versions of domain configuration are dropped
+
+	MaxNonces            = 65536 // outstanding nonces of the whole mount (oldest of the same domain are evicted)
+	MaxDomainNonces      = 64    // outstanding nonces of the domain, unless configured otherwise
+	MaxDomainNoncesLimit = 1024  // upper bound of max_nonces of the domain
+
+	MaxEnrollNonces       = 1024 // outstanding enrollment nonces of the whole mount (kept apart from the others)
+	MaxDomainEnrollNonces = 16   // outstanding enrollment nonces of the domain
+
+	InstanceNonceRequestSkew = 30 * time.Second // signed timestamp of instance nonce request may be off by this much
+
+	TPM2ClockTolerance = 5 * time.Minute // tpm2 clock may run ahead of the time that has passed by this much
+
+	ImportKeyBits = 4096 // size of rsa key that the exported secrets are encrypted to
 )
@@ -15,3 +15,11 @@ func Init(_ string, _, _ bool, _ io.Writer) *Logger {
 func Warning(args ...interface{}) {
 	zap.L().Sugar().WithOptions(zap.AddCallerSkip(1)).Warn(args)
 }
+
+func Warningf(template string, args ...interface{}) {
+	zap.L().Sugar().WithOptions(zap.AddCallerSkip(1)).Warnf(template, args...)
+}
+
+func Errorf(template string, args ...interface{}) {
+	zap.L().Sugar().WithOptions(zap.AddCallerSkip(1)).Errorf(template, args...)
+}
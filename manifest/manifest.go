@@ -0,0 +1,117 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+)
+
+// Manifest is the set of reference values of an image (e.g. the expected
+// measurements) that is published, and signed, by the image pipeline.
+type Manifest struct {
+	// Image is the name of the image.
+	Image string `json:"image"`
+
+	// Version is the version of the image.
+	Version string `json:"version"`
+
+	// ExpiresAt is the time after which the manifest must not be trusted.
+	ExpiresAt time.Time `json:"expires_at"`
+
+	// ReferenceValues are the expected values keyed by the same field names
+	// that are used to configure the trusted domain (e.g. `tdx_mr_td`, or
+	// `tpm2_pcr07`).
+	ReferenceValues map[string]interface{} `json:"reference_values"`
+}
+
+// Signed is the manifest as it was received (and stored), together with its
+// signature.
+type Signed struct {
+	// Manifest is the json-encoded manifest (exactly as it was signed).
+	Manifest types.Bytes `json:"manifest"`
+
+	// Signature is the ed25519 signature of the manifest.
+	Signature types.Bytes `json:"signature"`
+}
+
+var (
+	errManifestExpired                = errors.New("manifest is expired")
+	errManifestInvalidImage           = errors.New("invalid image name in manifest")
+	errManifestInvalidVersion         = errors.New("invalid image version in manifest")
+	errManifestMissingExpiry          = errors.New("manifest has no expiry")
+	errManifestMissingReferenceValues = errors.New("manifest has no reference values")
+	errManifestSignatureInvalid       = errors.New("invalid manifest signature")
+	errManifestSignerInvalidSize      = errors.New("invalid size of manifest signer public key")
+)
+
+var (
+	regexpName = regexp.MustCompile(`^\w(([\w.-]+)?\w)?$`)
+)
+
+// Sign encodes and signs the manifest with the provided key.
+func Sign(m *Manifest, key ed25519.PrivateKey) (*Signed, error) {
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Signed{
+		Manifest:  raw,
+		Signature: ed25519.Sign(key, raw),
+	}, nil
+}
+
+// Open verifies the signature of the manifest with the public key of the
+// signer, and decodes it.
+//
+// It does not check the expiry, see Manifest.Valid.
+func (s *Signed) Open(signer []byte) (*Manifest, error) {
+	if len(signer) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: %d != %d",
+			errManifestSignerInvalidSize, len(signer), ed25519.PublicKeySize,
+		)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(signer), s.Manifest, s.Signature) {
+		return nil, errManifestSignatureInvalid
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(s.Manifest, m); err != nil {
+		return nil, err
+	}
+
+	if !regexpName.MatchString(m.Image) {
+		return nil, fmt.Errorf("%w: %q", errManifestInvalidImage, m.Image)
+	}
+	if !regexpName.MatchString(m.Version) {
+		return nil, fmt.Errorf("%w: %q", errManifestInvalidVersion, m.Version)
+	}
+	if m.ExpiresAt.IsZero() {
+		return nil, errManifestMissingExpiry
+	}
+	if len(m.ReferenceValues) == 0 {
+		return nil, errManifestMissingReferenceValues
+	}
+
+	return m, nil
+}
+
+// ID returns the identifier of the manifest (`<image>/<version>`).
+func (m *Manifest) ID() string {
+	return m.Image + "/" + m.Version
+}
+
+// Valid verifies that the manifest is not expired at the provided time.
+func (m *Manifest) Valid(now time.Time) error {
+	if !now.Before(m.ExpiresAt) {
+		return fmt.Errorf("%w: %s",
+			errManifestExpired, m.ExpiresAt.UTC().Format(time.RFC3339),
+		)
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package manifest_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/manifest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestManifest(t *testing.T) {
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+	otherPublic, _, err := ed25519.GenerateKey(rand.Reader)
+	assert.NoError(t, err)
+
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	m := &manifest.Manifest{
+		Image:     "builder",
+		Version:   "1.2.3",
+		ExpiresAt: now.Add(time.Hour),
+		ReferenceValues: map[string]interface{}{
+			"tdx_mr_td": "AAAA",
+		},
+	}
+
+	signed, err := manifest.Sign(m, private)
+	assert.NoError(t, err)
+
+	{ // valid
+		opened, err := signed.Open(public)
+		assert.NoError(t, err)
+		assert.Equal(t, "builder/1.2.3", opened.ID())
+		assert.Equal(t, "AAAA", opened.ReferenceValues["tdx_mr_td"])
+		assert.NoError(t, opened.Valid(now))
+		assert.Error(t, opened.Valid(now.Add(time.Hour)))
+	}
+
+	{ // another signer
+		_, err := signed.Open(otherPublic)
+		assert.Error(t, err)
+	}
+
+	{ // tampered
+		tampered := &manifest.Signed{
+			Manifest:  append([]byte{}, signed.Manifest...),
+			Signature: signed.Signature,
+		}
+		tampered.Manifest[len(tampered.Manifest)-2] ^= 0x01
+		_, err := tampered.Open(public)
+		assert.Error(t, err)
+	}
+
+	{ // invalid image name
+		m.Image = "../builder"
+		signed, err := manifest.Sign(m, private)
+		assert.NoError(t, err)
+		_, err = signed.Open(public)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,158 @@
+package nitro
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/veraison/go-cose"
+)
+
+// Document is the parsed AWS Nitro Enclaves attestation document.
+//
+// For the reference see AWS Nitro Enclaves User Guide, "Verifying the root of
+// trust".
+//
+// See also:
+//
+//   - https://docs.aws.amazon.com/enclaves/latest/user/verify-root.html
+//   - https://github.com/aws/aws-nitro-enclaves-nsm-api/blob/main/docs/attestation_process.md
+type Document struct {
+	ModuleID    string          `cbor:"module_id"`
+	Digest      string          `cbor:"digest"`
+	Timestamp   uint64          `cbor:"timestamp"`
+	PCRs        map[uint][]byte `cbor:"pcrs"`
+	Certificate []byte          `cbor:"certificate"`
+	CABundle    [][]byte        `cbor:"cabundle"`
+	PublicKey   []byte          `cbor:"public_key,omitempty"`
+	UserData    []byte          `cbor:"user_data,omitempty"`
+	Nonce       []byte          `cbor:"nonce,omitempty"`
+
+	msg *cose.Sign1Message
+}
+
+// VerifyOptions configure the verification of attestation documents.
+type VerifyOptions struct {
+	// Now is the time at which the certificates must be valid.
+	Now time.Time
+
+	// RootFingerprint is the hex-encoded SHA256 fingerprint of the root
+	// certificate that the document must chain up to. When empty, AWS Nitro
+	// Enclaves Root-G1 is pinned.
+	RootFingerprint string
+}
+
+const (
+	// RootG1Fingerprint is the SHA256 fingerprint of AWS Nitro Enclaves
+	// Root-G1 certificate (as published in AWS Nitro Enclaves User Guide).
+	RootG1Fingerprint = "641a0321a3e244efe456463195d606317ed7cdcc3c1756e09893f3c68f79bb5b"
+
+	digestSHA384 = "SHA384"
+)
+
+var (
+	errDocumentInvalid            = errors.New("invalid nitro attestation document")
+	errDocumentUnexpectedDigest   = errors.New("unexpected nitro attestation document digest")
+	errDocumentEmptyCABundle      = errors.New("nitro attestation document has empty ca bundle")
+	errDocumentUntrustedRoot      = errors.New("nitro attestation document does not chain up to pinned root")
+	errDocumentInvalidCert        = errors.New("invalid nitro attestation document certificate")
+	errDocumentInvalidSignature   = errors.New("invalid nitro attestation document signature")
+	errDocumentInvalidFingerprint = errors.New("invalid nitro root certificate fingerprint")
+)
+
+// ParseDocument parses COSE_Sign1-encoded (tagged or not) attestation
+// document.
+func ParseDocument(raw []byte) (*Document, error) {
+	msg := cose.NewSign1Message()
+	if err := msg.UnmarshalCBOR(raw); err != nil {
+		untagged := (*cose.UntaggedSign1Message)(msg)
+		if err := untagged.UnmarshalCBOR(raw); err != nil {
+			return nil, fmt.Errorf("%w: %w", errDocumentInvalid, err)
+		}
+	}
+
+	d := &Document{msg: msg}
+	if err := cbor.Unmarshal(msg.Payload, d); err != nil {
+		return nil, fmt.Errorf("%w: %w", errDocumentInvalid, err)
+	}
+
+	if d.Digest != digestSHA384 {
+		return nil, fmt.Errorf("%w: %s != %s",
+			errDocumentUnexpectedDigest, d.Digest, digestSHA384,
+		)
+	}
+	if len(d.CABundle) == 0 {
+		return nil, errDocumentEmptyCABundle
+	}
+
+	return d, nil
+}
+
+// Verify verifies the genuineness of the document, i.e.:
+//
+//   - the first certificate of ca bundle is the pinned root;
+//   - the certificate of the document chains up to that root (via the rest of
+//     ca bundle);
+//   - the document is signed by its certificate.
+func (d *Document) Verify(opts *VerifyOptions) error {
+	fingerprint := opts.RootFingerprint
+	if fingerprint == "" {
+		fingerprint = RootG1Fingerprint
+	}
+	expected, err := hex.DecodeString(fingerprint)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDocumentInvalidFingerprint, err)
+	}
+
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	actual := sha256.Sum256(d.CABundle[0])
+	if !bytes.Equal(expected, actual[:]) {
+		return errDocumentUntrustedRoot
+	}
+
+	roots := x509.NewCertPool()
+	intermediates := x509.NewCertPool()
+	for idx, raw := range d.CABundle {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errDocumentInvalidCert, err)
+		}
+		if idx == 0 {
+			roots.AddCert(cert)
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+
+	cert, err := x509.ParseCertificate(d.Certificate)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDocumentInvalidCert, err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   now,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return fmt.Errorf("%w: %w", errDocumentInvalidCert, err)
+	}
+
+	verifier, err := cose.NewVerifier(cose.AlgorithmES384, cert.PublicKey)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errDocumentInvalidSignature, err)
+	}
+	if err := d.msg.Verify(nil, verifier); err != nil {
+		return fmt.Errorf("%w: %w", errDocumentInvalidSignature, err)
+	}
+
+	return nil
+}
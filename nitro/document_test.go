@@ -0,0 +1,162 @@
+package nitro_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/nitro"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+	"github.com/veraison/go-cose"
+)
+
+var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type pki struct {
+	fingerprint string
+	cabundle    [][]byte
+	cert        []byte
+	key         *ecdsa.PrivateKey
+}
+
+// newPKI generates root, intermediate and enclave certificates that mimic the
+// ones issued by aws.
+func newPKI(t *testing.T) *pki {
+	issue := func(cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+		assert.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(time.Hour),
+			IsCA:                  isCA,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		assert.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.NoError(t, err)
+		return cert, key
+	}
+
+	root, rootKey := issue("test.nitro-enclaves", true, nil, nil)
+	intermediate, intermediateKey := issue("test.zone.nitro-enclaves", true, root, rootKey)
+	enclave, enclaveKey := issue("test.enclave.nitro-enclaves", false, intermediate, intermediateKey)
+
+	fingerprint := sha256.Sum256(root.Raw)
+
+	return &pki{
+		fingerprint: hex.EncodeToString(fingerprint[:]),
+		cabundle:    [][]byte{root.Raw, intermediate.Raw},
+		cert:        enclave.Raw,
+		key:         enclaveKey,
+	}
+}
+
+// newDocument assembles attestation document as nsm would (untagged).
+func newDocument(t *testing.T, p *pki, pcr0 byte, nonce []byte) []byte {
+	pcrs := map[uint][]byte{}
+	for idx := uint(0); idx < 16; idx++ {
+		pcrs[idx] = make([]byte, 48)
+	}
+	pcrs[0][0] = pcr0
+
+	payload, err := cbor.Marshal(map[string]interface{}{
+		"module_id":   "i-0123456789abcdef0-enc0123456789abcdef",
+		"digest":      "SHA384",
+		"timestamp":   uint64(now.UnixMilli()),
+		"pcrs":        pcrs,
+		"certificate": p.cert,
+		"cabundle":    p.cabundle,
+		"nonce":       nonce,
+	})
+	assert.NoError(t, err)
+
+	signer, err := cose.NewSigner(cose.AlgorithmES384, p.key)
+	assert.NoError(t, err)
+	res, err := cose.Sign1Untagged(rand.Reader, signer, cose.Headers{
+		Protected: cose.ProtectedHeader{cose.HeaderLabelAlgorithm: cose.AlgorithmES384},
+	}, payload, nil)
+	assert.NoError(t, err)
+	return res
+}
+
+func TestVerify(t *testing.T) {
+	p := newPKI(t)
+	nonce := []byte("nonce")
+
+	{ // genuine document
+		doc, err := nitro.ParseDocument(newDocument(t, p, 0x11, nonce))
+		assert.NoError(t, err)
+		assert.Equal(t, nonce, doc.Nonce)
+		assert.NoError(t, doc.Verify(&nitro.VerifyOptions{Now: now, RootFingerprint: p.fingerprint}))
+	}
+
+	{ // aws root is pinned by default
+		doc, err := nitro.ParseDocument(newDocument(t, p, 0x11, nonce))
+		assert.NoError(t, err)
+		assert.Error(t, doc.Verify(&nitro.VerifyOptions{Now: now}))
+	}
+
+	{ // expired certificate
+		doc, err := nitro.ParseDocument(newDocument(t, p, 0x11, nonce))
+		assert.NoError(t, err)
+		assert.Error(t, doc.Verify(&nitro.VerifyOptions{Now: now.Add(2 * time.Hour), RootFingerprint: p.fingerprint}))
+	}
+
+	{ // signed by someone else
+		other := newPKI(t)
+		other.cabundle = p.cabundle
+		doc, err := nitro.ParseDocument(newDocument(t, other, 0x11, nonce))
+		assert.NoError(t, err)
+		assert.Error(t, doc.Verify(&nitro.VerifyOptions{Now: now, RootFingerprint: p.fingerprint}))
+	}
+}
+
+func TestMatchesDocument(t *testing.T) {
+	doc, err := nitro.ParseDocument(newDocument(t, newPKI(t), 0x11, nil))
+	assert.NoError(t, err)
+
+	{ // matching pcrs
+		td := &nitro.Nitro{
+			PCR0: &types.Byte48{0x11},
+			PCR1: &types.Byte48{},
+			PCR8: &types.Byte48{},
+		}
+		reported, _ := td.MatchesDocument(doc)
+		assert.Empty(t, failures(reported))
+	}
+
+	{ // mismatching pcrs
+		td := &nitro.Nitro{
+			PCR0: &types.Byte48{},
+			PCR2: &types.Byte48{0x22},
+		}
+		reported, _ := td.MatchesDocument(doc)
+		assert.Len(t, failures(reported), 2)
+	}
+}
+
+func failures(errs []error) []error {
+	res := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+	return res
+}
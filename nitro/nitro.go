@@ -0,0 +1,270 @@
+package nitro
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
+
+	"github.com/hf/nsm"
+	nsmrequest "github.com/hf/nsm/request"
+)
+
+// Nitro reflects our expectations about AWS Nitro enclave.
+//
+// For the reference see AWS Nitro Enclaves User Guide.
+//
+// See also:
+//
+//   - https://docs.aws.amazon.com/enclaves/latest/user/set-up-attestation.html
+type Nitro struct {
+	tokenutil.TokenParams `mapstructure:"-" structs:"-"`
+
+	// Name is the name of trusted domain.
+	Name string `json:"-" mapstructure:"-" structs:"-"`
+
+	// TOTPSecret is the secret used to generate initial TOTP codes.
+	TOTPSecret string `json:"totp_secret" mapstructure:"totp_secret" structs:"totp_secret"`
+
+	// PCR0 is the expected value of platform configuration register #0.
+	//
+	// PCR0 is the measurement of the enclave image file.
+	PCR0 *types.Byte48 `json:"nitro_pcr0,omitempty" mapstructure:"nitro_pcr0,omitempty" structs:"nitro_pcr0,omitempty"`
+
+	// PCR1 is the expected value of platform configuration register #1.
+	//
+	// PCR1 is the measurement of the linux kernel and bootstrap.
+	PCR1 *types.Byte48 `json:"nitro_pcr1,omitempty" mapstructure:"nitro_pcr1,omitempty" structs:"nitro_pcr1,omitempty"`
+
+	// PCR2 is the expected value of platform configuration register #2.
+	//
+	// PCR2 is the measurement of the application.
+	PCR2 *types.Byte48 `json:"nitro_pcr2,omitempty" mapstructure:"nitro_pcr2,omitempty" structs:"nitro_pcr2,omitempty"`
+
+	// PCR3 is the expected value of platform configuration register #3.
+	//
+	// PCR3 is the measurement of the IAM role assigned to the parent instance.
+	PCR3 *types.Byte48 `json:"nitro_pcr3,omitempty" mapstructure:"nitro_pcr3,omitempty" structs:"nitro_pcr3,omitempty"`
+
+	// PCR4 is the expected value of platform configuration register #4.
+	//
+	// PCR4 is the measurement of the instance ID of the parent instance.
+	PCR4 *types.Byte48 `json:"nitro_pcr4,omitempty" mapstructure:"nitro_pcr4,omitempty" structs:"nitro_pcr4,omitempty"`
+
+	// PCR5 is the expected value of platform configuration register #5.
+	PCR5 *types.Byte48 `json:"nitro_pcr5,omitempty" mapstructure:"nitro_pcr5,omitempty" structs:"nitro_pcr5,omitempty"`
+
+	// PCR6 is the expected value of platform configuration register #6.
+	PCR6 *types.Byte48 `json:"nitro_pcr6,omitempty" mapstructure:"nitro_pcr6,omitempty" structs:"nitro_pcr6,omitempty"`
+
+	// PCR7 is the expected value of platform configuration register #7.
+	PCR7 *types.Byte48 `json:"nitro_pcr7,omitempty" mapstructure:"nitro_pcr7,omitempty" structs:"nitro_pcr7,omitempty"`
+
+	// PCR8 is the expected value of platform configuration register #8.
+	//
+	// PCR8 is the measurement of the enclave image file signing certificate.
+	PCR8 *types.Byte48 `json:"nitro_pcr8,omitempty" mapstructure:"nitro_pcr8,omitempty" structs:"nitro_pcr8,omitempty"`
+}
+
+var (
+	errNitroDocumentIsNil        = errors.New("nitro attestation document is nil")
+	errNitroDocumentMismatchPCR0 = errors.New("nitro pcr[0] mismatch")
+	errNitroDocumentMismatchPCR1 = errors.New("nitro pcr[1] mismatch")
+	errNitroDocumentMismatchPCR2 = errors.New("nitro pcr[2] mismatch")
+	errNitroDocumentMismatchPCR3 = errors.New("nitro pcr[3] mismatch")
+	errNitroDocumentMismatchPCR4 = errors.New("nitro pcr[4] mismatch")
+	errNitroDocumentMismatchPCR5 = errors.New("nitro pcr[5] mismatch")
+	errNitroDocumentMismatchPCR6 = errors.New("nitro pcr[6] mismatch")
+	errNitroDocumentMismatchPCR7 = errors.New("nitro pcr[7] mismatch")
+	errNitroDocumentMismatchPCR8 = errors.New("nitro pcr[8] mismatch")
+	errNitroEmptyResponse        = errors.New("nsm returned no attestation document")
+)
+
+// GetDocument generates attestation document with provided nonce.
+//
+// It relies on nitro secure module (i.e. /dev/nsm device).
+func GetDocument(nonce [globals.NitroNonceSize]byte) ([]byte, error) {
+	sess, err := nsm.OpenDefaultSession()
+	if err != nil {
+		return nil, err
+	}
+	defer sess.Close()
+
+	res, err := sess.Send(&nsmrequest.Attestation{
+		Nonce: nonce[:],
+	})
+	if err != nil {
+		return nil, err
+	}
+	if res.Error != "" {
+		return nil, fmt.Errorf("nsm error: %s", res.Error)
+	}
+	if res.Attestation == nil || res.Attestation.Document == nil {
+		return nil, errNitroEmptyResponse
+	}
+
+	return res.Attestation.Document, nil
+}
+
+// FromPlatform creates new Nitro instance from the parameters of the enclave
+// we are currently running in.
+func FromPlatform() (*Nitro, error) {
+	raw, err := GetDocument([globals.NitroNonceSize]byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := ParseDocument(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	pcr := func(idx uint) *types.Byte48 {
+		if len(doc.PCRs[idx]) != 48 {
+			return nil
+		}
+		return (*types.Byte48)(doc.PCRs[idx])
+	}
+
+	return &Nitro{
+		PCR0: pcr(0),
+		PCR1: pcr(1),
+		PCR2: pcr(2),
+		PCR3: pcr(3),
+		PCR4: pcr(4),
+		PCR5: pcr(5),
+		PCR6: pcr(6),
+		PCR7: pcr(7),
+		PCR8: pcr(8),
+	}, nil
+}
+
+func (td *Nitro) MatchesDocument(doc *Document) (
+	[]error, []error,
+) {
+	type test struct {
+		expect []byte
+		actual []byte
+		err    error
+	}
+
+	{ // pre-flight checks
+		if doc == nil {
+			return []error{
+				errNitroDocumentIsNil,
+			}, nil
+		}
+	}
+
+	tests := []test{
+		{ // pcr[0]
+			actual: doc.PCRs[0],
+			err:    errNitroDocumentMismatchPCR0,
+		},
+		{ // pcr[1]
+			actual: doc.PCRs[1],
+			err:    errNitroDocumentMismatchPCR1,
+		},
+		{ // pcr[2]
+			actual: doc.PCRs[2],
+			err:    errNitroDocumentMismatchPCR2,
+		},
+		{ // pcr[3]
+			actual: doc.PCRs[3],
+			err:    errNitroDocumentMismatchPCR3,
+		},
+		{ // pcr[4]
+			actual: doc.PCRs[4],
+			err:    errNitroDocumentMismatchPCR4,
+		},
+		{ // pcr[5]
+			actual: doc.PCRs[5],
+			err:    errNitroDocumentMismatchPCR5,
+		},
+		{ // pcr[6]
+			actual: doc.PCRs[6],
+			err:    errNitroDocumentMismatchPCR6,
+		},
+		{ // pcr[7]
+			actual: doc.PCRs[7],
+			err:    errNitroDocumentMismatchPCR7,
+		},
+		{ // pcr[8]
+			actual: doc.PCRs[8],
+			err:    errNitroDocumentMismatchPCR8,
+		},
+	}
+	if td.PCR0 != nil {
+		tests[0].expect = td.PCR0[:]
+	}
+	if td.PCR1 != nil {
+		tests[1].expect = td.PCR1[:]
+	}
+	if td.PCR2 != nil {
+		tests[2].expect = td.PCR2[:]
+	}
+	if td.PCR3 != nil {
+		tests[3].expect = td.PCR3[:]
+	}
+	if td.PCR4 != nil {
+		tests[4].expect = td.PCR4[:]
+	}
+	if td.PCR5 != nil {
+		tests[5].expect = td.PCR5[:]
+	}
+	if td.PCR6 != nil {
+		tests[6].expect = td.PCR6[:]
+	}
+	if td.PCR7 != nil {
+		tests[7].expect = td.PCR7[:]
+	}
+	if td.PCR8 != nil {
+		tests[8].expect = td.PCR8[:]
+	}
+
+	errs := make([]error, 0, len(tests))
+	dump := make([]error, 0, len(tests))
+
+	for _, t := range tests {
+		// make sure the time is constant regardless of the config
+		if t.expect != nil {
+			if subtle.ConstantTimeCompare(t.expect, t.actual) != 1 {
+				errs = append(errs, t.err)
+			} else {
+				errs = append(errs, nil)
+			}
+		} else {
+			dummy := make([]byte, len(t.actual))
+			if subtle.ConstantTimeCompare(dummy, t.actual) != 1 {
+				dump = append(dump, t.err)
+			} else {
+				dump = append(dump, nil)
+			}
+		}
+	}
+
+	return errs, dump
+}
+
+func (td *Nitro) GetName() string {
+	return td.Name
+}
+
+func (td *Nitro) SetName(name string) {
+	td.Name = name
+}
+
+func (td *Nitro) AttestationType() string {
+	return "nitro"
+}
+
+func (td *Nitro) GetTOTPSecret() string {
+	return td.TOTPSecret
+}
+
+func (td *Nitro) SetTOTPSecret(totpSecret string) {
+	td.TOTPSecret = totpSecret
+}
@@ -0,0 +1,94 @@
+package policy
+
+import (
+	"sync"
+
+	"github.com/google/cel-go/cel"
+)
+
+// Cache keeps compiled programs of the policies, so that the expression is
+// not parsed and type-checked again on every evaluation.
+//
+// The programs are keyed by the owner of the policy (e.g. the trusted
+// domain). The program is recompiled when the expression (or the names of
+// the values) of the owner's policy change.
+type Cache struct {
+	mx       sync.Mutex
+	programs map[string]*cacheEntry
+}
+
+type cacheEntry struct {
+	fingerprint string
+	program     cel.Program
+
+	selectsTDXTCBStatus bool
+}
+
+func NewCache() *Cache {
+	return &Cache{
+		programs: make(map[string]*cacheEntry),
+	}
+}
+
+// Evaluate verifies that the claims satisfy the policy of the owner.
+func (c *Cache) Evaluate(key string, p *Policy, claims *Claims) error {
+	entry, err := c.entry(key, p)
+	if err != nil {
+		return err
+	}
+
+	return p.eval(entry.program, claims)
+}
+
+// SelectsTDXTCBStatus reports whether the policy of the owner refers to the
+// tcb status of tdx quote.
+func (c *Cache) SelectsTDXTCBStatus(key string, p *Policy) (bool, error) {
+	entry, err := c.entry(key, p)
+	if err != nil {
+		return false, err
+	}
+
+	return entry.selectsTDXTCBStatus, nil
+}
+
+// Delete forgets the program of the owner.
+func (c *Cache) Delete(key string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	delete(c.programs, key)
+}
+
+func (c *Cache) entry(key string, p *Policy) (*cacheEntry, error) {
+	fingerprint := p.fingerprint()
+
+	c.mx.Lock()
+	entry, ok := c.programs[key]
+	c.mx.Unlock()
+
+	if ok && entry.fingerprint == fingerprint {
+		return entry, nil
+	}
+
+	env, ast, err := p.check()
+	if err != nil {
+		return nil, err
+	}
+	prg, err := env.Program(ast, cel.CostLimit(costLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	entry = &cacheEntry{
+		fingerprint: fingerprint,
+		program:     prg,
+
+		selectsTDXTCBStatus: selectsTDXTCBStatus(ast),
+	}
+
+	c.mx.Lock()
+	c.programs[key] = entry
+	c.mx.Unlock()
+
+	return entry, nil
+}
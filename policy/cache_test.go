@@ -0,0 +1,62 @@
+package policy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCache(t *testing.T) {
+	c := NewCache()
+
+	p := &Policy{
+		Expression: `claims.tdx.mr_td in allowed_mr_td`,
+		Values:     map[string][]string{"allowed_mr_td": {"AAAA"}},
+	}
+	claims := &Claims{TDX: &TDX{MrTD: "AAAA"}}
+
+	require.NoError(t, c.Evaluate("tdx/a", p, claims))
+	compiled := c.programs["tdx/a"]
+	require.NotNil(t, compiled)
+
+	{ // same policy => same program
+		require.NoError(t, c.Evaluate("tdx/a", p, claims))
+		assert.Same(t, compiled, c.programs["tdx/a"])
+	}
+
+	{ // changed values => same program, new values
+		p.Values["allowed_mr_td"] = []string{"BBBB"}
+		assert.Error(t, c.Evaluate("tdx/a", p, claims))
+		assert.Same(t, compiled, c.programs["tdx/a"])
+	}
+
+	{ // changed expression => new program
+		p.Expression = `claims.tdx.mr_td == "AAAA"`
+		require.NoError(t, c.Evaluate("tdx/a", p, claims))
+		assert.NotSame(t, compiled, c.programs["tdx/a"])
+		compiled = c.programs["tdx/a"]
+	}
+
+	{ // renamed values => new program
+		p.Values = map[string][]string{"other": {"AAAA"}}
+		require.NoError(t, c.Evaluate("tdx/a", p, claims))
+		assert.NotSame(t, compiled, c.programs["tdx/a"])
+	}
+
+	{ // programs are kept per owner
+		other := &Policy{Expression: `claims.tdx.mr_td == "BBBB"`}
+		assert.Error(t, c.Evaluate("tdx/b", other, claims))
+		assert.NoError(t, c.Evaluate("tdx/a", p, claims))
+		assert.Len(t, c.programs, 2)
+	}
+
+	{ // invalid expression is not cached
+		invalid := &Policy{Expression: `claims.tdx.unknown == ""`}
+		assert.Error(t, c.Evaluate("tdx/c", invalid, claims))
+		assert.NotContains(t, c.programs, "tdx/c")
+	}
+
+	c.Delete("tdx/a")
+	assert.NotContains(t, c.programs, "tdx/a")
+}
@@ -0,0 +1,254 @@
+package policy
+
+import (
+	"crypto"
+	"encoding/base64"
+
+	"github.com/flashbots/vault-auth-plugin-attest/cca"
+	"github.com/flashbots/vault-auth-plugin-attest/nitro"
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/google/go-attestation/attest"
+
+	snppb "github.com/google/go-sev-guest/proto/sevsnp"
+)
+
+// Claims are the claims of the attestation evidence that policy expressions
+// are evaluated against (as `claims`).
+//
+// Only the claims of the evidence that was presented on login are set, the
+// rest are nil. All binary values are base64-encoded (the same way they are
+// configured on the trusted domains).
+type Claims struct {
+	TDX    *TDX    `cel:"tdx"`
+	TPM2   *TPM2   `cel:"tpm2"`
+	SEVSNP *SEVSNP `cel:"sevsnp"`
+	SGX    *SGX    `cel:"sgx"`
+	CCA    *CCA    `cel:"cca"`
+	Nitro  *Nitro  `cel:"nitro"`
+}
+
+// TDX are the claims of TDX quote.
+type TDX struct {
+	MrTD          string   `cel:"mr_td"`
+	MrConfigID    string   `cel:"mr_config_id"`
+	MrOwner       string   `cel:"mr_owner"`
+	MrOwnerConfig string   `cel:"mr_owner_config"`
+	MrSeam        string   `cel:"mr_seam"`
+	MrSignerSeam  string   `cel:"mr_signer_seam"`
+	MrServiceTD   string   `cel:"mr_service_td"`
+	RTMR          []string `cel:"rtmr"`
+	TeeTcbSvn     string   `cel:"tee_tcb_svn"`
+	TeeTcbSvn2    string   `cel:"tee_tcb_svn2"`
+	TDAttributes  string   `cel:"td_attributes"`
+	XFAM          string   `cel:"xfam"`
+	ReportData    string   `cel:"report_data"`
+
+	// TCBStatus is the status of the tcb level (e.g. "UpToDate") that the
+	// platform and tdx module meet as per tcb info collateral from Intel PCS.
+	// The collateral is only fetched for the policies that refer to it (see
+	// Policy.SelectsTDXTCBStatus).
+	TCBStatus string `cel:"tcb_status"`
+}
+
+// TPM2 are the claims of TPM 2.0 attestation.
+type TPM2 struct {
+	// PCRs are SHA256 platform configuration registers (indexed by the
+	// register number, with empty string for the ones that were not quoted).
+	PCRs []string `cel:"pcrs"`
+}
+
+// SEVSNP are the claims of SEV-SNP attestation report.
+type SEVSNP struct {
+	Measurement     string `cel:"measurement"`
+	HostData        string `cel:"host_data"`
+	IDKeyDigest     string `cel:"id_key_digest"`
+	AuthorKeyDigest string `cel:"author_key_digest"`
+	FamilyID        string `cel:"family_id"`
+	ImageID         string `cel:"image_id"`
+	ReportData      string `cel:"report_data"`
+	ChipID          string `cel:"chip_id"`
+	Policy          int64  `cel:"policy"`
+	GuestSVN        int64  `cel:"guest_svn"`
+	VMPL            int64  `cel:"vmpl"`
+	CurrentTCB      int64  `cel:"current_tcb"`
+	ReportedTCB     int64  `cel:"reported_tcb"`
+}
+
+// SGX are the claims of SGX quote.
+type SGX struct {
+	MrEnclave  string `cel:"mr_enclave"`
+	MrSigner   string `cel:"mr_signer"`
+	IsvProdID  int64  `cel:"isv_prod_id"`
+	IsvSVN     int64  `cel:"isv_svn"`
+	Attributes string `cel:"attributes"`
+	ReportData string `cel:"report_data"`
+}
+
+// CCA are the claims of CCA attestation token.
+type CCA struct {
+	RealmInitialMeasurement     string   `cel:"realm_initial_measurement"`
+	RealmExtensibleMeasurements []string `cel:"realm_extensible_measurements"`
+	RealmPersonalizationValue   string   `cel:"realm_personalization_value"`
+	RealmHashAlgorithm          string   `cel:"realm_hash_algorithm"`
+	RealmPublicKey              string   `cel:"realm_public_key"`
+	PlatformImplementationID    string   `cel:"platform_implementation_id"`
+	PlatformInstanceID          string   `cel:"platform_instance_id"`
+	PlatformLifeCycle           int64    `cel:"platform_lifecycle"`
+	PlatformProfile             string   `cel:"platform_profile"`
+}
+
+// Nitro are the claims of AWS Nitro Enclaves attestation document.
+type Nitro struct {
+	ModuleID  string `cel:"module_id"`
+	Digest    string `cel:"digest"`
+	PublicKey string `cel:"public_key"`
+	UserData  string `cel:"user_data"`
+
+	// PCRs are platform configuration registers (indexed by the register
+	// number, with empty string for the ones that were not reported).
+	PCRs []string `cel:"pcrs"`
+}
+
+func encode(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// FromTDXQuote extracts the claims of TDX quote.
+func FromTDXQuote(quote *tdx.Quote) *TDX {
+	if quote == nil || quote.Body == nil {
+		return nil
+	}
+	body := quote.Body
+
+	rtmr := make([]string, 0, len(body.GetRtmrs()))
+	for _, r := range body.GetRtmrs() {
+		rtmr = append(rtmr, encode(r))
+	}
+
+	return &TDX{
+		MrTD:          encode(body.GetMrTd()),
+		MrConfigID:    encode(body.GetMrConfigId()),
+		MrOwner:       encode(body.GetMrOwner()),
+		MrOwnerConfig: encode(body.GetMrOwnerConfig()),
+		MrSeam:        encode(body.GetMrSeam()),
+		MrSignerSeam:  encode(body.GetMrSignerSeam()),
+		MrServiceTD:   encode(quote.MrServiceTD),
+		RTMR:          rtmr,
+		TeeTcbSvn:     encode(body.GetTeeTcbSvn()),
+		TeeTcbSvn2:    encode(quote.TeeTcbSvn2),
+		TDAttributes:  encode(body.GetTdAttributes()),
+		XFAM:          encode(body.GetXfam()),
+		ReportData:    encode(body.GetReportData()),
+	}
+}
+
+// FromTPM2Attestation extracts the claims of TPM 2.0 attestation.
+func FromTPM2Attestation(attestation *attest.PlatformParameters) *TPM2 {
+	if attestation == nil {
+		return nil
+	}
+
+	pcrs := make([]string, 24)
+	for _, pcr := range attestation.PCRs {
+		if pcr.DigestAlg != crypto.SHA256 || pcr.Index < 0 || pcr.Index >= len(pcrs) {
+			continue
+		}
+		pcrs[pcr.Index] = encode(pcr.Digest)
+	}
+
+	return &TPM2{
+		PCRs: pcrs,
+	}
+}
+
+// FromSEVSNPAttestation extracts the claims of SEV-SNP attestation report.
+func FromSEVSNPAttestation(attestation *snppb.Attestation) *SEVSNP {
+	report := attestation.GetReport()
+	if report == nil {
+		return nil
+	}
+
+	return &SEVSNP{
+		Measurement:     encode(report.GetMeasurement()),
+		HostData:        encode(report.GetHostData()),
+		IDKeyDigest:     encode(report.GetIdKeyDigest()),
+		AuthorKeyDigest: encode(report.GetAuthorKeyDigest()),
+		FamilyID:        encode(report.GetFamilyId()),
+		ImageID:         encode(report.GetImageId()),
+		ReportData:      encode(report.GetReportData()),
+		ChipID:          encode(report.GetChipId()),
+		Policy:          int64(report.GetPolicy()),
+		GuestSVN:        int64(report.GetGuestSvn()),
+		VMPL:            int64(report.GetVmpl()),
+		CurrentTCB:      int64(report.GetCurrentTcb()),
+		ReportedTCB:     int64(report.GetReportedTcb()),
+	}
+}
+
+// FromSGXQuote extracts the claims of SGX quote.
+func FromSGXQuote(quote *sgx.Quote) *SGX {
+	if quote == nil {
+		return nil
+	}
+
+	return &SGX{
+		MrEnclave:  encode(quote.Body.MrEnclave),
+		MrSigner:   encode(quote.Body.MrSigner),
+		IsvProdID:  int64(quote.Body.IsvProdID),
+		IsvSVN:     int64(quote.Body.IsvSVN),
+		Attributes: encode(quote.Body.Attributes),
+		ReportData: encode(quote.Body.ReportData),
+	}
+}
+
+// FromCCAToken extracts the claims of CCA attestation token.
+func FromCCAToken(token *cca.Token) *CCA {
+	if token == nil {
+		return nil
+	}
+
+	rems := make([]string, 0, len(token.Realm.ExtensibleMeasurements))
+	for _, rem := range token.Realm.ExtensibleMeasurements {
+		rems = append(rems, encode(rem))
+	}
+
+	return &CCA{
+		RealmInitialMeasurement:     encode(token.Realm.InitialMeasurement),
+		RealmExtensibleMeasurements: rems,
+		RealmPersonalizationValue:   encode(token.Realm.PersonalizationValue),
+		RealmHashAlgorithm:          token.Realm.HashAlgorithm,
+		RealmPublicKey:              encode(token.Realm.PublicKey),
+		PlatformImplementationID:    encode(token.Platform.ImplementationID),
+		PlatformInstanceID:          encode(token.Platform.InstanceID),
+		PlatformLifeCycle:           int64(token.Platform.LifeCycle),
+		PlatformProfile:             token.Platform.Profile,
+	}
+}
+
+// FromNitroDocument extracts the claims of AWS Nitro Enclaves attestation
+// document.
+func FromNitroDocument(doc *nitro.Document) *Nitro {
+	if doc == nil {
+		return nil
+	}
+
+	pcrs := make([]string, 32)
+	for idx, pcr := range doc.PCRs {
+		if idx >= uint(len(pcrs)) {
+			continue
+		}
+		pcrs[idx] = encode(pcr)
+	}
+
+	return &Nitro{
+		ModuleID:  doc.ModuleID,
+		Digest:    doc.Digest,
+		PublicKey: encode(doc.PublicKey),
+		UserData:  encode(doc.UserData),
+		PCRs:      pcrs,
+	}
+}
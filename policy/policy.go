@@ -0,0 +1,204 @@
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+
+	celast "github.com/google/cel-go/common/ast"
+)
+
+// Policy is the CEL expression over the attestation claims that trusted
+// domain must satisfy (in addition to the fixed expectations).
+//
+// The expression is evaluated with `claims` variable (see Claims), and with
+// every named list of values as a variable of `list(string)` type, e.g.:
+//
+//	claims.tdx.rtmr[3] in allowed_rtmr3
+type Policy struct {
+	// Expression is the CEL expression that must evaluate to true.
+	Expression string `json:"expression"`
+
+	// Values are the named lists of values that expression can refer to.
+	Values map[string][]string `json:"values,omitempty"`
+}
+
+const (
+	// costLimit caps the runtime cost of a single evaluation.
+	costLimit = 1000000
+
+	varClaims = "claims"
+)
+
+var (
+	errPolicyInvalidValuesName = errors.New("invalid name of policy values")
+	errPolicyNotBool           = errors.New("policy expression must evaluate to bool")
+	errPolicyRejected          = errors.New("policy expression evaluated to false")
+)
+
+var (
+	regexpValuesName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+)
+
+// Compile parses and type-checks the policy expression.
+func (p *Policy) Compile() (cel.Program, error) {
+	env, ast, err := p.check()
+	if err != nil {
+		return nil, err
+	}
+
+	return env.Program(ast, cel.CostLimit(costLimit))
+}
+
+// References returns the names of the values that the policy expression
+// refers to (sorted).
+func (p *Policy) References() ([]string, error) {
+	_, ast, err := p.check()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0, len(p.Values))
+	for _, ref := range ast.NativeRep().ReferenceMap() {
+		if _, isValues := p.Values[ref.Name]; isValues && !slices.Contains(res, ref.Name) {
+			res = append(res, ref.Name)
+		}
+	}
+	sort.Strings(res)
+
+	return res, nil
+}
+
+// SelectsTDXTCBStatus reports whether the policy expression refers to the tcb
+// status of tdx quote (i.e. to `claims.tdx.tcb_status`).
+func (p *Policy) SelectsTDXTCBStatus() (bool, error) {
+	_, ast, err := p.check()
+	if err != nil {
+		return false, err
+	}
+
+	return selectsTDXTCBStatus(ast), nil
+}
+
+// selectsTDXTCBStatus reports whether checked expression selects
+// `tcb_status` of `tdx` claims.
+func selectsTDXTCBStatus(ast *cel.Ast) bool {
+	selects := celast.MatchDescendants(
+		celast.NavigateAST(ast.NativeRep()),
+		celast.KindMatcher(celast.SelectKind),
+	)
+	for _, expr := range selects {
+		sel := expr.AsSelect()
+		if sel.FieldName() != "tcb_status" || sel.Operand().Kind() != celast.SelectKind {
+			continue
+		}
+		if sel.Operand().AsSelect().FieldName() == "tdx" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check parses and type-checks the policy expression, and returns it together
+// with the environment it was checked in.
+func (p *Policy) check() (*cel.Env, *cel.Ast, error) {
+	opts := []cel.EnvOption{
+		ext.NativeTypes(
+			reflect.TypeOf(&Claims{}),
+			ext.ParseStructTags(true),
+		),
+		cel.Variable(varClaims, cel.ObjectType("policy.Claims")),
+	}
+
+	names := make([]string, 0, len(p.Values))
+	for name := range p.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if name == varClaims || !regexpValuesName.MatchString(name) {
+			return nil, nil, fmt.Errorf("%w: %s", errPolicyInvalidValuesName, name)
+		}
+		opts = append(opts, cel.Variable(name, cel.ListType(cel.StringType)))
+	}
+
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ast, issues := env.Compile(p.Expression)
+	if issues != nil && issues.Err() != nil {
+		return nil, nil, issues.Err()
+	}
+	if !ast.OutputType().IsExactType(cel.BoolType) {
+		return nil, nil, fmt.Errorf("%w: %s",
+			errPolicyNotBool, ast.OutputType(),
+		)
+	}
+
+	return env, ast, nil
+}
+
+// Evaluate verifies that the claims satisfy the policy.
+func (p *Policy) Evaluate(claims *Claims) error {
+	prg, err := p.Compile()
+	if err != nil {
+		return err
+	}
+
+	return p.eval(prg, claims)
+}
+
+// fingerprint identifies the program that the policy compiles into (it
+// depends on the expression and on the names of the values, but not on the
+// values themselves).
+func (p *Policy) fingerprint() string {
+	names := make([]string, 0, len(p.Values))
+	for name := range p.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	h.Write([]byte(p.Expression))
+	for _, name := range names {
+		h.Write([]byte{0})
+		h.Write([]byte(name))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// eval evaluates compiled program of the policy against the claims.
+func (p *Policy) eval(prg cel.Program, claims *Claims) error {
+	vars := make(map[string]interface{}, len(p.Values)+1)
+	for name, values := range p.Values {
+		vars[name] = values
+	}
+	vars[varClaims] = claims
+
+	res, _, err := prg.Eval(vars)
+	if err != nil {
+		return err
+	}
+
+	ok, isBool := res.Value().(bool)
+	if !isBool {
+		return fmt.Errorf("%w: %s", errPolicyNotBool, res.Type())
+	}
+	if !ok {
+		return errPolicyRejected
+	}
+
+	return nil
+}
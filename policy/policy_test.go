@@ -0,0 +1,122 @@
+package policy_test
+
+import (
+	"testing"
+
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompile(t *testing.T) {
+	{ // valid
+		p := &policy.Policy{
+			Expression: `claims.tdx.rtmr[3] in allowed_rtmr3 && claims.tpm2.pcrs[7] == "AAAA"`,
+			Values:     map[string][]string{"allowed_rtmr3": {"AAAA"}},
+		}
+		_, err := p.Compile()
+		assert.NoError(t, err)
+	}
+
+	{ // unknown claim
+		p := &policy.Policy{Expression: `claims.tdx.rtmr4 == ""`}
+		_, err := p.Compile()
+		assert.Error(t, err)
+	}
+
+	{ // unknown values
+		p := &policy.Policy{Expression: `claims.tdx.mr_td in allowed_mr_td`}
+		_, err := p.Compile()
+		assert.Error(t, err)
+	}
+
+	{ // not bool
+		p := &policy.Policy{Expression: `claims.tdx.mr_td`}
+		_, err := p.Compile()
+		assert.Error(t, err)
+	}
+
+	{ // invalid values name
+		p := &policy.Policy{
+			Expression: `true`,
+			Values:     map[string][]string{"claims": {}},
+		}
+		_, err := p.Compile()
+		assert.Error(t, err)
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	p := &policy.Policy{
+		Expression: `claims.tdx.rtmr[3] in allowed_rtmr3 && claims.sgx.isv_svn >= 2`,
+		Values:     map[string][]string{"allowed_rtmr3": {"AAAA", "BBBB"}},
+	}
+
+	claims := &policy.Claims{
+		TDX: &policy.TDX{RTMR: []string{"", "", "", "BBBB"}},
+		SGX: &policy.SGX{IsvSVN: 2},
+	}
+	assert.NoError(t, p.Evaluate(claims))
+
+	claims.TDX.RTMR[3] = "CCCC"
+	assert.Error(t, p.Evaluate(claims))
+
+	claims.SGX = nil
+	claims.TDX.RTMR[3] = "AAAA"
+	assert.Error(t, p.Evaluate(claims))
+}
+
+func TestTDXTCB(t *testing.T) {
+	{ // tcb status
+		p := &policy.Policy{Expression: `claims.tdx.tcb_status == "UpToDate"`}
+
+		selects, err := p.SelectsTDXTCBStatus()
+		assert.NoError(t, err)
+		assert.True(t, selects)
+
+		claims := &policy.Claims{TDX: &policy.TDX{TCBStatus: "UpToDate"}}
+		assert.NoError(t, p.Evaluate(claims))
+
+		claims.TDX.TCBStatus = "OutOfDate"
+		assert.Error(t, p.Evaluate(claims))
+	}
+
+	{ // tcb status is only fetched for the policies that refer to it
+		p := &policy.Policy{Expression: `claims.tdx.mr_td != "tcb_status"`}
+
+		selects, err := p.SelectsTDXTCBStatus()
+		assert.NoError(t, err)
+		assert.False(t, selects)
+	}
+
+	{ // tee_tcb_svn is checked against the allowed ones instead
+		p := &policy.Policy{
+			Expression: `claims.tdx.tee_tcb_svn in allowed_tee_tcb_svn`,
+			Values:     map[string][]string{"allowed_tee_tcb_svn": {"AwEFAAAAAAAAAAAAAAAAAA=="}},
+		}
+
+		claims := &policy.Claims{TDX: &policy.TDX{TeeTcbSvn: "AwEFAAAAAAAAAAAAAAAAAA=="}}
+		assert.NoError(t, p.Evaluate(claims))
+
+		claims.TDX.TeeTcbSvn = "AwEEAAAAAAAAAAAAAAAAAA=="
+		assert.Error(t, p.Evaluate(claims))
+	}
+}
+
+func TestReferences(t *testing.T) {
+	p := &policy.Policy{
+		Expression: `claims.tdx.rtmr[3] in tdx_rtmr3 && (claims.tdx.mr_td in tdx_mr_td || claims.tdx.mr_td in tdx_mr_td)`,
+		Values: map[string][]string{
+			"tdx_rtmr3":  {"AAAA"},
+			"tdx_mr_td":  {"BBBB"},
+			"tdx_unused": {"CCCC"},
+		},
+	}
+
+	references, err := p.References()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tdx_mr_td", "tdx_rtmr3"}, references)
+
+	p.Expression = `claims.tdx.mr_td in tdx_missing`
+	_, err = p.References()
+	assert.Error(t, err)
+}
@@ -0,0 +1,211 @@
+package refvalues
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// For the reference see draft-ietf-rats-corim (Concise Reference Integrity
+// Manifest).
+const (
+	tagCOSESign1 = 18
+	tagCoRIM     = 501
+	tagCoMID     = 506
+
+	keyCoRIMTags = 1
+
+	keyCoMIDTriples = 4
+
+	keyTriplesReferenceValues = 0
+
+	keyMeasurementKey    = 0
+	keyMeasurementValues = 1
+
+	keyValuesDigests            = 2
+	keyValuesIntegrityRegisters = 14
+)
+
+var (
+	errCoRIMInvalid            = errors.New("invalid corim")
+	errCoRIMUnexpectedTag      = errors.New("unexpected corim tag")
+	errCoRIMInvalidMeasurement = errors.New("invalid corim measurement")
+	errCoRIMMissingDigests     = errors.New("corim measurement has no digests")
+)
+
+// ParseCoRIM parses the reference values of CBOR-encoded CoRIM (tagged or
+// untagged, signed or unsigned), and returns the reference values of all of
+// its CoMID tags.
+//
+// The measurements are named by their keys (`mkey`), where unsigned integer
+// keys are treated as the indices of TPM 2.0 PCRs, and text keys are the names
+// of the registers (e.g. `MRTD`, or `RTMR2`). The digests of integrity
+// registers are named by the keys of the registers the same way.
+//
+// The signature of signed CoRIM is not verified.
+func ParseCoRIM(data []byte) ([]*Entry, error) {
+	var corim interface{}
+	if err := cbor.Unmarshal(data, &corim); err != nil {
+		return nil, fmt.Errorf("%w: %w", errCoRIMInvalid, err)
+	}
+
+	if tag, ok := corim.(cbor.Tag); ok && tag.Number == tagCOSESign1 {
+		msg, ok := tag.Content.([]interface{})
+		if !ok || len(msg) != 4 {
+			return nil, fmt.Errorf("%w: malformed cose_sign1", errCoRIMInvalid)
+		}
+		payload, ok := msg[2].([]byte)
+		if !ok {
+			return nil, fmt.Errorf("%w: cose_sign1 has no payload", errCoRIMInvalid)
+		}
+		if err := cbor.Unmarshal(payload, &corim); err != nil {
+			return nil, fmt.Errorf("%w: %w", errCoRIMInvalid, err)
+		}
+	}
+
+	if tag, ok := corim.(cbor.Tag); ok {
+		if tag.Number != tagCoRIM {
+			return nil, fmt.Errorf("%w: %d != %d",
+				errCoRIMUnexpectedTag, tag.Number, tagCoRIM,
+			)
+		}
+		corim = tag.Content
+	}
+
+	corimMap, ok := corim.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: not a map", errCoRIMInvalid)
+	}
+
+	tags, ok := lookup(corimMap, keyCoRIMTags).([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: no tags", errCoRIMInvalid)
+	}
+
+	entries := make([]*Entry, 0)
+	for _, t := range tags {
+		tag, ok := t.(cbor.Tag)
+		if !ok || tag.Number != tagCoMID {
+			continue // coswid, cotl, ...
+		}
+		raw, ok := tag.Content.([]byte)
+		if !ok {
+			return nil, fmt.Errorf("%w: comid is not a byte string", errCoRIMInvalid)
+		}
+		comid, err := parseCoMID(raw)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, comid...)
+	}
+
+	return entries, nil
+}
+
+func parseCoMID(raw []byte) ([]*Entry, error) {
+	var comid map[interface{}]interface{}
+	if err := cbor.Unmarshal(raw, &comid); err != nil {
+		return nil, fmt.Errorf("%w: comid: %w", errCoRIMInvalid, err)
+	}
+
+	triples, _ := lookup(comid, keyCoMIDTriples).(map[interface{}]interface{})
+	records, _ := lookup(triples, keyTriplesReferenceValues).([]interface{})
+
+	entries := make([]*Entry, 0)
+	for _, r := range records {
+		record, ok := r.([]interface{})
+		if !ok || len(record) != 2 {
+			return nil, fmt.Errorf("%w: malformed reference triple", errCoRIMInvalid)
+		}
+		measurements, ok := record[1].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed reference triple", errCoRIMInvalid)
+		}
+		for _, m := range measurements {
+			entries = append(entries, parseCoRIMMeasurement(m)...)
+		}
+	}
+
+	return entries, nil
+}
+
+func parseCoRIMMeasurement(m interface{}) []*Entry {
+	measurement, ok := m.(map[interface{}]interface{})
+	if !ok {
+		return []*Entry{{Err: errCoRIMInvalidMeasurement}}
+	}
+
+	name := coRIMName(lookup(measurement, keyMeasurementKey))
+
+	values, ok := lookup(measurement, keyMeasurementValues).(map[interface{}]interface{})
+	if !ok {
+		return []*Entry{{Name: name, Err: errCoRIMInvalidMeasurement}}
+	}
+
+	entries := make([]*Entry, 0)
+
+	if digests, ok := lookup(values, keyValuesDigests).([]interface{}); ok {
+		entries = append(entries, parseCoRIMDigests(name, digests)...)
+	}
+
+	if registers, ok := lookup(values, keyValuesIntegrityRegisters).(map[interface{}]interface{}); ok {
+		for key, d := range registers {
+			digests, _ := d.([]interface{})
+			entries = append(entries, parseCoRIMDigests(coRIMName(key), digests)...)
+		}
+	}
+
+	if len(entries) == 0 {
+		return []*Entry{{Name: name, Err: errCoRIMMissingDigests}}
+	}
+
+	return entries
+}
+
+func parseCoRIMDigests(name string, digests []interface{}) []*Entry {
+	if len(digests) == 0 {
+		return []*Entry{{Name: name, Err: errCoRIMMissingDigests}}
+	}
+
+	entries := make([]*Entry, 0, len(digests))
+	for _, d := range digests {
+		digest, ok := d.([]interface{}) // [alg, value]
+		if !ok || len(digest) != 2 {
+			entries = append(entries, &Entry{Name: name, Err: errEntryInvalidDigest})
+			continue
+		}
+		value, ok := digest[1].([]byte)
+		if !ok {
+			entries = append(entries, &Entry{Name: name, Err: errEntryInvalidDigest})
+			continue
+		}
+		entries = append(entries, newEntry(name, value))
+	}
+
+	return entries
+}
+
+// coRIMName returns the name of the measurement (or of the register) by its
+// key.
+func coRIMName(key interface{}) string {
+	switch k := key.(type) {
+	case uint64:
+		return "pcr" + strconv.FormatUint(k, 10)
+	case string:
+		return k
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", k)
+	}
+}
+
+// lookup returns the value of the map by its integer key.
+func lookup(m map[interface{}]interface{}, key uint64) interface{} {
+	if m == nil {
+		return nil
+	}
+	return m[key]
+}
@@ -0,0 +1,130 @@
+package refvalues
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Entry is the reference value (i.e. the expected digest of a measurement)
+// found in the imported document.
+type Entry struct {
+	// Name is the name of the measurement as it appears in the document.
+	Name string
+
+	// Field is the name of trusted domain configuration field that the
+	// measurement maps onto (e.g. `tdx_mr_td`, or `tpm2_pcr07`).
+	Field string
+
+	// Digest is the expected value of the measurement.
+	Digest []byte
+
+	// Err is the reason why the entry can not be imported (if it can't).
+	Err error
+}
+
+type field struct {
+	name string
+	size int
+}
+
+var (
+	errEntryUnknownMeasurement = errors.New("measurement does not map onto any field")
+	errEntryInvalidDigest      = errors.New("invalid digest")
+	errEntryUnexpectedSize     = errors.New("unexpected digest size")
+)
+
+// fields maps normalised measurement names onto trusted domain fields.
+var fields = func() map[string]field {
+	res := map[string]field{
+		"mrtd":          {"tdx_mr_td", 48},
+		"mrconfigid":    {"tdx_mr_config_id", 48},
+		"mrowner":       {"tdx_mr_owner", 48},
+		"mrownerconfig": {"tdx_mr_owner_config", 48},
+		"mrservicetd":   {"tdx_mr_service_td", 48},
+	}
+	for idx := 0; idx < 4; idx++ {
+		res[fmt.Sprintf("rtmr%d", idx)] = field{fmt.Sprintf("tdx_rtmr%d", idx), 48}
+	}
+	for idx := 0; idx < 24; idx++ {
+		res[fmt.Sprintf("pcr%d", idx)] = field{fmt.Sprintf("tpm2_pcr%02d", idx), 32}
+	}
+	return res
+}()
+
+// normalise reduces the measurement name to its canonical form, i.e.
+// `tdx.quote.body.mr_td` becomes `mrtd`, and `PCR 07` becomes `pcr7`.
+func normalise(name string) string {
+	if idx := strings.LastIndex(name, "."); idx >= 0 {
+		name = name[idx+1:]
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		}
+	}
+	name = b.String()
+
+	// strip leading zeroes of register indices
+	prefix := strings.TrimRight(name, "0123456789")
+	if suffix := name[len(prefix):]; suffix != "" {
+		if idx, err := strconv.Atoi(suffix); err == nil {
+			name = prefix + strconv.Itoa(idx)
+		}
+	}
+
+	return name
+}
+
+// newEntry maps the measurement onto trusted domain field, and validates the
+// digest.
+func newEntry(name string, digest []byte) *Entry {
+	e := &Entry{
+		Name:   name,
+		Digest: digest,
+	}
+
+	f, ok := fields[normalise(name)]
+	if !ok {
+		e.Err = errEntryUnknownMeasurement
+		return e
+	}
+	e.Field = f.name
+
+	if len(digest) != f.size {
+		e.Err = fmt.Errorf("%w: %d != %d", errEntryUnexpectedSize, len(digest), f.size)
+	}
+
+	return e
+}
+
+// newEntryFromString decodes hex- or base64-encoded digest, and maps the
+// measurement onto trusted domain field.
+func newEntryFromString(name, digest string) *Entry {
+	if _, known := fields[normalise(name)]; !known {
+		return newEntry(name, nil)
+	}
+
+	var fromHex *Entry
+	if decoded, err := hex.DecodeString(digest); err == nil {
+		if fromHex = newEntry(name, decoded); fromHex.Err == nil {
+			return fromHex
+		}
+	}
+	if decoded, err := base64.StdEncoding.DecodeString(digest); err == nil {
+		return newEntry(name, decoded)
+	}
+	if fromHex != nil {
+		return fromHex
+	}
+
+	return &Entry{
+		Name: name,
+		Err:  fmt.Errorf("%w: neither hex nor base64", errEntryInvalidDigest),
+	}
+}
@@ -0,0 +1,146 @@
+package refvalues_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/refvalues"
+	"github.com/fxamacker/cbor/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func byField(entries []*refvalues.Entry) map[string][][]byte {
+	res := map[string][][]byte{}
+	for _, e := range entries {
+		if e.Err == nil {
+			res[e.Field] = append(res[e.Field], e.Digest)
+		}
+	}
+	return res
+}
+
+func TestParseRVPS(t *testing.T) {
+	mrtd := bytes.Repeat([]byte{0x01}, 48)
+	pcr7 := bytes.Repeat([]byte{0x07}, 32)
+
+	{ // sample message
+		payload := fmt.Sprintf(`{"mr_td": ["%s", "%s"], "PCR07": ["%s"], "foo": ["bar"]}`,
+			hex.EncodeToString(mrtd),
+			base64.StdEncoding.EncodeToString(mrtd[:47]),
+			base64.StdEncoding.EncodeToString(pcr7),
+		)
+		msg := fmt.Sprintf(`{"version": "0.1.0", "type": "sample", "payload": "%s"}`,
+			base64.StdEncoding.EncodeToString([]byte(payload)),
+		)
+
+		entries, err := refvalues.ParseRVPS([]byte(msg), now)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 4)
+
+		fields := byField(entries)
+		assert.Equal(t, [][]byte{mrtd}, fields["tdx_mr_td"])
+		assert.Equal(t, [][]byte{pcr7}, fields["tpm2_pcr07"])
+		assert.Len(t, fields, 2)
+	}
+
+	{ // stored reference values
+		rvs := fmt.Sprintf(`[
+			{"version": "0.1.0", "name": "tdx.quote.body.rtmr_2", "expiration": "2025-01-01T00:00:00Z", "hash-value": [{"alg": "sha384", "value": "%s"}]},
+			{"version": "0.1.0", "name": "tdx.quote.body.rtmr_3", "expiration": "2023-01-01T00:00:00Z", "hash-value": [{"alg": "sha384", "value": "%s"}]}
+		]`, hex.EncodeToString(mrtd), hex.EncodeToString(mrtd))
+
+		entries, err := refvalues.ParseRVPS([]byte(rvs), now)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 2)
+		assert.NoError(t, entries[0].Err)
+		assert.Equal(t, "tdx_rtmr2", entries[0].Field)
+		assert.Error(t, entries[1].Err)
+	}
+
+	{ // unsupported provenance
+		_, err := refvalues.ParseRVPS([]byte(`{"version": "0.1.0", "type": "in-toto", "payload": ""}`), now)
+		assert.Error(t, err)
+	}
+}
+
+func TestParseCoRIM(t *testing.T) {
+	mrtd := bytes.Repeat([]byte{0x01}, 48)
+	rtmr0 := bytes.Repeat([]byte{0x02}, 48)
+	pcr4 := bytes.Repeat([]byte{0x04}, 32)
+
+	comid, err := cbor.Marshal(map[uint64]interface{}{
+		1: map[uint64]interface{}{0: "comid"},
+		4: map[uint64]interface{}{
+			0: []interface{}{
+				[]interface{}{
+					map[uint64]interface{}{}, // environment
+					[]interface{}{
+						map[uint64]interface{}{
+							0: "MRTD",
+							1: map[uint64]interface{}{
+								2: []interface{}{[]interface{}{7, mrtd}},
+							},
+						},
+						map[uint64]interface{}{
+							0: uint64(4),
+							1: map[uint64]interface{}{
+								2: []interface{}{[]interface{}{1, pcr4}},
+							},
+						},
+						map[uint64]interface{}{
+							1: map[uint64]interface{}{
+								14: map[interface{}]interface{}{
+									"RTMR0": []interface{}{[]interface{}{7, rtmr0}},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	})
+	assert.NoError(t, err)
+
+	corim, err := cbor.Marshal(cbor.Tag{
+		Number: 501,
+		Content: map[uint64]interface{}{
+			0: "corim",
+			1: []interface{}{cbor.Tag{Number: 506, Content: comid}},
+		},
+	})
+	assert.NoError(t, err)
+
+	entries, err := refvalues.ParseCoRIM(corim)
+	assert.NoError(t, err)
+
+	fields := byField(entries)
+	assert.Equal(t, [][]byte{mrtd}, fields["tdx_mr_td"])
+	assert.Equal(t, [][]byte{rtmr0}, fields["tdx_rtmr0"])
+	assert.Equal(t, [][]byte{pcr4}, fields["tpm2_pcr04"])
+
+	{ // signed
+		signed, err := cbor.Marshal(cbor.Tag{
+			Number:  18,
+			Content: []interface{}{[]byte{}, map[interface{}]interface{}{}, corim, []byte{}},
+		})
+		assert.NoError(t, err)
+
+		entries, err := refvalues.ParseCoRIM(signed)
+		assert.NoError(t, err)
+		assert.Len(t, entries, 3)
+	}
+
+	{ // not a corim
+		notCoRIM, err := cbor.Marshal(cbor.Tag{Number: 399, Content: map[uint64]interface{}{}})
+		assert.NoError(t, err)
+
+		_, err = refvalues.ParseCoRIM(notCoRIM)
+		assert.Error(t, err)
+	}
+}
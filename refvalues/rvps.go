@@ -0,0 +1,155 @@
+package refvalues
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// rvpsMessage is the message that registers reference values with CoCo RVPS.
+type rvpsMessage struct {
+	Version string `json:"version"`
+	Type    string `json:"type"`
+	Payload string `json:"payload"`
+}
+
+// rvpsReferenceValue is the reference value as it is stored (and served) by
+// CoCo RVPS.
+type rvpsReferenceValue struct {
+	Version    string          `json:"version"`
+	Name       string          `json:"name"`
+	Expiration time.Time       `json:"expiration"`
+	HashValue  []rvpsHashValue `json:"hash-value"`
+	Value      json.RawMessage `json:"value"`
+}
+
+type rvpsHashValue struct {
+	Alg   string `json:"alg"`
+	Value string `json:"value"`
+}
+
+const (
+	rvpsTypeSample = "sample"
+)
+
+var (
+	errRVPSInvalid              = errors.New("invalid rvps reference values")
+	errRVPSUnsupportedType      = errors.New("unsupported rvps provenance type")
+	errRVPSExpired              = errors.New("reference value is expired")
+	errRVPSUnsupportedValue     = errors.New("unsupported reference value")
+	errRVPSInvalidSamplePayload = errors.New("invalid rvps sample payload")
+)
+
+// ParseRVPS parses the reference values in Confidential Containers RVPS JSON
+// formats, that is either:
+//
+//   - the message that registers reference values (`sample` provenance type,
+//     with base64-encoded payload);
+//
+//   - the decoded payload of such message (i.e. the object that maps the
+//     names onto the lists of values);
+//
+//   - the list of the reference values as they are stored by RVPS (with
+//     `name`, `expiration` and `hash-value`, or `value`).
+func ParseRVPS(data []byte, now time.Time) ([]*Entry, error) {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '[' {
+		rvs := []rvpsReferenceValue{}
+		if err := json.Unmarshal(data, &rvs); err != nil {
+			return nil, fmt.Errorf("%w: %w", errRVPSInvalid, err)
+		}
+		return parseRVPSReferenceValues(rvs, now), nil
+	}
+
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%w: %w", errRVPSInvalid, err)
+	}
+
+	if _, isMessage := raw["payload"]; isMessage {
+		msg := rvpsMessage{}
+		if err := json.Unmarshal(data, &msg); err != nil {
+			return nil, fmt.Errorf("%w: %w", errRVPSInvalid, err)
+		}
+		if msg.Type != rvpsTypeSample {
+			return nil, fmt.Errorf("%w: %s", errRVPSUnsupportedType, msg.Type)
+		}
+		payload, err := base64.StdEncoding.DecodeString(msg.Payload)
+		if err != nil {
+			payload = []byte(msg.Payload) // payload can be plain json too
+		}
+		raw = map[string]json.RawMessage{}
+		if err := json.Unmarshal(payload, &raw); err != nil {
+			return nil, fmt.Errorf("%w: %w", errRVPSInvalidSamplePayload, err)
+		}
+	}
+
+	return parseRVPSSample(raw), nil
+}
+
+func parseRVPSSample(raw map[string]json.RawMessage) []*Entry {
+	names := make([]string, 0, len(raw))
+	for name := range raw {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	entries := make([]*Entry, 0, len(raw))
+	for _, name := range names {
+		entries = append(entries, parseRVPSValue(name, raw[name])...)
+	}
+
+	return entries
+}
+
+func parseRVPSReferenceValues(rvs []rvpsReferenceValue, now time.Time) []*Entry {
+	entries := make([]*Entry, 0, len(rvs))
+	for _, rv := range rvs {
+		if !rv.Expiration.IsZero() && !now.Before(rv.Expiration) {
+			entries = append(entries, &Entry{
+				Name: rv.Name,
+				Err: fmt.Errorf("%w: %s",
+					errRVPSExpired, rv.Expiration.UTC().Format(time.RFC3339),
+				),
+			})
+			continue
+		}
+
+		for _, hv := range rv.HashValue {
+			entries = append(entries, newEntryFromString(rv.Name, hv.Value))
+		}
+		if len(rv.Value) > 0 {
+			entries = append(entries, parseRVPSValue(rv.Name, rv.Value)...)
+		}
+	}
+
+	return entries
+}
+
+// parseRVPSValue parses the value that is either a string, or a list of
+// strings.
+func parseRVPSValue(name string, raw json.RawMessage) []*Entry {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return []*Entry{newEntryFromString(name, value)}
+	}
+
+	var values []string
+	if err := json.Unmarshal(raw, &values); err == nil {
+		entries := make([]*Entry, 0, len(values))
+		for _, value := range values {
+			entries = append(entries, newEntryFromString(name, value))
+		}
+		return entries
+	}
+
+	return []*Entry{{
+		Name: name,
+		Err:  errRVPSUnsupportedValue,
+	}}
+}
@@ -0,0 +1,340 @@
+package sevsnp
+
+import (
+	"crypto/subtle"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
+
+	snpabi "github.com/google/go-sev-guest/abi"
+	snp "github.com/google/go-sev-guest/client"
+	snpkds "github.com/google/go-sev-guest/kds"
+	snppb "github.com/google/go-sev-guest/proto/sevsnp"
+	snpverify "github.com/google/go-sev-guest/verify"
+	snptrust "github.com/google/go-sev-guest/verify/trust"
+)
+
+// SEVSNP reflects our expectations about AMD SEV-SNP trusted domain.
+//
+// For the reference see AMD SEV Secure Nested Paging Firmware ABI
+// Specification (rev 1.55, 2023/09).
+//
+// See also:
+//
+//   - https://www.amd.com/content/dam/amd/en/documents/epyc-technical-docs/specifications/56860.pdf
+//   - https://www.amd.com/content/dam/amd/en/documents/epyc-technical-docs/specifications/57230.pdf
+type SEVSNP struct {
+	tokenutil.TokenParams `mapstructure:"-" structs:"-"`
+
+	// Name is the name of trusted domain.
+	Name string `json:"-" mapstructure:"-" structs:"-"`
+
+	// TOTPSecret is the secret used to generate initial TOTP codes.
+	TOTPSecret string `json:"totp_secret" mapstructure:"totp_secret" structs:"totp_secret"`
+
+	// Measurement is the expected launch digest of the guest (MEASUREMENT).
+	Measurement *types.Byte48 `json:"sevsnp_measurement,omitempty" mapstructure:"sevsnp_measurement,omitempty" structs:"sevsnp_measurement,omitempty"`
+
+	// HostData is the expected data provided by the hypervisor at launch
+	// (HOST_DATA).
+	HostData *types.Byte32 `json:"sevsnp_host_data,omitempty" mapstructure:"sevsnp_host_data,omitempty" structs:"sevsnp_host_data,omitempty"`
+
+	// IDKeyDigest is the expected SHA384 digest of the ID public key that
+	// signed the ID block provided at launch (ID_KEY_DIGEST).
+	IDKeyDigest *types.Byte48 `json:"sevsnp_id_key_digest,omitempty" mapstructure:"sevsnp_id_key_digest,omitempty" structs:"sevsnp_id_key_digest,omitempty"`
+
+	// CheckDebug indicates whether POLICY.DEBUG == 0 is verified.
+	//
+	// POLICY.DEBUG defines whether the host is allowed to debug the guest
+	// (i.e. to decrypt its memory and state).
+	CheckDebug bool `json:"sevsnp_check_debug" mapstructure:"sevsnp_check_debug" structs:"sevsnp_check_debug"`
+
+	// CheckMigrateMA indicates whether POLICY.MIGRATE_MA == 0 is verified.
+	//
+	// POLICY.MIGRATE_MA defines whether the guest is allowed to be associated
+	// with a migration agent (that can export its memory and state).
+	CheckMigrateMA bool `json:"sevsnp_check_migrate_ma" mapstructure:"sevsnp_check_migrate_ma" structs:"sevsnp_check_migrate_ma"`
+
+	// MinTCBBootloader is the minimum bootloader SPL of REPORTED_TCB.
+	MinTCBBootloader uint8 `json:"sevsnp_min_tcb_bootloader" mapstructure:"sevsnp_min_tcb_bootloader" structs:"sevsnp_min_tcb_bootloader"`
+
+	// MinTCBTEE is the minimum PSP OS SPL of REPORTED_TCB.
+	MinTCBTEE uint8 `json:"sevsnp_min_tcb_tee" mapstructure:"sevsnp_min_tcb_tee" structs:"sevsnp_min_tcb_tee"`
+
+	// MinTCBSNP is the minimum SNP firmware SPL of REPORTED_TCB.
+	MinTCBSNP uint8 `json:"sevsnp_min_tcb_snp" mapstructure:"sevsnp_min_tcb_snp" structs:"sevsnp_min_tcb_snp"`
+
+	// MinTCBMicrocode is the minimum microcode SPL of REPORTED_TCB.
+	MinTCBMicrocode uint8 `json:"sevsnp_min_tcb_microcode" mapstructure:"sevsnp_min_tcb_microcode" structs:"sevsnp_min_tcb_microcode"`
+
+	// ASKARK is the PEM-encoded ASK (or ASVK) and ARK certificates that the
+	// VCEK (or VLEK) must chain up to.
+	//
+	// When empty, the ARK/ASK of AMD that are embedded into go-sev-guest are
+	// used.
+	ASKARK string `json:"sevsnp_ask_ark,omitempty" mapstructure:"sevsnp_ask_ark,omitempty" structs:"sevsnp_ask_ark,omitempty"`
+}
+
+var (
+	errSEVSNPReportIsNil            = errors.New("sev-snp report is nil")
+	errSEVSNPReportInvalidPolicy    = errors.New("sev-snp report has invalid policy")
+	errSEVSNPReportMismatchMeasure  = errors.New("sev-snp measurement mismatch")
+	errSEVSNPReportMismatchHostData = errors.New("sev-snp host_data mismatch")
+	errSEVSNPReportMismatchIDKey    = errors.New("sev-snp id_key_digest mismatch")
+	errSEVSNPReportDebugAllowed     = errors.New("sev-snp policy allows debug")
+	errSEVSNPReportMigrateMAAllowed = errors.New("sev-snp policy allows migration agent")
+	errSEVSNPReportTCBBootloader    = errors.New("sev-snp reported tcb bootloader spl is too low")
+	errSEVSNPReportTCBTEE           = errors.New("sev-snp reported tcb tee spl is too low")
+	errSEVSNPReportTCBSNP           = errors.New("sev-snp reported tcb snp spl is too low")
+	errSEVSNPReportTCBMicrocode     = errors.New("sev-snp reported tcb microcode spl is too low")
+	errSEVSNPUnexpectedARK          = errors.New("unexpected sev-snp ark certificate")
+)
+
+// TrustedRoots parses PEM-encoded ASK (or ASVK) and ARK certificates (the
+// format of cert_chain endpoint of AMD KDS) into the trusted roots suitable for
+// go-sev-guest verifier.
+//
+// The product line is derived from the common name of ARK (e.g. "ARK-Milan").
+func TrustedRoots(askArk string) (map[string][]*snptrust.AMDRootCerts, error) {
+	if askArk == "" {
+		return nil, nil
+	}
+
+	var ark *x509.Certificate
+	for rest := []byte(askArk); len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		ark = cert // ark is the last one in the chain
+	}
+	if ark == nil || !strings.HasPrefix(ark.Subject.CommonName, "ARK-") {
+		return nil, errSEVSNPUnexpectedARK
+	}
+	productLine := strings.TrimPrefix(ark.Subject.CommonName, "ARK-")
+
+	root := snptrust.AMDRootCertsProduct(productLine)
+	if err := root.FromKDSCertBytes([]byte(askArk)); err != nil {
+		return nil, err
+	}
+
+	return map[string][]*snptrust.AMDRootCerts{
+		productLine: {root},
+	}, nil
+}
+
+// Verify verifies the signature of the attestation report as well as the
+// chain of its VCEK (or VLEK) certificate up to the pinned ARK.
+//
+// Missing certificates are fetched from AMD KDS using provided getter.
+func (td *SEVSNP) Verify(
+	attestation *snppb.Attestation,
+	getter snptrust.HTTPSGetter,
+	now time.Time,
+) error {
+	roots, err := TrustedRoots(td.ASKARK)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errSEVSNPUnexpectedARK, err)
+	}
+
+	return snpverify.SnpAttestation(attestation, &snpverify.Options{
+		Getter:       getter,
+		Now:          now,
+		TrustedRoots: roots,
+	})
+}
+
+// FromPlatform creates new SEVSNP instance from the parameters of the
+// platform we are currently running on.
+func FromPlatform() (*SEVSNP, error) {
+	provider, err := snp.GetQuoteProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	rawQuote, err := provider.GetRawQuote([globals.SEVSNPNonceSize]byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	attestation, err := snpabi.ReportCertsToProto(rawQuote)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromReport(attestation.Report)
+}
+
+// FromReport creates new SEVSNP instance from the parameters of the
+// attestation report.
+func FromReport(report *snppb.Report) (*SEVSNP, error) {
+	policy, err := snpabi.ParseSnpPolicy(report.Policy)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errSEVSNPReportInvalidPolicy, err)
+	}
+
+	tcb := snpkds.DecomposeTCBVersion(snpkds.TCBVersion(report.ReportedTcb))
+
+	return &SEVSNP{
+		Measurement:      (*types.Byte48)(report.Measurement),
+		HostData:         (*types.Byte32)(report.HostData),
+		IDKeyDigest:      (*types.Byte48)(report.IdKeyDigest),
+		CheckDebug:       !policy.Debug,
+		CheckMigrateMA:   !policy.MigrateMA,
+		MinTCBBootloader: tcb.BlSpl,
+		MinTCBTEE:        tcb.TeeSpl,
+		MinTCBSNP:        tcb.SnpSpl,
+		MinTCBMicrocode:  tcb.UcodeSpl,
+	}, nil
+}
+
+func (td *SEVSNP) MatchesReport(report *snppb.Report) (
+	[]error, []error,
+) {
+	type test struct {
+		expect []byte
+		actual []byte
+		err    error
+	}
+
+	var policy snpabi.SnpPolicy
+
+	{ // pre-flight checks
+		if report == nil {
+			return []error{
+				errSEVSNPReportIsNil,
+			}, nil
+		}
+		var err error
+		policy, err = snpabi.ParseSnpPolicy(report.Policy)
+		if err != nil {
+			return []error{
+				fmt.Errorf("%w: %w", errSEVSNPReportInvalidPolicy, err),
+			}, nil
+		}
+	}
+
+	tests := []test{
+		{ // measurement
+			actual: report.Measurement,
+			err:    errSEVSNPReportMismatchMeasure,
+		},
+		{ // host_data
+			actual: report.HostData,
+			err:    errSEVSNPReportMismatchHostData,
+		},
+		{ // id_key_digest
+			actual: report.IdKeyDigest,
+			err:    errSEVSNPReportMismatchIDKey,
+		},
+	}
+	if td.Measurement != nil {
+		tests[0].expect = td.Measurement[:]
+	}
+	if td.HostData != nil {
+		tests[1].expect = td.HostData[:]
+	}
+	if td.IDKeyDigest != nil {
+		tests[2].expect = td.IDKeyDigest[:]
+	}
+
+	errs := make([]error, 0, len(tests)+6)
+	dump := make([]error, 0, len(tests)+6)
+
+	{ // report fields
+		for _, t := range tests {
+			// make sure the time is constant regardless of the config
+			if t.expect != nil {
+				if subtle.ConstantTimeCompare(t.expect, t.actual) != 1 {
+					errs = append(errs, t.err)
+				} else {
+					errs = append(errs, nil)
+				}
+			} else {
+				dummy := make([]byte, len(t.actual))
+				if subtle.ConstantTimeCompare(dummy, t.actual) != 1 {
+					dump = append(dump, t.err)
+				} else {
+					dump = append(dump, nil)
+				}
+			}
+		}
+	}
+
+	{ // policy
+		if policy.Debug {
+			if td.CheckDebug {
+				errs = append(errs, errSEVSNPReportDebugAllowed)
+			} else {
+				dump = append(dump, errSEVSNPReportDebugAllowed)
+			}
+		}
+
+		if policy.MigrateMA {
+			if td.CheckMigrateMA {
+				errs = append(errs, errSEVSNPReportMigrateMAAllowed)
+			} else {
+				dump = append(dump, errSEVSNPReportMigrateMAAllowed)
+			}
+		}
+	}
+
+	{ // reported tcb
+		tcb := snpkds.DecomposeTCBVersion(snpkds.TCBVersion(report.ReportedTcb))
+
+		if tcb.BlSpl < td.MinTCBBootloader {
+			errs = append(errs, fmt.Errorf("%w: %d < %d",
+				errSEVSNPReportTCBBootloader, tcb.BlSpl, td.MinTCBBootloader,
+			))
+		}
+		if tcb.TeeSpl < td.MinTCBTEE {
+			errs = append(errs, fmt.Errorf("%w: %d < %d",
+				errSEVSNPReportTCBTEE, tcb.TeeSpl, td.MinTCBTEE,
+			))
+		}
+		if tcb.SnpSpl < td.MinTCBSNP {
+			errs = append(errs, fmt.Errorf("%w: %d < %d",
+				errSEVSNPReportTCBSNP, tcb.SnpSpl, td.MinTCBSNP,
+			))
+		}
+		if tcb.UcodeSpl < td.MinTCBMicrocode {
+			errs = append(errs, fmt.Errorf("%w: %d < %d",
+				errSEVSNPReportTCBMicrocode, tcb.UcodeSpl, td.MinTCBMicrocode,
+			))
+		}
+	}
+
+	return errs, dump
+}
+
+func (td *SEVSNP) GetName() string {
+	return td.Name
+}
+
+func (td *SEVSNP) SetName(name string) {
+	td.Name = name
+}
+
+func (td *SEVSNP) AttestationType() string {
+	return "sevsnp"
+}
+
+func (td *SEVSNP) GetTOTPSecret() string {
+	return td.TOTPSecret
+}
+
+func (td *SEVSNP) SetTOTPSecret(totpSecret string) {
+	td.TOTPSecret = totpSecret
+}
@@ -0,0 +1,102 @@
+package sevsnp_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/sevsnp"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/stretchr/testify/assert"
+
+	snpabi "github.com/google/go-sev-guest/abi"
+	snppb "github.com/google/go-sev-guest/proto/sevsnp"
+	snptest "github.com/google/go-sev-guest/testing"
+	snptestdata "github.com/google/go-sev-guest/verify/testdata"
+	snptrust "github.com/google/go-sev-guest/verify/trust"
+)
+
+// recorded on milan machine, see go-sev-guest/verify/testdata
+const (
+	urlMilanCertChain = "https://kdsintf.amd.com/vcek/v1/Milan/cert_chain"
+	urlMilanVCEK      = "https://kdsintf.amd.com/vcek/v1/Milan/3ac3fe21e13fb0990eb28a802e3fb6a29483a6b0753590c951bdd3b8e53786184ca39e359669a2b76a1936776b564ea464cdce40c05f63c9b610c5068b006b5d?blSPL=2&teeSPL=0&snpSPL=5&ucodeSPL=68"
+)
+
+func recordedAttestation(t *testing.T) *snppb.Attestation {
+	report, err := snpabi.ReportToProto(snptestdata.AttestationBytes)
+	assert.NoError(t, err)
+
+	return &snppb.Attestation{
+		Report:           report,
+		CertificateChain: &snppb.CertificateChain{},
+	}
+}
+
+func TestVerify(t *testing.T) {
+	getter := snptest.SimpleGetter(map[string][]byte{
+		urlMilanCertChain: snptrust.AskArkMilanVcekBytes,
+		urlMilanVCEK:      snptestdata.VcekBytes,
+	})
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	{ // embedded ark
+		td := &sevsnp.SEVSNP{}
+		assert.NoError(t, td.Verify(recordedAttestation(t), getter, now))
+	}
+
+	{ // pinned ark
+		td := &sevsnp.SEVSNP{ASKARK: string(snptrust.AskArkMilanVcekBytes)}
+		assert.NoError(t, td.Verify(recordedAttestation(t), getter, now))
+	}
+
+	{ // wrong ark
+		td := &sevsnp.SEVSNP{ASKARK: string(snptrust.AskArkGenoaVcekBytes)}
+		assert.Error(t, td.Verify(recordedAttestation(t), getter, now))
+	}
+
+	{ // tampered report
+		attestation := recordedAttestation(t)
+		attestation.Report.Measurement[0] ^= 0xff
+		td := &sevsnp.SEVSNP{}
+		assert.Error(t, td.Verify(attestation, getter, now))
+	}
+}
+
+func TestMatchesReport(t *testing.T) {
+	report := recordedAttestation(t).Report
+
+	{ // matching measurements
+		td := &sevsnp.SEVSNP{
+			Measurement: (*types.Byte48)(report.Measurement),
+			HostData:    (*types.Byte32)(report.HostData),
+			IDKeyDigest: (*types.Byte48)(report.IdKeyDigest),
+		}
+		reported, _ := td.MatchesReport(report)
+		assert.Empty(t, failures(reported))
+	}
+
+	{ // mismatching measurement
+		td := &sevsnp.SEVSNP{
+			Measurement: &types.Byte48{},
+		}
+		reported, _ := td.MatchesReport(report)
+		assert.Len(t, failures(reported), 1)
+	}
+
+	{ // too low reported tcb
+		td := &sevsnp.SEVSNP{
+			MinTCBMicrocode: 0xff,
+		}
+		reported, _ := td.MatchesReport(report)
+		assert.Len(t, failures(reported), 1)
+	}
+}
+
+func failures(errs []error) []error {
+	res := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+	return res
+}
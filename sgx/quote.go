@@ -0,0 +1,226 @@
+package sgx
+
+import (
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// Quote is the parsed SGX DCAP quote (version 3) with ECDSA-256-with-P-256
+// attestation key.
+//
+// For the reference see Intel SGX ECDSA Quote Library API (rev 1.4, 2021/03),
+// appendix A.4 "Quote Format".
+type Quote struct {
+	Version  uint16
+	QESVN    uint16
+	PCESVN   uint16
+	QEVendor []byte
+
+	Body     ReportBody
+	QEReport ReportBody
+
+	QuoteSignature
+}
+
+// QuoteSignature is the ECDSA quote signature data (together with the data
+// that it signs).
+//
+// Its contents are the same for SGX and for TDX quotes, only the layout of the
+// encoding differs.
+type QuoteSignature struct {
+	Signed []byte // header || report body
+
+	Signature      []byte
+	AttestationKey []byte
+
+	QEReportRaw       []byte
+	QEReportSignature []byte
+	QEAuthData        []byte
+
+	PCKChain []*x509.Certificate
+}
+
+// ReportBody is the SGX enclave report (as in SGX_REPORT_BODY).
+type ReportBody struct {
+	CPUSVN     []byte
+	MiscSelect uint32
+	Attributes []byte
+	MrEnclave  []byte
+	MrSigner   []byte
+	IsvProdID  uint16
+	IsvSVN     uint16
+	ReportData []byte
+}
+
+const (
+	quoteVersion3 = 3
+
+	attestationKeyTypeECDSA256 = 2
+
+	certDataTypePCKChain = 5
+
+	sizeHeader       = 48
+	sizeReportBody   = 384
+	sizeSignature    = 64
+	sizePublicKey    = 64
+	sizeSignatureLen = 4
+)
+
+var (
+	errQuoteTooShort               = errors.New("sgx quote is too short")
+	errQuoteUnexpectedVersion      = errors.New("unexpected sgx quote version")
+	errQuoteUnexpectedKeyType      = errors.New("unexpected sgx quote attestation key type")
+	errQuoteUnexpectedCertDataType = errors.New("unexpected sgx quote certification data type")
+	errQuoteInvalidPCKChain        = errors.New("invalid pck certificate chain in sgx quote")
+)
+
+// ParseQuote parses raw SGX DCAP quote.
+func ParseQuote(raw []byte) (*Quote, error) {
+	if len(raw) < sizeHeader+sizeReportBody+sizeSignatureLen {
+		return nil, fmt.Errorf("%w: %d bytes",
+			errQuoteTooShort, len(raw),
+		)
+	}
+
+	q := &Quote{
+		Version:  binary.LittleEndian.Uint16(raw[0:2]),
+		QESVN:    binary.LittleEndian.Uint16(raw[8:10]),
+		PCESVN:   binary.LittleEndian.Uint16(raw[10:12]),
+		QEVendor: clone(raw[12:28]),
+	}
+
+	if q.Version != quoteVersion3 {
+		return nil, fmt.Errorf("%w: %d != %d",
+			errQuoteUnexpectedVersion, q.Version, quoteVersion3,
+		)
+	}
+	if keyType := binary.LittleEndian.Uint16(raw[2:4]); keyType != attestationKeyTypeECDSA256 {
+		return nil, fmt.Errorf("%w: %d != %d",
+			errQuoteUnexpectedKeyType, keyType, attestationKeyTypeECDSA256,
+		)
+	}
+
+	q.Body = parseReportBody(raw[sizeHeader : sizeHeader+sizeReportBody])
+	q.Signed = clone(raw[:sizeHeader+sizeReportBody])
+
+	sigLen := int(binary.LittleEndian.Uint32(raw[sizeHeader+sizeReportBody:]))
+	sig := raw[sizeHeader+sizeReportBody+sizeSignatureLen:]
+	if len(sig) < sigLen {
+		return nil, fmt.Errorf("%w: signature data is truncated",
+			errQuoteTooShort,
+		)
+	}
+	sig = sig[:sigLen]
+
+	r := reader{data: sig}
+	q.Signature = r.next(sizeSignature)
+	q.AttestationKey = r.next(sizePublicKey)
+	q.QEReportRaw = r.next(sizeReportBody)
+	q.QEReportSignature = r.next(sizeSignature)
+	q.QEAuthData = r.next(int(r.uint16()))
+	certDataType := r.uint16()
+	certData := r.next(int(r.uint32()))
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	q.QEReport = parseReportBody(q.QEReportRaw)
+
+	if certDataType != certDataTypePCKChain {
+		return nil, fmt.Errorf("%w: %d != %d",
+			errQuoteUnexpectedCertDataType, certDataType, certDataTypePCKChain,
+		)
+	}
+
+	pckChain, err := ParsePCKChain(certData)
+	if err != nil {
+		return nil, err
+	}
+	q.PCKChain = pckChain
+
+	return q, nil
+}
+
+// ParsePCKChain parses PEM-encoded PCK certificate chain (PCK leaf, PCK
+// platform/processor CA and root CA).
+func ParsePCKChain(certData []byte) ([]*x509.Certificate, error) {
+	res := make([]*x509.Certificate, 0, 3)
+	for rest := certData; len(rest) > 0; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w",
+				errQuoteInvalidPCKChain, err,
+			)
+		}
+		res = append(res, cert)
+	}
+	if len(res) != 3 { // pck leaf || intermediate ca || root ca
+		return nil, fmt.Errorf("%w: expected 3 certificates, got %d",
+			errQuoteInvalidPCKChain, len(res),
+		)
+	}
+	return res, nil
+}
+
+func parseReportBody(b []byte) ReportBody {
+	return ReportBody{
+		CPUSVN:     clone(b[0:16]),
+		MiscSelect: binary.LittleEndian.Uint32(b[16:20]),
+		Attributes: clone(b[48:64]),
+		MrEnclave:  clone(b[64:96]),
+		MrSigner:   clone(b[128:160]),
+		IsvProdID:  binary.LittleEndian.Uint16(b[256:258]),
+		IsvSVN:     binary.LittleEndian.Uint16(b[258:260]),
+		ReportData: clone(b[320:384]),
+	}
+}
+
+func clone(b []byte) []byte {
+	res := make([]byte, len(b))
+	copy(res, b)
+	return res
+}
+
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) next(size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < size {
+		r.err = fmt.Errorf("%w: signature data is truncated",
+			errQuoteTooShort,
+		)
+		return nil
+	}
+	res := clone(r.data[:size])
+	r.data = r.data[size:]
+	return res
+}
+
+func (r *reader) uint16() uint16 {
+	b := r.next(2)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(b)
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.next(4)
+	if b == nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(b)
+}
@@ -0,0 +1,298 @@
+package sgx_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/binary"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/stretchr/testify/assert"
+)
+
+var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type pki struct {
+	roots *x509.CertPool
+	chain []byte
+	pck   *ecdsa.PrivateKey
+
+	intermediate    *x509.Certificate
+	intermediateKey *ecdsa.PrivateKey
+}
+
+// newPKI generates root ca, intermediate ca and pck certificate that mimic the
+// ones issued by intel.
+func newPKI(t *testing.T) *pki {
+	issue := func(cn string, isCA bool, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		assert.NoError(t, err)
+		template := &x509.Certificate{
+			SerialNumber:          big.NewInt(1),
+			Subject:               pkix.Name{CommonName: cn},
+			NotBefore:             now.Add(-time.Hour),
+			NotAfter:              now.Add(time.Hour),
+			IsCA:                  isCA,
+			BasicConstraintsValid: true,
+			KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		}
+		if parent == nil {
+			parent, parentKey = template, key
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+		assert.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.NoError(t, err)
+		return cert, key
+	}
+
+	root, rootKey := issue("Test SGX Root CA", true, nil, nil)
+	intermediate, intermediateKey := issue("Test SGX PCK Platform CA", true, root, rootKey)
+	pck, pckKey := issue("Test SGX PCK Certificate", false, intermediate, intermediateKey)
+
+	res := &pki{
+		roots: x509.NewCertPool(),
+		pck:   pckKey,
+
+		intermediate:    intermediate,
+		intermediateKey: intermediateKey,
+	}
+	res.roots.AddCert(root)
+	for _, cert := range []*x509.Certificate{pck, intermediate, root} {
+		res.chain = append(res.chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return res
+}
+
+// newCRL issues the pck crl (valid for half an hour after now) that revokes the serial
+// numbers.
+func newCRL(t *testing.T, p *pki, serials ...int64) []byte {
+	entries := make([]x509.RevocationListEntry, 0, len(serials))
+	for _, serial := range serials {
+		entries = append(entries, x509.RevocationListEntry{
+			SerialNumber:   big.NewInt(serial),
+			RevocationTime: now.Add(-time.Minute),
+		})
+	}
+	crl, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:                    big.NewInt(1),
+		ThisUpdate:                now.Add(-time.Hour),
+		NextUpdate:                now.Add(30 * time.Minute),
+		RevokedCertificateEntries: entries,
+	}, p.intermediate, p.intermediateKey)
+	assert.NoError(t, err)
+	return crl
+}
+
+// pcs serves the pck crl of the platform ca.
+type pcs struct {
+	crl []byte
+}
+
+func (s *pcs) Get(url string) (map[string][]string, []byte, error) {
+	if !strings.Contains(url, "/pckcrl?ca=platform") {
+		return nil, nil, fmt.Errorf("unexpected url: %s", url)
+	}
+	return map[string][]string{}, s.crl, nil
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, data []byte) []byte {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	assert.NoError(t, err)
+	res := make([]byte, 64)
+	r.FillBytes(res[:32])
+	s.FillBytes(res[32:])
+	return res
+}
+
+// newQuote assembles sgx quote (version 3) as the quoting enclave would.
+func newQuote(t *testing.T, p *pki, body []byte) []byte {
+	attKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+	attPub := make([]byte, 64)
+	attKey.X.FillBytes(attPub[:32])
+	attKey.Y.FillBytes(attPub[32:])
+
+	authData := []byte("qe auth data")
+
+	qeReport := make([]byte, 384)
+	digest := sha256.Sum256(append(append([]byte{}, attPub...), authData...))
+	copy(qeReport[320:], digest[:])
+
+	header := make([]byte, 48)
+	binary.LittleEndian.PutUint16(header[0:], 3) // version
+	binary.LittleEndian.PutUint16(header[2:], 2) // ecdsa-256-with-p-256
+
+	signed := append(header, body...)
+
+	sig := sign(t, attKey, signed)
+	sig = append(sig, attPub...)
+	sig = append(sig, qeReport...)
+	sig = append(sig, sign(t, p.pck, qeReport)...)
+	sig = binary.LittleEndian.AppendUint16(sig, uint16(len(authData)))
+	sig = append(sig, authData...)
+	sig = binary.LittleEndian.AppendUint16(sig, 5) // pck cert chain
+	sig = binary.LittleEndian.AppendUint32(sig, uint32(len(p.chain)))
+	sig = append(sig, p.chain...)
+
+	res := binary.LittleEndian.AppendUint32(signed, uint32(len(sig)))
+	return append(res, sig...)
+}
+
+func newReportBody(mrEnclave, mrSigner byte, isvProdID, isvSVN uint16, debug bool) []byte {
+	body := make([]byte, 384)
+	if debug {
+		body[48] = 0x02
+	}
+	for idx := 0; idx < 32; idx++ {
+		body[64+idx] = mrEnclave
+		body[128+idx] = mrSigner
+	}
+	binary.LittleEndian.PutUint16(body[256:], isvProdID)
+	binary.LittleEndian.PutUint16(body[258:], isvSVN)
+	return body
+}
+
+func TestVerifyQuote(t *testing.T) {
+	p := newPKI(t)
+	opts := &sgx.VerifyOptions{TrustedRoots: p.roots, Now: now}
+
+	{ // genuine quote
+		quote, err := sgx.ParseQuote(newQuote(t, p, newReportBody(0xaa, 0xbb, 1, 2, false)))
+		assert.NoError(t, err)
+		assert.NoError(t, sgx.VerifyQuote(quote, opts))
+	}
+
+	{ // tampered report body
+		raw := newQuote(t, p, newReportBody(0xaa, 0xbb, 1, 2, false))
+		raw[48+64] ^= 0xff
+		quote, err := sgx.ParseQuote(raw)
+		assert.NoError(t, err)
+		assert.Error(t, sgx.VerifyQuote(quote, opts))
+	}
+
+	{ // untrusted root
+		quote, err := sgx.ParseQuote(newQuote(t, newPKI(t), newReportBody(0xaa, 0xbb, 1, 2, false)))
+		assert.NoError(t, err)
+		assert.Error(t, sgx.VerifyQuote(quote, opts))
+	}
+
+	{ // default intel root
+		quote, err := sgx.ParseQuote(newQuote(t, p, newReportBody(0xaa, 0xbb, 1, 2, false)))
+		assert.NoError(t, err)
+		assert.Error(t, sgx.VerifyQuote(quote, &sgx.VerifyOptions{Now: now}))
+	}
+
+	{ // truncated quote
+		raw := newQuote(t, p, newReportBody(0xaa, 0xbb, 1, 2, false))
+		_, err := sgx.ParseQuote(raw[:len(raw)-100])
+		assert.Error(t, err)
+	}
+}
+
+func TestVerifyQuoteRevocation(t *testing.T) {
+	p := newPKI(t)
+	quote, err := sgx.ParseQuote(newQuote(t, p, newReportBody(0xaa, 0xbb, 1, 2, false)))
+	assert.NoError(t, err)
+
+	verify := func(crl []byte) error {
+		return sgx.VerifyQuote(quote, &sgx.VerifyOptions{
+			Getter:        &pcs{crl: crl},
+			GetCollateral: true,
+			Now:           now,
+			TrustedRoots:  p.roots,
+		})
+	}
+
+	{ // revoked pck certificate
+		err := verify(newCRL(t, p, 1))
+		assert.ErrorContains(t, err, "sgx pck certificate is revoked")
+	}
+
+	{ // pck certificate is not revoked (the test one has no tcb extensions)
+		err := verify(newCRL(t, p, 2))
+		assert.ErrorContains(t, err, "invalid sgx pck certificate")
+		assert.NotContains(t, err.Error(), "revoked")
+	}
+
+	{ // crl that is not issued by the ca of the pck certificate
+		err := verify(newCRL(t, newPKI(t), 2))
+		assert.ErrorContains(t, err, "invalid sgx pck crl")
+	}
+
+	{ // expired crl
+		err := sgx.VerifyQuote(quote, &sgx.VerifyOptions{
+			Getter:        &pcs{crl: newCRL(t, p)},
+			GetCollateral: true,
+			Now:           now.Add(45 * time.Minute),
+			TrustedRoots:  p.roots,
+		})
+		assert.ErrorContains(t, err, "invalid sgx pck crl")
+	}
+}
+
+func TestMatchesQuote(t *testing.T) {
+	p := newPKI(t)
+	quote, err := sgx.ParseQuote(newQuote(t, p, newReportBody(0xaa, 0xbb, 1, 2, true)))
+	assert.NoError(t, err)
+
+	byte32 := func(b byte) types.Byte32 {
+		var res types.Byte32
+		for idx := range res {
+			res[idx] = b
+		}
+		return res
+	}
+	isvProdID := uint16(1)
+
+	{ // matching enclave
+		td := &sgx.SGX{
+			MrEnclave: []types.Byte32{byte32(0x11), byte32(0xaa)},
+			MrSigner:  []types.Byte32{byte32(0xbb)},
+			IsvProdID: &isvProdID,
+			MinIsvSVN: 2,
+		}
+		reported, ignored := td.MatchesQuote(quote)
+		assert.Empty(t, failures(reported))
+		assert.Len(t, failures(ignored), 1) // debug
+	}
+
+	{ // mismatching enclave
+		td := &sgx.SGX{
+			MrEnclave: []types.Byte32{byte32(0x11)},
+			MrSigner:  []types.Byte32{byte32(0x22)},
+			MinIsvSVN: 3,
+		}
+		reported, _ := td.MatchesQuote(quote)
+		assert.Len(t, failures(reported), 3)
+	}
+
+	{ // debug enclave
+		td := &sgx.SGX{
+			CheckDebug: true,
+		}
+		reported, _ := td.MatchesQuote(quote)
+		assert.Len(t, failures(reported), 1)
+	}
+}
+
+func failures(errs []error) []error {
+	res := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+	return res
+}
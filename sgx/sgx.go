@@ -0,0 +1,202 @@
+package sgx
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
+)
+
+// SGX reflects our expectations about Intel SGX enclave.
+//
+// For the reference see Intel SGX ECDSA Quote Library API (rev 1.4, 2021/03).
+//
+// See also:
+//
+//   - https://download.01.org/intel-sgx/latest/dcap-latest/linux/docs/Intel_SGX_ECDSA_QuoteLibReference_DCAP_API.pdf
+type SGX struct {
+	tokenutil.TokenParams `mapstructure:"-" structs:"-"`
+
+	// Name is the name of trusted domain.
+	Name string `json:"-" mapstructure:"-" structs:"-"`
+
+	// TOTPSecret is the secret used to generate initial TOTP codes.
+	TOTPSecret string `json:"totp_secret" mapstructure:"totp_secret" structs:"totp_secret"`
+
+	// MrEnclave is the allow-list of enclave measurements (MRENCLAVE).
+	//
+	// When empty, any MRENCLAVE is accepted.
+	MrEnclave []types.Byte32 `json:"sgx_mr_enclave,omitempty" mapstructure:"sgx_mr_enclave,omitempty" structs:"sgx_mr_enclave,omitempty"`
+
+	// MrSigner is the allow-list of enclave signers (MRSIGNER), i.e. of the
+	// hashes of the public keys that signed the enclave.
+	//
+	// When empty, any MRSIGNER is accepted.
+	MrSigner []types.Byte32 `json:"sgx_mr_signer,omitempty" mapstructure:"sgx_mr_signer,omitempty" structs:"sgx_mr_signer,omitempty"`
+
+	// IsvProdID is the expected product id of the enclave (ISVPRODID).
+	IsvProdID *uint16 `json:"sgx_isv_prod_id,omitempty" mapstructure:"sgx_isv_prod_id,omitempty" structs:"sgx_isv_prod_id,omitempty"`
+
+	// MinIsvSVN is the minimum security version of the enclave (ISVSVN).
+	MinIsvSVN uint16 `json:"sgx_min_isv_svn" mapstructure:"sgx_min_isv_svn" structs:"sgx_min_isv_svn"`
+
+	// CheckDebug indicates whether ATTRIBUTES.DEBUG == 0 is verified.
+	//
+	// ATTRIBUTES.DEBUG defines whether the enclave is a debug one (i.e.
+	// whether its memory can be inspected by the debugger).
+	CheckDebug bool `json:"sgx_check_debug" mapstructure:"sgx_check_debug" structs:"sgx_check_debug"`
+}
+
+const (
+	attributesDebug = 0x02
+
+	pathUserReportData = "/dev/attestation/user_report_data"
+	pathQuote          = "/dev/attestation/quote"
+)
+
+var (
+	errSGXQuoteIsNil            = errors.New("sgx quote is nil")
+	errSGXQuoteMismatchEnclave  = errors.New("sgx mr_enclave is not allowed")
+	errSGXQuoteMismatchSigner   = errors.New("sgx mr_signer is not allowed")
+	errSGXQuoteMismatchProdID   = errors.New("sgx isv_prod_id mismatch")
+	errSGXQuoteIsvSVNTooLow     = errors.New("sgx isv_svn is too low")
+	errSGXQuoteDebugEnabled     = errors.New("sgx enclave is in debug mode")
+	errSGXAttestationNotPresent = errors.New("sgx attestation interface is not present (are we running inside gramine?)")
+)
+
+// GetQuote generates SGX quote with provided report data.
+//
+// It relies on the attestation interface exposed to the enclave by Gramine
+// (i.e. pseudo-files under /dev/attestation).
+func GetQuote(reportData [globals.SGXNonceSize]byte) ([]byte, error) {
+	if _, err := os.Stat(pathQuote); err != nil {
+		return nil, fmt.Errorf("%w: %w", errSGXAttestationNotPresent, err)
+	}
+
+	if err := os.WriteFile(pathUserReportData, reportData[:], 0); err != nil {
+		return nil, err
+	}
+
+	return os.ReadFile(pathQuote)
+}
+
+// FromPlatform creates new SGX instance from the parameters of the enclave we
+// are currently running in.
+func FromPlatform() (*SGX, error) {
+	raw, err := GetQuote([globals.SGXNonceSize]byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	quote, err := ParseQuote(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	isvProdID := quote.Body.IsvProdID
+
+	return &SGX{
+		MrEnclave:  []types.Byte32{types.Byte32(quote.Body.MrEnclave)},
+		MrSigner:   []types.Byte32{types.Byte32(quote.Body.MrSigner)},
+		IsvProdID:  &isvProdID,
+		MinIsvSVN:  quote.Body.IsvSVN,
+		CheckDebug: quote.Body.Attributes[0]&attributesDebug == 0,
+	}, nil
+}
+
+func (td *SGX) MatchesQuote(quote *Quote) (
+	[]error, []error,
+) {
+	if quote == nil {
+		return []error{
+			errSGXQuoteIsNil,
+		}, nil
+	}
+
+	errs := make([]error, 0, 5)
+	dump := make([]error, 0, 5)
+
+	{ // allow-lists
+		// make sure the time is constant regardless of the position of the
+		// matching entry
+		if matches := matchesAny(td.MrEnclave, quote.Body.MrEnclave); len(td.MrEnclave) > 0 {
+			if !matches {
+				errs = append(errs, errSGXQuoteMismatchEnclave)
+			} else {
+				errs = append(errs, nil)
+			}
+		} else {
+			dump = append(dump, errSGXQuoteMismatchEnclave)
+		}
+
+		if matches := matchesAny(td.MrSigner, quote.Body.MrSigner); len(td.MrSigner) > 0 {
+			if !matches {
+				errs = append(errs, errSGXQuoteMismatchSigner)
+			} else {
+				errs = append(errs, nil)
+			}
+		} else {
+			dump = append(dump, errSGXQuoteMismatchSigner)
+		}
+	}
+
+	{ // isv
+		if td.IsvProdID != nil {
+			if quote.Body.IsvProdID != *td.IsvProdID {
+				errs = append(errs, fmt.Errorf("%w: %d != %d",
+					errSGXQuoteMismatchProdID, quote.Body.IsvProdID, *td.IsvProdID,
+				))
+			}
+		}
+
+		if quote.Body.IsvSVN < td.MinIsvSVN {
+			errs = append(errs, fmt.Errorf("%w: %d < %d",
+				errSGXQuoteIsvSVNTooLow, quote.Body.IsvSVN, td.MinIsvSVN,
+			))
+		}
+	}
+
+	{ // attributes
+		if quote.Body.Attributes[0]&attributesDebug != 0 {
+			if td.CheckDebug {
+				errs = append(errs, errSGXQuoteDebugEnabled)
+			} else {
+				dump = append(dump, errSGXQuoteDebugEnabled)
+			}
+		}
+	}
+
+	return errs, dump
+}
+
+func matchesAny(allowed []types.Byte32, actual []byte) bool {
+	res := 0
+	for _, expect := range allowed {
+		res |= subtle.ConstantTimeCompare(expect[:], actual)
+	}
+	return res == 1
+}
+
+func (td *SGX) GetName() string {
+	return td.Name
+}
+
+func (td *SGX) SetName(name string) {
+	td.Name = name
+}
+
+func (td *SGX) AttestationType() string {
+	return "sgx"
+}
+
+func (td *SGX) GetTOTPSecret() string {
+	return td.TOTPSecret
+}
+
+func (td *SGX) SetTOTPSecret(totpSecret string) {
+	td.TOTPSecret = totpSecret
+}
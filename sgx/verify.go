@@ -0,0 +1,542 @@
+package sgx
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	tdxabi "github.com/google/go-tdx-guest/abi"
+	tdxpcs "github.com/google/go-tdx-guest/pcs"
+	tdxtrust "github.com/google/go-tdx-guest/verify/trust"
+)
+
+// VerifyOptions configure the verification of SGX quotes.
+type VerifyOptions struct {
+	// Getter is used to fetch the collateral (PCK CRL, TCB info and QE
+	// identity) from Intel PCS.
+	Getter tdxtrust.HTTPSGetter
+
+	// GetCollateral indicates whether the collateral should be fetched and
+	// verified (i.e. whether PCK certificate is not revoked, and whether TCB
+	// status of the platform and of the quoting enclave should be checked).
+	GetCollateral bool
+
+	// Now is the time at which the certificates and the collateral must be
+	// valid.
+	Now time.Time
+
+	// TrustedRoots are the roots that PCK certificate chain (as well as the
+	// issuers of the collateral) must chain up to. When nil, embedded Intel
+	// SGX Root CA is used.
+	TrustedRoots *x509.CertPool
+}
+
+const (
+	pcsSGXBaseURL = "https://api.trustedservices.intel.com/sgx/certification/v4"
+	pcsTDXBaseURL = "https://api.trustedservices.intel.com/tdx/certification/v4"
+
+	headerTCBInfoIssuerChain    = "Tcb-Info-Issuer-Chain"
+	headerQEIdentityIssuerChain = "Sgx-Enclave-Identity-Issuer-Chain"
+
+	tcbInfoID         = "SGX"
+	tcbInfoIDTDX      = "TDX"
+	tcbInfoVersion    = 3
+	qeIdentityID      = "QE"
+	qeIdentityVersion = 2
+
+	pckPlatformCA  = "PCK Platform CA"
+	pckProcessorCA = "PCK Processor CA"
+)
+
+var (
+	//go:embed intel_sgx_root_ca.pem
+	intelSGXRootCA []byte
+
+	errQuoteInvalidPCKCertificate    = errors.New("invalid sgx pck certificate")
+	errQuoteInvalidQEReportSignature = errors.New("invalid sgx qe report signature")
+	errQuoteInvalidQEReportData      = errors.New("sgx qe report data does not bind attestation key")
+	errQuoteInvalidAttestationKey    = errors.New("invalid sgx attestation key")
+	errQuoteInvalidSignature         = errors.New("invalid sgx quote signature")
+	errCollateralTCBInfo             = errors.New("invalid sgx tcb info")
+	errCollateralQEIdentity          = errors.New("invalid sgx qe identity")
+	errCollateralTCBStatus           = errors.New("sgx tcb is not up to date")
+	errCollateralPCKCRL              = errors.New("invalid sgx pck crl")
+	errCollateralPCKRevoked          = errors.New("sgx pck certificate is revoked")
+)
+
+// TrustedRoots returns the pool with embedded Intel SGX Root CA.
+func TrustedRoots() *x509.CertPool {
+	block, _ := pem.Decode(intelSGXRootCA)
+	root, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		panic(err) // embedded certificate must be valid
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(root)
+	return pool
+}
+
+// VerifyQuote verifies the genuineness of the SGX quote, i.e.:
+//
+//   - PCK certificate chains up to Intel SGX Root CA;
+//   - QE report is signed by PCK certificate, and binds the attestation key;
+//   - quote is signed by the attestation key;
+//   - (optionally) PCK certificate is not revoked as per the PCK CRL published
+//     by Intel PCS;
+//   - (optionally) TCB levels of the platform and of the quoting enclave are
+//     up to date as per the collateral published by Intel PCS (platforms that
+//     only need software hardening are accepted).
+func VerifyQuote(quote *Quote, opts *VerifyOptions) error {
+	roots := opts.TrustedRoots
+	if roots == nil {
+		roots = TrustedRoots()
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	if err := quote.QuoteSignature.Verify(roots, now); err != nil {
+		return err
+	}
+
+	if !opts.GetCollateral {
+		return nil
+	}
+
+	getter := opts.Getter
+	if getter == nil {
+		getter = tdxtrust.DefaultHTTPSGetter()
+	}
+
+	if err := checkPCKRevocation(getter, quote.PCKChain, now); err != nil {
+		return err
+	}
+
+	extensions, err := tdxpcs.PckCertificateExtensions(quote.PCKChain[0])
+	if err != nil {
+		return fmt.Errorf("%w: %w", errQuoteInvalidPCKCertificate, err)
+	}
+
+	tcbInfo := &tdxpcs.TdxTcbInfo{}
+	if err := fetchCollateral(
+		getter, roots, now,
+		pcsSGXBaseURL+"/tcb?fmspc="+extensions.FMSPC,
+		headerTCBInfoIssuerChain, "tcbInfo", tcbInfo,
+	); err != nil {
+		return fmt.Errorf("%w: %w", errCollateralTCBInfo, err)
+	}
+	if err := checkTCBInfo(&tcbInfo.TcbInfo, extensions, now); err != nil {
+		return err
+	}
+
+	qeIdentity := &tdxpcs.QeIdentity{}
+	if err := fetchCollateral(
+		getter, roots, now,
+		pcsSGXBaseURL+"/qe/identity",
+		headerQEIdentityIssuerChain, "enclaveIdentity", qeIdentity,
+	); err != nil {
+		return fmt.Errorf("%w: %w", errCollateralQEIdentity, err)
+	}
+	if err := checkQEIdentity(&qeIdentity.EnclaveIdentity, &quote.QEReport, now); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// TDXTCBStatus fetches TDX TCB info collateral from Intel PCS for the platform
+// of the PCK certificate, and returns the TCB status of the level that both
+// the platform and the TDX module (as per TEE_TCB_SVN of the quote) meet
+// (e.g. "UpToDate", "OutOfDate" or "Revoked").
+//
+// The identity of the TDX module (i.e. its MRSIGNER and attributes) is not
+// checked, the quote is expected to be verified separately.
+func TDXTCBStatus(
+	pck *x509.Certificate,
+	teeTcbSvn []byte,
+	opts *VerifyOptions,
+) (string, error) {
+	roots := opts.TrustedRoots
+	if roots == nil {
+		roots = TrustedRoots()
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+	getter := opts.Getter
+	if getter == nil {
+		getter = tdxtrust.DefaultHTTPSGetter()
+	}
+
+	extensions, err := tdxpcs.PckCertificateExtensions(pck)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errQuoteInvalidPCKCertificate, err)
+	}
+
+	tcbInfo := &tdxpcs.TdxTcbInfo{}
+	if err := fetchCollateral(
+		getter, roots, now,
+		pcsTDXBaseURL+"/tcb?fmspc="+extensions.FMSPC,
+		headerTCBInfoIssuerChain, "tcbInfo", tcbInfo,
+	); err != nil {
+		return "", fmt.Errorf("%w: %w", errCollateralTCBInfo, err)
+	}
+
+	status, err := matchTCBLevel(&tcbInfo.TcbInfo, tcbInfoIDTDX, extensions, teeTcbSvn, now)
+	if err != nil {
+		return "", err
+	}
+
+	return string(status), nil
+}
+
+// Verify verifies that:
+//
+//   - PCK certificate chains up to provided roots;
+//   - QE report is signed by PCK certificate, and binds the attestation key;
+//   - signed data is signed by the attestation key.
+func (sig *QuoteSignature) Verify(roots *x509.CertPool, now time.Time) error {
+	if len(sig.PCKChain) < 2 {
+		return fmt.Errorf("%w: expected at least 2 certificates, got %d",
+			errQuoteInvalidPCKChain, len(sig.PCKChain),
+		)
+	}
+	if len(sig.QEReportRaw) != sizeReportBody ||
+		len(sig.AttestationKey) != sizePublicKey ||
+		len(sig.Signature) != sizeSignature {
+		return errQuoteTooShort
+	}
+
+	qeReport := parseReportBody(sig.QEReportRaw)
+
+	pck, intermediate := sig.PCKChain[0], sig.PCKChain[1]
+
+	{ // pck certificate chain
+		intermediates := x509.NewCertPool()
+		intermediates.AddCert(intermediate)
+		_, err := pck.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			CurrentTime:   now,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		})
+		if err != nil {
+			return fmt.Errorf("%w: %w", errQuoteInvalidPCKCertificate, err)
+		}
+	}
+
+	{ // qe report
+		signature, err := tdxabi.SignatureToDER(sig.QEReportSignature)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errQuoteInvalidQEReportSignature, err)
+		}
+		if err := pck.CheckSignature(x509.ECDSAWithSHA256, sig.QEReportRaw, signature); err != nil {
+			return fmt.Errorf("%w: %w", errQuoteInvalidQEReportSignature, err)
+		}
+
+		expected := make([]byte, 64)
+		digest := sha256.Sum256(append(clone(sig.AttestationKey), sig.QEAuthData...))
+		copy(expected, digest[:])
+		if !bytes.Equal(expected, qeReport.ReportData) {
+			return errQuoteInvalidQEReportData
+		}
+	}
+
+	{ // quote signature
+		key := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(sig.AttestationKey[:32]),
+			Y:     new(big.Int).SetBytes(sig.AttestationKey[32:]),
+		}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return errQuoteInvalidAttestationKey
+		}
+		digest := sha256.Sum256(sig.Signed)
+		r := new(big.Int).SetBytes(sig.Signature[:32])
+		s := new(big.Int).SetBytes(sig.Signature[32:])
+		if !ecdsa.Verify(key, digest[:], r, s) {
+			return errQuoteInvalidSignature
+		}
+	}
+
+	return nil
+}
+
+// fetchCollateral fetches the collateral from Intel PCS and verifies its
+// signature with the signing certificate from the issuer chain header.
+func fetchCollateral(
+	getter tdxtrust.HTTPSGetter,
+	roots *x509.CertPool,
+	now time.Time,
+	url, header, field string,
+	res interface{},
+) error {
+	headers, body, err := getter.Get(url)
+	if err != nil {
+		return err
+	}
+
+	signer, err := issuerChain(headers, header)
+	if err != nil {
+		return err
+	}
+	if _, err := signer.Verify(x509.VerifyOptions{
+		Roots:       roots,
+		CurrentTime: now,
+		KeyUsages:   []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	}); err != nil {
+		return err
+	}
+
+	raw := map[string]json.RawMessage{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return err
+	}
+	var signatureHex string
+	if err := json.Unmarshal(raw["signature"], &signatureHex); err != nil {
+		return err
+	}
+	signature, err := hex.DecodeString(signatureHex)
+	if err != nil {
+		return err
+	}
+	signatureDER, err := tdxabi.SignatureToDER(signature)
+	if err != nil {
+		return err
+	}
+	if err := signer.CheckSignature(x509.ECDSAWithSHA256, raw[field], signatureDER); err != nil {
+		return err
+	}
+
+	return json.Unmarshal(body, res)
+}
+
+// checkPCKRevocation fetches the CRL of the ca that issued the PCK certificate
+// from Intel PCS, and verifies that the certificate is not revoked by it. The
+// CRL must be signed by the issuer from the (already verified) PCK certificate
+// chain.
+func checkPCKRevocation(
+	getter tdxtrust.HTTPSGetter,
+	chain []*x509.Certificate,
+	now time.Time,
+) error {
+	pck, issuer := chain[0], chain[1]
+
+	var ca string
+	switch {
+	case strings.HasSuffix(issuer.Subject.CommonName, pckPlatformCA):
+		ca = "platform"
+	case strings.HasSuffix(issuer.Subject.CommonName, pckProcessorCA):
+		ca = "processor"
+	default:
+		return fmt.Errorf("%w: unexpected issuer of pck certificate: %s",
+			errCollateralPCKCRL, issuer.Subject.CommonName,
+		)
+	}
+
+	_, body, err := getter.Get(tdxpcs.PckCrlURL(ca))
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCollateralPCKCRL, err)
+	}
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return fmt.Errorf("%w: %w", errCollateralPCKCRL, err)
+	}
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("%w: %w", errCollateralPCKCRL, err)
+	}
+	if now.After(crl.NextUpdate) {
+		return fmt.Errorf("%w: expired at %s",
+			errCollateralPCKCRL, crl.NextUpdate,
+		)
+	}
+
+	for _, revoked := range crl.RevokedCertificateEntries {
+		if revoked.SerialNumber.Cmp(pck.SerialNumber) == 0 {
+			return fmt.Errorf("%w: serial number %s",
+				errCollateralPCKRevoked, pck.SerialNumber,
+			)
+		}
+	}
+
+	return nil
+}
+
+func issuerChain(headers map[string][]string, header string) (*x509.Certificate, error) {
+	values := headers[header]
+	if len(values) != 1 {
+		return nil, fmt.Errorf("%s header is missing", header)
+	}
+
+	chain, err := url.QueryUnescape(values[0])
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode([]byte(chain)) // signing certificate goes first
+	if block == nil {
+		return nil, fmt.Errorf("%s header has no certificates", header)
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func checkTCBInfo(
+	tcbInfo *tdxpcs.TcbInfo,
+	extensions *tdxpcs.PckExtensions,
+	now time.Time,
+) error {
+	status, err := matchTCBLevel(tcbInfo, tcbInfoID, extensions, nil, now)
+	if err != nil {
+		return err
+	}
+
+	// software hardening is the responsibility of the enclave itself
+	if status != tdxpcs.TcbComponentStatusUpToDate &&
+		status != tdxpcs.TcbComponentStatusSwHardeningNeeded {
+		return fmt.Errorf("%w: platform tcb status is %s",
+			errCollateralTCBStatus, status,
+		)
+	}
+
+	return nil
+}
+
+// matchTCBLevel checks the tcb info collateral against the platform, and
+// returns the status of the first (i.e. the highest) tcb level that the
+// platform meets. For tdx the svns of tdx module (teeTcbSvn) must meet the
+// level as well.
+func matchTCBLevel(
+	tcbInfo *tdxpcs.TcbInfo,
+	id string,
+	extensions *tdxpcs.PckExtensions,
+	teeTcbSvn []byte,
+	now time.Time,
+) (tdxpcs.TcbComponentStatus, error) {
+	if tcbInfo.ID != id || tcbInfo.Version != tcbInfoVersion {
+		return "", fmt.Errorf("%w: unexpected id or version: %s/%d",
+			errCollateralTCBInfo, tcbInfo.ID, tcbInfo.Version,
+		)
+	}
+	if now.After(tcbInfo.NextUpdate) {
+		return "", fmt.Errorf("%w: expired at %s",
+			errCollateralTCBInfo, tcbInfo.NextUpdate,
+		)
+	}
+	if tcbInfo.Fmspc != extensions.FMSPC || tcbInfo.PceID != extensions.PCEID {
+		return "", fmt.Errorf("%w: fmspc or pceid mismatch",
+			errCollateralTCBInfo,
+		)
+	}
+
+	for _, level := range tcbInfo.TcbLevels {
+		if len(level.Tcb.SgxTcbcomponents) != len(extensions.TCB.CPUSvnComponents) {
+			continue
+		}
+		matches := extensions.TCB.PCESvn >= level.Tcb.Pcesvn
+		for idx, component := range level.Tcb.SgxTcbcomponents {
+			matches = matches && extensions.TCB.CPUSvnComponents[idx] >= component.Svn
+		}
+		if id == tcbInfoIDTDX {
+			if len(level.Tcb.TdxTcbcomponents) != len(teeTcbSvn) {
+				continue
+			}
+			for idx, component := range level.Tcb.TdxTcbcomponents {
+				matches = matches && teeTcbSvn[idx] >= component.Svn
+			}
+		}
+		if !matches {
+			continue
+		}
+		return level.TcbStatus, nil
+	}
+
+	return "", fmt.Errorf("%w: no matching platform tcb level",
+		errCollateralTCBStatus,
+	)
+}
+
+func checkQEIdentity(
+	qeIdentity *tdxpcs.EnclaveIdentity,
+	qeReport *ReportBody,
+	now time.Time,
+) error {
+	if qeIdentity.ID != qeIdentityID || qeIdentity.Version != qeIdentityVersion {
+		return fmt.Errorf("%w: unexpected id or version: %s/%d",
+			errCollateralQEIdentity, qeIdentity.ID, qeIdentity.Version,
+		)
+	}
+	if now.After(qeIdentity.NextUpdate) {
+		return fmt.Errorf("%w: expired at %s",
+			errCollateralQEIdentity, qeIdentity.NextUpdate,
+		)
+	}
+	if len(qeIdentity.MiscselectMask.Bytes) != 4 || len(qeIdentity.Miscselect.Bytes) != 4 {
+		return fmt.Errorf("%w: unexpected miscselect size",
+			errCollateralQEIdentity,
+		)
+	}
+	miscSelectMask := binary.LittleEndian.Uint32(qeIdentity.MiscselectMask.Bytes)
+	miscSelect := binary.LittleEndian.Uint32(qeIdentity.Miscselect.Bytes)
+	if qeReport.MiscSelect&miscSelectMask != miscSelect {
+		return fmt.Errorf("%w: qe miscselect mismatch",
+			errCollateralQEIdentity,
+		)
+	}
+	if len(qeIdentity.AttributesMask.Bytes) != len(qeReport.Attributes) {
+		return fmt.Errorf("%w: unexpected attributes size",
+			errCollateralQEIdentity,
+		)
+	}
+	attributes := make([]byte, len(qeReport.Attributes))
+	for idx := range attributes {
+		attributes[idx] = qeReport.Attributes[idx] & qeIdentity.AttributesMask.Bytes[idx]
+	}
+	if !bytes.Equal(attributes, qeIdentity.Attributes.Bytes) {
+		return fmt.Errorf("%w: qe attributes mismatch",
+			errCollateralQEIdentity,
+		)
+	}
+	if !bytes.Equal(qeReport.MrSigner, qeIdentity.Mrsigner.Bytes) {
+		return fmt.Errorf("%w: qe mrsigner mismatch",
+			errCollateralQEIdentity,
+		)
+	}
+	if qeReport.IsvProdID != qeIdentity.IsvProdID {
+		return fmt.Errorf("%w: qe isvprodid mismatch",
+			errCollateralQEIdentity,
+		)
+	}
+
+	for _, level := range qeIdentity.TcbLevels {
+		if uint32(qeReport.IsvSVN) < level.Tcb.Isvsvn {
+			continue
+		}
+		if level.TcbStatus != tdxpcs.TcbComponentStatusUpToDate {
+			return fmt.Errorf("%w: qe tcb status is %s",
+				errCollateralTCBStatus, level.TcbStatus,
+			)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("%w: no matching qe tcb level",
+		errCollateralTCBStatus,
+	)
+}
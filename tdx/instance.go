@@ -0,0 +1,71 @@
+package tdx
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+)
+
+// Instance is the credential of an individual TD instance that was enrolled
+// by the means of the attested first contact.
+type Instance struct {
+	// ID is the identifier of the instance (derived from its public key).
+	ID string `json:"-" mapstructure:"instance_id" structs:"-"`
+
+	// PublicKey is the ed25519 public key of the instance.
+	PublicKey types.Bytes `json:"public_key" mapstructure:"public_key" structs:"public_key"`
+
+	// EnrolledAt is the time when the instance was enrolled.
+	EnrolledAt time.Time `json:"enrolled_at" mapstructure:"enrolled_at" structs:"enrolled_at"`
+}
+
+var (
+	errInstancePublicKeyInvalidSize = errors.New("invalid size of instance public key")
+	errInstanceSignatureInvalid     = errors.New("invalid instance signature")
+)
+
+// NewInstance creates new instance credential for the provided public key.
+func NewInstance(publicKey []byte) (*Instance, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("%w: %d != %d",
+			errInstancePublicKeyInvalidSize, len(publicKey), ed25519.PublicKeySize,
+		)
+	}
+
+	return &Instance{
+		ID:         InstanceID(publicKey),
+		PublicKey:  publicKey,
+		EnrolledAt: time.Now().UTC(),
+	}, nil
+}
+
+// InstanceID derives the instance identifier from its public key.
+func InstanceID(publicKey []byte) string {
+	h := sha256.Sum256(publicKey)
+	return hex.EncodeToString(h[:16])
+}
+
+// NonceRequestMessage returns the message that the enrolled instance signs to
+// request the nonce at the time of timestamp (unix seconds).
+func NonceRequestMessage(timestamp int64) []byte {
+	return []byte("nonce-request:" + strconv.FormatInt(timestamp, 10))
+}
+
+// VerifySignature verifies that the message was signed by the instance.
+func (i *Instance) VerifySignature(message, signature []byte) error {
+	if len(i.PublicKey) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: %d != %d",
+			errInstancePublicKeyInvalidSize, len(i.PublicKey), ed25519.PublicKeySize,
+		)
+	}
+	if !ed25519.Verify(ed25519.PublicKey(i.PublicKey), message, signature) {
+		return errInstanceSignatureInvalid
+	}
+	return nil
+}
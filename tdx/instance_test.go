@@ -0,0 +1,46 @@
+package tdx_test
+
+import (
+	"crypto/ed25519"
+	"crypto/sha512"
+	"testing"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportData(t *testing.T) {
+	nonce := make([]byte, 64)
+	for i := range nonce {
+		nonce[i] = byte(i)
+	}
+
+	{ // no extra values => nonce as-is
+		rd := tdx.ReportData(nonce)
+		assert.Equal(t, nonce, rd[:])
+	}
+
+	{ // with extra values => sha512 over everything
+		key := []byte{0xde, 0xad, 0xbe, 0xef}
+		expected := sha512.Sum512(append(append([]byte{}, nonce...), key...))
+		rd := tdx.ReportData(nonce, key)
+		assert.Equal(t, expected[:], rd[:])
+	}
+}
+
+func TestInstance(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	instance, err := tdx.NewInstance(pub)
+	assert.NoError(t, err)
+	assert.Equal(t, tdx.InstanceID(pub), instance.ID)
+	assert.Len(t, instance.ID, 32)
+
+	message := []byte("nonce")
+	assert.NoError(t, instance.VerifySignature(message, ed25519.Sign(priv, message)))
+	assert.Error(t, instance.VerifySignature([]byte("other"), ed25519.Sign(priv, message)))
+
+	_, err = tdx.NewInstance(pub[:16])
+	assert.Error(t, err)
+}
@@ -0,0 +1,372 @@
+package tdx
+
+import (
+	"crypto/x509"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
+
+	tdxabi "github.com/google/go-tdx-guest/abi"
+	tdx "github.com/google/go-tdx-guest/client"
+	"github.com/google/go-tdx-guest/pcs"
+	tdxpb "github.com/google/go-tdx-guest/proto/tdx"
+	tdxverify "github.com/google/go-tdx-guest/verify"
+)
+
+// Quote is the parsed TDX quote of either version 4 (with TD 1.0 report body),
+// or version 5 (with either TD 1.0 or TD 1.5 report body).
+//
+// For the reference see Intel TDX DCAP: Quote Generation Library and Quote
+// Verification Library (rev 0.9, 2023/12), appendix A.3 "Version 5 Quote
+// Format".
+type Quote struct {
+	Version uint16
+	TeeType uint32
+
+	// BodyType is the type of the report body (2 for TD 1.0, 3 for TD 1.5).
+	// Version 4 quotes always carry TD 1.0 bodies.
+	BodyType uint16
+
+	// Body holds the fields that are common to TD 1.0 and TD 1.5 report
+	// bodies.
+	Body *tdxpb.TDQuoteBody
+
+	// TeeTcbSvn2 is the TEE_TCB_SVN2 of TD 1.5 report body (nil otherwise).
+	TeeTcbSvn2 []byte
+
+	// MrServiceTD is the MRSERVICETD of TD 1.5 report body (nil otherwise).
+	MrServiceTD []byte
+
+	v4 *tdxpb.QuoteV4
+	v5 *sgx.QuoteSignature
+}
+
+const (
+	quoteVersion4 = 4
+	quoteVersion5 = 5
+
+	teeTypeTDX = 0x81
+
+	// BodyTypeTD10 is the type of TD 1.0 report body.
+	BodyTypeTD10 = 2
+	// BodyTypeTD15 is the type of TD 1.5 report body.
+	BodyTypeTD15 = 3
+
+	attestationKeyTypeECDSA256 = 2
+
+	certDataTypeQEReport = 6
+	certDataTypePCKChain = 5
+
+	sizeHeader         = 48
+	sizeBodyTD10       = 584
+	sizeBodyTD15       = 648
+	sizeTeeTcbSvn      = 16
+	sizeMeasurement    = 48
+	sizeAttributes     = 8
+	sizeReportData     = 64
+	sizeSGXReport      = 384
+	sizeSignature      = 64
+	sizePublicKey      = 64
+	sizeBodyDescriptor = 6
+)
+
+var (
+	errQuoteTooShort               = errors.New("tdx quote is too short")
+	errQuotePPID                   = errors.New("failed to read ppid from pck certificate of tdx quote")
+	errQuoteUnexpectedVersion      = errors.New("unexpected tdx quote version")
+	errQuoteUnexpectedKeyType      = errors.New("unexpected tdx quote attestation key type")
+	errQuoteUnexpectedBodyType     = errors.New("unexpected tdx quote body type")
+	errQuoteUnexpectedBodySize     = errors.New("unexpected tdx quote body size")
+	errQuoteUnexpectedCertDataType = errors.New("unexpected tdx quote certification data type")
+	errQuoteCollateralUnsupported  = errors.New("collateral verification is not supported for tdx quote v5")
+)
+
+// GetQuote generates TDX quote with provided report data on the platform we
+// are currently running on.
+func GetQuote(reportData [globals.TDXNonceSize]byte) (*Quote, error) {
+	provider, err := tdx.GetQuoteProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	raw, err := tdx.GetRawQuote(provider, reportData)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseQuote(raw)
+}
+
+// ParseQuote parses raw TDX quote of version 4 or 5.
+func ParseQuote(raw []byte) (*Quote, error) {
+	if len(raw) < sizeHeader {
+		return nil, fmt.Errorf("%w: %d < %d",
+			errQuoteTooShort, len(raw), sizeHeader,
+		)
+	}
+
+	switch version := binary.LittleEndian.Uint16(raw[0:2]); version {
+	case quoteVersion4:
+		return parseQuoteV4(raw)
+	case quoteVersion5:
+		return parseQuoteV5(raw)
+	default:
+		return nil, fmt.Errorf("%w: %d",
+			errQuoteUnexpectedVersion, version,
+		)
+	}
+}
+
+func parseQuoteV4(raw []byte) (*Quote, error) {
+	_quote, err := tdxabi.QuoteToProto(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	quote, ok := _quote.(*tdxpb.QuoteV4)
+	if !ok || quote == nil {
+		return nil, fmt.Errorf("%w: %s",
+			errTDXQuoteUnknownFormat, reflect.TypeOf(_quote),
+		)
+	}
+	if quote.Header == nil {
+		return nil, errTDXQuoteMissingHeader
+	}
+	if quote.TdQuoteBody == nil {
+		return nil, errTDXQuoteMissingBody
+	}
+
+	return &Quote{
+		Version:  quoteVersion4,
+		TeeType:  quote.Header.TeeType,
+		BodyType: BodyTypeTD10,
+		Body:     quote.TdQuoteBody,
+		v4:       quote,
+	}, nil
+}
+
+func parseQuoteV5(raw []byte) (*Quote, error) {
+	q := &Quote{
+		Version: quoteVersion5,
+		TeeType: binary.LittleEndian.Uint32(raw[4:8]),
+	}
+
+	if keyType := binary.LittleEndian.Uint16(raw[2:4]); keyType != attestationKeyTypeECDSA256 {
+		return nil, fmt.Errorf("%w: %d != %d",
+			errQuoteUnexpectedKeyType, keyType, attestationKeyTypeECDSA256,
+		)
+	}
+
+	r := reader{data: raw[sizeHeader:]}
+
+	q.BodyType = r.uint16()
+	bodySize := int(r.uint32())
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	switch {
+	case q.BodyType == BodyTypeTD10 && bodySize == sizeBodyTD10:
+	case q.BodyType == BodyTypeTD15 && bodySize == sizeBodyTD15:
+	case q.BodyType != BodyTypeTD10 && q.BodyType != BodyTypeTD15:
+		return nil, fmt.Errorf("%w: %d",
+			errQuoteUnexpectedBodyType, q.BodyType,
+		)
+	default:
+		return nil, fmt.Errorf("%w: %d (type %d)",
+			errQuoteUnexpectedBodySize, bodySize, q.BodyType,
+		)
+	}
+
+	body := reader{data: r.next(bodySize)}
+	q.Body = &tdxpb.TDQuoteBody{
+		TeeTcbSvn:      body.next(sizeTeeTcbSvn),
+		MrSeam:         body.next(sizeMeasurement),
+		MrSignerSeam:   body.next(sizeMeasurement),
+		SeamAttributes: body.next(sizeAttributes),
+		TdAttributes:   body.next(sizeAttributes),
+		Xfam:           body.next(sizeAttributes),
+		MrTd:           body.next(sizeMeasurement),
+		MrConfigId:     body.next(sizeMeasurement),
+		MrOwner:        body.next(sizeMeasurement),
+		MrOwnerConfig:  body.next(sizeMeasurement),
+		Rtmrs: [][]byte{
+			body.next(sizeMeasurement),
+			body.next(sizeMeasurement),
+			body.next(sizeMeasurement),
+			body.next(sizeMeasurement),
+		},
+		ReportData: body.next(sizeReportData),
+	}
+	if q.BodyType == BodyTypeTD15 {
+		q.TeeTcbSvn2 = body.next(sizeTeeTcbSvn)
+		q.MrServiceTD = body.next(sizeMeasurement)
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if body.err != nil {
+		return nil, body.err
+	}
+
+	sig := &sgx.QuoteSignature{
+		Signed: clone(raw[:sizeHeader+sizeBodyDescriptor+bodySize]),
+	}
+
+	r = reader{data: r.next(int(r.uint32())), err: r.err}
+	sig.Signature = r.next(sizeSignature)
+	sig.AttestationKey = r.next(sizePublicKey)
+
+	if certDataType := r.uint16(); r.err == nil && certDataType != certDataTypeQEReport {
+		return nil, fmt.Errorf("%w: %d != %d",
+			errQuoteUnexpectedCertDataType, certDataType, certDataTypeQEReport,
+		)
+	}
+
+	r = reader{data: r.next(int(r.uint32())), err: r.err}
+	sig.QEReportRaw = r.next(sizeSGXReport)
+	sig.QEReportSignature = r.next(sizeSignature)
+	sig.QEAuthData = r.next(int(r.uint16()))
+
+	if certDataType := r.uint16(); r.err == nil && certDataType != certDataTypePCKChain {
+		return nil, fmt.Errorf("%w: %d != %d",
+			errQuoteUnexpectedCertDataType, certDataType, certDataTypePCKChain,
+		)
+	}
+
+	certData := r.next(int(r.uint32()))
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	pckChain, err := sgx.ParsePCKChain(certData)
+	if err != nil {
+		return nil, err
+	}
+	sig.PCKChain = pckChain
+
+	q.v5 = sig
+
+	return q, nil
+}
+
+// PCKCertificate returns the leaf PCK certificate of the quote (it identifies
+// the platform that produced the quote).
+func (q *Quote) PCKCertificate() (*x509.Certificate, error) {
+	if q.v5 != nil {
+		return q.v5.PCKChain[0], nil
+	}
+
+	certData := q.v4.GetSignedData().
+		GetCertificationData().
+		GetQeReportCertificationData().
+		GetPckCertificateChainData().
+		GetPckCertChain()
+	pckChain, err := sgx.ParsePCKChain(certData)
+	if err != nil {
+		return nil, err
+	}
+
+	return pckChain[0], nil
+}
+
+// PPID returns the platform provisioning id (hex-encoded) from the PCK
+// certificate of the quote.
+func (q *Quote) PPID() (string, error) {
+	cert, err := q.PCKCertificate()
+	if err != nil {
+		return "", err
+	}
+
+	extensions, err := pcs.PckCertificateExtensions(cert)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", errQuotePPID, err)
+	}
+	if extensions.PPID == "" {
+		return "", errQuotePPID
+	}
+
+	return extensions.PPID, nil
+}
+
+// TCBStatus returns the TCB status of the platform and of the TDX module that
+// produced the quote, as per TDX TCB info collateral from Intel PCS.
+func (q *Quote) TCBStatus(opts *sgx.VerifyOptions) (string, error) {
+	pck, err := q.PCKCertificate()
+	if err != nil {
+		return "", err
+	}
+
+	return sgx.TDXTCBStatus(pck, q.Body.GetTeeTcbSvn(), opts)
+}
+
+// Verify verifies the genuineness of the quote.
+//
+// Version 4 quotes are verified by go-tdx-guest (including the collateral, if
+// requested by the options). For version 5 quotes only the signature chain
+// (PCK certificate, QE report and the quote signature) is verified.
+func (q *Quote) Verify(opts *tdxverify.Options) error {
+	if q.v4 != nil {
+		return tdxverify.TdxQuote(q.v4, opts)
+	}
+
+	if opts.GetCollateral {
+		return errQuoteCollateralUnsupported
+	}
+
+	roots := opts.TrustedRoots
+	if roots == nil {
+		roots = sgx.TrustedRoots()
+	}
+	now := opts.Now
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	return q.v5.Verify(roots, now)
+}
+
+type reader struct {
+	data []byte
+	err  error
+}
+
+func (r *reader) next(size int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.data) < size {
+		r.err = fmt.Errorf("%w: need %d more bytes, have %d",
+			errQuoteTooShort, size, len(r.data),
+		)
+		return nil
+	}
+	res := clone(r.data[:size])
+	r.data = r.data[size:]
+	return res
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func clone(b []byte) []byte {
+	res := make([]byte, len(b))
+	copy(res, b)
+	return res
+}
@@ -0,0 +1,229 @@
+package tdx_test
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx/tdxtest"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/stretchr/testify/assert"
+
+	tdxpcs "github.com/google/go-tdx-guest/pcs"
+	tdxverify "github.com/google/go-tdx-guest/verify"
+)
+
+var now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// newBodyTD15 fills all measurements of td 1.5 report body with mr, and sets
+// each component of tee_tcb_svn2 to svn.
+func newBodyTD15(mr, svn byte) []byte {
+	body := make([]byte, 648)
+	for idx := 136; idx < 520; idx++ { // mr_td .. rtmr[3]
+		body[idx] = mr
+	}
+	for idx := 584; idx < 600; idx++ { // tee_tcb_svn2
+		body[idx] = svn
+	}
+	for idx := 600; idx < 648; idx++ { // mr_service_td
+		body[idx] = mr
+	}
+	return body
+}
+
+func TestParseQuote(t *testing.T) {
+	p := tdxtest.NewPKI(t, now, nil)
+	opts := &tdxverify.Options{TrustedRoots: p.Roots, Now: now}
+
+	{ // td 1.0 body
+		quote, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD10, newBodyTD15(0xaa, 1)[:584]))
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(5), quote.Version)
+		assert.Equal(t, uint16(tdx.BodyTypeTD10), quote.BodyType)
+		assert.Nil(t, quote.MrServiceTD)
+		assert.NoError(t, quote.Verify(opts))
+	}
+
+	{ // td 1.5 body
+		quote, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, newBodyTD15(0xaa, 1)))
+		assert.NoError(t, err)
+		assert.Equal(t, uint16(tdx.BodyTypeTD15), quote.BodyType)
+		assert.Len(t, quote.Body.Rtmrs, 4)
+		assert.Equal(t, byte(0xaa), quote.Body.Rtmrs[3][47])
+		assert.Equal(t, byte(0xaa), quote.MrServiceTD[0])
+		assert.Equal(t, byte(1), quote.TeeTcbSvn2[15])
+		assert.NoError(t, quote.Verify(opts))
+
+		pck, err := quote.PCKCertificate()
+		assert.NoError(t, err)
+		assert.Equal(t, "Test SGX PCK Certificate", pck.Subject.CommonName)
+		_, err = quote.PPID() // test pck certificate carries no sgx extensions
+		assert.Error(t, err)
+	}
+
+	{ // tampered body
+		raw := tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, newBodyTD15(0xaa, 1))
+		raw[48+6+600] ^= 0xff
+		quote, err := tdx.ParseQuote(raw)
+		assert.NoError(t, err)
+		assert.Error(t, quote.Verify(opts))
+	}
+
+	{ // untrusted root
+		quote, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, tdxtest.NewPKI(t, now, nil), tdx.BodyTypeTD15, newBodyTD15(0xaa, 1)))
+		assert.NoError(t, err)
+		assert.Error(t, quote.Verify(opts))
+	}
+
+	{ // body size does not match its type
+		_, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, newBodyTD15(0xaa, 1)[:584]))
+		assert.Error(t, err)
+	}
+
+	{ // truncated quote
+		raw := tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, newBodyTD15(0xaa, 1))
+		_, err := tdx.ParseQuote(raw[:len(raw)-100])
+		assert.Error(t, err)
+	}
+
+	{ // unknown version
+		raw := tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, newBodyTD15(0xaa, 1))
+		binary.LittleEndian.PutUint16(raw, 6)
+		_, err := tdx.ParseQuote(raw)
+		assert.Error(t, err)
+	}
+}
+
+func TestQuotePPID(t *testing.T) {
+	ppid := []byte("0123456789abcdef")
+	p := tdxtest.NewPKI(t, now, ppid)
+
+	quote, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, newBodyTD15(0xaa, 1)))
+	assert.NoError(t, err)
+	assert.NoError(t, quote.Verify(&tdxverify.Options{TrustedRoots: p.Roots, Now: now}))
+
+	res, err := quote.PPID()
+	assert.NoError(t, err)
+	assert.Equal(t, hex.EncodeToString(ppid), res)
+
+	{ // another platform
+		other, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, tdxtest.NewPKI(t, now, []byte("fedcba9876543210")), tdx.BodyTypeTD15, newBodyTD15(0xaa, 1)))
+		assert.NoError(t, err)
+		res, err := other.PPID()
+		assert.NoError(t, err)
+		assert.Equal(t, hex.EncodeToString([]byte("fedcba9876543210")), res)
+	}
+}
+
+func TestQuoteTCBStatus(t *testing.T) {
+	p := tdxtest.NewPKI(t, now, []byte("0123456789abcdef"))
+
+	// quote returns the quote of the tdx module with the tee_tcb_svn
+	quote := func(svn byte) *tdx.Quote {
+		body := newBodyTD15(0xaa, 1)
+		body[0] = svn
+		q, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, body))
+		assert.NoError(t, err)
+		return q
+	}
+
+	pcs := tdxtest.NewPCS(t, p, now,
+		tdxtest.TCBLevel(tdxpcs.TcbComponentStatusUpToDate, 5),
+		tdxtest.TCBLevel(tdxpcs.TcbComponentStatusOutOfDate, 3),
+	)
+	opts := &sgx.VerifyOptions{Getter: pcs, TrustedRoots: p.Roots, Now: now}
+
+	{ // latest tdx module
+		status, err := quote(5).TCBStatus(opts)
+		assert.NoError(t, err)
+		assert.Equal(t, "UpToDate", status)
+	}
+
+	{ // outdated tdx module
+		status, err := quote(4).TCBStatus(opts)
+		assert.NoError(t, err)
+		assert.Equal(t, "OutOfDate", status)
+	}
+
+	{ // no matching tcb level
+		_, err := quote(2).TCBStatus(opts)
+		assert.Error(t, err)
+	}
+
+	{ // expired collateral
+		_, err := quote(5).TCBStatus(&sgx.VerifyOptions{Getter: pcs, TrustedRoots: p.Roots, Now: now.Add(2 * time.Hour)})
+		assert.Error(t, err)
+	}
+
+	{ // collateral that is not signed by the roots
+		other := tdxtest.NewPKI(t, now, []byte("0123456789abcdef"))
+		_, err := quote(5).TCBStatus(&sgx.VerifyOptions{Getter: pcs, TrustedRoots: other.Roots, Now: now})
+		assert.Error(t, err)
+	}
+}
+
+func TestMatchesQuote(t *testing.T) {
+	p := tdxtest.NewPKI(t, now, nil)
+
+	td15, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, newBodyTD15(0xaa, 2)))
+	assert.NoError(t, err)
+
+	td10, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD10, newBodyTD15(0xaa, 2)[:584]))
+	assert.NoError(t, err)
+
+	byte48 := func(b byte) *types.Byte48 {
+		var res types.Byte48
+		for idx := range res {
+			res[idx] = b
+		}
+		return &res
+	}
+	byte16 := func(b byte) *types.Byte16 {
+		var res types.Byte16
+		for idx := range res {
+			res[idx] = b
+		}
+		return &res
+	}
+
+	{ // matching td 1.5 registers
+		td := &tdx.TDX{
+			MrTD:          byte48(0xaa),
+			MrServiceTD:   byte48(0xaa),
+			MinTeeTcbSvn2: byte16(2),
+		}
+		reported, _ := td.MatchesQuote(td15)
+		assert.Empty(t, failures(reported))
+	}
+
+	{ // mismatching td 1.5 registers
+		td := &tdx.TDX{
+			MrServiceTD:   byte48(0xbb),
+			MinTeeTcbSvn2: byte16(3),
+		}
+		reported, _ := td.MatchesQuote(td15)
+		assert.Len(t, failures(reported), 2)
+	}
+
+	{ // td 1.5 registers are required, but the body is td 1.0
+		td := &tdx.TDX{
+			MrTD:        byte48(0xaa),
+			MrServiceTD: byte48(0xaa),
+		}
+		reported, _ := td.MatchesQuote(td10)
+		assert.Len(t, failures(reported), 1)
+	}
+}
+
+func failures(errs []error) []error {
+	res := make([]error, 0, len(errs))
+	for _, err := range errs {
+		if err != nil {
+			res = append(res, err)
+		}
+	}
+	return res
+}
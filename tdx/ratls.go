@@ -0,0 +1,115 @@
+package tdx
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+
+	tdx "github.com/google/go-tdx-guest/client"
+)
+
+// OIDRATLSQuote is the object identifier of the x.509 extension that carries
+// TDX quote in RA-TLS certificates.
+var OIDRATLSQuote = asn1.ObjectIdentifier{1, 2, 840, 113741, 1, 5, 5, 1, 6}
+
+var (
+	errRATLSCertificateIsNil   = errors.New("ra-tls certificate is nil")
+	errRATLSQuoteIsMissing     = errors.New("ra-tls certificate has no tdx quote extension")
+	errRATLSCertificateExpired = errors.New("ra-tls certificate is not valid at this time")
+)
+
+// RATLSReportData computes the report data that binds the quote embedded into
+// RA-TLS certificate to the public key of that certificate the way Gramine
+// and Intel RA-TLS libraries do it (i.e. SHA256(public key) followed by 32
+// zero bytes).
+func RATLSReportData(publicKey []byte) [globals.TDXNonceSize]byte {
+	res := [globals.TDXNonceSize]byte{}
+	h := sha256.Sum256(publicKey)
+	copy(res[:], h[:])
+	return res
+}
+
+// RATLSBindsKey reports whether the report data of the quote embedded into
+// RA-TLS certificate binds the public key of that certificate.
+func RATLSBindsKey(reportData []byte, publicKey []byte) bool {
+	expected := RATLSReportData(publicKey)
+
+	return subtle.ConstantTimeCompare(expected[:], reportData) == 1
+}
+
+// QuoteFromRATLSCertificate extracts raw TDX quote from RA-TLS certificate.
+func QuoteFromRATLSCertificate(cert *x509.Certificate, now time.Time) ([]byte, error) {
+	if cert == nil {
+		return nil, errRATLSCertificateIsNil
+	}
+
+	if now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+		return nil, fmt.Errorf("%w: %s (not before), %s (not after)",
+			errRATLSCertificateExpired, cert.NotBefore, cert.NotAfter,
+		)
+	}
+
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(OIDRATLSQuote) {
+			return ext.Value, nil
+		}
+	}
+
+	return nil, errRATLSQuoteIsMissing
+}
+
+// NewRATLSCertificate creates self-signed RA-TLS certificate with the TDX
+// quote (generated on the platform we are currently running on) that binds
+// the public part of the provided key.
+func NewRATLSCertificate(
+	key crypto.Signer,
+	commonName string,
+	validity time.Duration,
+) ([]byte, error) {
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := tdx.GetQuoteProvider()
+	if err != nil {
+		return nil, err
+	}
+
+	quote, err := tdx.GetRawQuote(provider, RATLSReportData(publicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-time.Minute),
+		NotAfter:     now.Add(validity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
+
+		ExtraExtensions: []pkix.Extension{{
+			Id:    OIDRATLSQuote,
+			Value: quote,
+		}},
+	}
+
+	return x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+}
@@ -0,0 +1,73 @@
+package tdx_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuoteFromRATLSCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	quote := []byte{0x04, 0x00, 0x02, 0x00, 0x81, 0x00, 0x00, 0x00}
+
+	newCert := func(extensions ...pkix.Extension) *x509.Certificate {
+		template := &x509.Certificate{
+			SerialNumber:    big.NewInt(1),
+			Subject:         pkix.Name{CommonName: "test"},
+			NotBefore:       now.Add(-time.Minute),
+			NotAfter:        now.Add(time.Hour),
+			ExtraExtensions: extensions,
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		assert.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.NoError(t, err)
+		return cert
+	}
+
+	{ // with quote
+		cert := newCert(pkix.Extension{Id: tdx.OIDRATLSQuote, Value: quote})
+		res, err := tdx.QuoteFromRATLSCertificate(cert, now)
+		assert.NoError(t, err)
+		assert.Equal(t, quote, res)
+
+		_, err = tdx.QuoteFromRATLSCertificate(cert, now.Add(2*time.Hour))
+		assert.Error(t, err)
+	}
+
+	{ // without quote
+		cert := newCert()
+		_, err := tdx.QuoteFromRATLSCertificate(cert, now)
+		assert.Error(t, err)
+	}
+}
+
+func TestRATLSBindsKey(t *testing.T) {
+	publicKey := []byte("public key of ra-tls certificate")
+
+	{ // gramine/intel layout
+		reportData := tdx.RATLSReportData(publicKey)
+		h := sha256.Sum256(publicKey)
+		assert.Equal(t, h[:], reportData[:32])
+		assert.Equal(t, make([]byte, 32), reportData[32:])
+		assert.True(t, tdx.RATLSBindsKey(reportData[:], publicKey))
+	}
+
+	{ // another key
+		reportData := tdx.RATLSReportData([]byte("another key"))
+		assert.False(t, tdx.RATLSBindsKey(reportData[:], publicKey))
+		assert.False(t, tdx.RATLSBindsKey(nil, publicKey))
+	}
+}
@@ -1,19 +1,15 @@
 package tdx
 
 import (
+	"crypto/sha512"
 	"crypto/subtle"
 	"errors"
 	"fmt"
-	"reflect"
 
 	"github.com/flashbots/vault-auth-plugin-attest/globals"
 	"github.com/flashbots/vault-auth-plugin-attest/types"
 	"github.com/flashbots/vault-auth-plugin-attest/utils"
 	"github.com/hashicorp/vault/sdk/helper/tokenutil"
-
-	tdxabi "github.com/google/go-tdx-guest/abi"
-	tdx "github.com/google/go-tdx-guest/client"
-	tdxpb "github.com/google/go-tdx-guest/proto/tdx"
 )
 
 // TDX reflects our expectations about TDX trusted domain.
@@ -27,7 +23,7 @@ import (
 //   - https://download.01.org/intel-sgx/latest/dcap-latest/linux/docs/SGX_DCAP_Caching_Service_Design_Guide.pdf
 //   - https://download.01.org/intel-sgx/latest/dcap-latest/linux/docs/Intel_TDX_DCAP_Quoting_Library_API.pdf
 type TDX struct {
-	tokenutil.TokenParams `json:"-" mapstructure:"-" structs:"-"`
+	tokenutil.TokenParams `mapstructure:"-" structs:"-"`
 
 	// Name is the name of trusted domain.
 	Name string `json:"-" mapstructure:"-" structs:"-"`
@@ -78,6 +74,21 @@ type TDX struct {
 	// more information on this measurement, contact the TD workload owner.
 	RTMR3 *types.Byte48 `json:"tdx_rtmr3,omitempty" mapstructure:"tdx_rtmr3,omitempty" structs:"tdx_rtmr3,omitempty"`
 
+	// MrServiceTD is the expected measurement of the service TDs bound to the
+	// TD (e.g. migration TD).
+	//
+	// It is only reported by TD 1.5 report bodies (i.e. with quotes of version
+	// 5 and up), therefore when set the quotes with TD 1.0 bodies are rejected.
+	MrServiceTD *types.Byte48 `json:"tdx_mr_service_td,omitempty" mapstructure:"tdx_mr_service_td,omitempty" structs:"tdx_mr_service_td,omitempty"`
+
+	// MinTeeTcbSvn2 is the minimum expected TEE_TCB_SVN2 (i.e. the security
+	// version of the TDX module after its TD-preserving update), verified per
+	// component.
+	//
+	// It is only reported by TD 1.5 report bodies (i.e. with quotes of version
+	// 5 and up), therefore when set the quotes with TD 1.0 bodies are rejected.
+	MinTeeTcbSvn2 *types.Byte16 `json:"tdx_min_tee_tcb_svn2,omitempty" mapstructure:"tdx_min_tee_tcb_svn2,omitempty" structs:"tdx_min_tee_tcb_svn2,omitempty"`
+
 	// CheckTDAttrDebug indicates whether TUD.DEBUG == 0 is verified.
 	//
 	// TUD.DEBUG defines whether the TD runs in TD debug mode (set to 1) or not
@@ -94,6 +105,20 @@ type TDX struct {
 	// See also: https://intel.github.io/ccc-linux-guest-hardening-docs/security-spec.html#safety-against-ve-in-kernel-code
 	CheckSeptVeDisable bool `json:"tdx_check_sept_ve_disable" mapstructure:"tdx_check_sept_ve_disable" structs:"tdx_check_sept_ve_disable"`
 
+	// InstanceEnrollment indicates whether the instances of the TD are allowed
+	// to enroll their own keys with the first attested contact (i.e. without
+	// the pre-shared TOTP secret), and then use those keys for the subsequent
+	// logins.
+	InstanceEnrollment bool `json:"instance_enrollment" mapstructure:"instance_enrollment" structs:"instance_enrollment"`
+
+	// TLSBinding indicates whether the quote must be bound to the TLS session
+	// of the client, i.e. whether the report data must be
+	// SHA512(nonce || client TLS certificate public key).
+	//
+	// This prevents relaying of the quote (e.g. generated by a compromised
+	// host) through another connection.
+	TLSBinding bool `json:"tdx_tls_binding" mapstructure:"tdx_tls_binding" structs:"tdx_tls_binding"`
+
 	// TODO: add XFAM?
 }
 
@@ -112,6 +137,9 @@ var (
 	errTDXQuoteMismatchRTMR1         = errors.New("tdx rtmr[1] mismatch")
 	errTDXQuoteMismatchRTMR2         = errors.New("tdx rtmr[2] mismatch")
 	errTDXQuoteMismatchRTMR3         = errors.New("tdx rtmr[3] mismatch")
+	errTDXQuoteMismatchMrServiceTD   = errors.New("tdx mr_service_td mismatch")
+	errTDXQuoteTeeTcbSvn2TooLow      = errors.New("tdx tee_tcb_svn2 is lower than expected")
+	errTDXQuoteIsNotTD15             = errors.New("tdx quote has no td 1.5 report body")
 	errTDXQuoteUnderDebugDetected    = errors.New("tdx td under debug detected")
 	errTDXQuoteSeptVeDisableIsUnset  = errors.New("tdx td sept_ve_disabled is unset")
 	errTDXQuoteUnknownFormat         = errors.New("unknown tdx quote format")
@@ -129,36 +157,49 @@ var (
 	}
 )
 
-// FromPlatform creates new TDX instance from the parameters of the platform
-// we are currently running on.
-func FromPlatform() (*TDX, error) {
-	provider, err := tdx.GetQuoteProvider()
-	if err != nil {
-		return nil, err
+// ReportData computes the report data that TD should include into its quote
+// so that the latter is bound to the nonce as well as to any other provided
+// values (e.g. public keys).
+//
+// Without any extra values the report data is just the nonce itself.
+// Otherwise it's SHA512(nonce || value[0] || value[1] || ...).
+func ReportData(nonce []byte, values ...[]byte) [globals.TDXNonceSize]byte {
+	res := [globals.TDXNonceSize]byte{}
+
+	if len(values) == 0 {
+		copy(res[:], nonce)
+		return res
 	}
 
-	rawQuote, err := tdx.GetRawQuote(provider, [globals.TDXNonceSize]byte{})
-	if err != nil {
-		return nil, err
+	h := sha512.New()
+	h.Write(nonce)
+	for _, v := range values {
+		h.Write(v)
 	}
+	copy(res[:], h.Sum(nil))
+
+	return res
+}
 
-	_quote, err := tdxabi.QuoteToProto(rawQuote)
+// FromPlatform creates new TDX instance from the parameters of the platform
+// we are currently running on.
+func FromPlatform() (*TDX, error) {
+	quote, err := GetQuote([globals.TDXNonceSize]byte{})
 	if err != nil {
 		return nil, err
 	}
 
-	quote := _quote.(*tdxpb.QuoteV4)
-	if quote == nil {
-		return nil, fmt.Errorf("%w: %s",
-			errTDXQuoteUnknownFormat, reflect.TypeOf(_quote),
-		)
-	}
+	return FromQuote(quote)
+}
 
-	if quote.TdQuoteBody == nil {
+// FromQuote creates new TDX instance from the parameters reported by the
+// quote.
+func FromQuote(quote *Quote) (*TDX, error) {
+	if quote.Body == nil {
 		return nil, errTDXQuoteMissingBody
 	}
 
-	body := quote.TdQuoteBody
+	body := quote.Body
 
 	if len(body.Rtmrs) != 4 {
 		return nil, fmt.Errorf("%w: %d != 4",
@@ -166,7 +207,7 @@ func FromPlatform() (*TDX, error) {
 		)
 	}
 
-	return &TDX{
+	res := &TDX{
 		MrOwner:            (*types.Byte48)(body.MrOwner),
 		MrOwnerConfig:      (*types.Byte48)(body.MrOwnerConfig),
 		MrConfigID:         (*types.Byte48)(body.MrConfigId),
@@ -177,10 +218,16 @@ func FromPlatform() (*TDX, error) {
 		RTMR3:              (*types.Byte48)(body.Rtmrs[3]),
 		CheckDebug:         utils.ConstantTimeMask(maskDebug[:], body.TdAttributes) == 1,
 		CheckSeptVeDisable: utils.ConstantTimeMask(maskSeptVeDisable[:], body.TdAttributes) == 1,
-	}, nil
+	}
+	if quote.BodyType == BodyTypeTD15 {
+		res.MrServiceTD = (*types.Byte48)(quote.MrServiceTD)
+		res.MinTeeTcbSvn2 = (*types.Byte16)(quote.TeeTcbSvn2)
+	}
+
+	return res, nil
 }
 
-func (td *TDX) MatchesQuoteV4(quote *tdxpb.QuoteV4) (
+func (td *TDX) MatchesQuote(quote *Quote) (
 	[]error, []error,
 ) {
 	type test struct {
@@ -195,38 +242,33 @@ func (td *TDX) MatchesQuoteV4(quote *tdxpb.QuoteV4) (
 				errTDXQuoteIsNil,
 			}, nil
 		}
-		if quote.Header == nil {
-			return []error{
-				errTDXQuoteMissingHeader,
-			}, nil
-		}
-		if quote.Header.TeeType != 0x81 {
+		if quote.TeeType != teeTypeTDX {
 			return []error{
 				errTDXQuoteIsNotTDX,
 			}, nil
 		}
-		if quote.TdQuoteBody == nil {
+		if quote.Body == nil {
 			return []error{
 				errTDXQuoteMissingBody,
 			}, nil
 		}
-		if len(quote.TdQuoteBody.Rtmrs) != 4 {
+		if len(quote.Body.Rtmrs) != 4 {
 			return []error{
 				fmt.Errorf("%w: %d != 4",
-					errTDXQuoteUnexpectedRTMRsCount, len(quote.TdQuoteBody.Rtmrs),
+					errTDXQuoteUnexpectedRTMRsCount, len(quote.Body.Rtmrs),
 				),
 			}, nil
 		}
-		if len(quote.TdQuoteBody.TdAttributes) != 8 {
+		if len(quote.Body.TdAttributes) != 8 {
 			return []error{
 				fmt.Errorf("%w: %d != 8",
-					errTDXQuoteUnexpectedTDAttrSize, len(quote.TdQuoteBody.TdAttributes),
+					errTDXQuoteUnexpectedTDAttrSize, len(quote.Body.TdAttributes),
 				),
 			}, nil
 		}
 	}
 
-	body := quote.TdQuoteBody
+	body := quote.Body
 
 	tests := []test{
 		{ // mr_owner
@@ -271,8 +313,16 @@ func (td *TDX) MatchesQuoteV4(quote *tdxpb.QuoteV4) (
 		},
 	}
 
-	errs := make([]error, 0, len(tests)+2)
-	dump := make([]error, 0, len(tests)+2)
+	if quote.BodyType == BodyTypeTD15 {
+		tests = append(tests, test{ // mr_service_td
+			expect: td.MrServiceTD,
+			actual: &quote.MrServiceTD,
+			err:    errTDXQuoteMismatchMrServiceTD,
+		})
+	}
+
+	errs := make([]error, 0, len(tests)+4)
+	dump := make([]error, 0, len(tests)+4)
 
 	{ // report fields
 		dummy := types.Byte48{}
@@ -324,6 +374,31 @@ func (td *TDX) MatchesQuoteV4(quote *tdxpb.QuoteV4) (
 		}
 	}
 
+	{ // td 1.5 report fields
+		if quote.BodyType != BodyTypeTD15 {
+			if td.MrServiceTD != nil || td.MinTeeTcbSvn2 != nil {
+				errs = append(errs, errTDXQuoteIsNotTD15)
+			}
+		} else {
+			expect := types.Byte16{}
+			if td.MinTeeTcbSvn2 != nil {
+				expect = *td.MinTeeTcbSvn2
+			}
+			low := 0
+			for idx, svn := range quote.TeeTcbSvn2 {
+				// constant-time "svn < expect"
+				low |= int((uint16(svn) - uint16(expect[idx])) >> 15)
+			}
+			if td.MinTeeTcbSvn2 != nil {
+				if low != 0 {
+					errs = append(errs, errTDXQuoteTeeTcbSvn2TooLow)
+				} else {
+					errs = append(errs, nil)
+				}
+			}
+		}
+	}
+
 	return errs, dump
 }
 
@@ -331,6 +406,10 @@ func (td *TDX) GetName() string {
 	return td.Name
 }
 
+func (td *TDX) SetName(name string) {
+	td.Name = name
+}
+
 func (td *TDX) AttestationType() string {
 	return "tdx"
 }
@@ -0,0 +1,247 @@
+// Package tdxtest assembles tdx quotes (and the pck certificates that sign
+// them) for the tests.
+package tdxtest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-tdx-guest/pcs"
+	"github.com/stretchr/testify/require"
+)
+
+// PKI is the certificate chain that mimics the one issued by intel.
+type PKI struct {
+	// Roots holds the root ca.
+	Roots *x509.CertPool
+
+	// Chain is pem-encoded pck certificate, intermediate ca and root ca.
+	Chain []byte
+
+	// PCK is the key of the pck certificate.
+	PCK *ecdsa.PrivateKey
+
+	root    *x509.Certificate
+	rootKey *ecdsa.PrivateKey
+}
+
+// sgxExtension is the element of the sgx extension of pck certificate.
+type sgxExtension struct {
+	Type  asn1.ObjectIdentifier
+	Value interface{}
+}
+
+// NewPKI generates root ca, intermediate ca and pck certificate valid around
+// now. When ppid is provided, the pck certificate carries the sgx extensions
+// (with that ppid) the way the ones issued by intel do.
+func NewPKI(t testing.TB, now time.Time, ppid []byte) *PKI {
+	var extensions []pkix.Extension
+	if ppid != nil {
+		extensions = append(extensions, newSGXExtensions(t, ppid))
+	}
+
+	root, rootKey := issue(t, now, "Test SGX Root CA", true, nil, nil)
+	intermediate, intermediateKey := issue(t, now, "Test SGX PCK Platform CA", true, root, rootKey)
+	pck, pckKey := issue(t, now, "Test SGX PCK Certificate", false, intermediate, intermediateKey, extensions...)
+
+	res := &PKI{
+		Roots: x509.NewCertPool(),
+		PCK:   pckKey,
+
+		root:    root,
+		rootKey: rootKey,
+	}
+	res.Roots.AddCert(root)
+	for _, cert := range []*x509.Certificate{pck, intermediate, root} {
+		res.Chain = append(res.Chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})...)
+	}
+	return res
+}
+
+// issue issues the certificate valid around now (self-signed, if there's no
+// parent).
+func issue(
+	t testing.TB,
+	now time.Time,
+	cn string,
+	isCA bool,
+	parent *x509.Certificate,
+	parentKey *ecdsa.PrivateKey,
+	extensions ...pkix.Extension,
+) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  isCA,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		ExtraExtensions:       extensions,
+	}
+	if len(extensions) > 0 {
+		template.SubjectKeyId = []byte("test pck certificate")
+		template.CRLDistributionPoints = []string{"https://example.com/pckcrl"}
+	}
+	if parent == nil {
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return cert, key
+}
+
+// newSGXExtensions returns the sgx extension of pck certificate with the ppid
+// (and the tcb, pceid and fmspc that go together with it).
+func newSGXExtensions(t testing.TB, ppid []byte) pkix.Extension {
+	tcb := make([]sgxExtension, 0, 18)
+	for idx := 1; idx <= 16; idx++ { // sgx tcb components
+		oid := append(asn1.ObjectIdentifier{}, pcs.OidTCB...)
+		tcb = append(tcb, sgxExtension{Type: append(oid, idx), Value: idx})
+	}
+	tcb = append(tcb,
+		sgxExtension{Type: pcs.OidPCESvn, Value: 11},
+		sgxExtension{Type: pcs.OidCPUSvn, Value: make([]byte, 16)},
+	)
+
+	value, err := asn1.Marshal([]sgxExtension{
+		{Type: pcs.OidPPID, Value: ppid},
+		{Type: pcs.OidTCB, Value: tcb},
+		{Type: pcs.OidPCEID, Value: []byte{0x00, 0x00}},
+		{Type: pcs.OidFMSPC, Value: []byte{0x00, 0x80, 0x6f, 0x05, 0x00, 0x00}},
+	})
+	require.NoError(t, err)
+
+	return pkix.Extension{Id: pcs.OidSgxExtension, Value: value}
+}
+
+func sign(t testing.TB, key *ecdsa.PrivateKey, data []byte) []byte {
+	digest := sha256.Sum256(data)
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	require.NoError(t, err)
+	res := make([]byte, 64)
+	r.FillBytes(res[:32])
+	s.FillBytes(res[32:])
+	return res
+}
+
+// NewQuoteV5 assembles tdx quote (version 5) as the quoting enclave would.
+func NewQuoteV5(t testing.TB, p *PKI, bodyType uint16, body []byte) []byte {
+	attKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	attPub := make([]byte, 64)
+	attKey.X.FillBytes(attPub[:32])
+	attKey.Y.FillBytes(attPub[32:])
+
+	authData := []byte("qe auth data")
+
+	qeReport := make([]byte, 384)
+	digest := sha256.Sum256(append(append([]byte{}, attPub...), authData...))
+	copy(qeReport[320:], digest[:])
+
+	signed := make([]byte, 48)
+	binary.LittleEndian.PutUint16(signed[0:], 5)    // version
+	binary.LittleEndian.PutUint16(signed[2:], 2)    // ecdsa-256-with-p-256
+	binary.LittleEndian.PutUint32(signed[4:], 0x81) // tdx
+	signed = binary.LittleEndian.AppendUint16(signed, bodyType)
+	signed = binary.LittleEndian.AppendUint32(signed, uint32(len(body)))
+	signed = append(signed, body...)
+
+	qeCertData := append([]byte{}, qeReport...)
+	qeCertData = append(qeCertData, sign(t, p.PCK, qeReport)...)
+	qeCertData = binary.LittleEndian.AppendUint16(qeCertData, uint16(len(authData)))
+	qeCertData = append(qeCertData, authData...)
+	qeCertData = binary.LittleEndian.AppendUint16(qeCertData, 5) // pck cert chain
+	qeCertData = binary.LittleEndian.AppendUint32(qeCertData, uint32(len(p.Chain)))
+	qeCertData = append(qeCertData, p.Chain...)
+
+	sig := sign(t, attKey, signed)
+	sig = append(sig, attPub...)
+	sig = binary.LittleEndian.AppendUint16(sig, 6) // qe report cert data
+	sig = binary.LittleEndian.AppendUint32(sig, uint32(len(qeCertData)))
+	sig = append(sig, qeCertData...)
+
+	res := binary.LittleEndian.AppendUint32(signed, uint32(len(sig)))
+	return append(res, sig...)
+}
+
+// PCS serves tdx tcb info collateral (signed by the root ca of the pki) the
+// way intel pcs does.
+type PCS struct {
+	header string
+	body   []byte
+}
+
+// TCBLevel returns the tcb level that the platform of the pck certificate
+// (issued with ppid) meets, provided that the first svn of tee_tcb_svn of the
+// quote is at least teeTcbSvn.
+func TCBLevel(status pcs.TcbComponentStatus, teeTcbSvn byte) pcs.TcbLevel {
+	level := pcs.TcbLevel{
+		Tcb: pcs.Tcb{
+			SgxTcbcomponents: make([]pcs.TcbComponent, 16),
+			Pcesvn:           11,
+			TdxTcbcomponents: make([]pcs.TcbComponent, 16),
+		},
+		TcbDate:   "2024-03-13T00:00:00Z",
+		TcbStatus: status,
+	}
+	level.Tcb.TdxTcbcomponents[0].Svn = teeTcbSvn
+	return level
+}
+
+// NewPCS returns the pcs that serves tdx tcb info with the tcb levels (for the
+// platform of the pck certificate issued with ppid) valid around now.
+func NewPCS(t testing.TB, p *PKI, now time.Time, levels ...pcs.TcbLevel) *PCS {
+	signing, signingKey := issue(t, now, "Test SGX TCB Signing", false, p.root, p.rootKey)
+
+	tcbInfo, err := json.Marshal(map[string]interface{}{ // pcs.TcbInfo can not be marshalled as-is
+		"id":                      "TDX",
+		"version":                 3,
+		"issueDate":               now.Add(-time.Hour),
+		"nextUpdate":              now.Add(time.Hour),
+		"fmspc":                   "00806f050000",
+		"pceId":                   "0000",
+		"tcbType":                 0,
+		"tcbEvaluationDataNumber": 17,
+		"tcbLevels":               levels,
+	})
+	require.NoError(t, err)
+
+	body, err := json.Marshal(map[string]interface{}{
+		"tcbInfo":   json.RawMessage(tcbInfo),
+		"signature": hex.EncodeToString(sign(t, signingKey, tcbInfo)),
+	})
+	require.NoError(t, err)
+
+	chain := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: signing.Raw})
+	chain = append(chain, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: p.root.Raw})...)
+
+	return &PCS{
+		header: url.QueryEscape(string(chain)),
+		body:   body,
+	}
+}
+
+// Get serves tdx tcb info regardless of the url.
+func (s *PCS) Get(string) (map[string][]string, []byte, error) {
+	return map[string][]string{
+		"Tcb-Info-Issuer-Chain": {s.header},
+	}, s.body, nil
+}
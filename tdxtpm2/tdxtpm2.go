@@ -0,0 +1,92 @@
+package tdxtpm2
+
+import (
+	"errors"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
+)
+
+// TDXTPM2 reflects our expectations about TDX trusted domain that also
+// exposes vTPM (e.g. with IMA and Secure Boot event logs).
+//
+// The login carries both TDX quote and TPM 2.0 attestation, and is only
+// allowed when both of them satisfy respective policies. Both proofs are
+// bound to the same nonce: TPM 2.0 attestation is generated with the nonce
+// as-is, and the report data of TDX quote is SHA512(nonce || AK public) (so
+// that vTPM attestation key is bound to the TD as well).
+type TDXTPM2 struct {
+	tokenutil.TokenParams `mapstructure:"-" structs:"-"`
+
+	// Name is the name of trusted domain.
+	Name string `json:"-" mapstructure:"-" structs:"-"`
+
+	// TOTPSecret is the secret used to generate initial TOTP codes.
+	TOTPSecret string `json:"totp_secret" mapstructure:"totp_secret" structs:"totp_secret"`
+
+	// TDX is the policy that TDX quote must satisfy.
+	TDX *tdx.TDX `json:"tdx" mapstructure:"-" structs:"-"`
+
+	// TPM2 is the policy that TPM 2.0 attestation must satisfy.
+	TPM2 *tpm2.TPM2 `json:"tpm2" mapstructure:"-" structs:"-"`
+}
+
+var (
+	errTDXTPM2MissingTDX  = errors.New("tdxtpm2 domain has no tdx policy")
+	errTDXTPM2MissingTPM2 = errors.New("tdxtpm2 domain has no tpm2 policy")
+)
+
+// SetName sets the name of the domain (and of its policies).
+func (td *TDXTPM2) SetName(name string) {
+	td.Name = name
+	if td.TDX != nil {
+		td.TDX.Name = name
+	}
+	if td.TPM2 != nil {
+		td.TPM2.Name = name
+	}
+}
+
+// Matches evaluates TDX and TPM 2.0 policies together.
+func (td *TDXTPM2) Matches(
+	quote *tdx.Quote,
+	attestation *attest.PlatformParameters,
+) (
+	[]error, []error,
+) {
+	{ // pre-flight checks
+		if td.TDX == nil {
+			return []error{
+				errTDXTPM2MissingTDX,
+			}, nil
+		}
+		if td.TPM2 == nil {
+			return []error{
+				errTDXTPM2MissingTPM2,
+			}, nil
+		}
+	}
+
+	errsTDX, dumpTDX := td.TDX.MatchesQuote(quote)
+	errsTPM2, dumpTPM2 := td.TPM2.MatchesAttestation(attestation)
+
+	return append(errsTDX, errsTPM2...), append(dumpTDX, dumpTPM2...)
+}
+
+func (td *TDXTPM2) GetName() string {
+	return td.Name
+}
+
+func (td *TDXTPM2) AttestationType() string {
+	return "tdxtpm2"
+}
+
+func (td *TDXTPM2) GetTOTPSecret() string {
+	return td.TOTPSecret
+}
+
+func (td *TDXTPM2) SetTOTPSecret(totpSecret string) {
+	td.TOTPSecret = totpSecret
+}
@@ -0,0 +1,38 @@
+package tdxtpm2_test
+
+import (
+	"testing"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdxtpm2"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSetName(t *testing.T) {
+	td := &tdxtpm2.TDXTPM2{
+		TDX:  &tdx.TDX{},
+		TPM2: &tpm2.TPM2{},
+	}
+	td.SetName("test")
+
+	assert.Equal(t, "test", td.GetName())
+	assert.Equal(t, "test", td.TDX.Name)
+	assert.Equal(t, "test", td.TPM2.Name)
+}
+
+func TestMatchesMissingPolicy(t *testing.T) {
+	{ // no tdx policy
+		td := &tdxtpm2.TDXTPM2{TPM2: &tpm2.TPM2{}}
+		reported, ignored := td.Matches(nil, nil)
+		assert.Len(t, reported, 1)
+		assert.Empty(t, ignored)
+	}
+
+	{ // no tpm2 policy
+		td := &tdxtpm2.TDXTPM2{TDX: &tdx.TDX{}}
+		reported, ignored := td.Matches(nil, nil)
+		assert.Len(t, reported, 1)
+		assert.Empty(t, ignored)
+	}
+}
@@ -0,0 +1,153 @@
+package tpm2
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/go-attestation/attest"
+	tpm "github.com/google/go-tpm/legacy/tpm2"
+)
+
+// Clock is the state of the clock of TPM as reported in its quotes.
+type Clock struct {
+	// Clock is the time (in milliseconds) that TPM has been powered on for
+	// since its last clear.
+	Clock uint64 `json:"clock"`
+
+	// ResetCount is the number of TPM resets (that is, reboots of the
+	// machine) since its last clear.
+	ResetCount uint32 `json:"reset_count"`
+
+	// RestartCount is the number of TPM restarts (e.g. resumes from
+	// hibernation) since its last reset.
+	RestartCount uint32 `json:"restart_count"`
+
+	// Safe reports that the clock was never reported with a greater value
+	// before (that is, it did not go backwards after unorderly shutdown).
+	Safe bool `json:"safe"`
+}
+
+const (
+	RebootActionNone      = "none"      // reboots are only recorded
+	RebootActionAlert     = "alert"     // reboots are logged with warning
+	RebootActionReapprove = "reapprove" // reboots have to be approved before the login
+)
+
+var (
+	errTPM2ClockNoQuotes           = errors.New("tpm2 attestation carries no quotes")
+	errTPM2ClockQuotesDiverge      = errors.New("tpm2 quotes report different reset or restart counts")
+	errTPM2ClockResetCountBackward = errors.New("tpm2 reset count went backwards")
+	errTPM2ClockRestartBackward    = errors.New("tpm2 restart count went backwards")
+	errTPM2ClockBackward           = errors.New("tpm2 clock went backwards")
+	errTPM2ClockTooFast            = errors.New("tpm2 clock advanced more than the time that has passed")
+	errTPM2RebootActionInvalid     = errors.New("invalid tpm2 reboot action")
+)
+
+// ClockFromAttestation extracts the clock of TPM from the quotes of the
+// attestation (the quotes must be verified beforehand).
+func ClockFromAttestation(attestation *attest.PlatformParameters) (*Clock, error) {
+	if attestation == nil {
+		return nil, errTPM2AttestationIsNil
+	}
+	if len(attestation.Quotes) == 0 {
+		return nil, errTPM2ClockNoQuotes
+	}
+
+	var clock *Clock
+	for _, quote := range attestation.Quotes {
+		data, err := tpm.DecodeAttestationData(quote.Quote)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode tpm2 quote: %w", err)
+		}
+		info := data.ClockInfo
+
+		if clock == nil {
+			clock = &Clock{
+				Clock:        info.Clock,
+				ResetCount:   info.ResetCount,
+				RestartCount: info.RestartCount,
+				Safe:         info.Safe != 0,
+			}
+			continue
+		}
+
+		if info.ResetCount != clock.ResetCount || info.RestartCount != clock.RestartCount {
+			return nil, errTPM2ClockQuotesDiverge
+		}
+		if info.Clock > clock.Clock { // the quotes are taken one after another
+			clock.Clock = info.Clock
+			clock.Safe = info.Safe != 0
+		}
+	}
+
+	return clock, nil
+}
+
+// RebootedSince reports whether TPM was reset (that is, the machine was
+// rebooted) since the previous observation of its clock.
+func (c *Clock) RebootedSince(previous *Clock) bool {
+	return c.ResetCount > previous.ResetCount
+}
+
+// Continues verifies that the clock can be the continuation of the previous
+// observation of it (that is, the counters and the clock of the same TPM did
+// not go backwards), regardless of the time that has passed.
+func (c *Clock) Continues(previous *Clock) error {
+	if c.ResetCount < previous.ResetCount {
+		return fmt.Errorf("%w: %d < %d",
+			errTPM2ClockResetCountBackward, c.ResetCount, previous.ResetCount,
+		)
+	}
+
+	if c.ResetCount == previous.ResetCount && c.RestartCount < previous.RestartCount {
+		return fmt.Errorf("%w: %d < %d",
+			errTPM2ClockRestartBackward, c.RestartCount, previous.RestartCount,
+		)
+	}
+
+	if c.Clock < previous.Clock {
+		// after unorderly shutdown the clock can legitimately go back (but
+		// then tpm has to be reset, and it has to report it as not safe)
+		if c.ResetCount == previous.ResetCount || c.Safe {
+			return fmt.Errorf("%w: %d < %d",
+				errTPM2ClockBackward, c.Clock, previous.Clock,
+			)
+		}
+	}
+
+	return nil
+}
+
+// FollowsUp verifies that the clock is consistent with the previous
+// observation of it that was made `elapsed` time ago.
+func (c *Clock) FollowsUp(previous *Clock, elapsed, tolerance time.Duration) error {
+	if err := c.Continues(previous); err != nil {
+		return err
+	}
+	if c.Clock < previous.Clock {
+		return nil // after unorderly shutdown
+	}
+
+	advanced := time.Duration(c.Clock-previous.Clock) * time.Millisecond
+	if advanced > elapsed+tolerance {
+		return fmt.Errorf("%w: %s > %s",
+			errTPM2ClockTooFast, advanced, elapsed,
+		)
+	}
+
+	return nil
+}
+
+// ValidateRebootAction verifies that the action on reboot is known.
+func ValidateRebootAction(action string) error {
+	switch action {
+	case "", RebootActionNone, RebootActionAlert, RebootActionReapprove:
+		return nil
+	default:
+		return fmt.Errorf("%w: %s (must be one of: %s, %s, %s)",
+			errTPM2RebootActionInvalid, action,
+			RebootActionNone, RebootActionAlert, RebootActionReapprove,
+		)
+	}
+}
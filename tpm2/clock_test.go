@@ -0,0 +1,55 @@
+package tpm2
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClockFollowsUp(t *testing.T) {
+	previous := &Clock{Clock: 60_000, ResetCount: 5, RestartCount: 2, Safe: true}
+
+	tests := []struct {
+		name    string
+		clock   *Clock
+		elapsed time.Duration
+		err     error
+	}{
+		{"advanced", &Clock{Clock: 90_000, ResetCount: 5, RestartCount: 2, Safe: true}, time.Minute, nil},
+		{"rebooted", &Clock{Clock: 70_000, ResetCount: 6, Safe: true}, time.Hour, nil},
+		{"reset count backwards", &Clock{Clock: 90_000, ResetCount: 4, Safe: true}, time.Minute, errTPM2ClockResetCountBackward},
+		{"restart count backwards", &Clock{Clock: 90_000, ResetCount: 5, RestartCount: 1, Safe: true}, time.Minute, errTPM2ClockRestartBackward},
+		{"clock backwards", &Clock{Clock: 30_000, ResetCount: 5, RestartCount: 2, Safe: true}, time.Minute, errTPM2ClockBackward},
+		{"clock backwards after reboot", &Clock{Clock: 30_000, ResetCount: 6, Safe: true}, time.Minute, errTPM2ClockBackward},
+		{"clock backwards after unorderly shutdown", &Clock{Clock: 30_000, ResetCount: 6, Safe: false}, time.Minute, nil},
+		{"clock too fast", &Clock{Clock: 60_000 + 3_600_000, ResetCount: 5, RestartCount: 2, Safe: true}, time.Minute, errTPM2ClockTooFast},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.clock.FollowsUp(previous, tt.elapsed, 5*time.Minute)
+			if tt.err == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, tt.err)
+			}
+		})
+	}
+}
+
+func TestClockContinues(t *testing.T) {
+	previous := &Clock{Clock: 60_000, ResetCount: 5, RestartCount: 2, Safe: true}
+
+	assert.NoError(t, (&Clock{Clock: 60_000 + 3_600_000, ResetCount: 5, RestartCount: 2, Safe: true}).Continues(previous))
+	assert.NoError(t, (&Clock{Clock: 30_000, ResetCount: 6, Safe: false}).Continues(previous))
+	assert.ErrorIs(t, (&Clock{Clock: 90_000, ResetCount: 4, Safe: true}).Continues(previous), errTPM2ClockResetCountBackward)
+	assert.ErrorIs(t, (&Clock{Clock: 30_000, ResetCount: 5, RestartCount: 2, Safe: true}).Continues(previous), errTPM2ClockBackward)
+}
+
+func TestClockRebootedSince(t *testing.T) {
+	previous := &Clock{ResetCount: 5, RestartCount: 2}
+
+	assert.False(t, (&Clock{ResetCount: 5, RestartCount: 3}).RebootedSince(previous))
+	assert.True(t, (&Clock{ResetCount: 6}).RebootedSince(previous))
+}
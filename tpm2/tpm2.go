@@ -2,7 +2,9 @@ package tpm2
 
 import (
 	"crypto"
+	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/hex"
 	"errors"
 	"fmt"
 
@@ -12,7 +14,7 @@ import (
 )
 
 type TPM2 struct {
-	tokenutil.TokenParams `json:"-" mapstructure:"-" structs:"-"`
+	tokenutil.TokenParams `mapstructure:"-" structs:"-"`
 
 	// Name is the name of trusted domain.
 	Name string `json:"-" mapstructure:"-" structs:"-"`
@@ -31,6 +33,16 @@ type TPM2 struct {
 	// PCRs is the slice with expected values of SHA256 Platform Configuration
 	// Registers.
 	PCRs [24]*types.Byte32 `json:"tpm2_pcrs,omitempty" mapstructure:"-" structs:"-"`
+
+	// ClockCheck makes the logins fail when the clock of TPM went backwards
+	// since the previous login with the same attestation key (i.e. it comes
+	// from another TPM), or when it advanced more than the time that has
+	// passed since then.
+	ClockCheck bool `json:"tpm2_clock_check,omitempty" mapstructure:"tpm2_clock_check" structs:"tpm2_clock_check"`
+
+	// RebootAction is what happens on login when the machine has rebooted
+	// since the previous login (see RebootAction* constants).
+	RebootAction string `json:"tpm2_reboot_action,omitempty" mapstructure:"tpm2_reboot_action" structs:"tpm2_reboot_action"`
 }
 
 var (
@@ -158,10 +170,28 @@ func (td *TPM2) MatchesAttestation(attestation *attest.PlatformParameters) (
 	return errs, dump
 }
 
+// AKFingerprint derives the identifier of TPM from the public part of its
+// attestation key.
+func AKFingerprint(akPublic []byte) string {
+	h := sha256.Sum256(akPublic)
+	return hex.EncodeToString(h[:16])
+}
+
+// EKFingerprint derives the identifier of TPM from the public part of its
+// endorsement key (DER-encoded).
+func EKFingerprint(ekPublic []byte) string {
+	h := sha256.Sum256(ekPublic)
+	return hex.EncodeToString(h[:16])
+}
+
 func (td *TPM2) GetName() string {
 	return td.Name
 }
 
+func (td *TPM2) SetName(name string) {
+	td.Name = name
+}
+
 func (td *TPM2) AttestationType() string {
 	return "tpm2"
 }
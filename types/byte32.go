@@ -58,7 +58,7 @@ func Byte32FromFieldData(
 	}
 
 	if encodedStr == "" {
-		return nil, true, nil
+		return nil, true, errs
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(encodedStr)
@@ -79,3 +79,46 @@ func Byte32FromFieldData(
 
 	return &res, true, errs
 }
+
+func Byte32SliceFromFieldData(
+	data *framework.FieldData,
+	key string,
+	errs *multierror.Error,
+) ([]Byte32, bool, *multierror.Error) {
+	encoded, present, err := data.GetOkErr(key)
+	if err != nil {
+		return nil, false, multierror.Append(err, errs)
+	}
+	if !present {
+		return nil, false, errs
+	}
+
+	encodedStrs, ok := encoded.([]string)
+	if !ok {
+		return nil, false, multierror.Append(errs, fmt.Errorf(
+			"%s is not a list of base64 strings", key,
+		))
+	}
+
+	res := make([]Byte32, 0, len(encodedStrs))
+	for idx, encodedStr := range encodedStrs {
+		decoded, err := base64.StdEncoding.DecodeString(encodedStr)
+		if err != nil {
+			return nil, false, multierror.Append(errs, fmt.Errorf(
+				"%s[%d] is not encoded as base64 string: %w", key, idx, err,
+			))
+		}
+
+		if len(decoded) != 32 {
+			return nil, false, multierror.Append(errs, fmt.Errorf(
+				"data encoded by %s[%d] is not 32 bytes long: %d != 32", key, idx, len(decoded),
+			))
+		}
+
+		var b Byte32
+		copy(b[:], decoded)
+		res = append(res, b)
+	}
+
+	return res, true, errs
+}
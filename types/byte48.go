@@ -58,7 +58,7 @@ func Byte48FromFieldData(
 	}
 
 	if encodedStr == "" {
-		return nil, true, nil
+		return nil, true, errs
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(encodedStr)
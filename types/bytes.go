@@ -58,7 +58,7 @@ func BytesFromFieldData(
 	}
 
 	if encodedStr == "" {
-		return nil, true, nil
+		return nil, true, errs
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(encodedStr)
@@ -70,5 +70,5 @@ func BytesFromFieldData(
 
 	res := Bytes(decoded)
 
-	return res, true, nil
+	return res, true, errs
 }
@@ -0,0 +1,154 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/azurecvm"
+	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"github.com/google/go-attestation/attest"
+	vaultapi "github.com/hashicorp/vault/api"
+	"go.uber.org/zap"
+)
+
+func (c *Client) loginAzureCVM(
+	ctx context.Context,
+	td *config.TD,
+) (*vaultapi.Secret, error) {
+	var (
+		totpTS      time.Time
+		nonce       = make([]byte, globals.TPM2NonceSize)
+		hclReport   []byte
+		quote       []byte
+		attestation *attest.PlatformParameters
+	)
+
+	{ // fetch azure cvm attestation nonce
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+		totpTS = time.Now()
+
+		_nonce, err := c.fetchNonce(ctx, td, totpCode)
+		if err != nil {
+			return nil, err
+		}
+		if len(_nonce) != globals.TPM2NonceSize {
+			return nil, fmt.Errorf("wrong size of azure cvm attestation nonce: expected %d; got %d",
+				globals.TPM2NonceSize, len(_nonce),
+			)
+		}
+		copy(nonce, _nonce)
+	}
+
+	{ // read hcl report (and convert tdreport into a quote, if needed)
+		var err error
+		hclReport, quote, err = c.generateAzureCVMHardwareReport(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // generate tpm2 attestation
+		l := logger.FromContext(ctx)
+
+		l.Debug("Generating TPM2 attestation with the attestation key of vTPM")
+
+		var err error
+		attestation, err = azurecvm.AttestPlatform(nonce)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate tpm2 attestation: %w",
+				err,
+			)
+		}
+	}
+
+	{ // fetch azure cvm attested token
+		time.Sleep(time.Until(totpTS.Add(globals.TOTPPeriod))) // wait for next totp
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.fetchAzureCVMToken(ctx, td, totpCode, nonce, hclReport, quote, attestation)
+	}
+}
+
+func (c *Client) generateAzureCVMHardwareReport(
+	ctx context.Context,
+) ([]byte, []byte, error) {
+	l := logger.FromContext(ctx)
+
+	l.Debug("Reading HCL report from vTPM")
+
+	hclReport, err := azurecvm.ReadHCLReport()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read hcl report: %w",
+			err,
+		)
+	}
+
+	hcl, err := azurecvm.ParseHCLReport(hclReport)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse hcl report: %w",
+			err,
+		)
+	}
+
+	if hcl.ReportType != azurecvm.ReportTypeTDX {
+		return hclReport, nil, nil
+	}
+
+	l.Debug("Requesting TDX quote from Azure IMDS",
+		zap.String("imds_url", azurecvm.IMDSTDQuoteURL),
+	)
+
+	quote, err := azurecvm.GetTDXQuote(ctx, hcl.HardwareReport)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get tdx quote: %w",
+			err,
+		)
+	}
+
+	return hclReport, quote, nil
+}
+
+func (c *Client) fetchAzureCVMToken(
+	ctx context.Context,
+	td *config.TD,
+	totpCode string,
+	nonce []byte,
+	hclReport []byte,
+	quote []byte,
+	attestation *attest.PlatformParameters,
+) (*vaultapi.Secret, error) {
+	l := logger.FromContext(ctx)
+
+	path := "auth/" + td.VaultPath + "/azure-cvm/" + td.Name + "/login"
+
+	jsonAttestation, err := json.Marshal(attestation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json-marshal tpm2 attestation: %w",
+			err,
+		)
+	}
+
+	l.Debug("Requesting azure cvm attested token from vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"totp":        totpCode,
+		"nonce":       base64.StdEncoding.EncodeToString(nonce),
+		"hcl_report":  base64.StdEncoding.EncodeToString(hclReport),
+		"quote":       base64.StdEncoding.EncodeToString(quote),
+		"attestation": base64.StdEncoding.EncodeToString(jsonAttestation),
+	})
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/cca"
+	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	vaultapi "github.com/hashicorp/vault/api"
+	"go.uber.org/zap"
+)
+
+func (c *Client) loginCCA(
+	ctx context.Context,
+	td *config.TD,
+) (*vaultapi.Secret, error) {
+	var (
+		totpTS time.Time
+		nonce  [globals.CCANonceSize]byte
+		token  []byte
+		err    error
+	)
+
+	{ // fetch cca attestation nonce
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+		totpTS = time.Now()
+
+		_nonce, err := c.fetchNonce(ctx, td, totpCode)
+		if err != nil {
+			return nil, err
+		}
+		if len(_nonce) != globals.CCANonceSize {
+			return nil, fmt.Errorf("wrong size of cca attestation nonce: expected %d; got %d",
+				globals.CCANonceSize, len(_nonce),
+			)
+		}
+		copy(nonce[:], _nonce)
+	}
+
+	{ // generate cca attestation token
+		token, err = c.generateCCAAttestation(ctx, nonce)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // fetch cca attested token
+		time.Sleep(time.Until(totpTS.Add(globals.TOTPPeriod))) // wait for next totp
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.fetchCCAToken(ctx, td, totpCode, token)
+	}
+}
+
+func (c *Client) generateCCAAttestation(
+	ctx context.Context,
+	nonce [globals.CCANonceSize]byte,
+) ([]byte, error) {
+	l := logger.FromContext(ctx)
+
+	l.Debug("Generating CCA attestation token")
+
+	token, err := cca.GetToken(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate cca attestation token: %w",
+			err,
+		)
+	}
+
+	return token, nil
+}
+
+func (c *Client) fetchCCAToken(
+	ctx context.Context,
+	td *config.TD,
+	totpCode string,
+	token []byte,
+) (*vaultapi.Secret, error) {
+	l := logger.FromContext(ctx)
+
+	path := "auth/" + td.VaultPath + "/cca/" + td.Name + "/login"
+
+	l.Debug("Requesting cca attested token from vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"totp":  totpCode,
+		"token": base64.StdEncoding.EncodeToString(token),
+	})
+}
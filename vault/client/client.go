@@ -29,6 +29,7 @@ type Client struct {
 	ui          vaultcli.Ui
 	vault       *vaultapi.Client
 
+	tlsBinding  []byte
 	totpOptions totp.ValidateOpts
 }
 
@@ -66,6 +67,15 @@ func New(cfg *config.Config) (*Client, error) {
 		}
 	}
 
+	var tlsBinding []byte
+	if cfg.TD.TLSBinding {
+		publicKey, err := clientCertificatePublicKey(cfg.HTTP.ClientCert)
+		if err != nil {
+			return nil, err
+		}
+		tlsBinding = publicKey
+	}
+
 	cli, err := vaultapi.NewClient(c)
 	if err != nil {
 		return nil, err
@@ -91,6 +101,7 @@ func New(cfg *config.Config) (*Client, error) {
 		ui:          ui,
 		vault:       cli,
 
+		tlsBinding: tlsBinding,
 		totpOptions: totp.ValidateOpts{
 			Algorithm: globals.TOTPAlgorithm,
 			Digits:    globals.TOTPDigits,
@@ -113,11 +124,28 @@ func (c *Client) Login(ctx context.Context, td *config.TD) error {
 		secret, err = c.loginTDX(ctx, td)
 	case "tpm2":
 		secret, err = c.loginTPM2(ctx, td)
+	case "tdxtpm2":
+		secret, err = c.loginTDXTPM2(ctx, td)
+	case "sevsnp":
+		secret, err = c.loginSEVSNP(ctx, td)
+	case "sgx":
+		secret, err = c.loginSGX(ctx, td)
+	case "cca":
+		secret, err = c.loginCCA(ctx, td)
+	case "nitro":
+		secret, err = c.loginNitro(ctx, td)
+	case "azure-cvm":
+		secret, err = c.loginAzureCVM(ctx, td)
 	}
 	if err != nil {
 		return err
 	}
 
+	secret, err = c.unwrapToken(ctx, secret)
+	if err != nil {
+		return err
+	}
+
 	token := secret.Auth.ClientToken
 
 	if !c.cfg.NoStore {
@@ -0,0 +1,49 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"go.uber.org/zap"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+var (
+	errWrappedTokenFailedToUnwrap = errors.New("failed to unwrap token")
+)
+
+// unwrapToken unwraps the token of the domain with the response-wrapped token
+// delivery (or returns the login response as-is otherwise).
+func (c *Client) unwrapToken(
+	ctx context.Context,
+	secret *vaultapi.Secret,
+) (*vaultapi.Secret, error) {
+	if secret == nil || secret.WrapInfo == nil {
+		return secret, nil
+	}
+
+	l := logger.FromContext(ctx)
+
+	l.Debug("Unwrapping token",
+		zap.String("wrapping_accessor", secret.WrapInfo.Accessor),
+	)
+
+	unwrapped, err := c.vault.Logical().UnwrapWithContext(ctx, secret.WrapInfo.Token)
+	if err != nil {
+		// the wrapping token can only be unwrapped once, so the failure
+		// might well mean that somebody else has already unwrapped it
+		return nil, fmt.Errorf("%w (it might have been intercepted): %w",
+			errWrappedTokenFailedToUnwrap, err,
+		)
+	}
+	if unwrapped == nil || unwrapped.Auth == nil {
+		return nil, fmt.Errorf("%w: no token was wrapped",
+			errWrappedTokenFailedToUnwrap,
+		)
+	}
+
+	return unwrapped, nil
+}
@@ -2,13 +2,18 @@ package client
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
+	"encoding/pem"
 	"errors"
 	"fmt"
+	"os"
 	"time"
 
 	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
 	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
 	"github.com/pquerna/otp/totp"
 	"go.uber.org/zap"
 )
@@ -25,6 +30,21 @@ func (c *Client) fetchNonce(
 	ctx context.Context,
 	td *config.TD,
 	totpCode string,
+) ([]byte, error) {
+	req := map[string]interface{}{}
+	if totpCode != "" { // instances that are about to enroll don't use totp
+		req["totp"] = totpCode
+	}
+
+	return c.requestNonce(ctx, td, req)
+}
+
+// requestNonce requests the attestation nonce from vault with provided
+// credentials.
+func (c *Client) requestNonce(
+	ctx context.Context,
+	td *config.TD,
+	req map[string]interface{},
 ) ([]byte, error) {
 	l := logger.FromContext(ctx)
 
@@ -39,9 +59,7 @@ func (c *Client) fetchNonce(
 		zap.String("vault_path", path),
 	)
 
-	res, err := c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
-		"totp": totpCode,
-	})
+	res, err := c.vault.Logical().WriteWithContext(ctx, path, req)
 	if err != nil {
 		return nil, err
 	}
@@ -62,3 +80,38 @@ func (c *Client) fetchNonce(
 
 	return nonce, nil
 }
+
+// tdxReportData computes the report data for the tdx quote that binds the
+// nonce with provided values (and with the tls client certificate, if
+// configured so).
+func (c *Client) tdxReportData(
+	nonce []byte,
+	values ...[]byte,
+) [globals.TDXNonceSize]byte {
+	if c.tlsBinding != nil {
+		values = append(values, c.tlsBinding)
+	}
+	return tdx.ReportData(nonce, values...)
+}
+
+// clientCertificatePublicKey returns DER-encoded public key of the (first)
+// certificate from PEM file.
+func clientCertificatePublicKey(path string) ([]byte, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tls client certificate: %w", err)
+	}
+
+	for block, rest := pem.Decode(b); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse tls client certificate: %w", err)
+		}
+		return cert.RawSubjectPublicKeyInfo, nil
+	}
+
+	return nil, errors.New("no tls client certificate found in " + path)
+}
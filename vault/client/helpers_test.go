@@ -0,0 +1,83 @@
+package client
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCertificatePublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "td"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+
+	{ // key and certificate in the same file
+		path := filepath.Join(dir, "client.pem")
+		content := append(
+			pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+			pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...,
+		)
+		require.NoError(t, os.WriteFile(path, content, 0o600))
+
+		publicKey, err := clientCertificatePublicKey(path)
+		assert.NoError(t, err)
+		assert.Equal(t, cert.RawSubjectPublicKeyInfo, publicKey)
+	}
+
+	{ // no certificate
+		path := filepath.Join(dir, "key.pem")
+		content := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+		require.NoError(t, os.WriteFile(path, content, 0o600))
+
+		_, err := clientCertificatePublicKey(path)
+		assert.Error(t, err)
+	}
+
+	{ // no file
+		_, err := clientCertificatePublicKey(filepath.Join(dir, "missing.pem"))
+		assert.Error(t, err)
+	}
+}
+
+func TestTDXReportData(t *testing.T) {
+	nonce := []byte("nonce")
+	instanceKey := []byte("instance")
+	binding := []byte("binding")
+
+	{ // no tls binding
+		c := &Client{}
+		assert.Equal(t, tdx.ReportData(nonce), c.tdxReportData(nonce))
+		assert.Equal(t, tdx.ReportData(nonce, instanceKey), c.tdxReportData(nonce, instanceKey))
+	}
+
+	{ // tls binding goes last
+		c := &Client{tlsBinding: binding}
+		assert.Equal(t, tdx.ReportData(nonce, binding), c.tdxReportData(nonce))
+		assert.Equal(t, tdx.ReportData(nonce, instanceKey, binding), c.tdxReportData(nonce, instanceKey))
+	}
+}
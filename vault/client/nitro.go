@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"github.com/flashbots/vault-auth-plugin-attest/nitro"
+	vaultapi "github.com/hashicorp/vault/api"
+	"go.uber.org/zap"
+)
+
+func (c *Client) loginNitro(
+	ctx context.Context,
+	td *config.TD,
+) (*vaultapi.Secret, error) {
+	var (
+		totpTS   time.Time
+		nonce    [globals.NitroNonceSize]byte
+		document []byte
+		err      error
+	)
+
+	{ // fetch nitro attestation nonce
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+		totpTS = time.Now()
+
+		_nonce, err := c.fetchNonce(ctx, td, totpCode)
+		if err != nil {
+			return nil, err
+		}
+		if len(_nonce) != globals.NitroNonceSize {
+			return nil, fmt.Errorf("wrong size of nitro attestation nonce: expected %d; got %d",
+				globals.NitroNonceSize, len(_nonce),
+			)
+		}
+		copy(nonce[:], _nonce)
+	}
+
+	{ // generate nitro attestation document
+		document, err = c.generateNitroDocument(ctx, nonce)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // fetch nitro attested token
+		time.Sleep(time.Until(totpTS.Add(globals.TOTPPeriod))) // wait for next totp
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.fetchNitroToken(ctx, td, totpCode, document)
+	}
+}
+
+func (c *Client) generateNitroDocument(
+	ctx context.Context,
+	nonce [globals.NitroNonceSize]byte,
+) ([]byte, error) {
+	l := logger.FromContext(ctx)
+
+	l.Debug("Generating Nitro attestation document")
+
+	document, err := nitro.GetDocument(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate nitro attestation document: %w",
+			err,
+		)
+	}
+
+	return document, nil
+}
+
+func (c *Client) fetchNitroToken(
+	ctx context.Context,
+	td *config.TD,
+	totpCode string,
+	document []byte,
+) (*vaultapi.Secret, error) {
+	l := logger.FromContext(ctx)
+
+	path := "auth/" + td.VaultPath + "/nitro/" + td.Name + "/login"
+
+	l.Debug("Requesting nitro attested token from vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"totp":     totpCode,
+		"document": base64.StdEncoding.EncodeToString(document),
+	})
+}
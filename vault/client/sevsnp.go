@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"go.uber.org/zap"
+
+	snp "github.com/google/go-sev-guest/client"
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+func (c *Client) loginSEVSNP(
+	ctx context.Context,
+	td *config.TD,
+) (*vaultapi.Secret, error) {
+	var (
+		totpTS      time.Time
+		nonce       [globals.SEVSNPNonceSize]byte
+		attestation []byte
+		err         error
+	)
+
+	{ // fetch sevsnp attestation nonce
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+		totpTS = time.Now()
+
+		_nonce, err := c.fetchNonce(ctx, td, totpCode)
+		if err != nil {
+			return nil, err
+		}
+		if len(_nonce) != globals.SEVSNPNonceSize {
+			return nil, fmt.Errorf("wrong size of sevsnp attestation nonce: expected %d; got %d",
+				globals.SEVSNPNonceSize, len(_nonce),
+			)
+		}
+		copy(nonce[:], _nonce)
+	}
+
+	{ // generate sevsnp attestation report
+		attestation, err = c.generateSEVSNPAttestation(ctx, nonce)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // fetch sevsnp attested token
+		time.Sleep(time.Until(totpTS.Add(globals.TOTPPeriod))) // wait for next totp
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.fetchSEVSNPToken(ctx, td, totpCode, attestation)
+	}
+}
+
+func (c *Client) generateSEVSNPAttestation(
+	ctx context.Context,
+	nonce [globals.SEVSNPNonceSize]byte,
+) ([]byte, error) {
+	l := logger.FromContext(ctx)
+
+	provider, err := snp.GetQuoteProvider()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sevsnp quote provider: %w",
+			err,
+		)
+	}
+
+	l.Debug("Generating SEV-SNP attestation report")
+
+	attestation, err := provider.GetRawQuote(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate sevsnp attestation report: %w",
+			err,
+		)
+	}
+
+	return attestation, nil
+}
+
+func (c *Client) fetchSEVSNPToken(
+	ctx context.Context,
+	td *config.TD,
+	totpCode string,
+	attestation []byte,
+) (*vaultapi.Secret, error) {
+	l := logger.FromContext(ctx)
+
+	path := "auth/" + td.VaultPath + "/sevsnp/" + td.Name + "/login"
+
+	l.Debug("Requesting sevsnp attested token from vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"totp":        totpCode,
+		"attestation": base64.StdEncoding.EncodeToString(attestation),
+	})
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
+	vaultapi "github.com/hashicorp/vault/api"
+	"go.uber.org/zap"
+)
+
+func (c *Client) loginSGX(
+	ctx context.Context,
+	td *config.TD,
+) (*vaultapi.Secret, error) {
+	var (
+		totpTS time.Time
+		nonce  [globals.SGXNonceSize]byte
+		quote  []byte
+		err    error
+	)
+
+	{ // fetch sgx attestation nonce
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+		totpTS = time.Now()
+
+		_nonce, err := c.fetchNonce(ctx, td, totpCode)
+		if err != nil {
+			return nil, err
+		}
+		if len(_nonce) != globals.SGXNonceSize {
+			return nil, fmt.Errorf("wrong size of sgx attestation nonce: expected %d; got %d",
+				globals.SGXNonceSize, len(_nonce),
+			)
+		}
+		copy(nonce[:], _nonce)
+	}
+
+	{ // generate sgx quote
+		quote, err = c.generateSGXQuote(ctx, nonce)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // fetch sgx attested token
+		time.Sleep(time.Until(totpTS.Add(globals.TOTPPeriod))) // wait for next totp
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.fetchSGXToken(ctx, td, totpCode, quote)
+	}
+}
+
+func (c *Client) generateSGXQuote(
+	ctx context.Context,
+	nonce [globals.SGXNonceSize]byte,
+) ([]byte, error) {
+	l := logger.FromContext(ctx)
+
+	l.Debug("Generating SGX quote")
+
+	quote, err := sgx.GetQuote(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate sgx quote: %w",
+			err,
+		)
+	}
+
+	return quote, nil
+}
+
+func (c *Client) fetchSGXToken(
+	ctx context.Context,
+	td *config.TD,
+	totpCode string,
+	quote []byte,
+) (*vaultapi.Secret, error) {
+	l := logger.FromContext(ctx)
+
+	path := "auth/" + td.VaultPath + "/sgx/" + td.Name + "/login"
+
+	l.Debug("Requesting sgx attested token from vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"totp":  totpCode,
+		"quote": base64.StdEncoding.EncodeToString(quote),
+	})
+}
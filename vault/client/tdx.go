@@ -26,6 +26,14 @@ func (c *Client) loginTDX(
 	ctx context.Context,
 	td *config.TD,
 ) (*vaultapi.Secret, error) {
+	if td.InstanceKey != "" {
+		return c.loginTDXInstance(ctx, td)
+	}
+
+	if td.RATLS {
+		return c.loginTDXRATLS(ctx, td)
+	}
+
 	var (
 		totpTS time.Time
 		nonce  [globals.TDXNonceSize]byte
@@ -53,7 +61,7 @@ func (c *Client) loginTDX(
 	}
 
 	{ // generate tdx quote
-		quote, err = c.generateTDXQuote(ctx, nonce)
+		quote, err = c.generateTDXQuote(ctx, c.tdxReportData(nonce[:]))
 		if err != nil {
 			return nil, err
 		}
@@ -66,7 +74,7 @@ func (c *Client) loginTDX(
 			return nil, err
 		}
 
-		return c.fetchTDXToken(ctx, td, totpCode, quote)
+		return c.fetchTDXToken(ctx, td, totpCode, nonce[:], quote)
 	}
 }
 
@@ -89,6 +97,7 @@ func (c *Client) fetchTDXToken(
 	ctx context.Context,
 	td *config.TD,
 	totpCode string,
+	nonce []byte,
 	quote []byte,
 ) (*vaultapi.Secret, error) {
 	l := logger.FromContext(ctx)
@@ -102,6 +111,30 @@ func (c *Client) fetchTDXToken(
 
 	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
 		"totp":  totpCode,
+		"nonce": base64.StdEncoding.EncodeToString(nonce),
 		"quote": base64.StdEncoding.EncodeToString(quote),
 	})
 }
+
+func (c *Client) loginTDXRATLS(
+	ctx context.Context,
+	td *config.TD,
+) (*vaultapi.Secret, error) {
+	l := logger.FromContext(ctx)
+
+	totpCode, err := c.totpCode(td)
+	if err != nil {
+		return nil, err
+	}
+
+	path := "auth/" + td.VaultPath + "/tdx/" + td.Name + "/ratls-login"
+
+	l.Debug("Requesting tdx ra-tls attested token from vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"totp": totpCode,
+	})
+}
@@ -0,0 +1,175 @@
+package client
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"go.uber.org/zap"
+
+	vaultapi "github.com/hashicorp/vault/api"
+)
+
+var (
+	errTDXInstanceFailedToEnroll = errors.New("failed to enroll tdx instance")
+	errTDXInstanceKeyInvalid     = errors.New("invalid tdx instance key")
+)
+
+func (c *Client) loginTDXInstance(
+	ctx context.Context,
+	td *config.TD,
+) (*vaultapi.Secret, error) {
+	key, err := c.loadTDXInstanceKey(td)
+	if err != nil {
+		return nil, err
+	}
+
+	if key == nil { // first contact
+		if key, err = c.enrollTDXInstance(ctx, td); err != nil {
+			return nil, err
+		}
+	}
+
+	timestamp := time.Now().Unix()
+	nonce, quote, err := c.attestTDXInstance(ctx, td, key, map[string]interface{}{
+		"public_key": base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		"timestamp":  timestamp,
+		"signature":  base64.StdEncoding.EncodeToString(ed25519.Sign(key, tdx.NonceRequestMessage(timestamp))),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	l := logger.FromContext(ctx)
+
+	path := "auth/" + td.VaultPath + "/tdx/" + td.Name + "/login"
+
+	l.Debug("Requesting tdx attested token from vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"nonce":      base64.StdEncoding.EncodeToString(nonce),
+		"public_key": base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		"signature":  base64.StdEncoding.EncodeToString(ed25519.Sign(key, nonce)),
+		"quote":      base64.StdEncoding.EncodeToString(quote),
+	})
+}
+
+func (c *Client) enrollTDXInstance(
+	ctx context.Context,
+	td *config.TD,
+) (ed25519.PrivateKey, error) {
+	l := logger.FromContext(ctx)
+
+	l.Debug("Generating tdx instance key")
+
+	_, key, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w",
+			errTDXInstanceFailedToEnroll, err,
+		)
+	}
+
+	nonce, quote, err := c.attestTDXInstance(ctx, td, key, map[string]interface{}{})
+	if err != nil {
+		return nil, err
+	}
+
+	path := "auth/" + td.VaultPath + "/tdx/" + td.Name + "/enroll"
+
+	l.Debug("Enrolling tdx instance key with vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	res, err := c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"nonce":      base64.StdEncoding.EncodeToString(nonce),
+		"public_key": base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		"quote":      base64.StdEncoding.EncodeToString(quote),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w",
+			errTDXInstanceFailedToEnroll, err,
+		)
+	}
+
+	l.Debug("Enrolled tdx instance",
+		zap.Any("instance_id", res.Data["instance_id"]),
+	)
+
+	seed := base64.StdEncoding.EncodeToString(key.Seed())
+	if err := os.WriteFile(td.InstanceKey, []byte(seed+"\n"), 0o600); err != nil {
+		return nil, fmt.Errorf("%w: failed to persist the key: %w",
+			errTDXInstanceFailedToEnroll, err,
+		)
+	}
+
+	return key, nil
+}
+
+func (c *Client) attestTDXInstance(
+	ctx context.Context,
+	td *config.TD,
+	key ed25519.PrivateKey,
+	nonceRequest map[string]interface{},
+) ([]byte, []byte, error) {
+	nonce, err := c.requestNonce(ctx, td, nonceRequest)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w",
+			errTDXNonceFailedToFetch, err,
+		)
+	}
+	if len(nonce) != globals.TDXNonceSize {
+		return nil, nil, fmt.Errorf("wrong size of tdx attestation nonce: expected %d; got %d",
+			globals.TDXNonceSize, len(nonce),
+		)
+	}
+
+	quote, err := c.generateTDXQuote(ctx,
+		c.tdxReportData(nonce, key.Public().(ed25519.PublicKey)),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %w",
+			errTDXQuoteFailedToGenerate, err,
+		)
+	}
+
+	return nonce, quote, nil
+}
+
+func (c *Client) loadTDXInstanceKey(td *config.TD) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(td.InstanceKey)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w",
+			errTDXInstanceKeyInvalid, err,
+		)
+	}
+
+	seed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w",
+			errTDXInstanceKeyInvalid, err,
+		)
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%w: wrong size: expected %d; got %d",
+			errTDXInstanceKeyInvalid, ed25519.SeedSize, len(seed),
+		)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/logger"
+	"github.com/google/go-attestation/attest"
+	vaultapi "github.com/hashicorp/vault/api"
+	"go.uber.org/zap"
+)
+
+func (c *Client) loginTDXTPM2(
+	ctx context.Context,
+	td *config.TD,
+) (*vaultapi.Secret, error) {
+	var (
+		totpTS      time.Time
+		nonce       = make([]byte, globals.TPM2NonceSize)
+		attestation *attest.PlatformParameters
+		quote       []byte
+	)
+
+	{ // fetch tdx+vtpm attestation nonce
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+		totpTS = time.Now()
+
+		_nonce, err := c.fetchNonce(ctx, td, totpCode)
+		if err != nil {
+			return nil, err
+		}
+		if len(_nonce) != globals.TPM2NonceSize {
+			return nil, fmt.Errorf("wrong size of tdx+vtpm attestation nonce: expected %d; got %d",
+				globals.TPM2NonceSize, len(_nonce),
+			)
+		}
+		copy(nonce, _nonce)
+	}
+
+	{ // generate tpm2 attestation
+		akBlob, err := base64.StdEncoding.DecodeString(td.TPM2AKPrivateBlob)
+		if err != nil {
+			return nil, fmt.Errorf("failed to base64-decode blob of tpm2 private attestation key: %w",
+				err,
+			)
+		}
+
+		attestation, err = c.generateTPM2Attestation(ctx, akBlob, nonce)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // generate tdx quote (that binds the attestation key of vtpm)
+		var err error
+		quote, err = c.generateTDXQuote(ctx, c.tdxReportData(nonce, attestation.Public))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	{ // fetch tdx+vtpm attested token
+		time.Sleep(time.Until(totpTS.Add(globals.TOTPPeriod))) // wait for next totp
+		totpCode, err := c.totpCode(td)
+		if err != nil {
+			return nil, err
+		}
+
+		return c.fetchTDXTPM2Token(ctx, td, totpCode, nonce, quote, attestation)
+	}
+}
+
+func (c *Client) fetchTDXTPM2Token(
+	ctx context.Context,
+	td *config.TD,
+	totpCode string,
+	nonce []byte,
+	quote []byte,
+	attestation *attest.PlatformParameters,
+) (*vaultapi.Secret, error) {
+	l := logger.FromContext(ctx)
+
+	path := "auth/" + td.VaultPath + "/tdxtpm2/" + td.Name + "/login"
+
+	jsonAttestation, err := json.Marshal(attestation)
+	if err != nil {
+		return nil, fmt.Errorf("failed to json-marshal tpm2 attestation: %w",
+			err,
+		)
+	}
+
+	l.Debug("Requesting tdx+vtpm attested token from vault",
+		zap.String("vault_addr", c.vault.Address()),
+		zap.String("vault_path", path),
+	)
+
+	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+		"totp":        totpCode,
+		"nonce":       base64.StdEncoding.EncodeToString(nonce),
+		"quote":       base64.StdEncoding.EncodeToString(quote),
+		"attestation": base64.StdEncoding.EncodeToString(jsonAttestation),
+	})
+}
@@ -2,6 +2,7 @@ package client
 
 import (
 	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
@@ -23,6 +24,7 @@ func (c *Client) loginTPM2(
 		totpTS      time.Time
 		nonce       = make([]byte, globals.TPM2NonceSize)
 		attestation *attest.PlatformParameters
+		ekPublic    []byte
 	)
 
 	{ // fetch tdx attestation nonce
@@ -58,6 +60,14 @@ func (c *Client) loginTPM2(
 		}
 	}
 
+	{ // read tpm2 endorsement key (for the domains that tell instances by it)
+		var err error
+		ekPublic, err = c.readTPM2EK(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	{ // fetch tpm2 attested token
 		time.Sleep(time.Until(totpTS.Add(globals.TOTPPeriod))) // wait for next totp
 		totpCode, err := c.totpCode(td)
@@ -65,7 +75,7 @@ func (c *Client) loginTPM2(
 			return nil, err
 		}
 
-		return c.fetchTPM2Token(ctx, td, totpCode, attestation, nonce)
+		return c.fetchTPM2Token(ctx, td, totpCode, attestation, ekPublic, nonce)
 	}
 }
 
@@ -118,11 +128,50 @@ func (c *Client) generateTPM2Attestation(
 	return attestation, nil
 }
 
+// readTPM2EK returns the public part of the endorsement key of tpm (nil if
+// the tpm does not expose any).
+func (c *Client) readTPM2EK(ctx context.Context) ([]byte, error) {
+	l := logger.FromContext(ctx)
+
+	l.Debug("Opening TPM2 device")
+
+	provider, err := attest.OpenTPM(&attest.OpenConfig{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open tpm2 device: %w",
+			err,
+		)
+	}
+	defer func() {
+		l.Debug("Closing TPM2 device")
+		provider.Close()
+	}()
+
+	eks, err := provider.EKs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tpm2 endorsement keys: %w",
+			err,
+		)
+	}
+	if len(eks) == 0 {
+		return nil, nil
+	}
+
+	ekPublic, err := x509.MarshalPKIXPublicKey(eks[0].Public)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal tpm2 endorsement key: %w",
+			err,
+		)
+	}
+
+	return ekPublic, nil
+}
+
 func (c *Client) fetchTPM2Token(
 	ctx context.Context,
 	td *config.TD,
 	totpCode string,
 	attestation *attest.PlatformParameters,
+	ekPublic []byte,
 	nonce []byte,
 ) (*vaultapi.Secret, error) {
 	l := logger.FromContext(ctx)
@@ -141,9 +190,14 @@ func (c *Client) fetchTPM2Token(
 		zap.String("vault_path", path),
 	)
 
-	return c.vault.Logical().WriteWithContext(ctx, path, map[string]interface{}{
+	data := map[string]interface{}{
 		"totp":        totpCode,
 		"attestation": base64.StdEncoding.EncodeToString(jsonAttestation),
 		"nonce":       base64.StdEncoding.EncodeToString(nonce[:]),
-	})
+	}
+	if ekPublic != nil {
+		data["ek_public"] = base64.StdEncoding.EncodeToString(ekPublic)
+	}
+
+	return c.vault.Logical().WriteWithContext(ctx, path, data)
 }
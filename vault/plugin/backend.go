@@ -1,15 +1,18 @@
 package plugin
 
 import (
+	"crypto/x509"
 	"sync"
 	"time"
 
 	app "github.com/flashbots/vault-auth-plugin-attest/config"
 	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/pquerna/otp/totp"
 
+	tdxtrust "github.com/google/go-tdx-guest/verify/trust"
 	cache "github.com/patrickmn/go-cache"
 )
 
@@ -19,6 +22,16 @@ type backend struct {
 
 	totpOptions   totp.ValidateOpts
 	totpUsedCodes *cache.Cache
+	nonces        *nonceCache
+	enrollNonces  *nonceCache // nonces of the instances that are about to enroll
+	policies      *policy.Cache
+	tdxRoots      *x509.CertPool       // roots of tdx pck certificates (nil means intel ones)
+	pcsGetter     tdxtrust.HTTPSGetter // getter of intel pcs collateral (nil means the default one)
+
+	importKeyLock  sync.Mutex
+	secretsKeyLock sync.Mutex
+	tpm2ClockLock  sync.Mutex
+	pendingLock    sync.Mutex
 }
 
 const helpBackend = `
@@ -35,6 +48,9 @@ client token in case if the validation and verifications are ok.
 func newBackend(cfg *app.Config) *backend {
 	b := &backend{
 		totpUsedCodes: cache.New(globals.TOTPPeriod, globals.TOTPPeriod),
+		nonces:        newNonceCache(globals.NoncePeriod, globals.MaxNonces),
+		enrollNonces:  newNonceCache(globals.NoncePeriod, globals.MaxEnrollNonces),
+		policies:      policy.NewCache(),
 
 		totpOptions: totp.ValidateOpts{
 			Algorithm: globals.TOTPAlgorithm,
@@ -48,29 +64,67 @@ func newBackend(cfg *app.Config) *backend {
 		BackendType:    logical.TypeCredential,
 		Help:           helpBackend,
 		RunningVersion: cfg.Version,
+		InitializeFunc: b.initialize,
 
 		// TODO: AuthRenew: b.loginRenew,
 
 		Paths: []*framework.Path{
-			pathTDX(b),
-			pathTDXList(b),
-			pathTDXNonce(b),
-			pathTDXLogin(b),
-			pathTPM2(b),
-			pathTPM2List(b),
-			pathTPM2Nonce(b),
-			pathTPM2Login(b),
+			pathConfig(b),
+			pathTDXRATLSLogin(b),
+			pathTDXEnroll(b),
+			pathTDXInstance(b),
+			pathTDXInstanceList(b),
+			pathReferenceValuesImport(b),
+			pathTemplate(b),
+			pathTemplateList(b),
+			pathTemplatePending(b),
+			pathExport(b),
+			pathImport(b),
+			pathImportKey(b),
+			pathMetrics(b),
 		},
 
 		PathsSpecial: &logical.Paths{
+			Root: []string{
+				"config",
+				"export",
+				"import",
+			},
+
+			SealWrapStorage: []string{
+				"secret/",
+				"import/key",
+			},
+
 			Unauthenticated: []string{
-				"tdx/+/nonce",
-				"tdx/+/login",
-				"tpm2/+/nonce",
-				"tpm2/+/login",
+				"tdx/+/ratls-login",
+				"tdx/+/enroll",
 			},
 		},
 	}
 
+	for _, vt := range verifierTypes {
+		b.Backend.Paths = append(b.Backend.Paths,
+			pathVerifier(b, vt),
+			pathVerifierList(b, vt),
+			pathVerifierNonce(b, vt),
+			pathVerifierLogin(b, vt),
+			pathVerifierManifest(b, vt),
+			pathVerifierManifestList(b, vt),
+			pathVerifierHistory(b, vt),
+			pathVerifierRollback(b, vt),
+			pathVerifierPending(b, vt),
+		)
+		if _, ok := vt.new(b).(tpm2Verifier); ok {
+			b.Backend.Paths = append(b.Backend.Paths,
+				pathVerifierTPM2Clock(b, vt),
+			)
+		}
+		b.Backend.PathsSpecial.Unauthenticated = append(b.Backend.PathsSpecial.Unauthenticated,
+			vt.attestationType+"/+/nonce",
+			vt.attestationType+"/+/login",
+		)
+	}
+
 	return b
 }
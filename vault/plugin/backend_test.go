@@ -0,0 +1,42 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	app "github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestBackend returns initialised backend together with its (in-memory)
+// storage.
+func newTestBackend(t *testing.T) (*backend, logical.Storage) {
+	ctx := context.Background()
+	storage := &logical.InmemStorage{}
+
+	b := newBackend(&app.Config{})
+	require.NoError(t, b.Setup(ctx, &logical.BackendConfig{StorageView: storage}))
+	require.NoError(t, b.Initialize(ctx, &logical.InitializationRequest{Storage: storage}))
+
+	return b, storage
+}
+
+// handle sends the request to the backend on behalf of the entity.
+func handle(
+	t *testing.T,
+	b *backend,
+	storage logical.Storage,
+	entityID string,
+	operation logical.Operation,
+	path string,
+	data map[string]interface{},
+) (*logical.Response, error) {
+	return b.HandleRequest(context.Background(), &logical.Request{
+		Operation: operation,
+		Path:      path,
+		Data:      data,
+		Storage:   storage,
+		EntityID:  entityID,
+	})
+}
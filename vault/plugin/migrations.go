@@ -0,0 +1,341 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// storageMigration upgrades the stored configurations of the domains to the
+// next schema version.
+//
+// Migrations work on the raw json of the stored entries (as opposed to the
+// types of the verifiers), so that they keep working after the types change.
+type storageMigration struct {
+	// version is the schema version that the migration upgrades to.
+	version int
+
+	// description is what the migration does.
+	description string
+
+	// domain upgrades the stored configuration of the domain.
+	domain func(
+		ctx context.Context,
+		b *backend,
+		storage logical.Storage,
+		vt *verifierType,
+		name string,
+		domain map[string]interface{},
+	) error
+
+	// history upgrades the configuration of the domain that is kept in its
+	// history. It also upgrades the values of the stored templates (they
+	// hold the fields of the domains in the same form).
+	history func(domain map[string]interface{}) error
+}
+
+// storageMigrations are the migrations in the order of schema versions. New
+// migrations are only ever appended.
+var storageMigrations = []*storageMigration{
+	{
+		version:     1,
+		description: "move totp secrets out of domain entries into sealed storage",
+		domain:      migrateTOTPSecret,
+		history:     dropTOTPSecret,
+	},
+}
+
+// latestSchemaVersion is the schema version that the entries are stored
+// with.
+func latestSchemaVersion() int {
+	return storageMigrations[len(storageMigrations)-1].version
+}
+
+// initialize migrates the storage of the mount to the latest schema version.
+func (b *backend) initialize(
+	ctx context.Context,
+	req *logical.InitializationRequest,
+) error {
+	l := b.Logger()
+
+	if err := b.migrateStorage(ctx, req.Storage); err != nil {
+		if errors.Is(err, logical.ErrReadOnly) {
+			l.Debug("skipping storage migration on read-only storage")
+			return nil
+		}
+		msg := "failed to migrate storage"
+		l.Error(msg,
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil
+}
+
+// migrateStorage upgrades all stored domains (and their history) and
+// templates that were stored with the older schema versions.
+func (b *backend) migrateStorage(
+	ctx context.Context,
+	storage logical.Storage,
+) error {
+	l := b.Logger()
+
+	schema, err := b.loadSchema(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	latest := latestSchemaVersion()
+	if schema.Version >= latest {
+		return nil
+	}
+
+	for _, m := range storageMigrations {
+		if m.version > schema.Version {
+			l.Info("migrating storage",
+				"schema_version", m.version,
+				"migration", m.description,
+			)
+		}
+	}
+
+	for _, vt := range verifierTypes {
+		names, err := b.listVerifiers(ctx, storage, vt)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := b.migrateDomain(ctx, storage, vt, name); err != nil {
+				return fmt.Errorf("%s/%s: %w", vt.attestationType, name, err)
+			}
+		}
+	}
+
+	templates, err := b.listTemplates(ctx, storage)
+	if err != nil {
+		return err
+	}
+	for _, name := range templates {
+		if err := b.migrateTemplate(ctx, storage, name); err != nil {
+			return fmt.Errorf("template/%s: %w", name, err)
+		}
+	}
+
+	schema.Version = latest
+	if err := b.saveSchema(ctx, storage, schema); err != nil {
+		return err
+	}
+
+	l.Info("migrated storage",
+		"schema_version", latest,
+	)
+
+	return nil
+}
+
+// migrateDomain upgrades the stored domain, and the versions of the domain
+// in its history.
+func (b *backend) migrateDomain(
+	ctx context.Context,
+	storage logical.Storage,
+	vt *verifierType,
+	name string,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	latest := latestSchemaVersion()
+
+	key := vt.attestationType + "/" + name
+	entry, err := storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	domain, version, err := decodeSchemaDomain(entry.Value)
+	if err != nil {
+		return err
+	}
+	if version < latest {
+		for _, m := range storageMigrations {
+			if m.version <= version || m.domain == nil {
+				continue
+			}
+			if err := m.domain(ctx, b, storage, vt, name, domain); err != nil {
+				return fmt.Errorf("schema version %d: %w", m.version, err)
+			}
+		}
+		domain["schema_version"] = latest
+
+		raw, err := json.Marshal(domain)
+		if err != nil {
+			return err
+		}
+		if err := storage.Put(ctx, &logical.StorageEntry{Key: key, Value: raw}); err != nil {
+			return err
+		}
+	}
+
+	td := vt.new(b)
+	td.SetName(name)
+
+	versions, err := b.listVersions(ctx, storage, td)
+	if err != nil {
+		return err
+	}
+	for _, number := range versions {
+		stored, err := b.loadVersion(ctx, storage, td, number)
+		if err != nil {
+			return err
+		}
+		if stored == nil {
+			continue
+		}
+
+		domain, version, err := decodeSchemaDomain(stored.Domain)
+		if err != nil {
+			return fmt.Errorf("version %d: %w", number, err)
+		}
+		if version >= latest {
+			continue
+		}
+		for _, m := range storageMigrations {
+			if m.version <= version || m.history == nil {
+				continue
+			}
+			if err := m.history(domain); err != nil {
+				return fmt.Errorf("version %d: schema version %d: %w", number, m.version, err)
+			}
+		}
+		domain["schema_version"] = latest
+
+		if stored.Domain, err = json.Marshal(domain); err != nil {
+			return err
+		}
+		if err := b.saveVersion(ctx, storage, td, stored); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateTemplate upgrades the values of the stored template.
+func (b *backend) migrateTemplate(
+	ctx context.Context,
+	storage logical.Storage,
+	name string,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	latest := latestSchemaVersion()
+
+	key := "template/" + name
+	entry, err := storage.Get(ctx, key)
+	if err != nil {
+		return err
+	}
+	if entry == nil {
+		return nil
+	}
+
+	template, version, err := decodeSchemaDomain(entry.Value)
+	if err != nil {
+		return err
+	}
+	if version >= latest {
+		return nil
+	}
+
+	attestationType, _ := template["attestation_type"].(string)
+	if lookupVerifierType(attestationType) == nil {
+		return fmt.Errorf("%w: %s", errTemplateUnknownType, attestationType)
+	}
+	values, _ := template["values"].(map[string]interface{})
+	if values != nil {
+		for _, m := range storageMigrations {
+			if m.version <= version || m.history == nil {
+				continue
+			}
+			if err := m.history(values); err != nil {
+				return fmt.Errorf("schema version %d: %w", m.version, err)
+			}
+		}
+	}
+	template["schema_version"] = latest
+
+	raw, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, &logical.StorageEntry{Key: key, Value: raw})
+}
+
+// decodeSchemaDomain decodes the stored configuration of the domain, and
+// returns it together with its schema version.
+func decodeSchemaDomain(raw []byte) (map[string]interface{}, int, error) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber() // keep the numbers as they are
+
+	domain := make(map[string]interface{})
+	if err := dec.Decode(&domain); err != nil {
+		return nil, 0, err
+	}
+
+	version := 0
+	if n, ok := domain["schema_version"].(json.Number); ok {
+		v, err := n.Int64()
+		if err != nil {
+			return nil, 0, fmt.Errorf("invalid schema version: %w", err)
+		}
+		version = int(v)
+	}
+
+	return domain, version, nil
+}
+
+// migrateTOTPSecret moves the totp secret of the domain into the sealed
+// storage (schema version 1).
+func migrateTOTPSecret(
+	ctx context.Context,
+	b *backend,
+	storage logical.Storage,
+	vt *verifierType,
+	name string,
+	domain map[string]interface{},
+) error {
+	if secret, _ := domain["totp_secret"].(string); secret != "" {
+		key := totpSecretKey(vt.attestationType, name)
+		s, err := b.sealTOTPSecret(ctx, storage, key, secret)
+		if err != nil {
+			return err
+		}
+		if err := b.saveSecret(ctx, storage, key, s); err != nil {
+			return err
+		}
+	}
+
+	return dropTOTPSecret(domain)
+}
+
+// dropTOTPSecret removes the totp secret from the configuration of the
+// domain (schema version 1).
+func dropTOTPSecret(domain map[string]interface{}) error {
+	if _, ok := domain["totp_secret"]; ok {
+		domain["totp_secret"] = ""
+	}
+
+	return nil
+}
@@ -0,0 +1,144 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	app "github.com/flashbots/vault-auth-plugin-attest/config"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// loadSchemaFixture fills the storage with the entries of the mount that was
+// stored with the schema version.
+func loadSchemaFixture(t *testing.T, version int) logical.Storage {
+	raw, err := os.ReadFile(filepath.Join("testdata", "schema", fmt.Sprintf("v%d.json", version)))
+	require.NoError(t, err)
+
+	entries := make(map[string]json.RawMessage)
+	require.NoError(t, json.Unmarshal(raw, &entries))
+
+	storage := &logical.InmemStorage{}
+	for key, value := range entries {
+		require.NoError(t, storage.Put(context.Background(), &logical.StorageEntry{
+			Key:   key,
+			Value: value,
+		}))
+	}
+
+	return storage
+}
+
+func TestMigrations(t *testing.T) {
+	for version := 0; version <= latestSchemaVersion(); version++ {
+		t.Run(fmt.Sprintf("v%d", version), func(t *testing.T) {
+			ctx := context.Background()
+			storage := loadSchemaFixture(t, version)
+
+			b := newBackend(&app.Config{})
+			require.NoError(t, b.Setup(ctx, &logical.BackendConfig{StorageView: storage}))
+			require.NoError(t, b.Initialize(ctx, &logical.InitializationRequest{Storage: storage}))
+
+			schema, err := b.loadSchema(ctx, storage)
+			require.NoError(t, err)
+			assert.Equal(t, latestSchemaVersion(), schema.Version)
+
+			{ // tdx
+				v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "app")
+				require.NoError(t, err)
+				require.NotNil(t, v)
+
+				td := v.(*verifierTDX)
+				assert.Equal(t, "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP", td.GetTOTPSecret())
+				assert.Equal(t, byte(0x01), td.MrTD[0])
+				assert.Equal(t, byte(0x02), td.RTMR0[0])
+				assert.Nil(t, td.RTMR1)
+				assert.True(t, td.CheckDebug)
+			}
+
+			{ // tpm2
+				v, err := b.loadVerifier(ctx, storage, verifierTypeTPM2, "vm")
+				require.NoError(t, err)
+				require.NotNil(t, v)
+
+				td := v.(*verifierTPM2)
+				assert.Equal(t, "KRSXG5CTMVRXEZLUKRSXG5CTMVRXEZLU", td.GetTOTPSecret())
+				assert.Len(t, td.AKPublic, 40)
+				require.NotNil(t, td.PCRs[7])
+				assert.Equal(t, byte(0x03), td.PCRs[7][0])
+				assert.Nil(t, td.PCRs[0])
+			}
+
+			for _, key := range []string{"tdx/app", "tpm2/vm"} { // stored form
+				entry, err := storage.Get(ctx, key)
+				require.NoError(t, err)
+
+				domain, version, err := decodeSchemaDomain(entry.Value)
+				require.NoError(t, err)
+				assert.Equal(t, latestSchemaVersion(), version)
+				assert.Empty(t, domain["totp_secret"])
+			}
+
+			{ // secrets
+				s, err := b.loadSecret(ctx, storage, totpSecretKey("tdx", "app"))
+				require.NoError(t, err)
+				require.NotNil(t, s)
+				assert.NotContains(t, string(s.Ciphertext), "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP")
+			}
+
+			if version >= 1 { // pending change of the new domain
+				p, v, err := b.fetchPending(ctx, &logical.Request{Storage: storage}, verifierTypeTDX, "new")
+				require.NoError(t, err)
+				assert.True(t, p.SecretChanged)
+				assert.Equal(t, "MFRGGZDFMZTWQ2LKNNWG23TPOBYXE43U", v.GetTOTPSecret())
+
+				entry, err := storage.Get(ctx, "pending/tdx/new")
+				require.NoError(t, err)
+				require.NotNil(t, entry)
+				assert.NotContains(t, string(entry.Value), "MFRGGZDFMZTWQ2LKNNWG23TPOBYXE43U")
+			}
+
+			{ // history
+				td := verifierTypeTDX.new(b)
+				td.SetName("app")
+
+				stored, err := b.loadVersion(ctx, storage, td, 1)
+				require.NoError(t, err)
+				require.NotNil(t, stored)
+
+				domain, version, err := decodeSchemaDomain(stored.Domain)
+				require.NoError(t, err)
+				assert.Equal(t, latestSchemaVersion(), version)
+				assert.Empty(t, domain["totp_secret"])
+				assert.Equal(t, true, domain["tdx_check_debug"])
+			}
+
+			{ // template
+				tpl, err := b.loadTemplate(ctx, storage, "firmware")
+				require.NoError(t, err)
+				require.NotNil(t, tpl)
+				assert.Equal(t, latestSchemaVersion(), tpl.SchemaVersion)
+				assert.Equal(t, "tdx", tpl.AttestationType)
+				assert.Equal(t, false, tpl.Values["tdx_check_debug"])
+				assert.Equal(t, "BAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE", tpl.Values["tdx_rtmr1"])
+
+				res, err := handle(t, b, storage, "", logical.ReadOperation, "template/firmware", nil)
+				require.NoError(t, err)
+				require.NotNil(t, res)
+				assert.Equal(t, "tdx", res.Data["attestation_type"])
+			}
+		})
+	}
+}
+
+func TestMigrationsVersions(t *testing.T) {
+	for i, m := range storageMigrations {
+		assert.Equal(t, i+1, m.version)
+		assert.NotEmpty(t, m.description)
+	}
+}
@@ -0,0 +1,187 @@
+package plugin
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+var errNonceCacheFull = errors.New("too many outstanding nonces")
+
+// nonceCache keeps the nonces that were issued to the clients and were not
+// consumed yet.
+//
+// The number of outstanding nonces is limited per domain as well as for the
+// whole mount. When either of the limits is reached, the oldest nonce of the
+// same domain is evicted to make room for the new one (since all nonces live
+// for the same period of time, the oldest nonce is also the one that expires
+// first). The nonces of the other domains are never evicted, so when the
+// mount is full and the domain has no outstanding nonces of its own the new
+// nonce is refused.
+type nonceCache struct {
+	mx sync.Mutex
+
+	ttl     time.Duration
+	maxSize int
+
+	nonces  map[string]*nonceCacheEntry
+	order   *list.List            // all nonces, oldest first
+	domains map[string]*list.List // nonces of every domain, oldest first
+
+	evictedDomainLimit uint64
+	evictedGlobalLimit uint64
+	rejected           uint64
+	expired            uint64
+}
+
+type nonceCacheEntry struct {
+	domain    string
+	key       string
+	expiresAt time.Time
+
+	element       *list.Element
+	domainElement *list.Element
+}
+
+// nonceCacheStats is the snapshot of the counters of the nonce cache.
+type nonceCacheStats struct {
+	Size    int
+	MaxSize int
+	Domains int
+
+	EvictedDomainLimit uint64
+	EvictedGlobalLimit uint64
+	Rejected           uint64
+	Expired            uint64
+}
+
+func newNonceCache(ttl time.Duration, maxSize int) *nonceCache {
+	return &nonceCache{
+		ttl:     ttl,
+		maxSize: maxSize,
+
+		nonces:  make(map[string]*nonceCacheEntry),
+		order:   list.New(),
+		domains: make(map[string]*list.List),
+	}
+}
+
+// add stores the nonce of the domain. It returns false if such nonce is
+// already present, and the number of nonces that were evicted to make room
+// for the new one. If the mount is full and there's nothing to evict from the
+// domain, errNonceCacheFull is returned.
+func (c *nonceCache) add(domain, nonce string, domainLimit int) (bool, int, error) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	now := time.Now()
+	c.expire(now)
+
+	key := domain + "/" + nonce
+	if _, present := c.nonces[key]; present {
+		return false, 0, nil
+	}
+
+	evicted := 0
+
+	nonces := c.domains[domain]
+	if nonces != nil {
+		for domainLimit > 0 && nonces.Len() >= domainLimit {
+			c.remove(nonces.Front().Value.(*nonceCacheEntry))
+			c.evictedDomainLimit++
+			evicted++
+		}
+	}
+	if c.maxSize > 0 && c.order.Len() >= c.maxSize {
+		if nonces == nil || nonces.Len() == 0 {
+			c.rejected++
+			return false, evicted, errNonceCacheFull
+		}
+		c.remove(nonces.Front().Value.(*nonceCacheEntry))
+		c.evictedGlobalLimit++
+		evicted++
+	}
+
+	nonces = c.domains[domain]
+	if nonces == nil {
+		nonces = list.New()
+		c.domains[domain] = nonces
+	}
+
+	e := &nonceCacheEntry{
+		domain:    domain,
+		key:       key,
+		expiresAt: now.Add(c.ttl),
+	}
+	e.element = c.order.PushBack(e)
+	e.domainElement = nonces.PushBack(e)
+	c.nonces[key] = e
+
+	return true, evicted, nil
+}
+
+// has reports whether the nonce of the domain is outstanding.
+func (c *nonceCache) has(domain, nonce string) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.expire(time.Now())
+
+	_, present := c.nonces[domain+"/"+nonce]
+	return present
+}
+
+// delete removes the nonce of the domain.
+func (c *nonceCache) delete(domain, nonce string) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if e, present := c.nonces[domain+"/"+nonce]; present {
+		c.remove(e)
+	}
+}
+
+// stats returns the current counters of the cache.
+func (c *nonceCache) stats() nonceCacheStats {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.expire(time.Now())
+
+	return nonceCacheStats{
+		Size:    c.order.Len(),
+		MaxSize: c.maxSize,
+		Domains: len(c.domains),
+
+		EvictedDomainLimit: c.evictedDomainLimit,
+		EvictedGlobalLimit: c.evictedGlobalLimit,
+		Rejected:           c.rejected,
+		Expired:            c.expired,
+	}
+}
+
+// expire removes the nonces that have expired (must be called with the lock
+// held).
+func (c *nonceCache) expire(now time.Time) {
+	for front := c.order.Front(); front != nil; front = c.order.Front() {
+		e := front.Value.(*nonceCacheEntry)
+		if now.Before(e.expiresAt) {
+			return
+		}
+		c.remove(e)
+		c.expired++
+	}
+}
+
+// remove drops the entry from the cache (must be called with the lock held).
+func (c *nonceCache) remove(e *nonceCacheEntry) {
+	delete(c.nonces, e.key)
+	c.order.Remove(e.element)
+
+	nonces := c.domains[e.domain]
+	nonces.Remove(e.domainElement)
+	if nonces.Len() == 0 {
+		delete(c.domains, e.domain)
+	}
+}
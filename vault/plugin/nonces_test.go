@@ -0,0 +1,168 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNonceCache(t *testing.T) {
+	t.Run("domain limit", func(t *testing.T) {
+		c := newNonceCache(time.Minute, 10)
+
+		for i := 0; i < 5; i++ {
+			added, _, err := c.add("tdx/app", fmt.Sprintf("n%d", i), 3)
+			require.NoError(t, err)
+			assert.True(t, added)
+		}
+		added, evicted, err := c.add("tdx/other", "n0", 3)
+		require.NoError(t, err)
+		assert.True(t, added)
+		assert.Equal(t, 0, evicted)
+
+		assert.False(t, c.has("tdx/app", "n0"))
+		assert.False(t, c.has("tdx/app", "n1"))
+		assert.True(t, c.has("tdx/app", "n2"))
+		assert.True(t, c.has("tdx/app", "n4"))
+		assert.True(t, c.has("tdx/other", "n0"))
+
+		stats := c.stats()
+		assert.Equal(t, 4, stats.Size)
+		assert.Equal(t, 2, stats.Domains)
+		assert.Equal(t, uint64(2), stats.EvictedDomainLimit)
+		assert.Equal(t, uint64(0), stats.EvictedGlobalLimit)
+	})
+
+	t.Run("global limit", func(t *testing.T) {
+		c := newNonceCache(time.Minute, 3)
+
+		for i := 0; i < 3; i++ {
+			added, _, err := c.add(fmt.Sprintf("tdx/d%d", i), "n", 10)
+			require.NoError(t, err)
+			assert.True(t, added)
+		}
+
+		// the domain has nothing to evict, and the others are left alone
+		added, _, err := c.add("tdx/d3", "n", 10)
+		assert.ErrorIs(t, err, errNonceCacheFull)
+		assert.False(t, added)
+		assert.True(t, c.has("tdx/d0", "n"))
+		assert.False(t, c.has("tdx/d3", "n"))
+
+		// the domain makes room out of its own nonces
+		added, evicted, err := c.add("tdx/d0", "m", 10)
+		require.NoError(t, err)
+		assert.True(t, added)
+		assert.Equal(t, 1, evicted)
+		assert.False(t, c.has("tdx/d0", "n"))
+		assert.True(t, c.has("tdx/d0", "m"))
+		assert.True(t, c.has("tdx/d1", "n"))
+
+		stats := c.stats()
+		assert.Equal(t, 3, stats.Size)
+		assert.Equal(t, 3, stats.Domains)
+		assert.Equal(t, uint64(1), stats.EvictedGlobalLimit)
+		assert.Equal(t, uint64(1), stats.Rejected)
+	})
+
+	t.Run("one domain can not flush the others", func(t *testing.T) {
+		c := newNonceCache(time.Minute, 8)
+
+		added, _, err := c.add("tdx/b", "n", 8)
+		require.NoError(t, err)
+		assert.True(t, added)
+
+		for i := 0; i < 100; i++ {
+			added, _, err := c.add("tdx/a", fmt.Sprintf("n%d", i), 8)
+			require.NoError(t, err)
+			assert.True(t, added)
+		}
+
+		assert.True(t, c.has("tdx/b", "n"))
+		assert.True(t, c.has("tdx/a", "n99"))
+		assert.Equal(t, 8, c.stats().Size)
+	})
+
+	t.Run("collision and delete", func(t *testing.T) {
+		c := newNonceCache(time.Minute, 10)
+
+		added, _, _ := c.add("tdx/app", "n", 3)
+		assert.True(t, added)
+		added, _, err := c.add("tdx/app", "n", 3)
+		require.NoError(t, err)
+		assert.False(t, added)
+
+		c.delete("tdx/app", "n")
+		assert.False(t, c.has("tdx/app", "n"))
+		assert.Equal(t, 0, c.stats().Domains)
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		c := newNonceCache(time.Millisecond, 10)
+
+		c.add("tdx/app", "n", 3)
+		time.Sleep(5 * time.Millisecond)
+
+		assert.False(t, c.has("tdx/app", "n"))
+		stats := c.stats()
+		assert.Equal(t, 0, stats.Size)
+		assert.Equal(t, uint64(1), stats.Expired)
+	})
+}
+
+func TestNonceCacheBackend(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	b.nonces = newNonceCache(globals.NoncePeriod, 16)
+
+	for _, name := range []string{"a", "b"} {
+		res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/"+name, nil)
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	{ // per-domain limit is capped well below the limit of the mount
+		res, err := handle(t, b, storage, "", logical.UpdateOperation, "tdx/a", map[string]interface{}{
+			"max_nonces": globals.MaxDomainNoncesLimit + 1,
+		})
+		assert.ErrorIs(t, err, errMaxNoncesInvalid)
+		assert.True(t, res.IsError())
+	}
+
+	{ // the stored limit is shown as it is (zero means the default)
+		res, err := handle(t, b, storage, "", logical.ReadOperation, "tdx/a", nil)
+		require.NoError(t, err)
+		assert.Equal(t, 0, res.Data["max_nonces"])
+
+		_, err = handle(t, b, storage, "", logical.UpdateOperation, "tdx/a", map[string]interface{}{
+			"max_nonces": 16,
+		})
+		require.NoError(t, err)
+		res, err = handle(t, b, storage, "", logical.ReadOperation, "tdx/a", nil)
+		require.NoError(t, err)
+		assert.Equal(t, 16, res.Data["max_nonces"])
+	}
+
+	va, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "a")
+	require.NoError(t, err)
+	vb, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "b")
+	require.NoError(t, err)
+
+	nonceB, err := b.generateNonce(ctx, b.nonces, vb, vb.NonceSize(), vb.common().nonceLimit())
+	require.NoError(t, err)
+
+	// domain a fills the whole cache
+	for i := 0; i < 100; i++ {
+		_, err := b.generateNonce(ctx, b.nonces, va, va.NonceSize(), 100)
+		require.NoError(t, err)
+	}
+	assert.Equal(t, 16, b.nonces.stats().Size)
+
+	assert.NoError(t, b.validateNonce(ctx, b.nonces, vb, nonceB))
+}
@@ -0,0 +1,118 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpConfigSynopsys = `
+Configure the mount.
+`
+
+const helpConfigDescription = `
+This endpoint allows you to read and update the settings that apply to all
+trusted domains of the mount.
+`
+
+func pathConfig(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "config",
+		HelpSynopsis:    helpConfigSynopsys,
+		HelpDescription: helpConfigDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"require_approval": {
+				Type:        framework.TypeBool,
+				Description: "Require the changes of measurements and of other pre-auth settings of trusted domains to be approved by another entity",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Require approval",
+					Description: "Require the changes of measurements and of other pre-auth settings of trusted domains to be approved by another entity (token parameters are still applied right away)",
+				},
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "attest",
+			OperationSuffix: "configuration",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathConfigRead,
+			},
+
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathConfigUpdate,
+			},
+		},
+	}
+}
+
+func (b *backend) pathConfigRead(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	cfg, err := b.loadConfig(ctx, req.Storage)
+	if err != nil {
+		msg := "failed to fetch configuration from storage"
+		l.Error(msg,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return &logical.Response{
+		Data: encodeConfig(cfg),
+	}, nil
+}
+
+func (b *backend) pathConfigUpdate(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	cfg, err := b.loadConfig(ctx, req.Storage)
+	if err != nil {
+		msg := "failed to fetch configuration from storage"
+		l.Error(msg,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if requireApproval, ok := data.GetOk("require_approval"); ok {
+		cfg.RequireApproval = requireApproval.(bool)
+	}
+
+	if err := b.saveConfig(ctx, req.Storage, cfg); err != nil {
+		msg := "failed to push configuration into storage"
+		l.Error(msg,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Info("updated configuration",
+		"require_approval", cfg.RequireApproval,
+		"entity_id", req.EntityID,
+	)
+
+	return &logical.Response{
+		Data: encodeConfig(cfg),
+	}, nil
+}
+
+func encodeConfig(cfg *backendConfig) map[string]interface{} {
+	return map[string]interface{}{
+		"require_approval": cfg.RequireApproval,
+	}
+}
@@ -0,0 +1,58 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpMetricsSynopsys = `
+Read the metrics of the in-memory caches.
+`
+
+const helpMetricsDescription = `
+This endpoint returns the metrics of the in-memory caches of the plugin (the
+outstanding nonces and the used TOTP codes) on the node that serves the
+request.
+`
+
+func pathMetrics(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "metrics",
+		HelpSynopsis:    helpMetricsSynopsys,
+		HelpDescription: helpMetricsDescription,
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "attest",
+			OperationSuffix: "metrics",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathMetricsRead,
+			},
+		},
+	}
+}
+
+func (b *backend) pathMetricsRead(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	stats := b.nonces.stats()
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"nonces":                      stats.Size,
+			"nonces_max":                  stats.MaxSize,
+			"nonces_domains":              stats.Domains,
+			"nonces_evicted_domain_limit": stats.EvictedDomainLimit,
+			"nonces_evicted_global_limit": stats.EvictedGlobalLimit,
+			"nonces_rejected":             stats.Rejected,
+			"nonces_expired":              stats.Expired,
+			"totp_used_codes":             b.totpUsedCodes.ItemCount(),
+		},
+	}, nil
+}
@@ -0,0 +1,270 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/refvalues"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpReferenceValuesImportSynopsys = `
+Import reference values from CoRIM or CoCo RVPS documents.
+`
+
+const helpReferenceValuesImportDescription = `
+This endpoint parses the reference values published as CoRIM (CBOR) or as
+Confidential Containers RVPS JSON, maps them onto the fields of the trusted
+domain (e.g. MRTD onto tdx_mr_td, PCR[7] onto tpm2_pcr07), and updates the
+domain with them. Measurements with a single value become the fixed
+expectations, while the ones with multiple values are stored as named lists of
+policy values (that the policy expression of the domain must refer to,
+otherwise the import is rejected). The response reports what was imported, and
+what was skipped (and why).
+`
+
+const (
+	formatCoRIM = "corim"
+	formatRVPS  = "rvps"
+)
+
+var (
+	errReferenceValuesUnknownFormat = errors.New("unknown format of reference values")
+	errReferenceValuesUnknownType   = errors.New("unknown attestation type")
+	errReferenceValuesUnreferenced  = errors.New("measurements with multiple values must be referred to by the policy of the domain")
+)
+
+func pathReferenceValuesImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "reference-values/import",
+		HelpSynopsis:    helpReferenceValuesImportSynopsys,
+		HelpDescription: helpReferenceValuesImportDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"attestation_type": {
+				Type:        framework.TypeString,
+				Description: "Attestation type of the trusted domain to import the reference values into (e.g. tdx, tpm2, tdxtpm2)",
+			},
+
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Name of the trusted domain to import the reference values into",
+			},
+
+			"format": {
+				Type:          framework.TypeString,
+				Description:   "Format of the reference values",
+				AllowedValues: []interface{}{formatCoRIM, formatRVPS},
+			},
+
+			"data": {
+				Type:        framework.TypeString,
+				Description: "Reference values document (base64-encoded)",
+			},
+
+			"policy": {
+				Type:        framework.TypeString,
+				Description: "Policy expression that replaces the one of the domain (it must refer to the measurements with multiple values)",
+			},
+
+			"dry_run": {
+				Type:        framework.TypeBool,
+				Description: "Only report what would be imported, without updating the domain",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "reference-values",
+			OperationVerb:   "import",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathReferenceValuesImport,
+			},
+		},
+	}
+}
+
+func (b *backend) pathReferenceValuesImport(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	attestationType := data.Get("attestation_type").(string)
+	vt := lookupVerifierType(attestationType)
+	if vt == nil {
+		err := fmt.Errorf("%w: %s", errReferenceValuesUnknownType, attestationType)
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	name, err := b.getName(ctx, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	v, err := b.fetchVerifier(ctx, req, vt, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	document, err := base64.StdEncoding.DecodeString(data.Get("data").(string))
+	if err != nil {
+		err = fmt.Errorf("data is not encoded as base64 string: %w", err)
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	var entries []*refvalues.Entry
+	switch format := data.Get("format").(string); format {
+	case formatCoRIM:
+		entries, err = refvalues.ParseCoRIM(document)
+	case formatRVPS:
+		entries, err = refvalues.ParseRVPS(document, time.Now())
+	default:
+		err = fmt.Errorf("%w: %s", errReferenceValuesUnknownFormat, format)
+	}
+	if err != nil {
+		msg := "failed to parse reference values"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	measurements := v.MeasurementFields()
+	digests := make(map[string][]string)
+	skipped := make([]string, 0)
+	for _, e := range entries {
+		if e.Err != nil {
+			skipped = append(skipped, fmt.Sprintf("%s: %s", e.Name, e.Err))
+			continue
+		}
+		if !slices.Contains(measurements, e.Field) {
+			skipped = append(skipped, fmt.Sprintf("%s: %s is not applicable to %s domain",
+				e.Name, e.Field, vt.attestationType,
+			))
+			continue
+		}
+		digest := base64.StdEncoding.EncodeToString(e.Digest)
+		if !slices.Contains(digests[e.Field], digest) {
+			digests[e.Field] = append(digests[e.Field], digest)
+		}
+	}
+
+	imported := make(map[string]interface{})
+	sets := make(map[string][]string)
+	for field, values := range digests {
+		if len(values) == 1 {
+			imported[field] = values[0]
+		} else {
+			sort.Strings(values)
+			sets[field] = values
+		}
+	}
+
+	updated, err := b.applyReferenceValues(ctx, vt, v, imported)
+	if err != nil {
+		msg := "failed to apply reference values"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	keys := make([]string, 0, len(imported))
+	for field := range imported {
+		keys = append(keys, field)
+	}
+	overrideFields(updated.common(), keys) // imported values are not inherited
+
+	expression, expressionOk := data.GetOk("policy")
+	if len(sets) > 0 || expressionOk {
+		p := &policy.Policy{Values: make(map[string][]string)}
+		if current := updated.common().PolicyExpression; current != nil {
+			p.Expression = current.Expression
+			for field, values := range current.Values {
+				p.Values[field] = values
+			}
+		}
+		for field, values := range sets {
+			p.Values[field] = values
+		}
+		if expressionOk {
+			p.Expression = expression.(string)
+		}
+		var references []string
+		if p.Expression != "" {
+			if references, err = p.References(); err != nil {
+				msg := "policy does not compile with imported values"
+				return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+			}
+		}
+		unreferenced := make([]string, 0, len(sets))
+		for field := range sets {
+			if !slices.Contains(references, field) {
+				unreferenced = append(unreferenced, field)
+			}
+		}
+		if len(unreferenced) > 0 {
+			sort.Strings(unreferenced)
+			err := fmt.Errorf("%w (e.g. `claims.tdx.mr_td in tdx_mr_td`): %v",
+				errReferenceValuesUnreferenced, unreferenced,
+			)
+			l.Error("failed to import reference values",
+				"attestation_type", vt.attestationType,
+				"domain", name,
+				"error", err,
+			)
+			return logical.ErrorResponse(err.Error()), err
+		}
+		updated.common().PolicyExpression = p
+	}
+
+	dryRun := data.Get("dry_run").(bool)
+	pending := false
+	if !dryRun {
+		if pending, err = b.proposeVerifier(ctx, req, v, updated); err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+	}
+
+	l.Info("imported reference values",
+		"attestation_type", vt.attestationType,
+		"domain", name,
+		"imported", len(imported),
+		"measurement_sets", len(sets),
+		"skipped", len(skipped),
+		"dry_run", dryRun,
+		"pending", pending,
+	)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"imported":         imported,
+			"measurement_sets": sets,
+			"skipped":          skipped,
+			"dry_run":          dryRun,
+			"pending":          pending,
+		},
+	}
+	if pending {
+		resp.AddWarning(fmt.Sprintf("the change must be approved by another entity at %s/%s/pending",
+			vt.attestationType, name,
+		))
+	}
+
+	return resp, nil
+}
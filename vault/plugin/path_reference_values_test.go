@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReferenceValuesImportSets(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/test", nil)
+	require.NoError(t, err)
+	require.False(t, res.IsError())
+
+	mrtd := bytes.Repeat([]byte{0x01}, 48)
+	rtmr3a := bytes.Repeat([]byte{0x0a}, 48)
+	rtmr3b := bytes.Repeat([]byte{0x0b}, 48)
+	payload := fmt.Sprintf(`{"mr_td": ["%s"], "rtmr_3": ["%s", "%s"]}`,
+		hex.EncodeToString(mrtd), hex.EncodeToString(rtmr3a), hex.EncodeToString(rtmr3b),
+	)
+	document := fmt.Sprintf(`{"version": "0.1.0", "type": "sample", "payload": "%s"}`,
+		base64.StdEncoding.EncodeToString([]byte(payload)),
+	)
+
+	importValues := func(extra map[string]interface{}) (*logical.Response, error) {
+		data := map[string]interface{}{
+			"attestation_type": "tdx",
+			"name":             "test",
+			"format":           "rvps",
+			"data":             base64.StdEncoding.EncodeToString([]byte(document)),
+		}
+		for k, v := range extra {
+			data[k] = v
+		}
+		return handle(t, b, storage, "", logical.UpdateOperation, "reference-values/import", data)
+	}
+
+	imported := func() bool {
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "test")
+		require.NoError(t, err)
+		return v.(*verifierTDX).MrTD != nil
+	}
+
+	{ // no policy
+		_, err := importValues(nil)
+		assert.ErrorIs(t, err, errReferenceValuesUnreferenced)
+		assert.False(t, imported())
+	}
+
+	{ // policy that does not refer to the values
+		_, err := importValues(map[string]interface{}{"policy": `claims.tdx.xfam != ""`})
+		assert.ErrorIs(t, err, errReferenceValuesUnreferenced)
+		assert.False(t, imported())
+	}
+
+	{ // policy that refers to the values
+		res, err := importValues(map[string]interface{}{"policy": `claims.tdx.rtmr[3] in tdx_rtmr3`})
+		require.NoError(t, err)
+		assert.Empty(t, res.Warnings)
+		assert.True(t, imported())
+
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "test")
+		require.NoError(t, err)
+		p := v.common().PolicyExpression
+		require.NotNil(t, p)
+		assert.Equal(t, `claims.tdx.rtmr[3] in tdx_rtmr3`, p.Expression)
+		assert.Equal(t, []string{
+			base64.StdEncoding.EncodeToString(rtmr3a),
+			base64.StdEncoding.EncodeToString(rtmr3b),
+		}, p.Values["tdx_rtmr3"])
+	}
+
+	{ // existing policy already refers to the values
+		_, err := importValues(nil)
+		assert.NoError(t, err)
+	}
+}
@@ -0,0 +1,129 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpTDXEnrollSynopsys = `
+Enroll TD instance key with TDX attestation quote.
+`
+
+const helpTDXEnrollDescription = `
+This endpoint enrolls the public key of the TD instance without TOTP code.
+The instance must provide TDX attestation quote with the report data that
+commits to the nonce issued by vault as well as to the public key being
+enrolled (i.e. SHA512(nonce || public_key), or SHA512(nonce || public_key ||
+tls_public_key) when TLS binding is required). If the quote is valid and its
+measurements match the configuration of the trusted domain, the key is
+registered as a credential of the instance that can be used for the
+subsequent logins instead of TOTP codes.
+`
+
+func pathTDXEnroll(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "tdx/" + framework.GenericNameRegex("name") + "/enroll",
+		HelpSynopsis:    helpTDXEnrollSynopsys,
+		HelpDescription: helpTDXEnrollDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "TDX trusted domain name",
+			},
+
+			"nonce": {
+				Type:        framework.TypeString,
+				Description: "Nonce used when generating TDX attestation quote",
+			},
+
+			"public_key": {
+				Type:        framework.TypeString,
+				Description: "Public key of the TD instance (base64-encoded ed25519 key)",
+			},
+
+			"quote": {
+				Type:        framework.TypeString,
+				Description: "TDX attestation quote",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathTDXEnroll,
+			},
+		},
+	}
+}
+
+func (b *backend) pathTDXEnroll(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	return b.sanitise(func() (*logical.Response, error) {
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		v, err := b.fetchResolvedVerifier(ctx, req, verifierTypeTDX, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		err = b.checkLoginSource(ctx, req, v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		td := v.(*verifierTDX).TDX
+
+		instance, err := b.enrollTDXInstance(ctx, data, td)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		bindings := [][]byte{instance.PublicKey}
+
+		tlsBinding, err := b.getTDXTLSBinding(ctx, v.AttestationType(), req, td)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if tlsBinding != nil {
+			bindings = append(bindings, tlsBinding)
+		}
+
+		quote, err := b.parseTDXQuote(ctx, v.AttestationType(), data, td)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		nonce, err := b.validateTDXReportData(ctx, v.AttestationType(), data, td, quote, bindings...)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		err = b.validateNonce(ctx, b.enrollNonces, td, nonce)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		err = b.consumeNonce(ctx, b.enrollNonces, td, nonce)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		errs := b.validateTDXQuote(ctx, v.AttestationType(), td, quote, b.multierror())
+		errs = b.matchVerifier(ctx, req, verifierTypeTDX, v, quote, errs)
+		errs = b.evaluatePolicy(ctx, v, quote, errs)
+
+		res, err := b.registerTDXInstance(ctx, req, td, instance, errs)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		return res, nil
+	})
+}
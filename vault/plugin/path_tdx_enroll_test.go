@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx/tdxtest"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestTDXQuote returns base64-encoded tdx quote (with TD 1.0 report body)
+// that carries the report data.
+func newTestTDXQuote(t *testing.T, p *tdxtest.PKI, reportData [globals.TDXNonceSize]byte) string {
+	body := make([]byte, 584)
+	copy(body[520:], reportData[:])
+
+	return base64.StdEncoding.EncodeToString(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD10, body))
+}
+
+func TestTDXInstanceEnrollment(t *testing.T) {
+	t.Parallel()
+
+	b, storage := newTestBackend(t)
+
+	p := tdxtest.NewPKI(t, time.Now(), nil)
+	b.tdxRoots = p.Roots
+
+	// every request takes a second, so the nonces must outlive the test
+	b.nonces = newNonceCache(time.Hour, globals.MaxNonces)
+	b.enrollNonces = newNonceCache(time.Hour, globals.MaxEnrollNonces)
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/app", map[string]interface{}{
+		"instance_enrollment":       true,
+		"tdx_check_sept_ve_disable": false,
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	publicKey, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	publicKeyBase64 := base64.StdEncoding.EncodeToString(publicKey)
+
+	// nonce requests the nonce with provided data
+	nonce := func(data map[string]interface{}) ([]byte, error) {
+		res, err := handle(t, b, storage, "", logical.UpdateOperation, "tdx/app/nonce", data)
+		if err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(res.Data["nonce"].(string))
+	}
+	// signedNonce requests the nonce on behalf of the enrolled instance
+	signedNonce := func(key ed25519.PrivateKey, timestamp int64) ([]byte, error) {
+		return nonce(map[string]interface{}{
+			"public_key": base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+			"timestamp":  timestamp,
+			"signature":  base64.StdEncoding.EncodeToString(ed25519.Sign(key, tdx.NonceRequestMessage(timestamp))),
+		})
+	}
+	// login logs in with the nonce signed by the key
+	login := func(n []byte, key ed25519.PrivateKey) (*logical.Response, error) {
+		publicKey := key.Public().(ed25519.PublicKey)
+		return handle(t, b, storage, "", logical.UpdateOperation, "tdx/app/login", map[string]interface{}{
+			"nonce":      base64.StdEncoding.EncodeToString(n),
+			"public_key": base64.StdEncoding.EncodeToString(publicKey),
+			"signature":  base64.StdEncoding.EncodeToString(ed25519.Sign(key, n)),
+			"quote":      newTestTDXQuote(t, p, tdx.ReportData(n, publicKey)),
+		})
+	}
+
+	{ // unenrolled key can neither get the nonce, nor login
+		_, err := signedNonce(key, time.Now().Unix())
+		assert.Error(t, err)
+
+		n, err := nonce(nil)
+		require.NoError(t, err)
+		_, err = login(n, key)
+		assert.Error(t, err) // enrollment nonce is not good for login
+
+		b.enrollNonces.delete("tdx/app", base64.StdEncoding.EncodeToString(n))
+	}
+
+	var instanceID string
+
+	{ // enroll
+		n, err := nonce(nil)
+		require.NoError(t, err)
+		assert.Equal(t, 1, b.enrollNonces.stats().Size)
+		assert.Equal(t, 0, b.nonces.stats().Size)
+
+		res, err := handle(t, b, storage, "", logical.UpdateOperation, "tdx/app/enroll", map[string]interface{}{
+			"nonce":      base64.StdEncoding.EncodeToString(n),
+			"public_key": publicKeyBase64,
+			"quote":      newTestTDXQuote(t, p, tdx.ReportData(n, publicKey)),
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+		instanceID = res.Data["instance_id"].(string)
+		assert.Equal(t, tdx.InstanceID(publicKey), instanceID)
+	}
+
+	{ // nonce, then login
+		n, err := signedNonce(key, time.Now().Unix())
+		require.NoError(t, err)
+		assert.Equal(t, 1, b.nonces.stats().Size)
+
+		res, err := login(n, key)
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+		assert.Equal(t, instanceID, res.Auth.Metadata["instance"])
+
+		_, err = login(n, key) // replayed nonce
+		assert.Error(t, err)
+	}
+
+	{ // wrong signature
+		_, other, err := ed25519.GenerateKey(nil)
+		require.NoError(t, err)
+
+		timestamp := time.Now().Unix()
+		_, err = nonce(map[string]interface{}{
+			"public_key": publicKeyBase64,
+			"timestamp":  timestamp,
+			"signature":  base64.StdEncoding.EncodeToString(ed25519.Sign(other, tdx.NonceRequestMessage(timestamp))),
+		})
+		assert.Error(t, err)
+
+		n, err := signedNonce(key, timestamp)
+		require.NoError(t, err)
+		_, err = handle(t, b, storage, "", logical.UpdateOperation, "tdx/app/login", map[string]interface{}{
+			"nonce":      base64.StdEncoding.EncodeToString(n),
+			"public_key": publicKeyBase64,
+			"signature":  base64.StdEncoding.EncodeToString(ed25519.Sign(other, n)),
+			"quote":      newTestTDXQuote(t, p, tdx.ReportData(n, publicKey)),
+		})
+		assert.Error(t, err)
+	}
+
+	{ // stale timestamp
+		_, err := signedNonce(key, time.Now().Add(-time.Hour).Unix())
+		assert.Error(t, err)
+	}
+
+	{ // revoked
+		_, err := handle(t, b, storage, "", logical.DeleteOperation, "tdx/app/instance/"+instanceID, nil)
+		require.NoError(t, err)
+
+		_, err = signedNonce(key, time.Now().Unix())
+		assert.Error(t, err)
+	}
+
+	{ // unauthenticated nonces stay within their own bucket
+		size := b.nonces.stats().Size
+		for i := 0; i < 3; i++ {
+			_, err := nonce(nil)
+			require.NoError(t, err)
+		}
+		assert.Equal(t, 3, b.enrollNonces.stats().Size)
+		assert.Equal(t, size, b.nonces.stats().Size)
+	}
+}
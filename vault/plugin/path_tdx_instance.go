@@ -0,0 +1,163 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpTDXInstanceSynopsys = `
+Manage enrolled TDX instances.
+`
+
+const helpTDXInstanceDescription = `
+This endpoint allows you to list, read, and revoke the credentials of TD
+instances that were enrolled by the means of attested first contact.
+`
+
+const (
+	opPrefixTDX = "tdx-op-prefix"
+)
+
+func pathTDXInstance(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "tdx/" + framework.GenericNameRegex("name") + "/instance/" + framework.GenericNameRegex("instance_id"),
+		HelpSynopsis:    helpTDXInstanceSynopsys,
+		HelpDescription: helpTDXInstanceDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "TDX trusted domain name",
+			},
+
+			"instance_id": {
+				Type:        framework.TypeString,
+				Description: "TD instance ID",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: opPrefixTDX,
+			OperationSuffix: "tdx-instance",
+			ItemType:        "TDX instance",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathTDXInstanceRead,
+			},
+
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathTDXInstanceDelete,
+			},
+		},
+	}
+}
+
+func pathTDXInstanceList(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "tdx/" + framework.GenericNameRegex("name") + "/instance/?",
+		HelpSynopsis:    helpTDXInstanceSynopsys,
+		HelpDescription: helpTDXInstanceDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "TDX trusted domain name",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathTDXInstanceList,
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: opPrefixTDX,
+			OperationSuffix: "tdx-instances",
+			ItemType:        "TDX instance",
+			Navigation:      true,
+		},
+	}
+}
+
+func (b *backend) pathTDXInstanceRead(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	name, err := b.getName(ctx, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	instance, err := b.fetchTDXInstance(ctx, req, name, data.Get("instance_id").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"instance_id": instance.ID,
+			"public_key":  instance.PublicKey.String(),
+			"enrolled_at": instance.EnrolledAt,
+		},
+	}, nil
+}
+
+func (b *backend) pathTDXInstanceDelete(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	name := data.Get("name").(string)
+	id := data.Get("instance_id").(string)
+
+	l.Debug("revoking instance",
+		"attestation_type", "tdx",
+		"domain", name,
+		"instance", id,
+	)
+
+	if err := b.deleteTDXInstance(ctx, req.Storage, name, id); err != nil {
+		msg := "failed to revoke instance"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", name,
+			"instance", id,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathTDXInstanceList(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	name := data.Get("name").(string)
+
+	ids, err := b.listTDXInstances(ctx, req.Storage, name)
+	if err != nil {
+		msg := "failed to list instances"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return logical.ListResponse(ids), nil
+}
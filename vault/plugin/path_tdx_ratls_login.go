@@ -2,25 +2,28 @@ package plugin
 
 import (
 	"context"
-	"encoding/base64"
 
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
-const helpTDXLoginSynopsys = `
-Log in with TOTP code and TDX attestation quote.
+const helpTDXRATLSLoginSynopsys = `
+Log in with TOTP code and RA-TLS client certificate.
 `
 
-const helpTDXLoginDescription = `
-This endpoint authenticates using TOTP code and TDX attestation quote.
+const helpTDXRATLSLoginDescription = `
+This endpoint authenticates using TOTP code and TDX attestation quote that is
+embedded into the RA-TLS client certificate presented by the client. The
+report data of the quote must bind the public key of that certificate (i.e.
+it must be SHA256(public key) padded with zeroes, as produced by Gramine or
+Intel RA-TLS libraries).
 `
 
-func pathTDXLogin(b *backend) *framework.Path {
+func pathTDXRATLSLogin(b *backend) *framework.Path {
 	return &framework.Path{
-		Pattern:         "tdx/" + framework.GenericNameRegex("name") + "/login",
-		HelpSynopsis:    helpTDXLoginSynopsys,
-		HelpDescription: helpTDXLoginDescription,
+		Pattern:         "tdx/" + framework.GenericNameRegex("name") + "/ratls-login",
+		HelpSynopsis:    helpTDXRATLSLoginSynopsys,
+		HelpDescription: helpTDXRATLSLoginDescription,
 
 		Fields: map[string]*framework.FieldSchema{
 			"name": {
@@ -32,42 +35,20 @@ func pathTDXLogin(b *backend) *framework.Path {
 				Type:        framework.TypeString,
 				Description: "TOTP code",
 			},
-
-			"quote": {
-				Type:        framework.TypeString,
-				Description: "TDX attestation quote",
-			},
 		},
 
 		Operations: map[logical.Operation]framework.OperationHandler{
 			logical.UpdateOperation: &framework.PathOperation{
-				Callback: b.pathTDXLogin,
+				Callback: b.pathTDXRATLSLogin,
 			},
 			logical.AliasLookaheadOperation: &framework.PathOperation{
-				Callback: b.pathTDXAliasLookahead,
+				Callback: b.pathVerifierAliasLookahead(verifierTypeTDX),
 			},
 		},
 	}
 }
 
-func (b *backend) pathTDXAliasLookahead(
-	ctx context.Context,
-	_ *logical.Request,
-	data *framework.FieldData,
-) (*logical.Response, error) {
-	name, err := b.getName(ctx, data)
-	if err != nil {
-		return logical.ErrorResponse(err.Error()), err
-	}
-
-	return &logical.Response{
-		Auth: &logical.Auth{
-			Alias: &logical.Alias{Name: "tdx/" + name},
-		},
-	}, nil
-}
-
-func (b *backend) pathTDXLogin(
+func (b *backend) pathTDXRATLSLogin(
 	ctx context.Context,
 	req *logical.Request,
 	data *framework.FieldData,
@@ -78,35 +59,37 @@ func (b *backend) pathTDXLogin(
 			return logical.ErrorResponse(err.Error()), err
 		}
 
-		td, err := b.fetchTDX(ctx, req, name)
+		v, err := b.fetchResolvedVerifier(ctx, req, verifierTypeTDX, name)
 		if err != nil {
 			return logical.ErrorResponse(err.Error()), err
 		}
 
-		err = b.validateTOTP(ctx, data, td)
+		err = b.checkLoginSource(ctx, req, v)
 		if err != nil {
 			return logical.ErrorResponse(err.Error()), err
 		}
+		td := v.(*verifierTDX).TDX
 
-		quote, err := b.parseTDXQuote(ctx, data, td)
+		err = b.validateTOTP(ctx, data, td)
 		if err != nil {
 			return logical.ErrorResponse(err.Error()), err
 		}
 
-		nonce := base64.StdEncoding.EncodeToString(quote.TdQuoteBody.ReportData)
-		err = b.validateNonce(ctx, td, nonce)
+		quote, err := b.parseTDXRATLSQuote(ctx, v.AttestationType(), req, td)
 		if err != nil {
 			return logical.ErrorResponse(err.Error()), err
 		}
 
-		errs := b.validateTDXQuote(ctx, td, quote, b.multierror())
-		errs = b.verifyTDXQuote(ctx, td, quote, errs)
+		errs := b.validateTDXQuote(ctx, v.AttestationType(), td, quote, b.multierror())
+		errs = b.matchVerifier(ctx, req, verifierTypeTDX, v, quote, errs)
+		errs = b.evaluatePolicy(ctx, v, quote, errs)
+		alias, errs := b.instanceAlias(ctx, v, quote, errs)
 
-		auth, err := b.loginTDX(ctx, td, errs)
+		auth, err := b.loginVerifier(ctx, td, "", alias, errs)
 		if err != nil {
 			return logical.ErrorResponse(err.Error()), err
 		}
 
-		return auth, nil
+		return b.wrapToken(v, auth), nil
 	})
 }
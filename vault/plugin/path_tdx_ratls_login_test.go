@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx/tdxtest"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTDXRATLSLogin(t *testing.T) {
+	t.Parallel()
+
+	const secret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+	b, storage := newTestBackend(t)
+
+	p := tdxtest.NewPKI(t, time.Now(), nil)
+	b.tdxRoots = p.Roots
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/app", map[string]interface{}{
+		"totp_secret":               secret,
+		"tdx_check_sept_ve_disable": false,
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	// certificate returns ra-tls certificate with the quote that carries the
+	// report data computed from the public key of the certificate
+	certificate := func(reportData func(publicKey []byte) [globals.TDXNonceSize]byte) *x509.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+		require.NoError(t, err)
+
+		body := make([]byte, 584)
+		rd := reportData(publicKey)
+		copy(body[520:], rd[:])
+
+		now := time.Now()
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(1),
+			Subject:      pkix.Name{CommonName: "test"},
+			NotBefore:    now.Add(-time.Minute),
+			NotAfter:     now.Add(time.Hour),
+			ExtraExtensions: []pkix.Extension{{
+				Id:    tdx.OIDRATLSQuote,
+				Value: tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD10, body),
+			}},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+		require.NoError(t, err)
+		cert, err := x509.ParseCertificate(der)
+		require.NoError(t, err)
+		return cert
+	}
+	// login logs in with the ra-tls certificate
+	login := func(cert *x509.Certificate) (*logical.Response, error) {
+		code, err := totp.GenerateCodeCustom(secret, time.Now().UTC(), b.totpOptions)
+		require.NoError(t, err)
+
+		req := &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "tdx/app/ratls-login",
+			Data:      map[string]interface{}{"totp": code},
+			Storage:   storage,
+		}
+		if cert != nil {
+			req.Connection = &logical.Connection{
+				RemoteAddr: "10.0.0.1",
+				ConnState:  &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+			}
+		}
+		return b.HandleRequest(context.Background(), req)
+	}
+
+	{ // gramine/intel layout
+		res, err := login(certificate(tdx.RATLSReportData))
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+		assert.Equal(t, "tdx/app", res.Auth.Alias.Name)
+	}
+
+	{ // quote binds another key
+		_, err := login(certificate(func([]byte) [globals.TDXNonceSize]byte {
+			return tdx.RATLSReportData([]byte("another key"))
+		}))
+		assert.ErrorIs(t, err, logical.ErrInvalidRequest)
+	}
+
+	{ // no certificate
+		_, err := login(nil)
+		assert.ErrorIs(t, err, logical.ErrInvalidRequest)
+	}
+}
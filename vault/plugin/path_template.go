@@ -0,0 +1,473 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpTemplateSynopsys = `
+Manage templates of trusted domains.
+`
+
+const helpTemplateDescription = `
+This endpoint allows you to create, read, update, and delete the templates
+that trusted domains can reference. The domains inherit the values of the
+fields of the template (unless they override them), so that changing the
+template updates every dependent domain.
+`
+
+const helpTemplatePendingSynopsys = `
+Review, approve, or reject the pending change of the template.
+`
+
+const helpTemplatePendingDescription = `
+When the mount requires approval, the changes of the templates are kept
+pending until another entity approves them. This endpoint shows the pending
+change (and what it changes, together with its digest), approves it (on
+write, with the digest of the reviewed change), or rejects it (on delete).
+`
+
+var (
+	errTemplateUnknownType    = errors.New("unknown attestation type")
+	errTemplateTypeImmutable  = errors.New("attestation type of the template can not be changed")
+	errTemplateFieldNotOfType = errors.New("field is not applicable to the attestation type of the template")
+)
+
+func pathTemplate(b *backend) *framework.Path {
+	path := &framework.Path{
+		Pattern:         "template/" + framework.GenericNameRegex("name"),
+		HelpSynopsis:    helpTemplateSynopsys,
+		HelpDescription: helpTemplateDescription,
+
+		ExistenceCheck: b.pathTemplateExists,
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Template name",
+			},
+
+			"attestation_type": {
+				Type:        framework.TypeString,
+				Description: "Attestation type of the domains that can reference the template (e.g. tdx, tpm2, tdxtpm2)",
+			},
+
+			"unset": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Fields to remove from the template",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "template",
+			OperationSuffix: "template",
+			ItemType:        "Template",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.CreateOperation: &framework.PathOperation{
+				Callback: b.pathTemplateUpsert,
+			},
+
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathTemplateUpsert,
+			},
+
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathTemplateRead,
+			},
+
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathTemplateDelete,
+			},
+		},
+	}
+
+	for _, vt := range verifierTypes {
+		for k, v := range vt.new(b).Fields() {
+			path.Fields[k] = v
+		}
+	}
+
+	return path
+}
+
+func pathTemplateList(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "template/?",
+		HelpSynopsis:    helpTemplateSynopsys,
+		HelpDescription: helpTemplateDescription,
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathTemplateList,
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "template",
+			OperationSuffix: "templates",
+			ItemType:        "Template",
+			Navigation:      true,
+		},
+	}
+}
+
+func pathTemplatePending(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "template/" + framework.GenericNameRegex("name") + "/pending",
+		HelpSynopsis:    helpTemplatePendingSynopsys,
+		HelpDescription: helpTemplatePendingDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: "Template name",
+			},
+
+			"digest": {
+				Type:        framework.TypeString,
+				Description: "Digest of the reviewed pending change (as shown on read), required on approval",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "template",
+			OperationSuffix: "template-pending",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathTemplatePendingRead,
+			},
+
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathTemplatePendingApprove,
+			},
+
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathTemplatePendingReject,
+			},
+		},
+	}
+}
+
+func (b *backend) pathTemplateExists(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (bool, error) {
+	t, err := b.loadTemplate(ctx, req.Storage, data.Get("name").(string))
+	if err != nil {
+		return false, err
+	}
+	return t != nil, nil
+}
+
+func (b *backend) pathTemplateUpsert(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	name, err := b.getName(ctx, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	current, err := b.loadTemplate(ctx, req.Storage, name)
+	if err != nil {
+		msg := "failed to fetch template from storage"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	t := &domainTemplate{
+		SchemaVersion: latestSchemaVersion(),
+		Values:        make(map[string]interface{}),
+	}
+	if current != nil {
+		t.AttestationType = current.AttestationType
+		for key, value := range current.Values {
+			t.Values[key] = value
+		}
+	}
+
+	if attestationType, ok := data.GetOk("attestation_type"); ok {
+		if current != nil && attestationType.(string) != current.AttestationType {
+			return logical.ErrorResponse(errTemplateTypeImmutable.Error()), errTemplateTypeImmutable
+		}
+		t.AttestationType = attestationType.(string)
+	}
+	vt := lookupVerifierType(t.AttestationType)
+	if vt == nil {
+		err := fmt.Errorf("%w: %s", errTemplateUnknownType, t.AttestationType)
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	fields := vt.new(b).Fields()
+	for key, value := range data.Raw {
+		switch key {
+		case "name", "attestation_type", "unset":
+			continue
+		}
+		if _, ok := fields[key]; !ok {
+			err := fmt.Errorf("%w: %s (%s)", errTemplateFieldNotOfType, key, vt.attestationType)
+			return logical.ErrorResponse(err.Error()), err
+		}
+		t.Values[key] = value
+	}
+	for _, key := range data.Get("unset").([]string) {
+		delete(t.Values, key)
+	}
+
+	if err := b.validateTemplate(ctx, vt, name, t); err != nil {
+		msg := "invalid template"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"template", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	pending, err := b.proposeTemplate(ctx, req, name, current, t)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+	if pending {
+		resp := &logical.Response{
+			Data: map[string]interface{}{
+				"pending": true,
+				"changes": templateChanges(current, t),
+			},
+		}
+		resp.AddWarning(fmt.Sprintf("the change must be approved by another entity at template/%s/pending", name))
+		return resp, nil
+	}
+
+	return &logical.Response{
+		Data: encodeTemplate(t),
+	}, nil
+}
+
+func (b *backend) pathTemplateRead(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	name, err := b.getName(ctx, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	t, err := b.fetchTemplate(ctx, req, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	_data := encodeTemplate(t)
+	if vt := lookupVerifierType(t.AttestationType); vt != nil {
+		dependents, err := b.templateDependents(ctx, req, vt, name)
+		if err != nil {
+			msg := "failed to list dependent domains"
+			l.Error(msg,
+				"template", name,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+		_data["domains"] = dependents
+	}
+
+	return &logical.Response{
+		Data: _data,
+	}, nil
+}
+
+func (b *backend) pathTemplateDelete(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	name := data.Get("name").(string)
+
+	t, err := b.loadTemplate(ctx, req.Storage, name)
+	if err != nil {
+		msg := "failed to fetch template from storage"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+	if t == nil {
+		return nil, nil
+	}
+
+	if vt := lookupVerifierType(t.AttestationType); vt != nil {
+		dependents, err := b.templateDependents(ctx, req, vt, name)
+		if err != nil {
+			msg := "failed to list dependent domains"
+			l.Error(msg,
+				"template", name,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+		if len(dependents) > 0 {
+			err := fmt.Errorf("%w: %v", errTemplateInUse, dependents)
+			return logical.ErrorResponse(err.Error()), err
+		}
+	}
+
+	if err := b.deletePending(ctx, req.Storage, templatePendingKey(name)); err != nil {
+		msg := "failed to delete pending change"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if err := b.deleteTemplate(ctx, req.Storage, name); err != nil {
+		msg := "failed to delete template"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathTemplateList(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	names, err := b.listTemplates(ctx, req.Storage)
+	if err != nil {
+		msg := "failed to list templates"
+		l.Error(msg,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return logical.ListResponse(names), nil
+}
+
+func (b *backend) pathTemplatePendingRead(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	name, err := b.getName(ctx, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	p, t, stale, err := b.fetchPendingTemplate(ctx, req, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	current, err := b.loadTemplate(ctx, req.Storage, name)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	digest, err := p.digest()
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"created_at":   p.CreatedAt.Format(time.RFC3339),
+			"entity_id":    p.EntityID,
+			"display_name": p.DisplayName,
+			"path":         p.Path,
+			"stale":        stale,
+			"changes":      templateChanges(current, t),
+			"digest":       digest,
+		},
+	}, nil
+}
+
+func (b *backend) pathTemplatePendingApprove(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	name, err := b.getName(ctx, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	t, err := b.approveTemplate(ctx, req, name, data.Get("digest").(string))
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	return &logical.Response{
+		Data: encodeTemplate(t),
+	}, nil
+}
+
+func (b *backend) pathTemplatePendingReject(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	name, err := b.getName(ctx, data)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	if err := b.deletePending(ctx, req.Storage, templatePendingKey(name)); err != nil {
+		msg := "failed to delete pending change"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Info("rejected change of template",
+		"template", name,
+		"entity_id", req.EntityID,
+	)
+
+	return nil, nil
+}
+
+// templateChanges returns the difference between the values of the current
+// and the requested templates.
+func templateChanges(current, proposed *domainTemplate) map[string]interface{} {
+	from := map[string]interface{}{}
+	if current != nil {
+		from = current.Values
+	}
+
+	return diffVersions(from, proposed.Values)
+}
@@ -0,0 +1,131 @@
+package plugin
+
+import (
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTemplate(t *testing.T) {
+	b, storage := newTestBackend(t)
+
+	write := func(path string, data map[string]interface{}) (*logical.Response, error) {
+		return handle(t, b, storage, "", logical.UpdateOperation, path, data)
+	}
+	read := func(path string) map[string]interface{} {
+		res, err := handle(t, b, storage, "", logical.ReadOperation, path, nil)
+		require.NoError(t, err)
+		require.NotNil(t, res)
+		require.False(t, res.IsError(), res.Error())
+		return res.Data
+	}
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "template/firmware", map[string]interface{}{
+		"attestation_type": "tdx",
+		"tdx_check_debug":  false,
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	res, err = handle(t, b, storage, "", logical.CreateOperation, "tdx/app", map[string]interface{}{
+		"template": "firmware",
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	{ // resolved from the template
+		data := read("tdx/app")
+		assert.Equal(t, false, data["tdx_check_debug"])
+		assert.Equal(t, "template/firmware", data["sources"].(map[string]string)["tdx_check_debug"])
+		assert.Empty(t, data["overrides"])
+	}
+
+	{ // template change updates the dependent domains
+		_, err := write("template/firmware", map[string]interface{}{"tdx_check_debug": true})
+		require.NoError(t, err)
+
+		data := read("tdx/app")
+		assert.Equal(t, true, data["tdx_check_debug"])
+		assert.Equal(t, "template/firmware", data["sources"].(map[string]string)["tdx_check_debug"])
+	}
+
+	{ // override
+		_, err := write("tdx/app", map[string]interface{}{"tdx_check_debug": false})
+		require.NoError(t, err)
+
+		data := read("tdx/app")
+		assert.Equal(t, false, data["tdx_check_debug"])
+		assert.Equal(t, "domain", data["sources"].(map[string]string)["tdx_check_debug"])
+		assert.Equal(t, []string{"tdx_check_debug"}, data["overrides"])
+	}
+
+	{ // inherit again
+		_, err := write("tdx/app", map[string]interface{}{"inherit": "tdx_check_debug"})
+		require.NoError(t, err)
+
+		data := read("tdx/app")
+		assert.Equal(t, true, data["tdx_check_debug"])
+		assert.Equal(t, "template/firmware", data["sources"].(map[string]string)["tdx_check_debug"])
+		assert.Empty(t, data["overrides"])
+	}
+
+	{ // dependent domains
+		data := read("template/firmware")
+		assert.Equal(t, []string{"app"}, data["domains"])
+
+		_, err := handle(t, b, storage, "", logical.DeleteOperation, "template/firmware", nil)
+		assert.ErrorIs(t, err, errTemplateInUse)
+	}
+
+	{ // attestation type is immutable
+		_, err := write("template/firmware", map[string]interface{}{"attestation_type": "tpm2"})
+		assert.ErrorIs(t, err, errTemplateTypeImmutable)
+	}
+
+	{ // templates can not reference other templates (hence no cycles)
+		_, err := write("template/firmware", map[string]interface{}{"template": "firmware"})
+		assert.ErrorIs(t, err, errTemplateFieldNotOfType)
+
+		_, err = handle(t, b, storage, "", logical.CreateOperation, "template/other", map[string]interface{}{
+			"attestation_type": "tdx",
+			"template":         "firmware",
+		})
+		assert.ErrorIs(t, err, errTemplateFieldNotOfType)
+	}
+
+	{ // missing template
+		_, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/missing", map[string]interface{}{
+			"template": "missing",
+		})
+		assert.ErrorIs(t, err, errTemplateNotFound)
+
+		_, err = write("tdx/app", map[string]interface{}{"template": "missing"})
+		assert.ErrorIs(t, err, errTemplateNotFound)
+		assert.Equal(t, "firmware", read("tdx/app")["template"])
+	}
+
+	{ // template of another attestation type
+		res, err := handle(t, b, storage, "", logical.CreateOperation, "template/ak", map[string]interface{}{
+			"attestation_type": "tpm2",
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+
+		_, err = write("tdx/app", map[string]interface{}{"template": "ak"})
+		assert.ErrorIs(t, err, errTemplateWrongType)
+	}
+
+	{ // dereference
+		_, err := write("tdx/app", map[string]interface{}{"template": ""})
+		require.NoError(t, err)
+
+		data := read("template/firmware")
+		assert.Empty(t, data["domains"])
+
+		res, err := handle(t, b, storage, "", logical.DeleteOperation, "template/firmware", nil)
+		require.NoError(t, err)
+		assert.False(t, res != nil && res.IsError())
+	}
+}
@@ -0,0 +1,473 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpExportSynopsys = `
+Export all trusted domains of the mount as one document.
+`
+
+const helpExportDescription = `
+This endpoint returns the configurations of all trusted domains (and of the
+templates they reference) as one JSON document that can be imported into
+another mount. The TOTP secrets are only included when the public key of the
+destination mount (see import/key) is provided, and are encrypted to it.
+`
+
+const helpImportSynopsys = `
+Import trusted domains from the exported document.
+`
+
+const helpImportDescription = `
+This endpoint creates or updates the trusted domains (and the templates) from
+the document produced by the export endpoint, and optionally deletes the
+domains that are missing from it. With dry_run it only reports what would be
+created, changed, or deleted.
+`
+
+const helpImportKeySynopsys = `
+Generate or read the public key that the exported secrets are encrypted to.
+`
+
+const helpImportKeyDescription = `
+This endpoint returns the public RSA key of the mount. The key is generated by
+the first write (the following writes return the existing key), and reads
+return nothing until then. The mount that exports the domains encrypts their TOTP
+secrets to it, so that only this mount can decrypt them on import.
+`
+
+func pathExport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "export",
+		HelpSynopsis:    helpExportSynopsys,
+		HelpDescription: helpExportDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"public_key": {
+				Type:        framework.TypeString,
+				Description: "PEM-encoded RSA public key to encrypt the TOTP secrets to (secrets are not exported without it)",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "attest",
+			OperationVerb:   "export",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathExport,
+			},
+
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathExport,
+			},
+		},
+	}
+}
+
+func pathImport(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "import",
+		HelpSynopsis:    helpImportSynopsys,
+		HelpDescription: helpImportDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"document": {
+				Type:        framework.TypeString,
+				Description: "JSON document produced by the export endpoint",
+			},
+
+			"delete_missing": {
+				Type:        framework.TypeBool,
+				Description: "Delete the domains that are missing from the document",
+			},
+
+			"dry_run": {
+				Type:        framework.TypeBool,
+				Description: "Only report what would be created, changed, or deleted",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "attest",
+			OperationVerb:   "import",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathImport,
+			},
+		},
+	}
+}
+
+func pathImportKey(b *backend) *framework.Path {
+	return &framework.Path{
+		Pattern:         "import/key",
+		HelpSynopsis:    helpImportKeySynopsys,
+		HelpDescription: helpImportKeyDescription,
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: "attest",
+			OperationSuffix: "import-key",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathImportKeyRead,
+			},
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathImportKeyWrite,
+			},
+		},
+	}
+}
+
+func (b *backend) pathExport(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	publicKey := data.Get("public_key").(string)
+
+	var key *rsa.PublicKey
+	if publicKey != "" {
+		var err error
+		if key, err = parsePublicKey(publicKey); err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+	}
+
+	doc, err := b.exportDocument(ctx, req, key)
+	if err != nil {
+		msg := "failed to export domains"
+		l.Error(msg,
+			"error", err,
+		)
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Info("exported domains",
+		"entity_id", req.EntityID,
+		"with_secrets", publicKey != "",
+	)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"document": doc,
+		},
+	}
+	if publicKey == "" {
+		resp.AddWarning("totp secrets are not exported without public_key")
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathImport(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	l := b.Logger()
+
+	doc := &transferDocument{}
+	if err := json.Unmarshal([]byte(data.Get("document").(string)), doc); err != nil {
+		msg := "failed to decode document"
+		return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+	}
+	if doc.Version != transferVersion {
+		err := fmt.Errorf("%w: %d", errTransferVersion, doc.Version)
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	secrets, err := b.decryptSecrets(ctx, req, doc)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	var (
+		dryRun        = data.Get("dry_run").(bool)
+		deleteMissing = data.Get("delete_missing").(bool)
+
+		created   = make([]string, 0)
+		changed   = make([]string, 0)
+		unchanged = make([]string, 0)
+		deleted   = make([]string, 0)
+		pending   = make([]string, 0)
+
+		generated = make(map[string]string)
+	)
+
+	templates := make([]string, 0, len(doc.Templates))
+	for name, t := range doc.Templates {
+		if !transferNameRegex.MatchString(name) {
+			err := fmt.Errorf("%w: template/%s", errTransferName, name)
+			return logical.ErrorResponse(err.Error()), err
+		}
+		vt := lookupVerifierType(t.AttestationType)
+		if vt == nil {
+			err := fmt.Errorf("%w: %s (template/%s)", errTransferUnknownType, t.AttestationType, name)
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if err := b.validateTemplate(ctx, vt, name, t); err != nil {
+			msg := "invalid template"
+			return logical.ErrorResponse("%s: template/%s: %s", msg, name, err), fmt.Errorf("%s: template/%s: %w", msg, name, err)
+		}
+		current, err := b.loadTemplate(ctx, req.Storage, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if current != nil && current.AttestationType != t.AttestationType {
+			err := fmt.Errorf("%w: template/%s", errTemplateTypeImmutable, name)
+			return logical.ErrorResponse(err.Error()), err
+		}
+		templates = append(templates, name)
+	}
+	sort.Strings(templates)
+
+	type importedDomain struct {
+		current Verifier
+		v       Verifier
+	}
+
+	domains := make([]*importedDomain, 0)
+	for attestationType, entries := range doc.Domains {
+		vt := lookupVerifierType(attestationType)
+		if vt == nil {
+			err := fmt.Errorf("%w: %s", errTransferUnknownType, attestationType)
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		for name, entry := range entries {
+			key := attestationType + "/" + name
+			if !transferNameRegex.MatchString(name) {
+				err := fmt.Errorf("%w: %s", errTransferName, key)
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			v := vt.new(b)
+			if err := json.Unmarshal(entry, v); err != nil {
+				msg := "failed to decode domain"
+				return logical.ErrorResponse("%s: %s: %s", msg, key, err), fmt.Errorf("%s: %s: %w", msg, key, err)
+			}
+			v.SetName(name)
+
+			if err := b.validateVerifier(ctx, v); err != nil {
+				return logical.ErrorResponse("%s: %s", key, err), fmt.Errorf("%s: %w", key, err)
+			}
+
+			if template := v.common().Template; template != "" {
+				t, ok := doc.Templates[template]
+				if !ok {
+					if t, err = b.fetchTemplate(ctx, req, template); err != nil {
+						return logical.ErrorResponse("%s: %s", key, err), fmt.Errorf("%s: %w", key, err)
+					}
+				}
+				if t.AttestationType != vt.attestationType {
+					err := fmt.Errorf("%s: %w: %s", key, errTemplateWrongType, t.AttestationType)
+					return logical.ErrorResponse(err.Error()), err
+				}
+			}
+
+			current, err := b.loadVerifier(ctx, req.Storage, vt, name)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			if current != nil {
+				current.SetName(name)
+			}
+
+			switch secret, ok := secrets[key]; {
+			case ok:
+				v.SetTOTPSecret(secret)
+			case current != nil:
+				v.SetTOTPSecret(current.GetTOTPSecret())
+			}
+
+			domains = append(domains, &importedDomain{current: current, v: v})
+		}
+	}
+	sort.Slice(domains, func(i, j int) bool {
+		if domains[i].v.AttestationType() != domains[j].v.AttestationType() {
+			return domains[i].v.AttestationType() < domains[j].v.AttestationType()
+		}
+		return domains[i].v.GetName() < domains[j].v.GetName()
+	})
+
+	for _, name := range templates {
+		t := doc.Templates[name]
+
+		current, err := b.loadTemplate(ctx, req.Storage, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		key := "template/" + name
+		switch {
+		case current == nil:
+			created = append(created, key)
+		case len(templateChanges(current, t)) == 0:
+			unchanged = append(unchanged, key)
+			continue
+		default:
+			changed = append(changed, key)
+		}
+
+		if dryRun {
+			continue
+		}
+		isPending, err := b.proposeTemplate(ctx, req, name, current, t)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if isPending {
+			pending = append(pending, key)
+		}
+	}
+
+	for _, d := range domains {
+		key := d.v.AttestationType() + "/" + d.v.GetName()
+
+		if d.current == nil {
+			created = append(created, key)
+		} else {
+			stored, err := marshalDomain(d.current)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			domain, err := marshalDomain(d.v)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			if string(stored) == string(domain) && d.current.GetTOTPSecret() == d.v.GetTOTPSecret() {
+				unchanged = append(unchanged, key)
+				continue
+			}
+			changed = append(changed, key)
+		}
+
+		if dryRun {
+			continue
+		}
+		if d.v.GetTOTPSecret() == "" {
+			if err := b.generateTOTPSecret(ctx, d.v); err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			generated[key] = d.v.GetTOTPSecret()
+		}
+		isPending, err := b.proposeVerifier(ctx, req, d.current, d.v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if isPending {
+			pending = append(pending, key)
+		}
+	}
+
+	if deleteMissing {
+		for _, vt := range verifierTypes {
+			names, err := b.listVerifiers(ctx, req.Storage, vt)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			for _, name := range names {
+				if _, ok := doc.Domains[vt.attestationType][name]; ok {
+					continue
+				}
+				deleted = append(deleted, vt.attestationType+"/"+name)
+				if dryRun {
+					continue
+				}
+				if err := b.removeVerifier(ctx, req, vt, name); err != nil {
+					return logical.ErrorResponse(err.Error()), err
+				}
+			}
+		}
+	}
+
+	l.Info("imported domains",
+		"entity_id", req.EntityID,
+		"created", len(created),
+		"changed", len(changed),
+		"unchanged", len(unchanged),
+		"deleted", len(deleted),
+		"pending", len(pending),
+		"dry_run", dryRun,
+	)
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"created":   created,
+			"changed":   changed,
+			"unchanged": unchanged,
+			"deleted":   deleted,
+			"pending":   pending,
+			"dry_run":   dryRun,
+		},
+	}
+	if len(generated) > 0 { // show totp secrets only when generating them
+		resp.Data["totp_secrets"] = generated
+	}
+	if len(pending) > 0 {
+		resp.AddWarning("some of the changes must be approved by another entity (see `pending`)")
+	}
+
+	return resp, nil
+}
+
+func (b *backend) pathImportKeyRead(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	privateKey, err := b.fetchImportKey(ctx, req, false)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+	if privateKey == nil {
+		return nil, nil
+	}
+
+	return importKeyResponse(privateKey)
+}
+
+func (b *backend) pathImportKeyWrite(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (*logical.Response, error) {
+	privateKey, err := b.fetchImportKey(ctx, req, true)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	return importKeyResponse(privateKey)
+}
+
+// importKeyResponse returns the response that carries the public part of the
+// import key.
+func importKeyResponse(privateKey *rsa.PrivateKey) (*logical.Response, error) {
+
+	publicKey, err := encodeImportKey(privateKey)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"public_key": publicKey,
+		},
+	}, nil
+}
@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportDomains exports the domains of the backend (with their totp secrets
+// encrypted to the public key, if provided) as json document.
+func exportDomains(t *testing.T, b *backend, storage logical.Storage, publicKey string) []byte {
+	data := map[string]interface{}{}
+	if publicKey != "" {
+		data["public_key"] = publicKey
+	}
+	res, err := handle(t, b, storage, "", logical.UpdateOperation, "export", data)
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	doc, err := json.Marshal(res.Data["document"])
+	require.NoError(t, err)
+
+	return doc
+}
+
+func TestTransfer(t *testing.T) {
+	ctx := context.Background()
+
+	src, srcStorage := newTestBackend(t)
+	for _, req := range []struct {
+		path string
+		data map[string]interface{}
+	}{
+		{"template/firmware", map[string]interface{}{"attestation_type": "tdx", "tdx_check_debug": true}},
+		{"tdx/app", map[string]interface{}{
+			"template":      "firmware",
+			"totp_secret":   "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+			"policy":        "claims.tdx.tee_tcb_svn in allowed",
+			"policy_values": map[string]interface{}{"allowed": "0d01080000000000,0d01090000000000"},
+			"max_nonces":    16,
+		}},
+		{"tpm2/host", map[string]interface{}{
+			"tpm2_ak_public":     "AAAA",
+			"tpm2_reboot_action": "alert",
+			"totp_secret":        "KRSXG5CTMVRXEZLUKRSXG5CTMVRXEZLU",
+		}},
+	} {
+		res, err := handle(t, src, srcStorage, "", logical.CreateOperation, req.path, req.data)
+		require.NoError(t, err, req.path)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	dst, dstStorage := newTestBackend(t)
+	{ // reading does not generate the key
+		res, err := handle(t, dst, dstStorage, "", logical.ReadOperation, "import/key", nil)
+		require.NoError(t, err)
+		assert.Nil(t, res)
+	}
+	res, err := handle(t, dst, dstStorage, "", logical.UpdateOperation, "import/key", nil)
+	require.NoError(t, err)
+	{ // the following reads and writes return the same key
+		for _, op := range []logical.Operation{logical.ReadOperation, logical.UpdateOperation} {
+			again, err := handle(t, dst, dstStorage, "", op, "import/key", nil)
+			require.NoError(t, err)
+			assert.Equal(t, res.Data["public_key"], again.Data["public_key"])
+		}
+	}
+	doc := exportDomains(t, src, srcStorage, res.Data["public_key"].(string))
+
+	{ // round-trip
+		res, err := handle(t, dst, dstStorage, "", logical.UpdateOperation, "import", map[string]interface{}{
+			"document": string(doc),
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+		assert.ElementsMatch(t, []string{"template/firmware", "tdx/app", "tpm2/host"}, res.Data["created"])
+		assert.NotContains(t, res.Data, "totp_secrets")
+
+		for _, vt := range []*verifierType{verifierTypeTDX, verifierTypeTPM2} {
+			names, err := dst.listVerifiers(ctx, dstStorage, vt)
+			require.NoError(t, err)
+			for _, name := range names {
+				want, err := src.loadVerifier(ctx, srcStorage, vt, name)
+				require.NoError(t, err)
+				got, err := dst.loadVerifier(ctx, dstStorage, vt, name)
+				require.NoError(t, err)
+				assert.Equal(t, want.GetTOTPSecret(), got.GetTOTPSecret())
+
+				wantDomain, err := marshalDomain(want)
+				require.NoError(t, err)
+				gotDomain, err := marshalDomain(got)
+				require.NoError(t, err)
+				assert.JSONEq(t, string(wantDomain), string(gotDomain), vt.attestationType+"/"+name)
+			}
+		}
+
+		// exporting the destination yields the same domains
+		var (
+			imported = &transferDocument{}
+			exported = &transferDocument{}
+		)
+		require.NoError(t, json.Unmarshal(doc, imported))
+		require.NoError(t, json.Unmarshal(exportDomains(t, dst, dstStorage, ""), exported))
+		assert.Equal(t, imported.Domains, exported.Domains)
+		assert.Equal(t, imported.Templates, exported.Templates)
+	}
+
+	{ // import of the same document changes nothing
+		res, err := handle(t, dst, dstStorage, "", logical.UpdateOperation, "import", map[string]interface{}{
+			"document": string(doc),
+		})
+		require.NoError(t, err)
+		assert.Empty(t, res.Data["created"])
+		assert.Empty(t, res.Data["changed"])
+		assert.ElementsMatch(t, []string{"template/firmware", "tdx/app", "tpm2/host"}, res.Data["unchanged"])
+	}
+}
+
+func TestImportInvalid(t *testing.T) {
+	ctx := context.Background()
+
+	src, srcStorage := newTestBackend(t)
+	for path, data := range map[string]map[string]interface{}{
+		"tdx/app":   {},
+		"tpm2/host": {"tpm2_ak_public": "AAAA"},
+	} {
+		res, err := handle(t, src, srcStorage, "", logical.CreateOperation, path, data)
+		require.NoError(t, err, path)
+		require.False(t, res.IsError(), res.Error())
+	}
+	doc := exportDomains(t, src, srcStorage, "")
+
+	for name, tc := range map[string]struct {
+		attestationType string
+		domain          string
+		key             string
+		value           interface{}
+		err             error
+	}{
+		"policy":          {"tdx", "app", "policy", map[string]interface{}{"expression": "claims.tdx ==="}, nil},
+		"manifest signer": {"tdx", "app", "manifest_signer", "AAAA", errManifestSignerWrongSize},
+		"max nonces":      {"tdx", "app", "max_nonces", -1, errMaxNoncesInvalid},
+		"instance alias":  {"tdx", "app", "instance_alias", "tpm2_ek", errInstanceAliasInvalid},
+		"reboot action":   {"tpm2", "host", "tpm2_reboot_action", "reboot", nil},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dst, dstStorage := newTestBackend(t)
+
+			invalid := &transferDocument{}
+			require.NoError(t, json.Unmarshal(doc, invalid))
+
+			domain := map[string]json.RawMessage{}
+			require.NoError(t, json.Unmarshal(invalid.Domains[tc.attestationType][tc.domain], &domain))
+			value, err := json.Marshal(tc.value)
+			require.NoError(t, err)
+			domain[tc.key] = value
+			invalid.Domains[tc.attestationType][tc.domain], err = json.Marshal(domain)
+			require.NoError(t, err)
+
+			encoded, err := json.Marshal(invalid)
+			require.NoError(t, err)
+
+			res, err := handle(t, dst, dstStorage, "", logical.UpdateOperation, "import", map[string]interface{}{
+				"document": string(encoded),
+			})
+			require.Error(t, err)
+			assert.True(t, res.IsError())
+			if tc.err != nil {
+				assert.ErrorIs(t, err, tc.err)
+			}
+
+			// nothing is imported, not even the valid domains
+			for _, vt := range []*verifierType{verifierTypeTDX, verifierTypeTPM2} {
+				names, err := dst.listVerifiers(ctx, dstStorage, vt)
+				require.NoError(t, err)
+				assert.Empty(t, names, vt.attestationType)
+			}
+		})
+	}
+}
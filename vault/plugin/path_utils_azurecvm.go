@@ -0,0 +1,246 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/azurecvm"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+func (b *backend) encodeAzureCVM(
+	ctx context.Context,
+	td *azurecvm.AzureCVM,
+) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+
+	for _, policy := range []TD{td.SEVSNP, td.TDX, td.TPM2} {
+		_data, err := b.encodeTD(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range _data {
+			res[k] = v
+		}
+	}
+	delete(res, "instance_enrollment") // not supported by azure cvms
+	delete(res, "tdx_tls_binding")
+	delete(res, "tpm2_ak_public")
+
+	encodeTPM2PCRs(td.TPM2, res)
+
+	_data, err := b.encodeTD(ctx, td) // totp secret and token params
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range _data {
+		res[k] = v
+	}
+
+	return res, nil
+}
+
+func (b *backend) parseAzureCVMHCLReport(
+	ctx context.Context,
+	data *framework.FieldData,
+	td *azurecvm.AzureCVM,
+) (*azurecvm.HCLReport, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	l.Debug("parsing hcl report",
+		"attestation_type", "azure-cvm",
+		"domain", td.Name,
+	)
+
+	hclReportBase64 := data.Get("hcl_report").(string)
+	if hclReportBase64 == "" {
+		return nil, errors.New("`hcl_report` field is required")
+	}
+
+	hclReportBytes, err := base64.StdEncoding.DecodeString(hclReportBase64)
+	if err != nil {
+		msg := "failed to base64-decode hcl report"
+		l.Error(msg,
+			"attestation_type", "azure-cvm",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	hcl, err := azurecvm.ParseHCLReport(hclReportBytes)
+	if err != nil {
+		msg := "failed to parse hcl report"
+		l.Error(msg,
+			"attestation_type", "azure-cvm",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return hcl, nil
+}
+
+func (b *backend) parseAzureCVMHardwareReport(
+	ctx context.Context,
+	data *framework.FieldData,
+	td *azurecvm.AzureCVM,
+	hcl *azurecvm.HCLReport,
+) (*azurecvm.HardwareReport, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	l.Debug("parsing hardware report",
+		"attestation_type", "azure-cvm",
+		"domain", td.Name,
+		"report_type", hcl.ReportType,
+	)
+
+	quote, err := base64.StdEncoding.DecodeString(data.Get("quote").(string))
+	if err != nil {
+		msg := "failed to base64-decode tdx quote"
+		l.Error(msg,
+			"attestation_type", "azure-cvm",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	report, err := azurecvm.ParseHardwareReport(hcl, quote)
+	if err != nil {
+		msg := "failed to parse hardware report"
+		l.Error(msg,
+			"attestation_type", "azure-cvm",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return report, nil
+}
+
+// parseAzureCVMAttestation parses tpm2 attestation and makes sure that it was
+// generated with the attestation key from hcl report.
+func (b *backend) parseAzureCVMAttestation(
+	ctx context.Context,
+	data *framework.FieldData,
+	td *azurecvm.AzureCVM,
+	hcl *azurecvm.HCLReport,
+) (*attest.PlatformParameters, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	attestationBase64 := data.Get("attestation").(string)
+	if attestationBase64 == "" {
+		return nil, errors.New("`attestation` field is required")
+	}
+
+	attestationBytes, err := base64.StdEncoding.DecodeString(attestationBase64)
+	if err != nil {
+		msg := "failed to base64-decode tpm2 attestation report"
+		l.Error(msg,
+			"attestation_type", "azure-cvm",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	attestation := &attest.PlatformParameters{}
+	if err := json.Unmarshal(attestationBytes, attestation); err != nil {
+		msg := "failed to json-unmarshal tpm2 attestation report"
+		l.Error(msg,
+			"attestation_type", "azure-cvm",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if err := hcl.MatchesAKPublic(attestation.Public); err != nil {
+		msg := "unexpected tpm2 attestation key"
+		l.Error(msg,
+			"attestation_type", "azure-cvm",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	// the key is bound to the hardware report, so it's safe to use it for
+	// the validation of the attestation itself
+	td.TPM2.AKPublic = attestation.Public
+
+	return attestation, nil
+}
+
+func (b *backend) validateAzureCVMHardwareReport(
+	ctx context.Context,
+	td *azurecvm.AzureCVM,
+	report *azurecvm.HardwareReport,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	switch {
+	case report.SEVSNP != nil && td.SEVSNP != nil:
+		return b.validateSEVSNPAttestation(ctx, td.SEVSNP, report.SEVSNP, errs)
+	case report.TDX != nil && td.TDX != nil:
+		return b.validateTDXQuote(ctx, "azure-cvm", td.TDX, report.TDX, errs)
+	}
+
+	return errs // missing policy is reported by verifyAzureCVM
+}
+
+func (b *backend) verifyAzureCVM(
+	ctx context.Context,
+	td *azurecvm.AzureCVM,
+	report *azurecvm.HardwareReport,
+	attestation *attest.PlatformParameters,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("verifying hardware report and tpm2 attestation",
+		"attestation_type", "azure-cvm",
+		"domain", td.Name,
+	)
+
+	reported, ignored := td.Matches(report, attestation)
+
+	errs = multierror.Append(errs, reported...)
+
+	if len(ignored) > 0 {
+		l.Debug("finished verifying hardware report and tpm2 attestation",
+			"attestation_type", "azure-cvm",
+			"domain", td.Name,
+			"ignored", b.multierror(ignored...),
+		)
+	}
+
+	return errs
+}
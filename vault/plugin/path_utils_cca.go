@@ -0,0 +1,218 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/cca"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// applyCCAFields updates cca policy with the fields provided in the request
+// (or creates a new one, if td is nil).
+func (b *backend) applyCCAFields(
+	ctx context.Context,
+	data *framework.FieldData,
+	name string,
+	td *cca.CCA,
+) (*cca.CCA, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	l := b.Logger()
+
+	rim, rimOk, errs := types.BytesFromFieldData(data, "cca_rim", nil)
+	rem0, rem0Ok, errs := types.BytesFromFieldData(data, "cca_rem0", errs)
+	rem1, rem1Ok, errs := types.BytesFromFieldData(data, "cca_rem1", errs)
+	rem2, rem2Ok, errs := types.BytesFromFieldData(data, "cca_rem2", errs)
+	rem3, rem3Ok, errs := types.BytesFromFieldData(data, "cca_rem3", errs)
+	rpv, rpvOk, errs := types.BytesFromFieldData(data, "cca_personalization_value", errs)
+	implementationID, implementationIDOk, errs := types.Byte32FromFieldData(data, "cca_platform_implementation_id", errs)
+
+	cpaks, cpaksOk := data.GetOk("cca_cpaks")
+	if cpaksOk {
+		if _, err := cca.ParseCPAKs(cpaks.(string)); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"cca_cpaks is not a valid pem-encoded bundle of public keys or certificates: %w", err,
+			))
+		}
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		msg := "failed to read parameters for cca entry"
+		l.Error(msg,
+			"attestation_type", "cca",
+			"domain", name,
+			"error", err,
+		)
+		return nil, false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if td != nil {
+		l.Debug("updating domain",
+			"attestation_type", "cca",
+			"domain", name,
+		)
+
+		td.Name = name // name is not stored as a field
+
+		if rimOk {
+			td.RIM = rim
+		}
+		if rem0Ok {
+			td.REM0 = rem0
+		}
+		if rem1Ok {
+			td.REM1 = rem1
+		}
+		if rem2Ok {
+			td.REM2 = rem2
+		}
+		if rem3Ok {
+			td.REM3 = rem3
+		}
+		if rpvOk {
+			td.PersonalizationValue = rpv
+		}
+		if implementationIDOk {
+			td.PlatformImplementationID = implementationID
+		}
+		if cpaksOk {
+			td.CPAKs = cpaks.(string)
+		}
+
+		return td, false, nil
+	}
+
+	l.Debug("creating domain",
+		"attestation_type", "cca",
+		"domain", name,
+	)
+
+	td = &cca.CCA{
+		Name:                     name,
+		RIM:                      rim,
+		REM0:                     rem0,
+		REM1:                     rem1,
+		REM2:                     rem2,
+		REM3:                     rem3,
+		PersonalizationValue:     rpv,
+		PlatformImplementationID: implementationID,
+		CPAKs:                    data.Get("cca_cpaks").(string),
+	}
+
+	return td, true, nil
+}
+
+func (b *backend) parseCCAToken(
+	ctx context.Context,
+	data *framework.FieldData,
+	td *cca.CCA,
+) (*cca.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	l.Debug("parsing cca attestation token",
+		"attestation_type", "cca",
+		"domain", td.Name,
+	)
+
+	tokenBase64 := data.Get("token").(string)
+	if tokenBase64 == "" {
+		return nil, errors.New("`token` field is required")
+	}
+
+	tokenBytes, err := base64.StdEncoding.DecodeString(tokenBase64)
+	if err != nil {
+		msg := "failed to base64-decode cca attestation token"
+		l.Error(msg,
+			"attestation_type", "cca",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	token, err := cca.ParseToken(tokenBytes)
+	if err != nil {
+		msg := "failed to cbor-parse cca attestation token"
+		l.Error(msg,
+			"attestation_type", "cca",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return token, nil
+}
+
+func (b *backend) validateCCAToken(
+	ctx context.Context,
+	td *cca.CCA,
+	token *cca.Token,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("validating cca attestation token",
+		"attestation_type", "cca",
+		"domain", td.Name,
+	)
+
+	if err := td.Verify(token); err != nil {
+		msg := "failed to validate cca attestation token"
+		l.Error(msg,
+			"attestation_type", "cca",
+			"domain", td.Name,
+			"error", err,
+		)
+		return multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+	}
+
+	return errs
+}
+
+func (b *backend) verifyCCAToken(
+	ctx context.Context,
+	td *cca.CCA,
+	token *cca.Token,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("verifying cca attestation token",
+		"attestation_type", "cca",
+		"domain", td.Name,
+	)
+
+	reported, ignored := td.MatchesToken(token)
+
+	errs = multierror.Append(errs, reported...)
+
+	if len(ignored) > 0 {
+		l.Debug("finished verifying cca attestation token",
+			"attestation_type", "cca",
+			"domain", td.Name,
+			"ignored", b.multierror(ignored...),
+		)
+	}
+
+	return errs
+}
@@ -61,7 +61,7 @@ func (b *backend) encodeTD(
 	if err := mapstructure.Decode(td, &res); err != nil {
 		msg := "failed to encode td entry"
 		l.Error(msg,
-			"attestation_type", "tdx",
+			"attestation_type", td.AttestationType(),
 			"domain", td.GetName(),
 			"error", err,
 		)
@@ -180,10 +180,15 @@ func (b *backend) validateTOTP(
 	return nil
 }
 
+// generateNonce issues the nonce to the domain. When the domain (or the whole
+// mount) reaches the limit of outstanding nonces, the oldest ones of the
+// domain are evicted.
 func (b *backend) generateNonce(
 	ctx context.Context,
+	nonces *nonceCache,
 	td TD,
 	size int,
+	limit int,
 ) (string, error) {
 	if err := ctx.Err(); err != nil {
 		return "", err
@@ -209,24 +214,29 @@ func (b *backend) generateNonce(
 		}
 		nonce := base64.StdEncoding.EncodeToString(_nonce)
 
-		entry := td.AttestationType() + "/" + td.GetName() + "/nonce/" + nonce
-
-		if _, used := b.totpUsedCodes.Get(entry); used {
+		added, evicted, err := nonces.add(td.AttestationType()+"/"+td.GetName(), nonce, limit)
+		if err != nil {
+			msg := "failed to generate nonce"
+			l.Error(msg,
+				"attestation_type", td.AttestationType(),
+				"domain", td.GetName(),
+				"error", err,
+			)
+			return "", fmt.Errorf("%s: %w", msg, err)
+		}
+		if !added {
 			l.Warn("regenerating nonce due to a collision",
 				"attestation_type", td.AttestationType(),
 				"domain", td.GetName(),
 			)
 			continue
 		}
-
-		if err := b.totpUsedCodes.Add(entry, nil, globals.NoncePeriod); err != nil {
-			msg := "failed to generate nonce"
-			l.Error(msg,
+		if evicted > 0 {
+			l.Warn("evicted outstanding nonces to make room for the new one",
 				"attestation_type", td.AttestationType(),
 				"domain", td.GetName(),
-				"error", err,
+				"evicted", evicted,
 			)
-			return "", fmt.Errorf("%s: %w", msg, err)
 		}
 
 		return nonce, nil
@@ -242,6 +252,7 @@ func (b *backend) generateNonce(
 
 func (b *backend) validateNonce(
 	ctx context.Context,
+	nonces *nonceCache,
 	td TD,
 	nonce string,
 ) error {
@@ -256,8 +267,7 @@ func (b *backend) validateNonce(
 		"domain", td.GetName(),
 	)
 
-	entry := td.AttestationType() + "/" + td.GetName() + "/nonce/" + nonce
-	if _, present := b.totpUsedCodes.Get(entry); !present {
+	if !nonces.has(td.AttestationType()+"/"+td.GetName(), nonce) {
 		msg := "unexpected nonce"
 		l.Error(msg,
 			"attestation_type", td.AttestationType(),
@@ -269,6 +279,28 @@ func (b *backend) validateNonce(
 	return nil
 }
 
+func (b *backend) consumeNonce(
+	ctx context.Context,
+	nonces *nonceCache,
+	td TD,
+	nonce string,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	l.Debug("consuming nonce",
+		"attestation_type", td.AttestationType(),
+		"domain", td.GetName(),
+	)
+
+	nonces.delete(td.AttestationType()+"/"+td.GetName(), nonce)
+
+	return nil
+}
+
 func (b *backend) parseTokenFields(
 	ctx context.Context,
 	req *logical.Request,
@@ -0,0 +1,25 @@
+package plugin
+
+import (
+	"github.com/hashicorp/vault/sdk/helper/wrapping"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// wrapToken makes vault core return the token of the domain with the wrapped
+// token delivery in the single-use response-wrapping token.
+//
+// The token itself is still issued by vault core from the auth response (with
+// its bound cidrs, token type and identity alias), it is only revealed to
+// whoever unwraps it first.
+func (b *backend) wrapToken(v Verifier, res *logical.Response) *logical.Response {
+	if res == nil || v.common().TokenDelivery != tokenDeliveryWrapped {
+		return res
+	}
+
+	res.WrapInfo = &wrapping.ResponseWrapInfo{
+		TTL:      tokenDeliveryWrapTTL,
+		SealWrap: true,
+	}
+
+	return res
+}
@@ -0,0 +1,92 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx/tdxtest"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrappedTokenDelivery(t *testing.T) {
+	t.Parallel()
+
+	const secret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+	b, storage := newTestBackend(t)
+
+	p := tdxtest.NewPKI(t, time.Now(), nil)
+	b.tdxRoots = p.Roots
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/app", map[string]interface{}{
+		"totp_secret":               secret,
+		"token_delivery":            "wrapped",
+		"token_bound_cidrs":         "10.0.0.0/8",
+		"token_type":                "batch",
+		"tdx_check_sept_ve_disable": false,
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	// login logs in with the quote
+	login := func() (*logical.Response, error) {
+		code, err := totp.GenerateCodeCustom(secret, time.Now().UTC(), b.totpOptions)
+		require.NoError(t, err)
+		res, err := handle(t, b, storage, "", logical.UpdateOperation, "tdx/app/nonce", map[string]interface{}{
+			"totp": code,
+		})
+		require.NoError(t, err)
+		n, err := base64.StdEncoding.DecodeString(res.Data["nonce"].(string))
+		require.NoError(t, err)
+
+		code, err = totp.GenerateCodeCustom(secret, time.Now().UTC(), b.totpOptions)
+		require.NoError(t, err)
+		return handle(t, b, storage, "", logical.UpdateOperation, "tdx/app/login", map[string]interface{}{
+			"totp":  code,
+			"nonce": base64.StdEncoding.EncodeToString(n),
+			"quote": newTestTDXQuote(t, p, tdx.ReportData(n)),
+		})
+	}
+
+	{ // token is issued from the auth response, and wrapped by vault core
+		res, err := login()
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+
+		require.NotNil(t, res.WrapInfo)
+		assert.Equal(t, tokenDeliveryWrapTTL, res.WrapInfo.TTL)
+		assert.True(t, res.WrapInfo.SealWrap)
+
+		require.NotNil(t, res.Auth)
+		require.Len(t, res.Auth.BoundCIDRs, 1)
+		assert.Equal(t, "10.0.0.0/8", res.Auth.BoundCIDRs[0].String())
+		assert.Equal(t, logical.TokenTypeBatch, res.Auth.TokenType)
+		require.NotNil(t, res.Auth.Alias)
+		assert.Equal(t, "tdx/app", res.Auth.Alias.Name)
+	}
+
+	{ // any attestation type can deliver wrapped tokens
+		res, err := handle(t, b, storage, "", logical.CreateOperation, "tpm2/app", map[string]interface{}{
+			"tpm2_ak_public": "AAAA",
+			"token_delivery": "wrapped",
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	{ // unknown delivery
+		res, err := handle(t, b, storage, "", logical.CreateOperation, "tpm2/other", map[string]interface{}{
+			"tpm2_ak_public": "AAAA",
+			"token_delivery": "sealed",
+		})
+		assert.ErrorIs(t, err, errTokenDeliveryInvalid)
+		if assert.NotNil(t, res) {
+			assert.True(t, res.IsError())
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var (
+	errVersionNotFound = errors.New("version is not found")
+)
+
+// recordVersion adds the configuration of the domain (as it is about to be
+// saved) to the history of the domain.
+func (b *backend) recordVersion(
+	ctx context.Context,
+	req *logical.Request,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	versions, err := b.listVersions(ctx, req.Storage, v)
+	if err != nil {
+		return err
+	}
+
+	next := 1
+	if len(versions) > 0 {
+		next = versions[len(versions)-1] + 1
+	} else {
+		// keep the configuration of the domains that were configured before
+		// the history was introduced
+		entry, err := req.Storage.Get(ctx, v.AttestationType()+"/"+v.GetName())
+		if err != nil {
+			return err
+		}
+		if entry != nil {
+			domain, err := withoutTOTPSecret(entry.Value)
+			if err != nil {
+				return err
+			}
+			if err := b.saveVersion(ctx, req.Storage, v, &verifierVersion{
+				Version: next,
+				Domain:  domain,
+			}); err != nil {
+				return err
+			}
+			versions = append(versions, next)
+			next++
+		}
+	}
+
+	domain, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if domain, err = withoutTOTPSecret(domain); err != nil {
+		return err
+	}
+
+	if err := b.saveVersion(ctx, req.Storage, v, &verifierVersion{
+		Version:     next,
+		CreatedAt:   time.Now().UTC(),
+		EntityID:    req.EntityID,
+		DisplayName: req.DisplayName,
+		Path:        req.Path,
+		Domain:      domain,
+	}); err != nil {
+		return err
+	}
+	versions = append(versions, next)
+
+	for len(versions) > globals.DomainHistorySize {
+		if err := b.deleteVersion(ctx, req.Storage, v, versions[0]); err != nil {
+			return err
+		}
+		versions = versions[1:]
+	}
+
+	return nil
+}
+
+// withoutTOTPSecret removes totp secret from the encoded domain configuration
+// so that it never makes it into the history.
+func withoutTOTPSecret(domain []byte) ([]byte, error) {
+	fields := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(domain, &fields); err != nil {
+		return nil, err
+	}
+	delete(fields, "totp_secret")
+
+	return json.Marshal(fields)
+}
+
+// fetchVersion returns the stored version of the domain together with the
+// configuration of the domain decoded from it.
+func (b *backend) fetchVersion(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	td TD,
+	version int,
+) (*verifierVersion, Verifier, error) {
+	l := b.Logger()
+
+	stored, err := b.loadVersion(ctx, req.Storage, td, version)
+	if err != nil {
+		msg := "failed to fetch version from storage"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", td.GetName(),
+			"version", version,
+			"error", err,
+		)
+		return nil, nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	if stored == nil {
+		return nil, nil, fmt.Errorf("%w: %d", errVersionNotFound, version)
+	}
+
+	v := vt.new(b)
+	if err := json.Unmarshal(stored.Domain, v); err != nil {
+		msg := "failed to decode version"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", td.GetName(),
+			"version", version,
+			"error", err,
+		)
+		return nil, nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	v.SetName(td.GetName())
+
+	return stored, v, nil
+}
+
+// encodeVersion returns the domain configuration of the version in the form
+// that is shown on read.
+func (b *backend) encodeVersion(
+	ctx context.Context,
+	v Verifier,
+) (map[string]interface{}, error) {
+	res, err := v.Encode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	encodeCommon(v, res)
+	delete(res, "totp_secret") // not kept in history
+
+	return res, nil
+}
+
+// diffVersions returns the fields that differ between two encoded versions.
+func diffVersions(from, to map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{})
+
+	for k, f := range from {
+		if t, ok := to[k]; !ok || !reflect.DeepEqual(f, t) {
+			res[k] = map[string]interface{}{"from": f, "to": to[k]}
+		}
+	}
+	for k, t := range to {
+		if _, ok := from[k]; !ok {
+			res[k] = map[string]interface{}{"from": nil, "to": t}
+		}
+	}
+
+	return res
+}
+
+// purgeHistory removes all versions stored for the domain.
+func (b *backend) purgeHistory(
+	ctx context.Context,
+	req *logical.Request,
+	td TD,
+) error {
+	l := b.Logger()
+
+	versions, err := b.listVersions(ctx, req.Storage, td)
+	if err != nil {
+		msg := "failed to list versions"
+		l.Error(msg,
+			"attestation_type", td.AttestationType(),
+			"domain", td.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	for _, version := range versions {
+		if err := b.deleteVersion(ctx, req.Storage, td, version); err != nil {
+			msg := "failed to delete version"
+			l.Error(msg,
+				"attestation_type", td.AttestationType(),
+				"domain", td.GetName(),
+				"version", version,
+				"error", err,
+			)
+			return fmt.Errorf("%s: %w", msg, err)
+		}
+	}
+
+	return nil
+}
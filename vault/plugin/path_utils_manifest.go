@@ -0,0 +1,286 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/manifest"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var (
+	errManifestNoMatch              = errors.New("evidence does not match any valid manifest")
+	errManifestNoSigner             = errors.New("domain does not trust any manifest signer")
+	errReferenceValueUnknown        = errors.New("unknown reference value")
+	errReferenceValueNotMeasurement = errors.New("reference value is not a measurement")
+	errManifestSignerWrongSize      = errors.New("invalid size of manifest signer public key")
+)
+
+// applyManifestSigner updates the manifest signer of the verifier with the
+// field provided in the request (empty value removes it).
+func (b *backend) applyManifestSigner(
+	ctx context.Context,
+	data *framework.FieldData,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	signer, signerOk, errs := types.BytesFromFieldData(data, "manifest_signer", nil)
+	if signerOk {
+		if err := checkManifestSigner(signer); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+	if err := errs.ErrorOrNil(); err != nil {
+		msg := "failed to read manifest signer"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if signerOk {
+		v.common().ManifestSigner = signer
+	}
+
+	return nil
+}
+
+// checkManifestSigner makes sure that the manifest signer (if any) is ed25519
+// public key.
+func checkManifestSigner(signer []byte) error {
+	if len(signer) != 0 && len(signer) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: %d != %d",
+			errManifestSignerWrongSize, len(signer), ed25519.PublicKeySize,
+		)
+	}
+	return nil
+}
+
+// applyReferenceValues returns the copy of the verifier with the reference
+// values (keyed by the names of the fields) applied on top of its policy.
+//
+// Only the measurement fields of the verifier can be set this way, so that
+// the reference values can not relax the checks of the policy (e.g. allow
+// debug tds).
+func (b *backend) applyReferenceValues(
+	ctx context.Context,
+	vt *verifierType,
+	v Verifier,
+	values map[string]interface{},
+) (Verifier, error) {
+	measurements := v.MeasurementFields()
+	for key := range values {
+		if !slices.Contains(measurements, key) {
+			return nil, fmt.Errorf("%w: %s", errReferenceValueNotMeasurement, key)
+		}
+	}
+
+	return b.applyValues(ctx, vt, v, values)
+}
+
+// applyValues returns the copy of the verifier with the values (keyed by the
+// names of the fields) applied on top of its policy.
+func (b *backend) applyValues(
+	ctx context.Context,
+	vt *verifierType,
+	v Verifier,
+	values map[string]interface{},
+) (Verifier, error) {
+	fields := v.Fields()
+	for key := range values {
+		if _, known := fields[key]; !known {
+			return nil, fmt.Errorf("%w: %s", errReferenceValueUnknown, key)
+		}
+	}
+
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	clone := vt.new(b)
+	if err := json.Unmarshal(raw, clone); err != nil {
+		return nil, err
+	}
+	clone.SetName(v.GetName())
+
+	data := &framework.FieldData{
+		Raw:    values,
+		Schema: fields,
+	}
+	if err := clone.Apply(ctx, data, false); err != nil {
+		return nil, err
+	}
+	clone.SetName(v.GetName())
+
+	return clone, nil
+}
+
+// openManifest verifies the signature and the expiry of the manifest, and
+// makes sure its reference values can be applied to the verifier.
+func (b *backend) openManifest(
+	ctx context.Context,
+	vt *verifierType,
+	v Verifier,
+	signed *manifest.Signed,
+) (*manifest.Manifest, Verifier, error) {
+	signer := v.common().ManifestSigner
+	if len(signer) == 0 {
+		return nil, nil, errManifestNoSigner
+	}
+
+	m, err := signed.Open(signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := m.Valid(time.Now()); err != nil {
+		return nil, nil, err
+	}
+
+	clone, err := b.applyReferenceValues(ctx, vt, v, m.ReferenceValues)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return m, clone, nil
+}
+
+// matchVerifier verifies that the evidence satisfies the policy of the
+// verifier.
+//
+// When the domain trusts a manifest signer, the evidence must satisfy the
+// policy with the reference values of any valid and unexpired manifest applied
+// on top of it.
+func (b *backend) matchVerifier(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	v Verifier,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	if len(v.common().ManifestSigner) == 0 {
+		return v.Match(ctx, evidence, errs)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	ids, err := b.listManifests(ctx, req.Storage, v)
+	if err != nil {
+		msg := "failed to list manifests"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+	}
+
+	for _, id := range ids {
+		signed, err := b.loadManifest(ctx, req.Storage, v, id)
+		if err != nil || signed == nil {
+			l.Warn("failed to fetch manifest from storage",
+				"attestation_type", v.AttestationType(),
+				"domain", v.GetName(),
+				"manifest", id,
+				"error", err,
+			)
+			continue
+		}
+
+		_, clone, err := b.openManifest(ctx, vt, v, signed)
+		if err != nil {
+			l.Debug("skipping manifest",
+				"attestation_type", v.AttestationType(),
+				"domain", v.GetName(),
+				"manifest", id,
+				"error", err,
+			)
+			continue
+		}
+
+		if err := clone.Match(ctx, evidence, b.multierror()).ErrorOrNil(); err != nil {
+			l.Debug("evidence does not match manifest",
+				"attestation_type", v.AttestationType(),
+				"domain", v.GetName(),
+				"manifest", id,
+				"error", err,
+			)
+			continue
+		}
+
+		l.Debug("evidence matches manifest",
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"manifest", id,
+		)
+
+		return errs
+	}
+
+	return multierror.Append(errs, fmt.Errorf("%w: %d manifest(s) checked",
+		errManifestNoMatch, len(ids),
+	))
+}
+
+// purgeManifests removes all manifests stored for the domain.
+func (b *backend) purgeManifests(
+	ctx context.Context,
+	req *logical.Request,
+	td TD,
+) error {
+	l := b.Logger()
+
+	ids, err := b.listManifests(ctx, req.Storage, td)
+	if err != nil {
+		msg := "failed to list manifests"
+		l.Error(msg,
+			"attestation_type", td.AttestationType(),
+			"domain", td.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	for _, id := range ids {
+		if err := b.deleteManifest(ctx, req.Storage, td, id); err != nil {
+			msg := "failed to delete manifest"
+			l.Error(msg,
+				"attestation_type", td.AttestationType(),
+				"domain", td.GetName(),
+				"manifest", id,
+				"error", err,
+			)
+			return fmt.Errorf("%s: %w", msg, err)
+		}
+	}
+
+	return nil
+}
+
+func encodeManifest(m *manifest.Manifest) map[string]interface{} {
+	return map[string]interface{}{
+		"image":            m.Image,
+		"version":          m.Version,
+		"expires_at":       m.ExpiresAt.UTC().Format(time.RFC3339),
+		"reference_values": m.ReferenceValues,
+	}
+}
@@ -0,0 +1,218 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/nitro"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+)
+
+// applyNitroFields updates nitro policy with the fields provided in the request
+// (or creates a new one, if td is nil).
+func (b *backend) applyNitroFields(
+	ctx context.Context,
+	data *framework.FieldData,
+	name string,
+	td *nitro.Nitro,
+) (*nitro.Nitro, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	l := b.Logger()
+
+	pcr0, pcr0Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr0", nil)
+	pcr1, pcr1Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr1", errs)
+	pcr2, pcr2Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr2", errs)
+	pcr3, pcr3Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr3", errs)
+	pcr4, pcr4Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr4", errs)
+	pcr5, pcr5Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr5", errs)
+	pcr6, pcr6Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr6", errs)
+	pcr7, pcr7Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr7", errs)
+	pcr8, pcr8Ok, errs := types.Byte48FromFieldData(data, "nitro_pcr8", errs)
+
+	if err := errs.ErrorOrNil(); err != nil {
+		msg := "failed to read parameters for nitro entry"
+		l.Error(msg,
+			"attestation_type", "nitro",
+			"domain", name,
+			"error", err,
+		)
+		return nil, false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if td != nil {
+		l.Debug("updating domain",
+			"attestation_type", "nitro",
+			"domain", name,
+		)
+
+		td.Name = name // name is not stored as a field
+
+		if pcr0Ok {
+			td.PCR0 = pcr0
+		}
+		if pcr1Ok {
+			td.PCR1 = pcr1
+		}
+		if pcr2Ok {
+			td.PCR2 = pcr2
+		}
+		if pcr3Ok {
+			td.PCR3 = pcr3
+		}
+		if pcr4Ok {
+			td.PCR4 = pcr4
+		}
+		if pcr5Ok {
+			td.PCR5 = pcr5
+		}
+		if pcr6Ok {
+			td.PCR6 = pcr6
+		}
+		if pcr7Ok {
+			td.PCR7 = pcr7
+		}
+		if pcr8Ok {
+			td.PCR8 = pcr8
+		}
+
+		return td, false, nil
+	}
+
+	l.Debug("creating domain",
+		"attestation_type", "nitro",
+		"domain", name,
+	)
+
+	td = &nitro.Nitro{
+		Name: name,
+		PCR0: pcr0,
+		PCR1: pcr1,
+		PCR2: pcr2,
+		PCR3: pcr3,
+		PCR4: pcr4,
+		PCR5: pcr5,
+		PCR6: pcr6,
+		PCR7: pcr7,
+		PCR8: pcr8,
+	}
+
+	return td, true, nil
+}
+
+func (b *backend) parseNitroDocument(
+	ctx context.Context,
+	data *framework.FieldData,
+	td *nitro.Nitro,
+) (*nitro.Document, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	l.Debug("parsing nitro attestation document",
+		"attestation_type", "nitro",
+		"domain", td.Name,
+	)
+
+	documentBase64 := data.Get("document").(string)
+	if documentBase64 == "" {
+		return nil, errors.New("`document` field is required")
+	}
+
+	documentBytes, err := base64.StdEncoding.DecodeString(documentBase64)
+	if err != nil {
+		msg := "failed to base64-decode nitro attestation document"
+		l.Error(msg,
+			"attestation_type", "nitro",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	doc, err := nitro.ParseDocument(documentBytes)
+	if err != nil {
+		msg := "failed to cbor-parse nitro attestation document"
+		l.Error(msg,
+			"attestation_type", "nitro",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return doc, nil
+}
+
+func (b *backend) validateNitroDocument(
+	ctx context.Context,
+	td *nitro.Nitro,
+	doc *nitro.Document,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("validating nitro attestation document",
+		"attestation_type", "nitro",
+		"domain", td.Name,
+	)
+
+	if err := doc.Verify(&nitro.VerifyOptions{
+		Now: time.Now(),
+	}); err != nil {
+		msg := "failed to validate nitro attestation document"
+		l.Error(msg,
+			"attestation_type", "nitro",
+			"domain", td.Name,
+			"error", err,
+		)
+		return multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+	}
+
+	return errs
+}
+
+func (b *backend) verifyNitroDocument(
+	ctx context.Context,
+	td *nitro.Nitro,
+	doc *nitro.Document,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("verifying nitro attestation document",
+		"attestation_type", "nitro",
+		"domain", td.Name,
+	)
+
+	reported, ignored := td.MatchesDocument(doc)
+
+	errs = multierror.Append(errs, reported...)
+
+	if len(ignored) > 0 {
+		l.Debug("finished verifying nitro attestation document",
+			"attestation_type", "nitro",
+			"domain", td.Name,
+			"ignored", b.multierror(ignored...),
+		)
+	}
+
+	return errs
+}
@@ -0,0 +1,466 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var (
+	errPendingNotFound   = errors.New("there is no pending change")
+	errPendingNoEntity   = errors.New("change can only be approved by a token that belongs to an entity")
+	errPendingSameEntity = errors.New("change must be approved by another entity than the one that requested it")
+	errPendingStale      = errors.New("domain was changed after the change was requested")
+	errPendingReplaced   = errors.New("pending change was replaced after it was reviewed")
+)
+
+// proposeVerifier saves the updated configuration of the domain (or, when
+// the mount requires approval and the update changes measurements or other
+// pre-auth settings, keeps it as the pending change). It reports whether the
+// change is pending.
+//
+// Token parameters are not subject to approval, their changes are always
+// saved right away.
+func (b *backend) proposeVerifier(
+	ctx context.Context,
+	req *logical.Request,
+	current Verifier,
+	proposed Verifier,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	l := b.Logger()
+
+	cfg, err := b.loadConfig(ctx, req.Storage)
+	if err != nil {
+		msg := "failed to fetch configuration from storage"
+		l.Error(msg,
+			"error", err,
+		)
+		return false, fmt.Errorf("%s: %w", msg, err)
+	}
+	if !cfg.RequireApproval {
+		return false, b.pushVerifier(ctx, req, proposed)
+	}
+
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+
+	domain, err := marshalDomain(proposed)
+	if err != nil {
+		return false, err
+	}
+	var stored json.RawMessage
+	if current != nil {
+		if stored, err = marshalDomain(current); err != nil {
+			return false, err
+		}
+		storedSettings, storedToken, err := splitTokenParams(stored)
+		if err != nil {
+			return false, err
+		}
+		settings, token, err := splitTokenParams(domain)
+		if err != nil {
+			return false, err
+		}
+		if bytes.Equal(storedSettings, settings) && current.GetTOTPSecret() == proposed.GetTOTPSecret() {
+			return false, b.pushVerifier(ctx, req, proposed)
+		}
+		if !bytes.Equal(storedToken, token) {
+			if err := json.Unmarshal(token, current); err != nil {
+				return false, err
+			}
+			if err := b.pushVerifier(ctx, req, current); err != nil {
+				return false, err
+			}
+			if stored, err = marshalDomain(current); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	p := &pendingChange{
+		CreatedAt:   time.Now().UTC(),
+		EntityID:    req.EntityID,
+		DisplayName: req.DisplayName,
+		Path:        req.Path,
+		Current:     stored,
+		Domain:      domain,
+	}
+	if current == nil || current.GetTOTPSecret() != proposed.GetTOTPSecret() {
+		p.SecretChanged = true
+		key := pendingSecretKey(proposed)
+		s, err := b.sealTOTPSecret(ctx, req.Storage, key, proposed.GetTOTPSecret())
+		if err != nil {
+			return false, err
+		}
+		if err := b.saveSecret(ctx, req.Storage, key, s); err != nil {
+			msg := "failed to push pending totp secret into storage"
+			l.Error(msg,
+				"attestation_type", proposed.AttestationType(),
+				"domain", proposed.GetName(),
+				"error", err,
+			)
+			return false, fmt.Errorf("%s: %w", msg, err)
+		}
+	}
+
+	if err := b.savePending(ctx, req.Storage, pendingKey(proposed), p); err != nil {
+		msg := "failed to push pending change into storage"
+		l.Error(msg,
+			"attestation_type", proposed.AttestationType(),
+			"domain", proposed.GetName(),
+			"error", err,
+		)
+		return false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Info("change of domain waits for approval",
+		"attestation_type", proposed.AttestationType(),
+		"domain", proposed.GetName(),
+		"entity_id", req.EntityID,
+	)
+
+	return true, nil
+}
+
+// fetchPending returns the pending change of the domain together with the
+// requested configuration decoded from it.
+func (b *backend) fetchPending(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	name string,
+) (*pendingChange, Verifier, error) {
+	l := b.Logger()
+
+	td := vt.new(b)
+	td.SetName(name)
+
+	p, err := b.loadPending(ctx, req.Storage, pendingKey(td))
+	if err != nil {
+		msg := "failed to fetch pending change from storage"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return nil, nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	if p == nil {
+		return nil, nil, fmt.Errorf("%w: %s/%s", errPendingNotFound, vt.attestationType, name)
+	}
+
+	v := vt.new(b)
+	if err := json.Unmarshal(p.Domain, v); err != nil {
+		msg := "failed to decode pending change"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return nil, nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	v.SetName(name)
+
+	if p.SecretChanged {
+		key := pendingSecretKey(td)
+		s, err := b.loadSecret(ctx, req.Storage, key)
+		if err != nil {
+			msg := "failed to fetch pending totp secret from storage"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", name,
+				"error", err,
+			)
+			return nil, nil, fmt.Errorf("%s: %w", msg, err)
+		}
+		if s != nil {
+			secret, err := b.unsealTOTPSecret(ctx, req.Storage, key, s)
+			if err != nil {
+				return nil, nil, err
+			}
+			v.SetTOTPSecret(secret)
+		}
+	}
+
+	return p, v, nil
+}
+
+// isPendingStale reports whether the domain was changed (or deleted) after
+// the pending change was requested.
+func (b *backend) isPendingStale(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	name string,
+	p *pendingChange,
+) (bool, Verifier, error) {
+	current, err := b.loadVerifier(ctx, req.Storage, vt, name)
+	if err != nil {
+		return false, nil, err
+	}
+	if current == nil {
+		return len(p.Current) != 0, nil, nil
+	}
+	current.SetName(name)
+
+	stored, err := marshalDomain(current)
+	if err != nil {
+		return false, nil, err
+	}
+
+	// the changes that were requested with the older schema versions carry
+	// the domain in its older form
+	if len(p.Current) > 0 {
+		requested := vt.new(b)
+		if err := json.Unmarshal(p.Current, requested); err != nil {
+			return false, nil, err
+		}
+		if p.Current, err = marshalDomain(requested); err != nil {
+			return false, nil, err
+		}
+	}
+
+	// the changes of token parameters do not make the change stale (they
+	// are applied right away)
+	stored, _, err = splitTokenParams(stored)
+	if err != nil {
+		return false, nil, err
+	}
+	requested, _, err := splitTokenParams(p.Current)
+	if err != nil {
+		return false, nil, err
+	}
+
+	return !bytes.Equal(stored, requested), current, nil
+}
+
+// splitTokenParams splits the stored form of the domain into its settings
+// (with the token parameters zeroed) and its token parameters.
+func splitTokenParams(domain []byte) ([]byte, []byte, error) {
+	if len(domain) == 0 {
+		return nil, nil, nil
+	}
+
+	settings := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(domain, &settings); err != nil {
+		return nil, nil, err
+	}
+
+	fields := make(map[string]*framework.FieldSchema)
+	tokenutil.AddTokenFields(fields)
+
+	token := make(map[string]json.RawMessage, len(fields))
+	for key := range fields {
+		if value, ok := settings[key]; ok {
+			token[key] = value
+			delete(settings, key)
+		}
+	}
+
+	rawSettings, err := json.Marshal(settings)
+	if err != nil {
+		return nil, nil, err
+	}
+	rawToken, err := json.Marshal(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rawSettings, rawToken, nil
+}
+
+// approvePending applies the pending change of the domain, provided that it
+// is approved by another entity than the one that requested it, and that it
+// is the change that was reviewed (as identified by its digest).
+func (b *backend) approvePending(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	name string,
+	digest string,
+) (Verifier, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+
+	p, v, err := b.fetchPending(ctx, req, vt, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.EntityID == "" {
+		return nil, errPendingNoEntity
+	}
+	if req.EntityID == p.EntityID {
+		l.Warn("refusing self-approval of pending change",
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"entity_id", req.EntityID,
+		)
+		return nil, errPendingSameEntity
+	}
+	if err := checkPendingDigest(p, digest); err != nil {
+		l.Warn("refusing approval of pending change",
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"entity_id", req.EntityID,
+			"error", err,
+		)
+		return nil, err
+	}
+
+	stale, current, err := b.isPendingStale(ctx, req, vt, name, p)
+	if err != nil {
+		msg := "failed to fetch domain from storage"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	if stale {
+		return nil, errPendingStale
+	}
+
+	if current != nil { // keep the token parameters that apply already
+		stored, err := marshalDomain(current)
+		if err != nil {
+			return nil, err
+		}
+		_, token, err := splitTokenParams(stored)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(token, v); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := b.pushVerifier(ctx, req, v); err != nil {
+		return nil, err
+	}
+
+	if err := b.deletePending(ctx, req.Storage, pendingKey(v)); err != nil {
+		msg := "failed to delete pending change"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Info("approved change of domain",
+		"attestation_type", vt.attestationType,
+		"domain", name,
+		"requested_by", p.EntityID,
+		"approved_by", req.EntityID,
+	)
+
+	return v, nil
+}
+
+// checkPendingDigest verifies that the approval refers to the pending change
+// as it is stored now.
+func checkPendingDigest(p *pendingChange, digest string) error {
+	if digest == "" {
+		return errors.New("`digest` field is required")
+	}
+
+	expected, err := p.digest()
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(digest)) != 1 {
+		return errPendingReplaced
+	}
+
+	return nil
+}
+
+// purgePending removes the pending change of the domain (if any).
+func (b *backend) purgePending(
+	ctx context.Context,
+	req *logical.Request,
+	td TD,
+) error {
+	l := b.Logger()
+
+	if err := b.deletePending(ctx, req.Storage, pendingKey(td)); err != nil {
+		msg := "failed to delete pending change"
+		l.Error(msg,
+			"attestation_type", td.AttestationType(),
+			"domain", td.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil
+}
+
+// pendingChanges returns the difference between the current and requested
+// configurations of the domain (in the form that is shown on read).
+func (b *backend) pendingChanges(
+	ctx context.Context,
+	current Verifier,
+	proposed Verifier,
+) (map[string]interface{}, error) {
+	from := map[string]interface{}{}
+	if current != nil {
+		encoded, err := b.encodeVersion(ctx, current)
+		if err != nil {
+			return nil, err
+		}
+		from = encoded
+	}
+
+	to, err := b.encodeVersion(ctx, proposed)
+	if err != nil {
+		return nil, err
+	}
+
+	return diffVersions(from, to), nil
+}
+
+// pendingResponse is the response to the request that made a pending change.
+func (b *backend) pendingResponse(
+	ctx context.Context,
+	current Verifier,
+	proposed Verifier,
+) (*logical.Response, error) {
+	changes, err := b.pendingChanges(ctx, current, proposed)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &logical.Response{
+		Data: map[string]interface{}{
+			"pending": true,
+			"changes": changes,
+		},
+	}
+	resp.AddWarning(fmt.Sprintf("the change must be approved by another entity at %s/%s/pending",
+		proposed.AttestationType(), proposed.GetName(),
+	))
+
+	return resp, nil
+}
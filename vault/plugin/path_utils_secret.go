@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var (
+	errSecretsKeyNotFound = errors.New("secrets key of the mount is not generated")
+	errSecretTooShort     = errors.New("sealed secret is too short")
+)
+
+// fetchSecretsCipher returns the cipher that the totp secrets are encrypted
+// with. The key is generated (from the entropy source of the mount) on the
+// first use, if generate is set.
+func (b *backend) fetchSecretsCipher(
+	ctx context.Context,
+	storage logical.Storage,
+	generate bool,
+) (cipher.AEAD, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	b.secretsKeyLock.Lock()
+	defer b.secretsKeyLock.Unlock()
+
+	k, err := b.loadSecretsKey(ctx, storage)
+	if err != nil {
+		msg := "failed to fetch secrets key from storage"
+		l.Error(msg,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if k == nil {
+		if !generate {
+			return nil, errSecretsKeyNotFound
+		}
+
+		k = &secretsKey{Key: make([]byte, 32)}
+		if _, err := io.ReadFull(b.Rand(), k.Key); err != nil {
+			return nil, fmt.Errorf("failed to generate secrets key: %w", err)
+		}
+		if err := b.saveSecretsKey(ctx, storage, k); err != nil {
+			msg := "failed to push secrets key into storage"
+			l.Error(msg,
+				"error", err,
+			)
+			return nil, fmt.Errorf("%s: %w", msg, err)
+		}
+
+		l.Info("generated secrets key")
+	}
+
+	block, err := aes.NewCipher(k.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// sealTOTPSecret encrypts the totp secret with the key of the mount. The
+// secret is bound to the storage key it is kept at.
+func (b *backend) sealTOTPSecret(
+	ctx context.Context,
+	storage logical.Storage,
+	key string,
+	secret string,
+) (*sealedSecret, error) {
+	aead, err := b.fetchSecretsCipher(ctx, storage, true)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(b.Rand(), nonce); err != nil {
+		return nil, err
+	}
+
+	return &sealedSecret{
+		Ciphertext: aead.Seal(nonce, nonce, []byte(secret), []byte(key)),
+	}, nil
+}
+
+// unsealTOTPSecret decrypts the totp secret that was sealed for the storage
+// key.
+func (b *backend) unsealTOTPSecret(
+	ctx context.Context,
+	storage logical.Storage,
+	key string,
+	s *sealedSecret,
+) (string, error) {
+	aead, err := b.fetchSecretsCipher(ctx, storage, false)
+	if err != nil {
+		return "", err
+	}
+
+	if len(s.Ciphertext) < aead.NonceSize() {
+		return "", errSecretTooShort
+	}
+	nonce, ciphertext := s.Ciphertext[:aead.NonceSize()], s.Ciphertext[aead.NonceSize():]
+
+	secret, err := aead.Open(nil, nonce, ciphertext, []byte(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt totp secret: %w", err)
+	}
+
+	return string(secret), nil
+}
@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSealTOTPSecret(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	const secret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+	key := totpSecretKey("tdx", "app")
+
+	{ // key of the mount is not generated yet
+		_, err := b.unsealTOTPSecret(ctx, storage, key, &sealedSecret{Ciphertext: make([]byte, 64)})
+		assert.ErrorIs(t, err, errSecretsKeyNotFound)
+	}
+
+	sealed, err := b.sealTOTPSecret(ctx, storage, key, secret)
+	require.NoError(t, err)
+	assert.False(t, bytes.Contains(sealed.Ciphertext, []byte(secret)))
+
+	{ // round-trip
+		unsealed, err := b.unsealTOTPSecret(ctx, storage, key, sealed)
+		require.NoError(t, err)
+		assert.Equal(t, secret, unsealed)
+	}
+
+	{ // sealing is randomised
+		again, err := b.sealTOTPSecret(ctx, storage, key, secret)
+		require.NoError(t, err)
+		assert.NotEqual(t, sealed.Ciphertext, again.Ciphertext)
+	}
+
+	{ // ciphertext is bound to its storage key
+		_, err := b.unsealTOTPSecret(ctx, storage, totpSecretKey("tdx", "other"), sealed)
+		assert.Error(t, err)
+		_, err = b.unsealTOTPSecret(ctx, storage, totpSecretKey("tpm2", "app"), sealed)
+		assert.Error(t, err)
+	}
+
+	{ // tampered or truncated ciphertext
+		tampered := &sealedSecret{Ciphertext: bytes.Clone(sealed.Ciphertext)}
+		tampered.Ciphertext[len(tampered.Ciphertext)-1] ^= 1
+		_, err := b.unsealTOTPSecret(ctx, storage, key, tampered)
+		assert.Error(t, err)
+
+		_, err = b.unsealTOTPSecret(ctx, storage, key, &sealedSecret{Ciphertext: sealed.Ciphertext[:4]})
+		assert.ErrorIs(t, err, errSecretTooShort)
+	}
+}
+
+func TestTOTPSecretMoved(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	for name, secret := range map[string]string{
+		"app":   "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP",
+		"other": "KRSXG5CTMVRXEZLUKRSXG5CTMVRXEZLU",
+	} {
+		res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/"+name, map[string]interface{}{
+			"totp_secret": secret,
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	{ // the domain entry does not carry the secret
+		entry, err := storage.Get(ctx, "tdx/app")
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		assert.NotContains(t, string(entry.Value), "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP")
+	}
+
+	// move the sealed secret of one domain over the one of another
+	entry, err := storage.Get(ctx, totpSecretKey("tdx", "app"))
+	require.NoError(t, err)
+	require.NotNil(t, entry)
+	require.NoError(t, storage.Put(ctx, &logical.StorageEntry{
+		Key:   totpSecretKey("tdx", "other"),
+		Value: entry.Value,
+	}))
+
+	{ // the moved secret does not decrypt
+		_, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "other")
+		assert.Error(t, err)
+	}
+
+	{ // the original one still does
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "app")
+		require.NoError(t, err)
+		assert.Equal(t, "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP", v.GetTOTPSecret())
+	}
+}
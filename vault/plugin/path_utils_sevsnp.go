@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/sevsnp"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+
+	snpabi "github.com/google/go-sev-guest/abi"
+	snppb "github.com/google/go-sev-guest/proto/sevsnp"
+	snptrust "github.com/google/go-sev-guest/verify/trust"
+)
+
+// applySEVSNPFields updates sevsnp policy with the fields provided in the
+// request (or creates a new one, if td is nil).
+func (b *backend) applySEVSNPFields(
+	ctx context.Context,
+	data *framework.FieldData,
+	name string,
+	td *sevsnp.SEVSNP,
+) (*sevsnp.SEVSNP, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	l := b.Logger()
+
+	measurement, measurementOk, errs := types.Byte48FromFieldData(data, "sevsnp_measurement", nil)
+	hostData, hostDataOk, errs := types.Byte32FromFieldData(data, "sevsnp_host_data", errs)
+	idKeyDigest, idKeyDigestOk, errs := types.Byte48FromFieldData(data, "sevsnp_id_key_digest", errs)
+	minTCBBootloader, minTCBBootloaderOk, errs := sevsnpSPLFromFieldData(data, "sevsnp_min_tcb_bootloader", errs)
+	minTCBTEE, minTCBTEEOk, errs := sevsnpSPLFromFieldData(data, "sevsnp_min_tcb_tee", errs)
+	minTCBSNP, minTCBSNPOk, errs := sevsnpSPLFromFieldData(data, "sevsnp_min_tcb_snp", errs)
+	minTCBMicrocode, minTCBMicrocodeOk, errs := sevsnpSPLFromFieldData(data, "sevsnp_min_tcb_microcode", errs)
+
+	askArk, askArkOk := data.GetOk("sevsnp_ask_ark")
+	if askArkOk {
+		if _, err := sevsnp.TrustedRoots(askArk.(string)); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf(
+				"sevsnp_ask_ark is not a valid pem-encoded ask/ark bundle: %w", err,
+			))
+		}
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		msg := "failed to read parameters for sevsnp entry"
+		l.Error(msg,
+			"attestation_type", "sevsnp",
+			"domain", name,
+			"error", err,
+		)
+		return nil, false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if td != nil {
+		l.Debug("updating domain",
+			"attestation_type", "sevsnp",
+			"domain", name,
+		)
+
+		td.Name = name // name is not stored as a field
+
+		if checkDebug, ok := data.GetOk("sevsnp_check_debug"); ok {
+			td.CheckDebug = checkDebug.(bool)
+		}
+		if checkMigrateMA, ok := data.GetOk("sevsnp_check_migrate_ma"); ok {
+			td.CheckMigrateMA = checkMigrateMA.(bool)
+		}
+
+		if measurementOk {
+			td.Measurement = measurement
+		}
+		if hostDataOk {
+			td.HostData = hostData
+		}
+		if idKeyDigestOk {
+			td.IDKeyDigest = idKeyDigest
+		}
+		if minTCBBootloaderOk {
+			td.MinTCBBootloader = minTCBBootloader
+		}
+		if minTCBTEEOk {
+			td.MinTCBTEE = minTCBTEE
+		}
+		if minTCBSNPOk {
+			td.MinTCBSNP = minTCBSNP
+		}
+		if minTCBMicrocodeOk {
+			td.MinTCBMicrocode = minTCBMicrocode
+		}
+		if askArkOk {
+			td.ASKARK = askArk.(string)
+		}
+
+		return td, false, nil
+	}
+
+	l.Debug("creating domain",
+		"attestation_type", "sevsnp",
+		"domain", name,
+	)
+
+	td = &sevsnp.SEVSNP{
+		Name:             name,
+		Measurement:      measurement,
+		HostData:         hostData,
+		IDKeyDigest:      idKeyDigest,
+		CheckDebug:       data.Get("sevsnp_check_debug").(bool),
+		CheckMigrateMA:   data.Get("sevsnp_check_migrate_ma").(bool),
+		MinTCBBootloader: minTCBBootloader,
+		MinTCBTEE:        minTCBTEE,
+		MinTCBSNP:        minTCBSNP,
+		MinTCBMicrocode:  minTCBMicrocode,
+		ASKARK:           data.Get("sevsnp_ask_ark").(string),
+	}
+
+	return td, true, nil
+}
+
+func (b *backend) parseSEVSNPAttestation(
+	ctx context.Context,
+	data *framework.FieldData,
+	td *sevsnp.SEVSNP,
+) (*snppb.Attestation, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	l.Debug("parsing sevsnp attestation report",
+		"attestation_type", "sevsnp",
+		"domain", td.Name,
+	)
+
+	attestationBase64 := data.Get("attestation").(string)
+	if attestationBase64 == "" {
+		return nil, errors.New("`attestation` field is required")
+	}
+
+	attestationBytes, err := base64.StdEncoding.DecodeString(attestationBase64)
+	if err != nil {
+		msg := "failed to base64-decode sevsnp attestation report"
+		l.Error(msg,
+			"attestation_type", "sevsnp",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	attestation, err := snpabi.ReportCertsToProto(attestationBytes)
+	if err != nil {
+		msg := "failed to abi-parse sevsnp attestation report"
+		l.Error(msg,
+			"attestation_type", "sevsnp",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return attestation, nil
+}
+
+func (b *backend) validateSEVSNPAttestation(
+	ctx context.Context,
+	td *sevsnp.SEVSNP,
+	attestation *snppb.Attestation,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("validating sevsnp attestation report",
+		"attestation_type", "sevsnp",
+		"domain", td.Name,
+	)
+
+	if err := td.Verify(attestation, snptrust.DefaultHTTPSGetter(), time.Now()); err != nil {
+		msg := "failed to validate sevsnp attestation report"
+		l.Error(msg,
+			"attestation_type", "sevsnp",
+			"domain", td.Name,
+			"error", err,
+		)
+		return multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+	}
+
+	return errs
+}
+
+func (b *backend) verifySEVSNPAttestation(
+	ctx context.Context,
+	td *sevsnp.SEVSNP,
+	attestation *snppb.Attestation,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("verifying sevsnp attestation report",
+		"attestation_type", "sevsnp",
+		"domain", td.Name,
+	)
+
+	reported, ignored := td.MatchesReport(attestation.Report)
+
+	errs = multierror.Append(errs, reported...)
+
+	if len(ignored) > 0 {
+		l.Debug("finished verifying sevsnp attestation report",
+			"attestation_type", "sevsnp",
+			"domain", td.Name,
+			"ignored", b.multierror(ignored...),
+		)
+	}
+
+	return errs
+}
+
+func sevsnpSPLFromFieldData(
+	data *framework.FieldData,
+	key string,
+	errs *multierror.Error,
+) (uint8, bool, *multierror.Error) {
+	raw, present := data.GetOk(key)
+	if !present {
+		return 0, false, errs
+	}
+
+	spl := raw.(int)
+	if spl < 0 || spl > 255 {
+		return 0, false, multierror.Append(errs, fmt.Errorf(
+			"%s is out of bounds: %d is not within [0, 255]", key, spl,
+		))
+	}
+
+	return uint8(spl), true, errs
+}
@@ -0,0 +1,249 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+
+	tdxtrust "github.com/google/go-tdx-guest/verify/trust"
+)
+
+// applySGXFields updates sgx policy with the fields provided in the request
+// (or creates a new one, if td is nil).
+func (b *backend) applySGXFields(
+	ctx context.Context,
+	data *framework.FieldData,
+	name string,
+	td *sgx.SGX,
+) (*sgx.SGX, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	l := b.Logger()
+
+	mrEnclave, mrEnclaveOk, errs := types.Byte32SliceFromFieldData(data, "sgx_mr_enclave", nil)
+	mrSigner, mrSignerOk, errs := types.Byte32SliceFromFieldData(data, "sgx_mr_signer", errs)
+	isvProdID, isvProdIDOk, errs := sgxIsvProdIDFromFieldData(data, "sgx_isv_prod_id", errs)
+	minIsvSVN, minIsvSVNOk, errs := sgxIsvSVNFromFieldData(data, "sgx_min_isv_svn", errs)
+
+	if err := errs.ErrorOrNil(); err != nil {
+		msg := "failed to read parameters for sgx entry"
+		l.Error(msg,
+			"attestation_type", "sgx",
+			"domain", name,
+			"error", err,
+		)
+		return nil, false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if td != nil {
+		l.Debug("updating domain",
+			"attestation_type", "sgx",
+			"domain", name,
+		)
+
+		td.Name = name // name is not stored as a field
+
+		if checkDebug, ok := data.GetOk("sgx_check_debug"); ok {
+			td.CheckDebug = checkDebug.(bool)
+		}
+
+		if mrEnclaveOk {
+			td.MrEnclave = mrEnclave
+		}
+		if mrSignerOk {
+			td.MrSigner = mrSigner
+		}
+		if isvProdIDOk {
+			td.IsvProdID = isvProdID
+		}
+		if minIsvSVNOk {
+			td.MinIsvSVN = minIsvSVN
+		}
+
+		return td, false, nil
+	}
+
+	l.Debug("creating domain",
+		"attestation_type", "sgx",
+		"domain", name,
+	)
+
+	td = &sgx.SGX{
+		Name:       name,
+		MrEnclave:  mrEnclave,
+		MrSigner:   mrSigner,
+		IsvProdID:  isvProdID,
+		MinIsvSVN:  minIsvSVN,
+		CheckDebug: data.Get("sgx_check_debug").(bool),
+	}
+
+	return td, true, nil
+}
+
+func (b *backend) parseSGXQuote(
+	ctx context.Context,
+	data *framework.FieldData,
+	td *sgx.SGX,
+) (*sgx.Quote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	l.Debug("parsing sgx quote",
+		"attestation_type", "sgx",
+		"domain", td.Name,
+	)
+
+	quoteBase64 := data.Get("quote").(string)
+	if quoteBase64 == "" {
+		return nil, errors.New("`quote` field is required")
+	}
+
+	quoteBytes, err := base64.StdEncoding.DecodeString(quoteBase64)
+	if err != nil {
+		msg := "failed to base64-decode sgx quote"
+		l.Error(msg,
+			"attestation_type", "sgx",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	quote, err := sgx.ParseQuote(quoteBytes)
+	if err != nil {
+		msg := "failed to abi-parse sgx quote"
+		l.Error(msg,
+			"attestation_type", "sgx",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return quote, nil
+}
+
+func (b *backend) validateSGXQuote(
+	ctx context.Context,
+	td *sgx.SGX,
+	quote *sgx.Quote,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("validating sgx quote",
+		"attestation_type", "sgx",
+		"domain", td.Name,
+	)
+
+	if err := sgx.VerifyQuote(quote, &sgx.VerifyOptions{
+		Getter: &tdxtrust.RetryHTTPSGetter{
+			Getter: &tdxtrust.SimpleHTTPSGetter{},
+		},
+		GetCollateral: true,
+		Now:           time.Now(),
+	}); err != nil {
+		msg := "failed to validate sgx quote"
+		l.Error(msg,
+			"attestation_type", "sgx",
+			"domain", td.Name,
+			"error", err,
+		)
+		return multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+	}
+
+	return errs
+}
+
+func (b *backend) verifySGXQuote(
+	ctx context.Context,
+	td *sgx.SGX,
+	quote *sgx.Quote,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("verifying sgx quote",
+		"attestation_type", "sgx",
+		"domain", td.Name,
+	)
+
+	reported, ignored := td.MatchesQuote(quote)
+
+	errs = multierror.Append(errs, reported...)
+
+	if len(ignored) > 0 {
+		l.Debug("finished verifying sgx quote",
+			"attestation_type", "sgx",
+			"domain", td.Name,
+			"ignored", b.multierror(ignored...),
+		)
+	}
+
+	return errs
+}
+
+func sgxIsvProdIDFromFieldData(
+	data *framework.FieldData,
+	key string,
+	errs *multierror.Error,
+) (*uint16, bool, *multierror.Error) {
+	raw, present := data.GetOk(key)
+	if !present {
+		return nil, false, errs
+	}
+
+	isvProdID := raw.(int)
+	if isvProdID < 0 { // negative value disables the check
+		return nil, true, errs
+	}
+	if isvProdID > math.MaxUint16 {
+		return nil, false, multierror.Append(errs, fmt.Errorf(
+			"%s is out of bounds: %d is not within [-1, %d]", key, isvProdID, math.MaxUint16,
+		))
+	}
+
+	res := uint16(isvProdID)
+	return &res, true, errs
+}
+
+func sgxIsvSVNFromFieldData(
+	data *framework.FieldData,
+	key string,
+	errs *multierror.Error,
+) (uint16, bool, *multierror.Error) {
+	raw, present := data.GetOk(key)
+	if !present {
+		return 0, false, errs
+	}
+
+	isvSVN := raw.(int)
+	if isvSVN < 0 || isvSVN > math.MaxUint16 {
+		return 0, false, multierror.Append(errs, fmt.Errorf(
+			"%s is out of bounds: %d is not within [0, %d]", key, isvSVN, math.MaxUint16,
+		))
+	}
+
+	return uint16(isvSVN), true, errs
+}
@@ -2,89 +2,57 @@ package plugin
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"time"
 
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
 	"github.com/flashbots/vault-auth-plugin-attest/tdx"
 	"github.com/flashbots/vault-auth-plugin-attest/types"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
 
-	tdxabi "github.com/google/go-tdx-guest/abi"
 	txdcheck "github.com/google/go-tdx-guest/proto/checkconfig"
-	tdxpb "github.com/google/go-tdx-guest/proto/tdx"
 	tdxverify "github.com/google/go-tdx-guest/verify"
 	tdxtrust "github.com/google/go-tdx-guest/verify/trust"
 )
 
-func (b *backend) fetchTDX(
-	ctx context.Context,
-	req *logical.Request,
-	name string,
-) (*tdx.TDX, error) {
-	l := b.Logger()
-
-	l.Debug("fetching domain from storage",
-		"attestation_type", "tdx",
-		"domain", name,
-	)
-
-	td, err := b.loadTDX(ctx, req.Storage, name)
-	if err != nil {
-		msg := "failed to fetch domain from storage"
-		l.Error(msg,
-			"attestation_type", "tdx",
-			"domain", name,
-			"error", err,
-		)
-		return nil, fmt.Errorf("%s: %w", msg, err)
-	}
-	if td == nil {
-		msg := "domain is not configured"
-		l.Error(msg,
-			"attestation_type", "tdx",
-			"domain", name,
-		)
-		return nil, fmt.Errorf("%s: tdx/%s", msg, name)
-	}
-
-	td.Name = name
-
-	return td, nil
+// tdxFieldsOptions tells which of the optional tdx fields are configurable
+// for the attestation type that embeds tdx policy.
+type tdxFieldsOptions struct {
+	// tlsBinding is set when the quote can be bound to the tls certificate of
+	// the client (azure cvms can not do that).
+	tlsBinding bool
 }
 
-func (b *backend) pushTDX(
+// applyTDXFields updates tdx policy with the fields provided in the request
+// (or creates a new one, if td is nil).
+func (b *backend) applyTDXFields(
 	ctx context.Context,
-	req *logical.Request,
+	attestationType string,
+	data *framework.FieldData,
+	name string,
 	td *tdx.TDX,
-) error {
-	l := b.Logger()
-
-	l.Debug("pushing domain into storage",
-		"attestation_type", "tdx",
-		"domain", td.Name,
-	)
-
-	if err := b.saveTDX(ctx, req.Storage, td); err != nil {
-		msg := "failed to push domain into storage"
-		b.Logger().Error(msg,
-			"attestation_type", "tdx",
-			"domain", td.Name,
-			"error", err,
-		)
-		return fmt.Errorf("%s: %w", msg, err)
-	}
-
-	return nil
+) (*tdx.TDX, bool, error) {
+	return b.applyTDXFieldsWithOptions(ctx, attestationType, data, name, td, tdxFieldsOptions{
+		tlsBinding: true,
+	})
 }
 
-func (b *backend) upsertTDX(
+// applyTDXFieldsWithOptions is applyTDXFields for the attestation types that
+// only configure some of the optional tdx fields.
+func (b *backend) applyTDXFieldsWithOptions(
 	ctx context.Context,
-	req *logical.Request,
+	attestationType string,
 	data *framework.FieldData,
 	name string,
+	td *tdx.TDX,
+	opts tdxFieldsOptions,
 ) (*tdx.TDX, bool, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, false, err
@@ -92,22 +60,6 @@ func (b *backend) upsertTDX(
 
 	l := b.Logger()
 
-	l.Debug("fetching domain from storage",
-		"attestation_type", "tdx",
-		"domain", name,
-	)
-
-	td, err := b.loadTDX(ctx, req.Storage, name)
-	if err != nil {
-		msg := "failed to fetch domain from storage"
-		l.Error(msg,
-			"attestation_type", "tdx",
-			"domain", name,
-			"error", err,
-		)
-		return nil, false, fmt.Errorf("%s: %w", msg, err)
-	}
-
 	mrOwner, mrOwnerOk, errs := types.Byte48FromFieldData(data, "tdx_mr_owner", nil)
 	mrOwnerConfig, mrOwnerConfigOk, errs := types.Byte48FromFieldData(data, "tdx_mr_owner_config", errs)
 	mrConfigID, mrConfigIDOk, errs := types.Byte48FromFieldData(data, "tdx_mr_config_id", errs)
@@ -116,11 +68,13 @@ func (b *backend) upsertTDX(
 	rtmr1, rtmr1Ok, errs := types.Byte48FromFieldData(data, "tdx_rtmr1", errs)
 	rtmr2, rtmr2Ok, errs := types.Byte48FromFieldData(data, "tdx_rtmr2", errs)
 	rtmr3, rtmr3Ok, errs := types.Byte48FromFieldData(data, "tdx_rtmr3", errs)
+	mrServiceTD, mrServiceTDOk, errs := types.Byte48FromFieldData(data, "tdx_mr_service_td", errs)
+	minTeeTcbSvn2, minTeeTcbSvn2Ok, errs := types.Byte16FromFieldData(data, "tdx_min_tee_tcb_svn2", errs)
 
 	if err := errs.ErrorOrNil(); err != nil {
 		msg := "failed to read parameters for tdx entry"
 		l.Error(msg,
-			"attestation_type", "tdx",
+			"attestation_type", attestationType,
 			"domain", name,
 			"error", err,
 		)
@@ -129,21 +83,21 @@ func (b *backend) upsertTDX(
 
 	if td != nil {
 		l.Debug("updating domain",
-			"attestation_type", "tdx",
+			"attestation_type", attestationType,
 			"domain", name,
 		)
 
 		td.Name = name // name is not stored as a field
 
-		if totpSecret, ok := data.GetOk("totp_secret"); ok {
-			td.TOTPSecret = totpSecret.(string)
-		}
 		if checkDebug, ok := data.GetOk("tdx_check_debug"); ok {
 			td.CheckDebug = checkDebug.(bool)
 		}
 		if checkSeptVeDisable, ok := data.GetOk("tdx_check_sept_ve_disable"); ok {
 			td.CheckSeptVeDisable = checkSeptVeDisable.(bool)
 		}
+		if tlsBinding, ok := data.GetOk("tdx_tls_binding"); opts.tlsBinding && ok {
+			td.TLSBinding = tlsBinding.(bool)
+		}
 
 		if mrOwnerOk {
 			td.MrOwner = mrOwner
@@ -169,18 +123,23 @@ func (b *backend) upsertTDX(
 		if rtmr3Ok {
 			td.RTMR3 = rtmr3
 		}
+		if mrServiceTDOk {
+			td.MrServiceTD = mrServiceTD
+		}
+		if minTeeTcbSvn2Ok {
+			td.MinTeeTcbSvn2 = minTeeTcbSvn2
+		}
 
 		return td, false, nil
 	}
 
 	l.Debug("creating domain",
-		"attestation_type", "tdx",
+		"attestation_type", attestationType,
 		"domain", name,
 	)
 
 	td = &tdx.TDX{
 		Name:               name,
-		TOTPSecret:         data.Get("totp_secret").(string),
 		MrOwner:            mrOwner,
 		MrOwnerConfig:      mrOwnerConfig,
 		MrConfigID:         mrConfigID,
@@ -189,8 +148,11 @@ func (b *backend) upsertTDX(
 		RTMR1:              rtmr1,
 		RTMR2:              rtmr2,
 		RTMR3:              rtmr3,
+		MrServiceTD:        mrServiceTD,
+		MinTeeTcbSvn2:      minTeeTcbSvn2,
 		CheckDebug:         data.Get("tdx_check_debug").(bool),
 		CheckSeptVeDisable: data.Get("tdx_check_sept_ve_disable").(bool),
+		TLSBinding:         opts.tlsBinding && data.Get("tdx_tls_binding").(bool),
 	}
 
 	return td, true, nil
@@ -198,9 +160,10 @@ func (b *backend) upsertTDX(
 
 func (b *backend) parseTDXQuote(
 	ctx context.Context,
+	attestationType string,
 	data *framework.FieldData,
 	td *tdx.TDX,
-) (*tdxpb.QuoteV4, error) {
+) (*tdx.Quote, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
@@ -208,7 +171,7 @@ func (b *backend) parseTDXQuote(
 	l := b.Logger()
 
 	l.Debug("parsing tdx quote",
-		"attestation_type", "tdx",
+		"attestation_type", attestationType,
 		"domain", td.Name,
 	)
 
@@ -221,41 +184,111 @@ func (b *backend) parseTDXQuote(
 	if err != nil {
 		msg := "failed to base64-decode tdx quote"
 		l.Error(msg,
-			"attestation_type", "tdx",
+			"attestation_type", attestationType,
 			"domain", td.Name,
 			"error", err,
 		)
 		return nil, fmt.Errorf("%s: %w", msg, err)
 	}
 
-	quote, err := tdxabi.QuoteToProto(quoteBytes)
+	return b.unmarshalTDXQuote(ctx, attestationType, td, quoteBytes)
+}
+
+func (b *backend) parseTDXRATLSQuote(
+	ctx context.Context,
+	attestationType string,
+	req *logical.Request,
+	td *tdx.TDX,
+) (*tdx.Quote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	l.Debug("parsing tdx quote from ra-tls certificate",
+		"attestation_type", attestationType,
+		"domain", td.Name,
+	)
+
+	if req.Connection == nil ||
+		req.Connection.ConnState == nil ||
+		len(req.Connection.ConnState.PeerCertificates) == 0 {
+		msg := "ra-tls client certificate is required"
+		l.Error(msg,
+			"attestation_type", attestationType,
+			"domain", td.Name,
+		)
+		return nil, errors.New(msg)
+	}
+
+	cert := req.Connection.ConnState.PeerCertificates[0]
+
+	quoteBytes, err := tdx.QuoteFromRATLSCertificate(cert, time.Now())
 	if err != nil {
-		msg := "failed to abi-parse tdx quote"
+		msg := "failed to extract tdx quote from ra-tls certificate"
 		l.Error(msg,
-			"attestation_type", "tdx",
+			"attestation_type", attestationType,
 			"domain", td.Name,
 			"error", err,
 		)
 		return nil, fmt.Errorf("%s: %w", msg, err)
 	}
 
-	quoteV4 := quote.(*tdxpb.QuoteV4)
-	if quoteV4 == nil {
-		msg := "unknown tdx quote format"
+	quote, err := b.unmarshalTDXQuote(ctx, attestationType, td, quoteBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if !tdx.RATLSBindsKey(quote.Body.ReportData, cert.RawSubjectPublicKeyInfo) {
+		msg := "tdx quote does not bind ra-tls certificate key"
 		l.Error(msg,
-			"attestation_type", "tdx",
+			"attestation_type", attestationType,
 			"domain", td.Name,
 		)
 		return nil, errors.New(msg)
 	}
 
-	return quoteV4, nil
+	return quote, nil
+}
+
+func (b *backend) unmarshalTDXQuote(
+	ctx context.Context,
+	attestationType string,
+	td *tdx.TDX,
+	quoteBytes []byte,
+) (*tdx.Quote, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	quote, err := tdx.ParseQuote(quoteBytes)
+	if err != nil {
+		msg := "failed to parse tdx quote"
+		l.Error(msg,
+			"attestation_type", attestationType,
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Debug("parsed tdx quote",
+		"attestation_type", attestationType,
+		"domain", td.Name,
+		"version", quote.Version,
+	)
+
+	return quote, nil
 }
 
 func (b *backend) validateTDXQuote(
 	ctx context.Context,
+	attestationType string,
 	td *tdx.TDX,
-	quote *tdxpb.QuoteV4,
+	quote *tdx.Quote,
 	errs *multierror.Error,
 ) *multierror.Error {
 	if err := ctx.Err(); err != nil {
@@ -265,7 +298,7 @@ func (b *backend) validateTDXQuote(
 	l := b.Logger()
 
 	l.Debug("validating tdx quote",
-		"attestation_type", "tdx",
+		"attestation_type", attestationType,
 		"domain", td.Name,
 	)
 
@@ -275,7 +308,7 @@ func (b *backend) validateTDXQuote(
 	if err != nil {
 		msg := "failed to validate tdx quote"
 		l.Error(msg,
-			"attestation_type", "tdx",
+			"attestation_type", attestationType,
 			"domain", td.Name,
 			"error", err,
 		)
@@ -285,10 +318,13 @@ func (b *backend) validateTDXQuote(
 	sopts.Getter = &tdxtrust.RetryHTTPSGetter{
 		Getter: &tdxtrust.SimpleHTTPSGetter{},
 	}
-	if err := tdxverify.TdxQuote(quote, sopts); err != nil {
+	if b.tdxRoots != nil {
+		sopts.TrustedRoots = b.tdxRoots
+	}
+	if err := quote.Verify(sopts); err != nil {
 		msg := "failed to validate tdx quote"
 		l.Error(msg,
-			"attestation_type", "tdx",
+			"attestation_type", attestationType,
 			"domain", td.Name,
 			"error", err,
 		)
@@ -298,10 +334,75 @@ func (b *backend) validateTDXQuote(
 	return errs
 }
 
+// claimTDXTCBStatus fetches tdx tcb info collateral and sets the tcb status
+// claim of the quote (only if the policy refers to it, since it takes the
+// round-trip to intel pcs).
+func (b *backend) claimTDXTCBStatus(
+	ctx context.Context,
+	key string,
+	p *policy.Policy,
+	v Verifier,
+	evidence interface{},
+	claims *policy.Claims,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	qv, ok := v.(tdxQuoteVerifier)
+	if !ok || claims.TDX == nil {
+		return nil
+	}
+	quote := qv.TDXQuote(evidence)
+	if quote == nil {
+		return nil
+	}
+
+	selects, err := b.policies.SelectsTDXTCBStatus(key, p)
+	if err != nil || !selects { // invalid policy is reported by its evaluation
+		return nil
+	}
+
+	l := b.Logger()
+
+	getter := b.pcsGetter
+	if getter == nil {
+		getter = &tdxtrust.RetryHTTPSGetter{
+			Getter: &tdxtrust.SimpleHTTPSGetter{},
+		}
+	}
+
+	status, err := quote.TCBStatus(&sgx.VerifyOptions{
+		Getter:       getter,
+		Now:          time.Now(),
+		TrustedRoots: b.tdxRoots,
+	})
+	if err != nil {
+		msg := "failed to fetch tdx tcb status"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Debug("fetched tdx tcb status",
+		"attestation_type", v.AttestationType(),
+		"domain", v.GetName(),
+		"tcb_status", status,
+	)
+
+	claims.TDX.TCBStatus = status
+
+	return nil
+}
+
 func (b *backend) verifyTDXQuote(
 	ctx context.Context,
+	attestationType string,
 	td *tdx.TDX,
-	quote *tdxpb.QuoteV4,
+	quote *tdx.Quote,
 	errs *multierror.Error,
 ) *multierror.Error {
 	if err := ctx.Err(); err != nil {
@@ -311,17 +412,17 @@ func (b *backend) verifyTDXQuote(
 	l := b.Logger()
 
 	l.Debug("verifying tdx quote",
-		"attestation_type", "tdx",
+		"attestation_type", attestationType,
 		"domain", td.Name,
 	)
 
-	reported, ignored := td.MatchesQuoteV4(quote)
+	reported, ignored := td.MatchesQuote(quote)
 
 	errs = multierror.Append(errs, reported...)
 
 	if len(ignored) > 0 {
 		l.Debug("finished verifying tdx quote",
-			"attestation_type", "tdx",
+			"attestation_type", attestationType,
 			"domain", td.Name,
 			"ignored", b.multierror(ignored...),
 		)
@@ -330,9 +431,159 @@ func (b *backend) verifyTDXQuote(
 	return errs
 }
 
-func (b *backend) loginTDX(
+func (b *backend) validateTDXReportData(
+	ctx context.Context,
+	attestationType string,
+	data *framework.FieldData,
+	td *tdx.TDX,
+	quote *tdx.Quote,
+	values ...[]byte,
+) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+
+	l := b.Logger()
+
+	if len(values) == 0 { // report data is the nonce itself
+		return base64.StdEncoding.EncodeToString(quote.Body.ReportData), nil
+	}
+
+	l.Debug("validating tdx report data",
+		"attestation_type", attestationType,
+		"domain", td.Name,
+	)
+
+	nonce, err := b.getNonce(ctx, data)
+	if err != nil {
+		return "", err
+	}
+
+	_nonce, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		msg := "failed to base64-decode tdx nonce"
+		l.Error(msg,
+			"attestation_type", attestationType,
+			"domain", td.Name,
+			"error", err,
+		)
+		return "", fmt.Errorf("%s: %w", msg, err)
+	}
+
+	expected := tdx.ReportData(_nonce, values...)
+	if subtle.ConstantTimeCompare(expected[:], quote.Body.ReportData) != 1 {
+		msg := "unexpected tdx report data"
+		l.Error(msg,
+			"attestation_type", attestationType,
+			"domain", td.Name,
+		)
+		return "", errors.New(msg)
+	}
+
+	return nonce, nil
+}
+
+func (b *backend) getTDXTLSBinding(
+	ctx context.Context,
+	attestationType string,
+	req *logical.Request,
+	td *tdx.TDX,
+) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if !td.TLSBinding {
+		return nil, nil
+	}
+
+	l := b.Logger()
+
+	if req.Connection == nil ||
+		req.Connection.ConnState == nil ||
+		len(req.Connection.ConnState.PeerCertificates) == 0 {
+		msg := "tls client certificate is required"
+		l.Error(msg,
+			"attestation_type", attestationType,
+			"domain", td.Name,
+		)
+		return nil, errors.New(msg)
+	}
+
+	return req.Connection.ConnState.PeerCertificates[0].RawSubjectPublicKeyInfo, nil
+}
+
+func (b *backend) getTDXInstancePublicKey(
+	ctx context.Context,
+	data *framework.FieldData,
+) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	publicKeyBase64 := data.Get("public_key").(string)
+	if publicKeyBase64 == "" {
+		return nil, errors.New("`public_key` field is required")
+	}
+
+	publicKey, err := base64.StdEncoding.DecodeString(publicKeyBase64)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode instance public key: %w", err)
+	}
+
+	return publicKey, nil
+}
+
+func (b *backend) enrollTDXInstance(
 	ctx context.Context,
+	data *framework.FieldData,
 	td *tdx.TDX,
+) (*tdx.Instance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	if !td.InstanceEnrollment {
+		msg := "instance enrollment is disabled"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", td.Name,
+		)
+		return nil, errors.New(msg)
+	}
+
+	publicKey, err := b.getTDXInstancePublicKey(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := tdx.NewInstance(publicKey)
+	if err != nil {
+		msg := "failed to enroll instance"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Debug("enrolling instance",
+		"attestation_type", "tdx",
+		"domain", td.Name,
+		"instance", instance.ID,
+	)
+
+	return instance, nil
+}
+
+func (b *backend) registerTDXInstance(
+	ctx context.Context,
+	req *logical.Request,
+	td *tdx.TDX,
+	instance *tdx.Instance,
 	errs *multierror.Error,
 ) (*logical.Response, error) {
 	if err := ctx.Err(); err != nil {
@@ -342,22 +593,245 @@ func (b *backend) loginTDX(
 	l := b.Logger()
 
 	if err := errs.ErrorOrNil(); err != nil {
-		msg := "failed to login trusted domain"
+		msg := "failed to enroll instance"
 		l.Error(msg,
 			"attestation_type", "tdx",
 			"domain", td.Name,
+			"instance", instance.ID,
 			"error", err,
 		)
 		return nil, fmt.Errorf("%s: %w", msg, err)
 	}
 
-	auth := &logical.Auth{
-		Metadata: map[string]string{"tdx": td.Name},
-		Alias:    &logical.Alias{Name: "tdx/" + td.Name},
+	if err := b.pushTDXInstance(ctx, req, td.Name, instance); err != nil {
+		return nil, err
 	}
-	td.PopulateTokenAuth(auth)
 
 	return &logical.Response{
-		Auth: auth,
+		Data: map[string]interface{}{
+			"instance_id": instance.ID,
+		},
 	}, nil
 }
+
+func (b *backend) authenticateTDXInstance(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+	td *tdx.TDX,
+) (*tdx.Instance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	if !td.InstanceEnrollment {
+		msg := "instance enrollment is disabled"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", td.Name,
+		)
+		return nil, errors.New(msg)
+	}
+
+	publicKey, err := b.getTDXInstancePublicKey(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := b.fetchTDXInstance(ctx, req, td.Name, tdx.InstanceID(publicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	l.Debug("authenticating instance",
+		"attestation_type", "tdx",
+		"domain", td.Name,
+		"instance", instance.ID,
+	)
+
+	nonce, err := b.getNonce(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	_nonce, err := base64.StdEncoding.DecodeString(nonce)
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode tdx nonce: %w", err)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(data.Get("signature").(string))
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode instance signature: %w", err)
+	}
+
+	if err := instance.VerifySignature(_nonce, signature); err != nil {
+		msg := "failed to authenticate instance"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", td.Name,
+			"instance", instance.ID,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return instance, nil
+}
+
+func (b *backend) authenticateTDXNonceRequest(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+	td *tdx.TDX,
+) (*tdx.Instance, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	if !td.InstanceEnrollment {
+		msg := "instance enrollment is disabled"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", td.Name,
+		)
+		return nil, errors.New(msg)
+	}
+
+	publicKey, err := b.getTDXInstancePublicKey(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+
+	instance, err := b.fetchTDXInstance(ctx, req, td.Name, tdx.InstanceID(publicKey))
+	if err != nil {
+		return nil, err
+	}
+
+	l.Debug("authenticating nonce request of instance",
+		"attestation_type", "tdx",
+		"domain", td.Name,
+		"instance", instance.ID,
+	)
+
+	timestamp := int64(data.Get("timestamp").(int))
+	if skew := time.Since(time.Unix(timestamp, 0)).Abs(); skew > globals.InstanceNonceRequestSkew {
+		msg := "instance nonce request is stale"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", td.Name,
+			"instance", instance.ID,
+			"skew", skew,
+		)
+		return nil, errors.New(msg)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(data.Get("signature").(string))
+	if err != nil {
+		return nil, fmt.Errorf("failed to base64-decode instance signature: %w", err)
+	}
+
+	if err := instance.VerifySignature(tdx.NonceRequestMessage(timestamp), signature); err != nil {
+		msg := "failed to authenticate instance"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", td.Name,
+			"instance", instance.ID,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return instance, nil
+}
+
+func (b *backend) fetchTDXInstance(
+	ctx context.Context,
+	req *logical.Request,
+	name string,
+	id string,
+) (*tdx.Instance, error) {
+	l := b.Logger()
+
+	instance, err := b.loadTDXInstance(ctx, req.Storage, name, id)
+	if err != nil {
+		msg := "failed to fetch instance from storage"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", name,
+			"instance", id,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	if instance == nil {
+		msg := "instance is not enrolled"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", name,
+			"instance", id,
+		)
+		return nil, fmt.Errorf("%s: tdx/%s/instance/%s", msg, name, id)
+	}
+
+	return instance, nil
+}
+
+func (b *backend) pushTDXInstance(
+	ctx context.Context,
+	req *logical.Request,
+	name string,
+	instance *tdx.Instance,
+) error {
+	l := b.Logger()
+
+	l.Debug("pushing instance into storage",
+		"attestation_type", "tdx",
+		"domain", name,
+		"instance", instance.ID,
+	)
+
+	if err := b.saveTDXInstance(ctx, req.Storage, name, instance); err != nil {
+		msg := "failed to push instance into storage"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", name,
+			"instance", instance.ID,
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil
+}
+
+func (b *backend) purgeTDXInstances(
+	ctx context.Context,
+	req *logical.Request,
+	name string,
+) error {
+	l := b.Logger()
+
+	ids, err := b.listTDXInstances(ctx, req.Storage, name)
+	if err == nil {
+		for _, id := range ids {
+			if err = b.deleteTDXInstance(ctx, req.Storage, name, id); err != nil {
+				break
+			}
+		}
+	}
+	if err != nil {
+		msg := "failed to delete domain instances"
+		l.Error(msg,
+			"attestation_type", "tdx",
+			"domain", name,
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil
+}
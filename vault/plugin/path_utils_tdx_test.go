@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tdxpb "github.com/google/go-tdx-guest/proto/tdx"
+)
+
+// newTestCertificate returns self-signed tls client certificate.
+func newTestCertificate(t *testing.T, cn string) *x509.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	return cert
+}
+
+func TestTDXTLSBinding(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBackend(t)
+
+	cert := newTestCertificate(t, "td")
+	withCert := &logical.Request{Connection: &logical.Connection{
+		ConnState: &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}},
+	}}
+
+	{ // binding is not configured
+		binding, err := b.getTDXTLSBinding(ctx, "tdx", withCert, &tdx.TDX{Name: "test"})
+		assert.NoError(t, err)
+		assert.Nil(t, binding)
+	}
+
+	td := &tdx.TDX{Name: "test", TLSBinding: true}
+
+	{ // client certificate is required
+		for _, req := range []*logical.Request{
+			{},
+			{Connection: &logical.Connection{}},
+			{Connection: &logical.Connection{ConnState: &tls.ConnectionState{}}},
+		} {
+			_, err := b.getTDXTLSBinding(ctx, "tdx", req, td)
+			assert.Error(t, err)
+		}
+	}
+
+	{ // public key of the client certificate
+		binding, err := b.getTDXTLSBinding(ctx, "tdx", withCert, td)
+		assert.NoError(t, err)
+		assert.Equal(t, cert.RawSubjectPublicKeyInfo, binding)
+	}
+}
+
+func TestValidateTDXReportDataTLSBinding(t *testing.T) {
+	ctx := context.Background()
+	b, _ := newTestBackend(t)
+
+	td := &tdx.TDX{Name: "test", TLSBinding: true}
+	nonce := make([]byte, 32)
+	_, err := rand.Read(nonce)
+	require.NoError(t, err)
+
+	data := &framework.FieldData{
+		Raw:    map[string]interface{}{"nonce": base64.StdEncoding.EncodeToString(nonce)},
+		Schema: map[string]*framework.FieldSchema{"nonce": {Type: framework.TypeString}},
+	}
+
+	bound := newTestCertificate(t, "td").RawSubjectPublicKeyInfo
+	other := newTestCertificate(t, "relay").RawSubjectPublicKeyInfo
+
+	reportData := tdx.ReportData(nonce, bound)
+	quote := &tdx.Quote{Body: &tdxpb.TDQuoteBody{ReportData: reportData[:]}}
+
+	{ // quote is bound to the certificate of the client
+		res, err := b.validateTDXReportData(ctx, "tdx", data, td, quote, bound)
+		assert.NoError(t, err)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(nonce), res)
+	}
+
+	{ // quote is relayed through another connection
+		_, err := b.validateTDXReportData(ctx, "tdx", data, td, quote, other)
+		assert.Error(t, err)
+	}
+
+	{ // quote is not bound at all
+		_, err := b.validateTDXReportData(ctx, "tdx", data, td, quote)
+		assert.NoError(t, err) // report data is just returned as nonce
+
+		plain := tdx.ReportData(nonce)
+		quote := &tdx.Quote{Body: &tdxpb.TDQuoteBody{ReportData: plain[:]}}
+		_, err = b.validateTDXReportData(ctx, "tdx", data, td, quote, bound)
+		assert.Error(t, err)
+	}
+}
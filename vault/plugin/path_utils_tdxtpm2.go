@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdxtpm2"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/go-multierror"
+)
+
+func (b *backend) encodeTDXTPM2(
+	ctx context.Context,
+	td *tdxtpm2.TDXTPM2,
+) (map[string]interface{}, error) {
+	res := make(map[string]interface{})
+
+	for _, policy := range []TD{td.TDX, td.TPM2} {
+		_data, err := b.encodeTD(ctx, policy)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range _data {
+			res[k] = v
+		}
+	}
+	delete(res, "instance_enrollment") // not supported by composite domains
+
+	encodeTPM2PCRs(td.TPM2, res)
+
+	_data, err := b.encodeTD(ctx, td) // totp secret and token params
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range _data {
+		res[k] = v
+	}
+
+	return res, nil
+}
+
+func (b *backend) verifyTDXTPM2(
+	ctx context.Context,
+	td *tdxtpm2.TDXTPM2,
+	quote *tdx.Quote,
+	attestation *attest.PlatformParameters,
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	l.Debug("verifying tdx quote and tpm2 attestation",
+		"attestation_type", "tdxtpm2",
+		"domain", td.Name,
+	)
+
+	reported, ignored := td.Matches(quote, attestation)
+
+	errs = multierror.Append(errs, reported...)
+
+	if len(ignored) > 0 {
+		l.Debug("finished verifying tdx quote and tpm2 attestation",
+			"attestation_type", "tdxtpm2",
+			"domain", td.Name,
+			"ignored", b.multierror(ignored...),
+		)
+	}
+
+	return errs
+}
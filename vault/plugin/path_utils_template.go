@@ -0,0 +1,481 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var (
+	errTemplateNotFound  = errors.New("template is not configured")
+	errTemplateWrongType = errors.New("template is configured for another attestation type")
+	errTemplateInUse     = errors.New("template is referenced by domains")
+)
+
+const (
+	sourceDomain   = "domain"
+	sourceTemplate = "template/"
+)
+
+// applyTemplate updates the template that the verifier references with the
+// field provided in the request (empty value removes it), and keeps track of
+// the fields that the domain overrides.
+//
+// Only the fields that are set while the domain references a template are
+// considered to be overridden, the rest are inherited from the template.
+func (b *backend) applyTemplate(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+	vt *verifierType,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	c := v.common()
+
+	if name, ok := data.GetOk("template"); ok {
+		name := strings.TrimSpace(name.(string))
+		if name != "" {
+			t, err := b.fetchTemplate(ctx, req, name)
+			if err != nil {
+				return err
+			}
+			if t.AttestationType != vt.attestationType {
+				err := fmt.Errorf("%w: %s", errTemplateWrongType, t.AttestationType)
+				l.Error("failed to reference template",
+					"attestation_type", vt.attestationType,
+					"domain", v.GetName(),
+					"template", name,
+					"error", err,
+				)
+				return err
+			}
+		}
+		c.Template = name
+	}
+
+	if c.Template == "" {
+		c.Overrides = nil
+		return nil
+	}
+
+	fields := v.Fields()
+	keys := make([]string, 0, len(data.Raw))
+	for key := range data.Raw {
+		if _, ok := fields[key]; ok {
+			keys = append(keys, key)
+		}
+	}
+	overrideFields(c, keys)
+
+	if inherit, ok := data.GetOk("inherit"); ok {
+		c.Overrides = slices.DeleteFunc(c.Overrides, func(key string) bool {
+			return slices.Contains(inherit.([]string), key)
+		})
+	}
+	if len(c.Overrides) == 0 {
+		c.Overrides = nil
+	}
+
+	return nil
+}
+
+// overrideFields marks the fields as overridden by the domain (if it
+// references a template).
+func overrideFields(c *verifierCommon, keys []string) {
+	if c.Template == "" {
+		return
+	}
+
+	for _, key := range keys {
+		if !slices.Contains(c.Overrides, key) {
+			c.Overrides = append(c.Overrides, key)
+		}
+	}
+	sort.Strings(c.Overrides)
+}
+
+// resolveVerifier returns the copy of the verifier with the values inherited
+// from its template, together with the source of every field.
+func (b *backend) resolveVerifier(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	v Verifier,
+) (Verifier, map[string]string, error) {
+	sources := make(map[string]string)
+	for key := range v.Fields() {
+		sources[key] = sourceDomain
+	}
+
+	name := v.common().Template
+	if name == "" {
+		return v, sources, nil
+	}
+
+	l := b.Logger()
+
+	t, err := b.fetchTemplate(ctx, req, name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := make(map[string]interface{}, len(t.Values))
+	for key, value := range t.Values {
+		if !slices.Contains(v.common().Overrides, key) {
+			values[key] = value
+			sources[key] = sourceTemplate + name
+		}
+	}
+
+	resolved, err := b.applyValues(ctx, vt, v, values)
+	if err != nil {
+		msg := "failed to apply template"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", v.GetName(),
+			"template", name,
+			"error", err,
+		)
+		return nil, nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return resolved, sources, nil
+}
+
+// fetchResolvedVerifier returns the verifier with the values inherited from
+// its template.
+func (b *backend) fetchResolvedVerifier(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	name string,
+) (Verifier, error) {
+	v, err := b.fetchVerifier(ctx, req, vt, name)
+	if err != nil {
+		return nil, err
+	}
+
+	resolved, _, err := b.resolveVerifier(ctx, req, vt, v)
+	if err != nil {
+		return nil, err
+	}
+
+	return resolved, nil
+}
+
+// encodeResolved returns the resolved values of the domain (in the form that
+// is shown on read) together with the source of every value.
+func (b *backend) encodeResolved(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	v Verifier,
+) (map[string]interface{}, error) {
+	resolved, sources, err := b.resolveVerifier(ctx, req, vt, v)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := resolved.Encode(ctx)
+	if err != nil {
+		return nil, err
+	}
+	encodeCommon(resolved, res)
+
+	_sources := make(map[string]string)
+	for key := range res {
+		if source, ok := sources[key]; ok {
+			_sources[key] = source
+		}
+	}
+	res["sources"] = _sources
+
+	return res, nil
+}
+
+func (b *backend) fetchTemplate(
+	ctx context.Context,
+	req *logical.Request,
+	name string,
+) (*domainTemplate, error) {
+	l := b.Logger()
+
+	t, err := b.loadTemplate(ctx, req.Storage, name)
+	if err != nil {
+		msg := "failed to fetch template from storage"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	if t == nil {
+		return nil, fmt.Errorf("%w: %s", errTemplateNotFound, name)
+	}
+
+	return t, nil
+}
+
+// validateTemplate makes sure that the values of the template can be applied
+// to the domains of its attestation type.
+func (b *backend) validateTemplate(
+	ctx context.Context,
+	vt *verifierType,
+	name string,
+	t *domainTemplate,
+) error {
+	v := vt.new(b)
+	v.SetName(name)
+
+	_, err := b.applyValues(ctx, vt, v, t.Values)
+
+	return err
+}
+
+// templateDependents returns the names of the domains that reference the
+// template.
+func (b *backend) templateDependents(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	name string,
+) ([]string, error) {
+	names, err := b.listVerifiers(ctx, req.Storage, vt)
+	if err != nil {
+		return nil, err
+	}
+
+	dependents := make([]string, 0)
+	for _, domain := range names {
+		v, err := b.loadVerifier(ctx, req.Storage, vt, domain)
+		if err != nil {
+			return nil, err
+		}
+		if v != nil && v.common().Template == name {
+			dependents = append(dependents, domain)
+		}
+	}
+
+	return dependents, nil
+}
+
+// proposeTemplate saves the template (or, when the mount requires approval
+// and the template changes, keeps it as the pending change). It reports
+// whether the change is pending.
+func (b *backend) proposeTemplate(
+	ctx context.Context,
+	req *logical.Request,
+	name string,
+	current *domainTemplate,
+	proposed *domainTemplate,
+) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	l := b.Logger()
+
+	cfg, err := b.loadConfig(ctx, req.Storage)
+	if err != nil {
+		msg := "failed to fetch configuration from storage"
+		l.Error(msg,
+			"error", err,
+		)
+		return false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	domain, err := json.Marshal(proposed)
+	if err != nil {
+		return false, err
+	}
+	var stored json.RawMessage
+	if current != nil {
+		if stored, err = json.Marshal(current); err != nil {
+			return false, err
+		}
+	}
+
+	if !cfg.RequireApproval || bytes.Equal(stored, domain) {
+		if err := b.saveTemplate(ctx, req.Storage, name, proposed); err != nil {
+			msg := "failed to push template into storage"
+			l.Error(msg,
+				"template", name,
+				"error", err,
+			)
+			return false, fmt.Errorf("%s: %w", msg, err)
+		}
+		return false, nil
+	}
+
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+
+	if err := b.savePending(ctx, req.Storage, templatePendingKey(name), &pendingChange{
+		CreatedAt:   time.Now().UTC(),
+		EntityID:    req.EntityID,
+		DisplayName: req.DisplayName,
+		Path:        req.Path,
+		Current:     stored,
+		Domain:      domain,
+	}); err != nil {
+		msg := "failed to push pending change into storage"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Info("change of template waits for approval",
+		"template", name,
+		"entity_id", req.EntityID,
+	)
+
+	return true, nil
+}
+
+// fetchPendingTemplate returns the pending change of the template together
+// with the requested template decoded from it, and reports whether the
+// template was changed after the change was requested.
+func (b *backend) fetchPendingTemplate(
+	ctx context.Context,
+	req *logical.Request,
+	name string,
+) (*pendingChange, *domainTemplate, bool, error) {
+	l := b.Logger()
+
+	p, err := b.loadPending(ctx, req.Storage, templatePendingKey(name))
+	if err != nil {
+		msg := "failed to fetch pending change from storage"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return nil, nil, false, fmt.Errorf("%s: %w", msg, err)
+	}
+	if p == nil {
+		return nil, nil, false, fmt.Errorf("%w: template/%s", errPendingNotFound, name)
+	}
+
+	t := &domainTemplate{}
+	if err := json.Unmarshal(p.Domain, t); err != nil {
+		msg := "failed to decode pending change"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return nil, nil, false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	current, err := b.loadTemplate(ctx, req.Storage, name)
+	if err != nil {
+		msg := "failed to fetch template from storage"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return nil, nil, false, fmt.Errorf("%s: %w", msg, err)
+	}
+	var stored []byte
+	if current != nil {
+		if stored, err = json.Marshal(current); err != nil {
+			return nil, nil, false, err
+		}
+	}
+
+	return p, t, !bytes.Equal(stored, p.Current), nil
+}
+
+// approveTemplate applies the pending change of the template, provided that
+// it is approved by another entity than the one that requested it, and that
+// it is the change that was reviewed (as identified by its digest).
+func (b *backend) approveTemplate(
+	ctx context.Context,
+	req *logical.Request,
+	name string,
+	digest string,
+) (*domainTemplate, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	b.pendingLock.Lock()
+	defer b.pendingLock.Unlock()
+
+	p, t, stale, err := b.fetchPendingTemplate(ctx, req, name)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.EntityID == "" {
+		return nil, errPendingNoEntity
+	}
+	if req.EntityID == p.EntityID {
+		l.Warn("refusing self-approval of pending change",
+			"template", name,
+			"entity_id", req.EntityID,
+		)
+		return nil, errPendingSameEntity
+	}
+	if err := checkPendingDigest(p, digest); err != nil {
+		l.Warn("refusing approval of pending change",
+			"template", name,
+			"entity_id", req.EntityID,
+			"error", err,
+		)
+		return nil, err
+	}
+	if stale {
+		return nil, errPendingStale
+	}
+
+	if err := b.saveTemplate(ctx, req.Storage, name, t); err != nil {
+		msg := "failed to push template into storage"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if err := b.deletePending(ctx, req.Storage, templatePendingKey(name)); err != nil {
+		msg := "failed to delete pending change"
+		l.Error(msg,
+			"template", name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Info("approved change of template",
+		"template", name,
+		"requested_by", p.EntityID,
+		"approved_by", req.EntityID,
+	)
+
+	return t, nil
+}
+
+func encodeTemplate(t *domainTemplate) map[string]interface{} {
+	return map[string]interface{}{
+		"attestation_type": t.AttestationType,
+		"values":           t.Values,
+	}
+}
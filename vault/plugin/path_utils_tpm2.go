@@ -3,6 +3,7 @@ package plugin
 import (
 	"context"
 	"crypto/subtle"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -13,75 +14,37 @@ import (
 	"github.com/google/go-attestation/attest"
 	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/vault/sdk/framework"
-	"github.com/hashicorp/vault/sdk/logical"
 )
 
-func (b *backend) fetchTPM2(
-	ctx context.Context,
-	req *logical.Request,
-	name string,
-) (*tpm2.TPM2, error) {
-	l := b.Logger()
-
-	l.Debug("fetching domain from storage",
-		"attestation_type", "tpm2",
-		"domain", name,
-	)
-
-	td, err := b.loadTPM2(ctx, req.Storage, name)
-	if err != nil {
-		msg := "failed to fetch domain from storage"
-		l.Error(msg,
-			"attestation_type", "tpm2",
-			"domain", name,
-			"error", err,
-		)
-		return nil, fmt.Errorf("%s: %w", msg, err)
-	}
-	if td == nil {
-		msg := "domain is not configured"
-		l.Error(msg,
-			"attestation_type", "tpm2",
-			"domain", name,
-		)
-		return nil, fmt.Errorf("%s: tpm2/%s", msg, name)
-	}
-
-	td.Name = name
-
-	return td, nil
+// tpm2FieldsOptions tells which of the optional tpm2 fields are configurable
+// for the attestation type that embeds tpm2 policy.
+type tpm2FieldsOptions struct {
+	// akPublic is set when the attestation key is configured with the domain
+	// (azure cvms take it from hcl report instead).
+	akPublic bool
 }
 
-func (b *backend) pushTPM2(
+// applyTPM2Fields updates tpm2 policy with the fields provided in the request
+// (or creates a new one, if td is nil).
+func (b *backend) applyTPM2Fields(
 	ctx context.Context,
-	req *logical.Request,
+	data *framework.FieldData,
+	name string,
 	td *tpm2.TPM2,
-) error {
-	l := b.Logger()
-
-	l.Debug("pushing domain into storage",
-		"attestation_type", "tpm2",
-		"domain", td.Name,
-	)
-
-	if err := b.saveTPM2(ctx, req.Storage, td); err != nil {
-		msg := "failed to push domain into storage"
-		b.Logger().Error(msg,
-			"attestation_type", "tdx",
-			"domain", td.Name,
-			"error", err,
-		)
-		return fmt.Errorf("%s: %w", msg, err)
-	}
-
-	return nil
+) (*tpm2.TPM2, bool, error) {
+	return b.applyTPM2FieldsWithOptions(ctx, data, name, td, tpm2FieldsOptions{
+		akPublic: true,
+	})
 }
 
-func (b *backend) upsertTPM2(
+// applyTPM2FieldsWithOptions is applyTPM2Fields for the attestation types
+// that only configure some of the optional tpm2 fields.
+func (b *backend) applyTPM2FieldsWithOptions(
 	ctx context.Context,
-	req *logical.Request,
 	data *framework.FieldData,
 	name string,
+	td *tpm2.TPM2,
+	opts tpm2FieldsOptions,
 ) (*tpm2.TPM2, bool, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, false, err
@@ -89,24 +52,15 @@ func (b *backend) upsertTPM2(
 
 	l := b.Logger()
 
-	l.Debug("fetching domain from storage",
-		"attestation_type", "tpm2",
-		"domain", name,
+	var (
+		akPublic   types.Bytes
+		akPublicOk bool
+		errs       *multierror.Error
 	)
-
-	td, err := b.loadTPM2(ctx, req.Storage, name)
-	if err != nil {
-		msg := "failed to fetch domain from storage"
-		l.Error(msg,
-			"attestation_type", "tpm2",
-			"domain", name,
-			"error", err,
-		)
-		return nil, false, fmt.Errorf("%s: %w", msg, err)
+	if opts.akPublic {
+		akPublic, akPublicOk, errs = types.BytesFromFieldData(data, "tpm2_ak_public", nil)
 	}
 
-	akPublic, akPublicOk, errs := types.BytesFromFieldData(data, "tpm2_ak_public", nil)
-
 	var (
 		pcrs   = [24]*types.Byte32{}
 		pcrsOk = [24]bool{}
@@ -115,6 +69,15 @@ func (b *backend) upsertTPM2(
 		pcrs[idx], pcrsOk[idx], errs = types.Byte32FromFieldData(data, fmt.Sprintf("tpm2_pcr%02d", idx), errs)
 	}
 
+	clockCheck, clockCheckOk := data.GetOk("tpm2_clock_check")
+
+	rebootAction, rebootActionOk := data.GetOk("tpm2_reboot_action")
+	if rebootActionOk {
+		if err := tpm2.ValidateRebootAction(rebootAction.(string)); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
 	if err := errs.ErrorOrNil(); err != nil {
 		msg := "failed to read parameters for tpm2 entry"
 		l.Error(msg,
@@ -133,10 +96,6 @@ func (b *backend) upsertTPM2(
 
 		td.Name = name // name is not stored as a field
 
-		if totpSecret, ok := data.GetOk("totp_secret"); ok {
-			td.TOTPSecret = totpSecret.(string)
-		}
-
 		if akPublicOk {
 			td.AKPublic = akPublic
 		}
@@ -145,6 +104,12 @@ func (b *backend) upsertTPM2(
 				td.PCRs[idx] = pcr
 			}
 		}
+		if clockCheckOk {
+			td.ClockCheck = clockCheck.(bool)
+		}
+		if rebootActionOk {
+			td.RebootAction = rebootAction.(string)
+		}
 
 		return td, false, nil
 	}
@@ -154,15 +119,20 @@ func (b *backend) upsertTPM2(
 		"domain", name,
 	)
 
-	if akPublic == nil {
+	if opts.akPublic && akPublic == nil {
 		return nil, false, errors.New("`tpm2_ak_public` field is required")
 	}
 
 	td = &tpm2.TPM2{
-		Name:       name,
-		TOTPSecret: data.Get("totp_secret").(string),
-		AKPublic:   akPublic,
-		PCRs:       pcrs,
+		Name:     name,
+		AKPublic: akPublic,
+		PCRs:     pcrs,
+	}
+	if clockCheckOk {
+		td.ClockCheck = clockCheck.(bool)
+	}
+	if rebootActionOk {
+		td.RebootAction = rebootAction.(string)
 	}
 
 	return td, true, nil
@@ -219,6 +189,48 @@ func (b *backend) parseTPM2Attestation(
 	return attestation, nil
 }
 
+// parseTPM2EK decodes the public part of the endorsement key that the
+// instance reported with its attestation (if any).
+func (b *backend) parseTPM2EK(
+	ctx context.Context,
+	data *framework.FieldData,
+	td *tpm2.TPM2,
+) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	ekBase64 := data.Get("ek_public").(string)
+	if ekBase64 == "" {
+		return nil, nil
+	}
+
+	ek, err := base64.StdEncoding.DecodeString(ekBase64)
+	if err != nil {
+		msg := "failed to base64-decode tpm2 endorsement key"
+		l.Error(msg,
+			"attestation_type", "tpm2",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if _, err := x509.ParsePKIXPublicKey(ek); err != nil {
+		msg := "failed to parse tpm2 endorsement key"
+		l.Error(msg,
+			"attestation_type", "tpm2",
+			"domain", td.Name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return ek, nil
+}
+
 func (b *backend) validateTPM2Attestation(
 	ctx context.Context,
 	td *tpm2.TPM2,
@@ -269,15 +281,15 @@ func (b *backend) validateTPM2Attestation(
 		errs = multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
 	}
 
-	eventlog, errParseEventLog := attest.ParseEventLog(attestation.EventLog)
-	if errParseEventLog != nil {
+	eventlog, err := attest.ParseEventLog(attestation.EventLog)
+	if err != nil {
 		msg := "failed to parse tpm2 event log"
 		l.Error(msg,
 			"attestation_type", "tpm2",
 			"domain", td.Name,
 			"error", err,
 		)
-		errs = multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+		return multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
 	}
 
 	if _, err := eventlog.Verify(attestation.PCRs); err != nil {
@@ -324,35 +336,3 @@ func (b *backend) verifyTPM2Attestation(
 
 	return errs
 }
-
-func (b *backend) loginTPM2(
-	ctx context.Context,
-	td *tpm2.TPM2,
-	errs *multierror.Error,
-) (*logical.Response, error) {
-	if err := ctx.Err(); err != nil {
-		return nil, err
-	}
-
-	l := b.Logger()
-
-	if err := errs.ErrorOrNil(); err != nil {
-		msg := "failed to login trusted domain"
-		l.Error(msg,
-			"attestation_type", "tpm2",
-			"domain", td.Name,
-			"error", err,
-		)
-		return nil, fmt.Errorf("%s: %w", msg, err)
-	}
-
-	auth := &logical.Auth{
-		Metadata: map[string]string{"tpm2": td.Name},
-		Alias:    &logical.Alias{Name: "tpm2/" + td.Name},
-	}
-	td.PopulateTokenAuth(auth)
-
-	return &logical.Response{
-		Auth: auth,
-	}, nil
-}
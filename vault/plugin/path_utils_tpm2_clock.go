@@ -0,0 +1,425 @@
+package plugin
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var (
+	errTPM2RebootNotApproved = errors.New("tpm2 reboot since the previous login is waiting for the approval")
+	errTPM2RebootNotPending  = errors.New("there is no tpm2 reboot waiting for the approval")
+	errTPM2RebootAmbiguous   = errors.New("several tpm2 reboots are waiting for the approval, `ak` field is required")
+	errTPM2ClockAKInvalid    = errors.New("`ak` field must be the fingerprint of the attestation key")
+	errTPM2ClockOtherTPM     = errors.New("tpm2 clock does not continue the one observed with the same attestation key")
+)
+
+// getTPM2ClockAK returns the fingerprint of the attestation key that the
+// request refers to (if any).
+func getTPM2ClockAK(data *framework.FieldData) (string, error) {
+	ak := strings.ToLower(strings.TrimSpace(data.Get("ak").(string)))
+	if ak == "" {
+		return "", nil
+	}
+
+	if _, err := hex.DecodeString(ak); err != nil || len(ak) != len(tpm2.AKFingerprint(nil)) {
+		return "", errTPM2ClockAKInvalid
+	}
+
+	return ak, nil
+}
+
+// checkTPM2Clock verifies the clock of the tpm reported by the evidence
+// against the one observed on the previous login of the domain with the same
+// attestation key, and returns the record that is to be stored once the login
+// succeeds.
+//
+// The records are kept per attestation key, so with the clock check of the
+// domain all logins with the same key must come from the same tpm. For the
+// domains that pin the key (tpm2 and tdxtpm2) this means that only one
+// instance of the domain can log in.
+//
+// The clock is only looked at when the evidence is valid otherwise (as until
+// then the quotes that carry it can not be trusted).
+func (b *backend) checkTPM2Clock(
+	ctx context.Context,
+	req *logical.Request,
+	v Verifier,
+	evidence interface{},
+	errs *multierror.Error,
+) (*tpm2ClockRecord, *multierror.Error) {
+	tv, ok := v.(tpm2Verifier)
+	if !ok || errs.ErrorOrNil() != nil {
+		return nil, errs
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	attestation := tv.TPM2Attestation(evidence)
+	policy := tv.TPM2Policy()
+
+	clock, err := tpm2.ClockFromAttestation(attestation)
+	if err != nil {
+		msg := "failed to read tpm2 clock"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return nil, multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+	}
+
+	observed := &tpm2ClockRecord{
+		AKPublic:   attestation.Public,
+		Clock:      clock,
+		ObservedAt: time.Now().UTC(),
+	}
+	ak := tpm2.AKFingerprint(attestation.Public)
+
+	b.tpm2ClockLock.Lock()
+	defer b.tpm2ClockLock.Unlock()
+
+	r, err := b.loadTPM2Clock(ctx, req.Storage, v, ak)
+	if err != nil {
+		msg := "failed to fetch tpm2 clock from storage"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"ak", ak,
+			"error", err,
+		)
+		return nil, multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+	}
+	if r == nil {
+		return observed, errs // first login with this attestation key
+	}
+
+	if policy.ClockCheck {
+		// the attestation key lives in a single tpm, so the clock that does
+		// not continue the observed one comes from another instance that
+		// carries the same key (e.g. a clone of the vm together with the state
+		// of its vtpm), and such instances are not told apart
+		if err := clock.Continues(r.Clock); err != nil {
+			msg := errTPM2ClockOtherTPM.Error()
+			l.Error(msg,
+				"attestation_type", v.AttestationType(),
+				"domain", v.GetName(),
+				"ak", ak,
+				"error", err,
+			)
+			return nil, multierror.Append(errs, fmt.Errorf("%w: %w", errTPM2ClockOtherTPM, err))
+		}
+
+		if err := clock.FollowsUp(r.Clock, time.Since(r.ObservedAt), globals.TPM2ClockTolerance); err != nil {
+			msg := "inconsistent tpm2 clock"
+			l.Error(msg,
+				"attestation_type", v.AttestationType(),
+				"domain", v.GetName(),
+				"ak", ak,
+				"error", err,
+			)
+			return nil, multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+		}
+	}
+
+	if !clock.RebootedSince(r.Clock) {
+		return observed, errs
+	}
+
+	switch policy.RebootAction {
+	case tpm2.RebootActionAlert:
+		l.Warn("tpm2 reboot detected since the previous login",
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"ak", ak,
+			"reset_count", clock.ResetCount,
+			"previous_reset_count", r.Clock.ResetCount,
+			"previous_login", r.ObservedAt,
+		)
+
+	case tpm2.RebootActionReapprove:
+		if r.Reboot == nil || r.Reboot.ResetCount != clock.ResetCount {
+			r.Reboot = clock
+			r.RebootObservedAt = observed.ObservedAt
+			if err := b.saveTPM2Clock(ctx, req.Storage, v, r); err != nil {
+				msg := "failed to push tpm2 clock into storage"
+				l.Error(msg,
+					"attestation_type", v.AttestationType(),
+					"domain", v.GetName(),
+					"ak", ak,
+					"error", err,
+				)
+				return nil, multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+			}
+		}
+		l.Warn(errTPM2RebootNotApproved.Error(),
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"ak", ak,
+			"reset_count", clock.ResetCount,
+			"previous_reset_count", r.Clock.ResetCount,
+			"previous_login", r.ObservedAt,
+		)
+		return nil, multierror.Append(errs, errTPM2RebootNotApproved)
+
+	default:
+		l.Info("tpm2 reboot detected since the previous login",
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"ak", ak,
+			"reset_count", clock.ResetCount,
+			"previous_reset_count", r.Clock.ResetCount,
+		)
+	}
+
+	return observed, errs
+}
+
+// recordTPM2Clock stores the clock of the tpm observed on the successful
+// login (unless the concurrent login with the same attestation key has
+// already stored the later one).
+func (b *backend) recordTPM2Clock(
+	ctx context.Context,
+	req *logical.Request,
+	v Verifier,
+	observed *tpm2ClockRecord,
+) error {
+	if observed == nil {
+		return nil
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	ak := tpm2.AKFingerprint(observed.AKPublic)
+
+	b.tpm2ClockLock.Lock()
+	defer b.tpm2ClockLock.Unlock()
+
+	r, err := b.loadTPM2Clock(ctx, req.Storage, v, ak)
+	if err != nil {
+		msg := "failed to fetch tpm2 clock from storage"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"ak", ak,
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	if r != nil &&
+		r.Clock.ResetCount == observed.Clock.ResetCount &&
+		r.Clock.Clock > observed.Clock.Clock {
+		return nil
+	}
+
+	if err := b.saveTPM2Clock(ctx, req.Storage, v, observed); err != nil {
+		msg := "failed to push tpm2 clock into storage"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"ak", ak,
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil
+}
+
+// fetchTPM2Clocks returns the clocks observed on the logins of the domain,
+// keyed by the fingerprints of the attestation keys.
+func (b *backend) fetchTPM2Clocks(
+	ctx context.Context,
+	req *logical.Request,
+	td TD,
+) (map[string]*tpm2ClockRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	aks, err := b.listTPM2Clocks(ctx, req.Storage, td)
+	if err != nil {
+		msg := "failed to list tpm2 clocks"
+		l.Error(msg,
+			"attestation_type", td.AttestationType(),
+			"domain", td.GetName(),
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	clocks := make(map[string]*tpm2ClockRecord, len(aks))
+	for _, ak := range aks {
+		r, err := b.loadTPM2Clock(ctx, req.Storage, td, ak)
+		if err != nil {
+			msg := "failed to fetch tpm2 clock from storage"
+			l.Error(msg,
+				"attestation_type", td.AttestationType(),
+				"domain", td.GetName(),
+				"ak", ak,
+				"error", err,
+			)
+			return nil, fmt.Errorf("%s: %w", msg, err)
+		}
+		if r != nil {
+			clocks[ak] = r
+		}
+	}
+
+	return clocks, nil
+}
+
+// approveTPM2Reboot accepts the reboot that is waiting for the approval, so
+// that the subsequent logins with the attestation key are checked against the
+// clock reported after it. Without the fingerprint of the attestation key the
+// only reboot that is waiting for the approval is accepted.
+func (b *backend) approveTPM2Reboot(
+	ctx context.Context,
+	req *logical.Request,
+	td TD,
+	ak string,
+) (*tpm2ClockRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	b.tpm2ClockLock.Lock()
+	defer b.tpm2ClockLock.Unlock()
+
+	if ak == "" {
+		clocks, err := b.fetchTPM2Clocks(ctx, req, td)
+		if err != nil {
+			return nil, err
+		}
+		for fingerprint, r := range clocks {
+			if r.Reboot == nil {
+				continue
+			}
+			if ak != "" {
+				return nil, errTPM2RebootAmbiguous
+			}
+			ak = fingerprint
+		}
+		if ak == "" {
+			return nil, errTPM2RebootNotPending
+		}
+	}
+
+	r, err := b.loadTPM2Clock(ctx, req.Storage, td, ak)
+	if err != nil {
+		msg := "failed to fetch tpm2 clock from storage"
+		l.Error(msg,
+			"attestation_type", td.AttestationType(),
+			"domain", td.GetName(),
+			"ak", ak,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	if r == nil || r.Reboot == nil {
+		return nil, errTPM2RebootNotPending
+	}
+
+	r.Clock, r.ObservedAt = r.Reboot, r.RebootObservedAt
+	r.Reboot, r.RebootObservedAt = nil, time.Time{}
+
+	if err := b.saveTPM2Clock(ctx, req.Storage, td, r); err != nil {
+		msg := "failed to push tpm2 clock into storage"
+		l.Error(msg,
+			"attestation_type", td.AttestationType(),
+			"domain", td.GetName(),
+			"ak", ak,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	l.Info("approved tpm2 reboot",
+		"attestation_type", td.AttestationType(),
+		"domain", td.GetName(),
+		"ak", ak,
+		"reset_count", r.Clock.ResetCount,
+		"entity_id", req.EntityID,
+	)
+
+	return r, nil
+}
+
+// purgeTPM2Clocks forgets the clocks observed on the logins of the domain
+// with all of its attestation keys.
+func (b *backend) purgeTPM2Clocks(
+	ctx context.Context,
+	req *logical.Request,
+	td TD,
+) error {
+	l := b.Logger()
+
+	aks, err := b.listTPM2Clocks(ctx, req.Storage, td)
+	if err != nil {
+		msg := "failed to list tpm2 clocks"
+		l.Error(msg,
+			"attestation_type", td.AttestationType(),
+			"domain", td.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	for _, ak := range aks {
+		if err := b.deleteTPM2Clock(ctx, req.Storage, td, ak); err != nil {
+			msg := "failed to delete tpm2 clock"
+			l.Error(msg,
+				"attestation_type", td.AttestationType(),
+				"domain", td.GetName(),
+				"ak", ak,
+				"error", err,
+			)
+			return fmt.Errorf("%s: %w", msg, err)
+		}
+	}
+
+	return nil
+}
+
+func encodeTPM2Clock(r *tpm2ClockRecord) map[string]interface{} {
+	res := map[string]interface{}{
+		"ak":            tpm2.AKFingerprint(r.AKPublic),
+		"clock":         r.Clock.Clock,
+		"reset_count":   r.Clock.ResetCount,
+		"restart_count": r.Clock.RestartCount,
+		"safe":          r.Clock.Safe,
+		"observed_at":   r.ObservedAt.Format(time.RFC3339),
+	}
+	if r.Reboot != nil {
+		res["reboot"] = map[string]interface{}{
+			"clock":         r.Reboot.Clock,
+			"reset_count":   r.Reboot.ResetCount,
+			"restart_count": r.Reboot.RestartCount,
+			"safe":          r.Reboot.Safe,
+			"observed_at":   r.RebootObservedAt.Format(time.RFC3339),
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,242 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tpm "github.com/google/go-tpm/legacy/tpm2"
+)
+
+// newTestTPM2Attestation returns the attestation with the quote that carries
+// the clock of tpm (the quote is not signed).
+func newTestTPM2Attestation(t *testing.T, akPublic []byte, clock tpm2.Clock) *attest.PlatformParameters {
+	safe := byte(0)
+	if clock.Safe {
+		safe = 1
+	}
+
+	quote, err := tpm.AttestationData{
+		Magic: 0xff544347,
+		Type:  tpm.TagAttestQuote,
+		QualifiedSigner: tpm.Name{
+			Digest: &tpm.HashValue{Alg: tpm.AlgSHA256, Value: make([]byte, 32)},
+		},
+		ClockInfo: tpm.ClockInfo{
+			Clock:        clock.Clock,
+			ResetCount:   clock.ResetCount,
+			RestartCount: clock.RestartCount,
+			Safe:         safe,
+		},
+		AttestedQuoteInfo: &tpm.QuoteInfo{
+			PCRSelection: tpm.PCRSelection{Hash: tpm.AlgSHA256, PCRs: []int{0}},
+			PCRDigest:    make([]byte, 32),
+		},
+	}.Encode()
+	require.NoError(t, err)
+
+	return &attest.PlatformParameters{
+		Public: akPublic,
+		Quotes: []attest.Quote{{Version: attest.TPMVersion20, Quote: quote}},
+	}
+}
+
+func TestTPM2ClockPerAK(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tpm2/host", map[string]interface{}{
+		"tpm2_ak_public":     "AAAA",
+		"tpm2_clock_check":   true,
+		"tpm2_reboot_action": "reapprove",
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	v, err := b.loadVerifier(ctx, storage, verifierTypeTPM2, "host")
+	require.NoError(t, err)
+
+	var (
+		akA = []byte("attestation key of machine a")
+		akB = []byte("attestation key of machine b")
+		fpA = tpm2.AKFingerprint(akA)
+		fpB = tpm2.AKFingerprint(akB)
+	)
+
+	// login runs the clock checks of the login with the evidence
+	login := func(akPublic []byte, clock tpm2.Clock) error {
+		req := &logical.Request{Storage: storage}
+		observed, errs := b.checkTPM2Clock(ctx, req, v, &tpm2Evidence{attestation: newTestTPM2Attestation(t, akPublic, clock)}, b.multierror())
+		if err := errs.ErrorOrNil(); err != nil {
+			return err
+		}
+		return b.recordTPM2Clock(ctx, req, v, observed)
+	}
+	clocks := func(data map[string]interface{}) map[string]interface{} {
+		res, err := handle(t, b, storage, "", logical.ReadOperation, "tpm2/host/tpm2-clock", data)
+		require.NoError(t, err)
+		if res == nil {
+			return nil
+		}
+		return res.Data
+	}
+
+	{ // first logins with both keys
+		require.NoError(t, login(akA, tpm2.Clock{Clock: 60_000, ResetCount: 5, Safe: true}))
+		require.NoError(t, login(akB, tpm2.Clock{Clock: 1_000, ResetCount: 1, Safe: true}))
+
+		data := clocks(nil)
+		require.Contains(t, data, "clocks")
+		assert.Len(t, data["clocks"], 2)
+		assert.Contains(t, data["clocks"], fpA)
+		assert.Contains(t, data["clocks"], fpB)
+
+		data = clocks(map[string]interface{}{"ak": fpA})
+		assert.Equal(t, fpA, data["ak"])
+		assert.EqualValues(t, 5, data["reset_count"])
+	}
+
+	{ // the keys are checked against their own clocks
+		assert.NoError(t, login(akA, tpm2.Clock{Clock: 61_000, ResetCount: 5, Safe: true}))
+		assert.NoError(t, login(akB, tpm2.Clock{Clock: 2_000, ResetCount: 1, Safe: true}))
+	}
+
+	{ // reboot of one machine does not affect the other one
+		assert.ErrorIs(t, login(akB, tpm2.Clock{Clock: 3_000, ResetCount: 2, Safe: true}), errTPM2RebootNotApproved)
+		assert.NoError(t, login(akA, tpm2.Clock{Clock: 62_000, ResetCount: 5, Safe: true}))
+
+		assert.Contains(t, clocks(map[string]interface{}{"ak": fpB}), "reboot")
+		assert.NotContains(t, clocks(map[string]interface{}{"ak": fpA}), "reboot")
+
+		// the only pending reboot is approved without the fingerprint
+		res, err := handle(t, b, storage, "", logical.UpdateOperation, "tpm2/host/tpm2-clock", nil)
+		require.NoError(t, err)
+		assert.Equal(t, fpB, res.Data["ak"])
+
+		assert.NoError(t, login(akB, tpm2.Clock{Clock: 4_000, ResetCount: 2, Safe: true}))
+	}
+
+	{ // several pending reboots are approved one by one
+		assert.ErrorIs(t, login(akA, tpm2.Clock{Clock: 63_000, ResetCount: 6, Safe: true}), errTPM2RebootNotApproved)
+		assert.ErrorIs(t, login(akB, tpm2.Clock{Clock: 5_000, ResetCount: 3, Safe: true}), errTPM2RebootNotApproved)
+
+		_, err := handle(t, b, storage, "", logical.UpdateOperation, "tpm2/host/tpm2-clock", nil)
+		assert.ErrorIs(t, err, errTPM2RebootAmbiguous)
+
+		_, err = handle(t, b, storage, "", logical.UpdateOperation, "tpm2/host/tpm2-clock", map[string]interface{}{
+			"ak": fpA,
+		})
+		require.NoError(t, err)
+
+		assert.NoError(t, login(akA, tpm2.Clock{Clock: 64_000, ResetCount: 6, Safe: true}))
+		assert.ErrorIs(t, login(akB, tpm2.Clock{Clock: 6_000, ResetCount: 3, Safe: true}), errTPM2RebootNotApproved)
+	}
+
+	{ // invalid fingerprint
+		_, err := handle(t, b, storage, "", logical.ReadOperation, "tpm2/host/tpm2-clock", map[string]interface{}{
+			"ak": "../../tpm2/host",
+		})
+		assert.ErrorIs(t, err, errTPM2ClockAKInvalid)
+	}
+
+	{ // forget the clock of one key, then all of them
+		_, err := handle(t, b, storage, "", logical.DeleteOperation, "tpm2/host/tpm2-clock", map[string]interface{}{
+			"ak": fpA,
+		})
+		require.NoError(t, err)
+		assert.Nil(t, clocks(map[string]interface{}{"ak": fpA}))
+		assert.NotNil(t, clocks(map[string]interface{}{"ak": fpB}))
+
+		_, err = handle(t, b, storage, "", logical.DeleteOperation, "tpm2/host/tpm2-clock", nil)
+		require.NoError(t, err)
+		assert.Nil(t, clocks(nil))
+	}
+
+	{ // the clocks are removed together with the domain
+		require.NoError(t, login(akA, tpm2.Clock{Clock: 65_000, ResetCount: 7, Safe: true}))
+		require.NoError(t, login(akB, tpm2.Clock{Clock: 7_000, ResetCount: 4, Safe: true}))
+
+		_, err := handle(t, b, storage, "", logical.DeleteOperation, "tpm2/host", nil)
+		require.NoError(t, err)
+
+		keys, err := storage.List(ctx, tpm2ClockPrefix(v))
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	}
+}
+
+func TestTPM2ClockInterleaved(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tpm2/host", map[string]interface{}{
+		"tpm2_ak_public":     "AAAA",
+		"tpm2_clock_check":   true,
+		"tpm2_reboot_action": "reapprove",
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	v, err := b.loadVerifier(ctx, storage, verifierTypeTPM2, "host")
+	require.NoError(t, err)
+
+	// both instances carry the same attestation key (the domain pins it)
+	ak := []byte("attestation key of the domain")
+
+	// login runs the clock checks of the login with the evidence
+	login := func(clock tpm2.Clock) error {
+		req := &logical.Request{Storage: storage}
+		observed, errs := b.checkTPM2Clock(ctx, req, v, &tpm2Evidence{attestation: newTestTPM2Attestation(t, ak, clock)}, b.multierror())
+		if err := errs.ErrorOrNil(); err != nil {
+			return err
+		}
+		return b.recordTPM2Clock(ctx, req, v, observed)
+	}
+	// resetCount returns the reset count of the recorded clock
+	resetCount := func() interface{} {
+		res, err := handle(t, b, storage, "", logical.ReadOperation, "tpm2/host/tpm2-clock", map[string]interface{}{
+			"ak": tpm2.AKFingerprint(ak),
+		})
+		require.NoError(t, err)
+		return res.Data["reset_count"]
+	}
+
+	require.NoError(t, login(tpm2.Clock{Clock: 60_000, ResetCount: 5, Safe: true})) // instance a
+
+	{ // instance b that was booted fewer times
+		assert.ErrorIs(t, login(tpm2.Clock{Clock: 1_000, ResetCount: 1, Safe: true}), errTPM2ClockOtherTPM)
+		assert.NoError(t, login(tpm2.Clock{Clock: 61_000, ResetCount: 5, Safe: true}))
+		assert.ErrorIs(t, login(tpm2.Clock{Clock: 2_000, ResetCount: 1, Safe: true}), errTPM2ClockOtherTPM)
+		assert.EqualValues(t, 5, resetCount())
+	}
+
+	{ // instance b that is the clone of instance a (the clock lags behind)
+		assert.NoError(t, login(tpm2.Clock{Clock: 62_000, ResetCount: 5, Safe: true}))
+		assert.ErrorIs(t, login(tpm2.Clock{Clock: 61_500, ResetCount: 5, Safe: true}), errTPM2ClockOtherTPM)
+		assert.NoError(t, login(tpm2.Clock{Clock: 63_000, ResetCount: 5, Safe: true}))
+	}
+
+	{ // the reboot of instance a is still told apart
+		assert.ErrorIs(t, login(tpm2.Clock{Clock: 64_000, ResetCount: 6, Safe: true}), errTPM2RebootNotApproved)
+		assert.EqualValues(t, 5, resetCount())
+	}
+
+	{ // without the clock check the instances are not told apart
+		res, err := handle(t, b, storage, "", logical.UpdateOperation, "tpm2/host", map[string]interface{}{
+			"tpm2_clock_check": false,
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+
+		v, err = b.loadVerifier(ctx, storage, verifierTypeTPM2, "host")
+		require.NoError(t, err)
+
+		assert.NoError(t, login(tpm2.Clock{Clock: 61_500, ResetCount: 5, Safe: true}))
+		assert.EqualValues(t, 5, resetCount())
+	}
+}
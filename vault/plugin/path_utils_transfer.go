@@ -0,0 +1,253 @@
+package plugin
+
+import (
+	"context"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// transferVersion is the version of the format of the exported documents.
+const transferVersion = 1
+
+var (
+	errTransferVersion     = errors.New("unsupported version of the document")
+	errTransferUnknownType = errors.New("unknown attestation type")
+	errTransferName        = errors.New("invalid name")
+	errTransferPublicKey   = errors.New("public key must be pem-encoded rsa public key")
+	errTransferNoImportKey = errors.New("document carries secrets, but the import key of the mount is not generated")
+)
+
+var transferNameRegex = regexp.MustCompile("^" + framework.GenericNameRegex("name") + "$")
+
+// transferDocument is the portable form of the domains (and templates) of the
+// mount.
+type transferDocument struct {
+	// Version is the version of the format of the document.
+	Version int `json:"version"`
+
+	// ExportedAt is the time of the export.
+	ExportedAt time.Time `json:"exported_at"`
+
+	// Domains are the stored configurations of the domains (without their
+	// totp secrets), keyed by attestation type and by name.
+	Domains map[string]map[string]json.RawMessage `json:"domains"`
+
+	// Templates are the templates that the domains can reference.
+	Templates map[string]*domainTemplate `json:"templates,omitempty"`
+
+	// Secrets are the totp secrets of the domains (keyed by
+	// `<attestation_type>/<name>`), encrypted with rsa-oaep to the import key
+	// of the destination mount.
+	Secrets map[string]string `json:"secrets,omitempty"`
+}
+
+// exportDocument collects the domains and templates of the mount into the
+// document. The totp secrets are only included when the public key to encrypt
+// them to is provided.
+func (b *backend) exportDocument(
+	ctx context.Context,
+	req *logical.Request,
+	publicKey *rsa.PublicKey,
+) (*transferDocument, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	doc := &transferDocument{
+		Version:    transferVersion,
+		ExportedAt: time.Now().UTC(),
+		Domains:    make(map[string]map[string]json.RawMessage),
+		Templates:  make(map[string]*domainTemplate),
+	}
+	if publicKey != nil {
+		doc.Secrets = make(map[string]string)
+	}
+
+	for _, vt := range verifierTypes {
+		names, err := b.listVerifiers(ctx, req.Storage, vt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list domains: %w", err)
+		}
+		if len(names) == 0 {
+			continue
+		}
+
+		domains := make(map[string]json.RawMessage, len(names))
+		for _, name := range names {
+			v, err := b.fetchVerifier(ctx, req, vt, name)
+			if err != nil {
+				return nil, err
+			}
+
+			key := vt.attestationType + "/" + name
+			if publicKey != nil {
+				secret, err := rsa.EncryptOAEP(
+					sha256.New(), b.Rand(), publicKey, []byte(v.GetTOTPSecret()), []byte(key),
+				)
+				if err != nil {
+					return nil, fmt.Errorf("failed to encrypt totp secret of %s: %w", key, err)
+				}
+				doc.Secrets[key] = base64.StdEncoding.EncodeToString(secret)
+			}
+
+			if domains[name], err = marshalDomain(v); err != nil {
+				return nil, err
+			}
+		}
+		doc.Domains[vt.attestationType] = domains
+	}
+
+	names, err := b.listTemplates(ctx, req.Storage)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %w", err)
+	}
+	for _, name := range names {
+		if doc.Templates[name], err = b.fetchTemplate(ctx, req, name); err != nil {
+			return nil, err
+		}
+	}
+
+	return doc, nil
+}
+
+// parsePublicKey parses the pem-encoded rsa public key that the secrets are
+// encrypted to.
+func parsePublicKey(encoded string) (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(encoded))
+	if block == nil {
+		return nil, errTransferPublicKey
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errTransferPublicKey, err)
+	}
+
+	publicKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errTransferPublicKey
+	}
+
+	return publicKey, nil
+}
+
+// fetchImportKey returns the import key of the mount, and generates it when
+// it does not exist yet (if generate is set).
+func (b *backend) fetchImportKey(
+	ctx context.Context,
+	req *logical.Request,
+	generate bool,
+) (*rsa.PrivateKey, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	b.importKeyLock.Lock()
+	defer b.importKeyLock.Unlock()
+
+	k, err := b.loadImportKey(ctx, req.Storage)
+	if err != nil {
+		msg := "failed to fetch import key from storage"
+		l.Error(msg,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if k == nil {
+		if !generate {
+			return nil, nil
+		}
+
+		privateKey, err := rsa.GenerateKey(b.Rand(), globals.ImportKeyBits)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate import key: %w", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+		if err != nil {
+			return nil, err
+		}
+		if err := b.saveImportKey(ctx, req.Storage, &importKey{PrivateKey: der}); err != nil {
+			msg := "failed to push import key into storage"
+			l.Error(msg,
+				"error", err,
+			)
+			return nil, fmt.Errorf("%s: %w", msg, err)
+		}
+
+		l.Info("generated import key")
+
+		return privateKey, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(k.PrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode import key: %w", err)
+	}
+	privateKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("import key is not rsa key")
+	}
+
+	return privateKey, nil
+}
+
+// decryptSecrets decrypts the totp secrets of the document with the import
+// key of the mount.
+func (b *backend) decryptSecrets(
+	ctx context.Context,
+	req *logical.Request,
+	doc *transferDocument,
+) (map[string]string, error) {
+	secrets := make(map[string]string, len(doc.Secrets))
+	if len(doc.Secrets) == 0 {
+		return secrets, nil
+	}
+
+	privateKey, err := b.fetchImportKey(ctx, req, false)
+	if err != nil {
+		return nil, err
+	}
+	if privateKey == nil {
+		return nil, errTransferNoImportKey
+	}
+
+	for key, encoded := range doc.Secrets {
+		encrypted, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("totp secret of %s is not encoded as base64 string: %w", key, err)
+		}
+		secret, err := rsa.DecryptOAEP(sha256.New(), nil, privateKey, encrypted, []byte(key))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt totp secret of %s: %w", key, err)
+		}
+		secrets[key] = string(secret)
+	}
+
+	return secrets, nil
+}
+
+// encodeImportKey returns the public part of the import key in the form that
+// the export endpoint accepts.
+func encodeImportKey(privateKey *rsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), nil
+}
@@ -0,0 +1,743 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-secure-stdlib/parseutil"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/cidrutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var (
+	errLoginSourceNotAllowed = errors.New("request address is not allowed to login")
+	errMaxNoncesInvalid      = errors.New("invalid max nonces")
+)
+
+func (b *backend) fetchVerifier(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	name string,
+) (Verifier, error) {
+	l := b.Logger()
+
+	l.Debug("fetching domain from storage",
+		"attestation_type", vt.attestationType,
+		"domain", name,
+	)
+
+	v, err := b.loadVerifier(ctx, req.Storage, vt, name)
+	if err != nil {
+		msg := "failed to fetch domain from storage"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+	if v == nil {
+		msg := "domain is not configured"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+		)
+		return nil, fmt.Errorf("%s: %s/%s", msg, vt.attestationType, name)
+	}
+
+	v.SetName(name) // name is not stored as a field
+
+	return v, nil
+}
+
+func (b *backend) pushVerifier(
+	ctx context.Context,
+	req *logical.Request,
+	v Verifier,
+) error {
+	l := b.Logger()
+
+	l.Debug("pushing domain into storage",
+		"attestation_type", v.AttestationType(),
+		"domain", v.GetName(),
+	)
+
+	if err := b.recordVersion(ctx, req, v); err != nil {
+		msg := "failed to record domain version"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	if err := b.saveVerifier(ctx, req.Storage, v); err != nil {
+		msg := "failed to push domain into storage"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil
+}
+
+// removeVerifier deletes the domain together with everything that is stored
+// alongside it (enrolled instances, manifests, history, and pending change).
+func (b *backend) removeVerifier(
+	ctx context.Context,
+	req *logical.Request,
+	vt *verifierType,
+	name string,
+) error {
+	l := b.Logger()
+
+	l.Debug("deleting domain",
+		"attestation_type", vt.attestationType,
+		"domain", name,
+	)
+
+	td := vt.new(b)
+	td.SetName(name)
+
+	if iv, ok := td.(instanceVerifier); ok {
+		if err := iv.PurgeInstances(ctx, req); err != nil {
+			return err
+		}
+	}
+
+	if err := b.purgeManifests(ctx, req, td); err != nil {
+		return err
+	}
+
+	if err := b.purgeHistory(ctx, req, td); err != nil {
+		return err
+	}
+
+	if err := b.purgePending(ctx, req, td); err != nil {
+		return err
+	}
+
+	if err := b.purgeTPM2Clocks(ctx, req, td); err != nil {
+		return err
+	}
+
+	b.policies.Delete(vt.attestationType + "/" + name)
+
+	if err := b.deleteVerifier(ctx, req.Storage, vt, name); err != nil {
+		msg := "failed to delete domain"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil
+}
+
+func (b *backend) upsertVerifier(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+	vt *verifierType,
+	name string,
+) (Verifier, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	l := b.Logger()
+
+	l.Debug("fetching domain from storage",
+		"attestation_type", vt.attestationType,
+		"domain", name,
+	)
+
+	v, err := b.loadVerifier(ctx, req.Storage, vt, name)
+	if err != nil {
+		msg := "failed to fetch domain from storage"
+		l.Error(msg,
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"error", err,
+		)
+		return nil, false, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	isNew := v == nil
+	if isNew {
+		v = vt.new(b)
+	}
+	v.SetName(name) // name is not stored as a field
+
+	if err := v.Apply(ctx, data, isNew); err != nil {
+		return nil, false, err
+	}
+	v.SetName(name) // apply might have replaced the policies
+
+	if err := b.applyPolicy(ctx, data, v); err != nil {
+		return nil, false, err
+	}
+
+	if err := b.applyManifestSigner(ctx, data, v); err != nil {
+		return nil, false, err
+	}
+
+	if err := b.applyLoginBoundCIDRs(ctx, data, v); err != nil {
+		return nil, false, err
+	}
+
+	if err := b.applyMaxNonces(ctx, data, v); err != nil {
+		return nil, false, err
+	}
+
+	if err := b.applyInstanceAlias(ctx, data, v); err != nil {
+		return nil, false, err
+	}
+
+	if err := b.applyTokenDelivery(ctx, data, v); err != nil {
+		return nil, false, err
+	}
+
+	if err := b.applyTemplate(ctx, req, data, vt, v); err != nil {
+		return nil, false, err
+	}
+
+	if totpSecret, ok := data.GetOk("totp_secret"); ok {
+		v.SetTOTPSecret(totpSecret.(string))
+	}
+
+	return v, isNew, nil
+}
+
+// applyPolicy updates the policy expression of the verifier with the fields
+// provided in the request, and makes sure that it compiles.
+func (b *backend) applyPolicy(
+	ctx context.Context,
+	data *framework.FieldData,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	expression, expressionOk := data.GetOk("policy")
+	values, valuesOk := data.GetOk("policy_values")
+	if !expressionOk && !valuesOk {
+		return nil
+	}
+
+	p := &policy.Policy{}
+	if current := v.common().PolicyExpression; current != nil {
+		p.Expression = current.Expression
+		p.Values = current.Values
+	}
+	if expressionOk {
+		p.Expression = strings.TrimSpace(expression.(string))
+	}
+	if valuesOk {
+		p.Values = make(map[string][]string, len(values.(map[string]string)))
+		for name, list := range values.(map[string]string) {
+			p.Values[name] = []string{}
+			for _, value := range strings.Split(list, ",") {
+				if value = strings.TrimSpace(value); value != "" {
+					p.Values[name] = append(p.Values[name], value)
+				}
+			}
+		}
+	}
+
+	if p.Expression == "" && len(p.Values) == 0 {
+		v.common().PolicyExpression = nil
+		return nil
+	}
+
+	if p.Expression != "" { // values can be kept without the expression
+		if _, err := p.Compile(); err != nil {
+			msg := "invalid policy"
+			l.Error(msg,
+				"attestation_type", v.AttestationType(),
+				"domain", v.GetName(),
+				"error", err,
+			)
+			return fmt.Errorf("%s: %w", msg, err)
+		}
+	}
+
+	v.common().PolicyExpression = p
+
+	return nil
+}
+
+// applyLoginBoundCIDRs updates the cidr blocks that the verifier accepts the
+// nonce and login requests from (empty value removes the restriction).
+func (b *backend) applyLoginBoundCIDRs(
+	ctx context.Context,
+	data *framework.FieldData,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	raw, ok := data.GetOk("login_bound_cidrs")
+	if !ok {
+		return nil
+	}
+
+	cidrs, err := parseutil.ParseAddrs(raw.([]string))
+	if err != nil {
+		msg := "invalid login bound cidrs"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+	if len(cidrs) == 0 {
+		cidrs = nil
+	}
+
+	v.common().LoginBoundCIDRs = cidrs
+
+	return nil
+}
+
+// applyMaxNonces updates the limit of the outstanding nonces of the verifier.
+func (b *backend) applyMaxNonces(
+	ctx context.Context,
+	data *framework.FieldData,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	raw, ok := data.GetOk("max_nonces")
+	if !ok {
+		return nil
+	}
+
+	maxNonces := raw.(int)
+	if err := checkMaxNonces(maxNonces); err != nil {
+		l.Error("invalid max nonces",
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return err
+	}
+
+	v.common().MaxNonces = maxNonces
+
+	return nil
+}
+
+// checkMaxNonces makes sure that the limit of the outstanding nonces is within
+// the bounds.
+func checkMaxNonces(maxNonces int) error {
+	if maxNonces < 0 || maxNonces > globals.MaxDomainNoncesLimit {
+		return fmt.Errorf("%w: %d (must be between 0 and %d)",
+			errMaxNoncesInvalid, maxNonces, globals.MaxDomainNoncesLimit,
+		)
+	}
+	return nil
+}
+
+// applyInstanceAlias updates the source of the per-instance identifier that
+// the identity alias of the verifier is derived from.
+func (b *backend) applyInstanceAlias(
+	ctx context.Context,
+	data *framework.FieldData,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	raw, ok := data.GetOk("instance_alias")
+	if !ok {
+		return nil
+	}
+
+	source := raw.(string)
+	if source == "" || source == aliasSourceDomain {
+		v.common().InstanceAlias = ""
+		return nil
+	}
+
+	if err := checkInstanceAlias(v, source); err != nil {
+		l.Error("invalid instance alias",
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return err
+	}
+
+	v.common().InstanceAlias = source
+
+	return nil
+}
+
+// checkInstanceAlias makes sure that the verifier supports the source of the
+// per-instance identifier.
+func checkInstanceAlias(v Verifier, source string) error {
+	if source == "" || source == aliasSourceDomain {
+		return nil
+	}
+
+	sources := []string{aliasSourceDomain}
+	if av, ok := v.(instanceAliasVerifier); ok {
+		sources = append(sources, av.InstanceAliasSources()...)
+	}
+	if !slices.Contains(sources, source) {
+		return fmt.Errorf("%w: %s (%s supports: %s)",
+			errInstanceAliasInvalid, source, v.AttestationType(), strings.Join(sources, ", "),
+		)
+	}
+	return nil
+}
+
+// applyTokenDelivery updates the way the token is delivered to the client
+// upon login.
+func (b *backend) applyTokenDelivery(
+	ctx context.Context,
+	data *framework.FieldData,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	raw, ok := data.GetOk("token_delivery")
+	if !ok {
+		return nil
+	}
+
+	delivery := raw.(string)
+	if delivery == "" || delivery == tokenDeliveryCleartext {
+		v.common().TokenDelivery = ""
+		return nil
+	}
+
+	if err := checkTokenDelivery(v, delivery); err != nil {
+		l.Error("invalid token delivery",
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return err
+	}
+
+	v.common().TokenDelivery = delivery
+
+	return nil
+}
+
+// checkTokenDelivery makes sure that the verifier supports the way the token
+// is delivered.
+func checkTokenDelivery(_ Verifier, delivery string) error {
+	switch delivery {
+	case "", tokenDeliveryCleartext:
+		return nil
+	case tokenDeliveryWrapped:
+		return nil
+	}
+	return fmt.Errorf("%w: %s (must be %s or %s)",
+		errTokenDeliveryInvalid, delivery, tokenDeliveryCleartext, tokenDeliveryWrapped,
+	)
+}
+
+// validateVerifier makes sure that the verifier that was decoded as a whole
+// (e.g. from the imported document) passes the same checks as the one that
+// is configured through the fields of the request.
+func (b *backend) validateVerifier(
+	ctx context.Context,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	l := b.Logger()
+
+	var errs *multierror.Error
+
+	c := v.common()
+	if p := c.PolicyExpression; p != nil && p.Expression != "" {
+		if _, err := p.Compile(); err != nil {
+			errs = multierror.Append(errs, fmt.Errorf("invalid policy: %w", err))
+		}
+	}
+	if err := checkManifestSigner(c.ManifestSigner); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := checkMaxNonces(c.MaxNonces); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := checkInstanceAlias(v, c.InstanceAlias); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if err := checkTokenDelivery(v, c.TokenDelivery); err != nil {
+		errs = multierror.Append(errs, err)
+	}
+	if tv, ok := v.(tpm2Verifier); ok && tv.TPM2Policy() != nil {
+		if err := tpm2.ValidateRebootAction(tv.TPM2Policy().RebootAction); err != nil {
+			errs = multierror.Append(errs, err)
+		}
+	}
+
+	if err := errs.ErrorOrNil(); err != nil {
+		msg := "invalid domain"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"error", err,
+		)
+		return fmt.Errorf("%s: %w", msg, err)
+	}
+
+	return nil
+}
+
+// instanceAlias derives the identifier of the instance that the identity
+// alias is made of (empty when the domain uses single alias for all of its
+// instances).
+func (b *backend) instanceAlias(
+	ctx context.Context,
+	v Verifier,
+	evidence interface{},
+	errs *multierror.Error,
+) (string, *multierror.Error) {
+	source := v.common().InstanceAlias
+	if source == "" || errs.ErrorOrNil() != nil {
+		return "", errs
+	}
+
+	if err := ctx.Err(); err != nil {
+		return "", multierror.Append(errs, err)
+	}
+
+	l := b.Logger()
+
+	av, ok := v.(instanceAliasVerifier)
+	if !ok {
+		return "", multierror.Append(errs, fmt.Errorf("%w: %s", errInstanceAliasInvalid, source))
+	}
+
+	alias, err := av.InstanceAlias(source, evidence)
+	if err != nil {
+		msg := "failed to derive instance alias"
+		l.Error(msg,
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"instance_alias", source,
+			"error", err,
+		)
+		return "", multierror.Append(errs, fmt.Errorf("%s: %w", msg, err))
+	}
+
+	return alias, errs
+}
+
+// checkLoginSource verifies that the unauthenticated request comes from the
+// address that the verifier accepts the nonce and login requests from.
+func (b *backend) checkLoginSource(
+	ctx context.Context,
+	req *logical.Request,
+	v Verifier,
+) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	cidrs := v.common().LoginBoundCIDRs
+	if len(cidrs) == 0 {
+		return nil
+	}
+
+	l := b.Logger()
+
+	remoteAddr := ""
+	if req.Connection != nil {
+		remoteAddr = req.Connection.RemoteAddr
+	}
+	if remoteAddr == "" || !cidrutil.RemoteAddrIsOk(remoteAddr, cidrs) {
+		l.Warn("rejecting request from address outside of login bound cidrs",
+			"attestation_type", v.AttestationType(),
+			"domain", v.GetName(),
+			"remote_addr", remoteAddr,
+		)
+		return fmt.Errorf("%w: %s", errLoginSourceNotAllowed, remoteAddr)
+	}
+
+	return nil
+}
+
+// encodeCommon adds the settings that are shared by all attestation types
+// to the encoded policy.
+func encodeCommon(v Verifier, res map[string]interface{}) {
+	c := v.common()
+	if p := c.PolicyExpression; p != nil {
+		if p.Expression != "" {
+			res["policy"] = p.Expression
+		}
+		if len(p.Values) > 0 {
+			res["policy_values"] = p.Values
+		}
+	}
+	if len(c.ManifestSigner) > 0 {
+		res["manifest_signer"] = c.ManifestSigner.String()
+	}
+	if len(c.LoginBoundCIDRs) > 0 {
+		cidrs := make([]string, 0, len(c.LoginBoundCIDRs))
+		for _, cidr := range c.LoginBoundCIDRs {
+			cidrs = append(cidrs, cidr.String())
+		}
+		res["login_bound_cidrs"] = cidrs
+	}
+	if c.InstanceAlias != "" {
+		res["instance_alias"] = c.InstanceAlias
+	} else {
+		res["instance_alias"] = aliasSourceDomain
+	}
+	if c.TokenDelivery != "" {
+		res["token_delivery"] = c.TokenDelivery
+	} else {
+		res["token_delivery"] = tokenDeliveryCleartext
+	}
+	res["max_nonces"] = c.MaxNonces
+	if c.Template != "" {
+		res["template"] = c.Template
+	}
+	if len(c.Overrides) > 0 {
+		res["overrides"] = c.Overrides
+	}
+}
+
+// evaluatePolicy verifies that the claims of the evidence satisfy the policy
+// expression of the verifier (if any).
+func (b *backend) evaluatePolicy(
+	ctx context.Context,
+	v Verifier,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	if err := ctx.Err(); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	p := v.common().PolicyExpression
+	if p == nil || p.Expression == "" {
+		return errs
+	}
+
+	l := b.Logger()
+
+	l.Debug("evaluating policy",
+		"attestation_type", v.AttestationType(),
+		"domain", v.GetName(),
+	)
+
+	key := v.AttestationType() + "/" + v.GetName()
+	claims := v.Claims(evidence)
+
+	if err := b.claimTDXTCBStatus(ctx, key, p, v, evidence, claims); err != nil {
+		return multierror.Append(errs, err)
+	}
+
+	if err := b.policies.Evaluate(key, p, claims); err != nil {
+		return multierror.Append(errs, fmt.Errorf("policy mismatch: %w", err))
+	}
+
+	return errs
+}
+
+// authenticate validates the totp code of the request (or, for the requests
+// that come from enrolled instances, authenticates the instance and returns
+// its id).
+func (b *backend) authenticate(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+	v Verifier,
+) (string, error) {
+	if iv, ok := v.(instanceVerifier); ok && iv.IsInstanceRequest(data) {
+		return iv.AuthenticateInstance(ctx, req, data)
+	}
+
+	return "", b.validateTOTP(ctx, data, v)
+}
+
+func (b *backend) loginVerifier(
+	ctx context.Context,
+	td TD,
+	instance string,
+	alias string,
+	errs *multierror.Error,
+) (*logical.Response, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	l := b.Logger()
+
+	if err := errs.ErrorOrNil(); err != nil {
+		msg := "failed to login trusted domain"
+		l.Error(msg,
+			"attestation_type", td.AttestationType(),
+			"domain", td.GetName(),
+			"error", err,
+		)
+		return nil, fmt.Errorf("%s: %w", msg, err)
+	}
+
+	auth := &logical.Auth{
+		Metadata: map[string]string{td.AttestationType(): td.GetName()},
+		Alias: &logical.Alias{
+			Name: td.AttestationType() + "/" + td.GetName(),
+			Metadata: map[string]string{
+				"attestation_type": td.AttestationType(),
+				"domain":           td.GetName(),
+			},
+		},
+	}
+	if instance != "" {
+		auth.Metadata["instance"] = instance
+	}
+	if alias != "" { // every instance gets its own alias (and entity)
+		auth.Alias.Name += "/" + alias
+		auth.Metadata["instance_alias"] = alias
+	}
+	td.PopulateTokenAuth(auth)
+
+	return &logical.Response{
+		Auth: auth,
+	}, nil
+}
@@ -0,0 +1,280 @@
+package plugin
+
+import (
+	"context"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx/tdxtest"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/pquerna/otp/totp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	tdxpcs "github.com/google/go-tdx-guest/pcs"
+	tdxtrust "github.com/google/go-tdx-guest/verify/trust"
+)
+
+func TestCheckLoginSource(t *testing.T) {
+	ctx := context.Background()
+
+	const secret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+	for _, endpoint := range []string{"nonce", "login"} {
+		t.Run(endpoint, func(t *testing.T) {
+			t.Parallel()
+
+			b, storage := newTestBackend(t)
+
+			res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/app", map[string]interface{}{
+				"totp_secret":       secret,
+				"login_bound_cidrs": "10.0.0.0/8,192.168.1.1/32",
+			})
+			require.NoError(t, err)
+			require.False(t, res.IsError(), res.Error())
+
+			used := func(code string) bool {
+				_, used := b.totpUsedCodes.Get("tdx/app/totp/" + code)
+				return used
+			}
+
+			// the codes are short-lived, so every request gets the fresh one
+			request := func(remoteAddr string) (string, *logical.Response, error) {
+				code, err := totp.GenerateCodeCustom(secret, time.Now().UTC(), b.totpOptions)
+				require.NoError(t, err)
+
+				req := &logical.Request{
+					Operation: logical.UpdateOperation,
+					Path:      "tdx/app/" + endpoint,
+					Data:      map[string]interface{}{"totp": code},
+					Storage:   storage,
+				}
+				if remoteAddr != "" {
+					req.Connection = &logical.Connection{RemoteAddr: remoteAddr}
+				}
+				res, err := b.HandleRequest(ctx, req)
+				return code, res, err
+			}
+
+			{ // denied before the totp code is even looked at
+				for _, remoteAddr := range []string{"", "172.16.0.1", "192.168.1.2"} {
+					code, res, err := request(remoteAddr)
+					assert.ErrorIs(t, err, logical.ErrInvalidRequest, remoteAddr)
+					require.NotNil(t, res)
+					assert.Equal(t, logical.ErrInvalidRequest.Error(), res.Error().Error())
+					assert.False(t, used(code), remoteAddr)
+				}
+			}
+
+			{ // allowed
+				for _, remoteAddr := range []string{"10.1.2.3", "192.168.1.1"} {
+					code, res, err := request(remoteAddr)
+					if endpoint == "nonce" {
+						require.NoError(t, err, remoteAddr)
+						assert.NotEmpty(t, res.Data["nonce"])
+					} else {
+						// there's no evidence, but the totp code is accepted
+						assert.ErrorIs(t, err, logical.ErrInvalidRequest, remoteAddr)
+					}
+					assert.True(t, used(code), remoteAddr)
+				}
+			}
+		})
+	}
+}
+
+func TestInstanceAlias(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	// quote returns the quote produced on the platform with the ppid
+	quote := func(ppid []byte) *tdx.Quote {
+		p := tdxtest.NewPKI(t, time.Now(), ppid)
+		q, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, make([]byte, 648)))
+		require.NoError(t, err)
+		return q
+	}
+	// alias returns the name of the identity alias the login with the quote
+	// gets
+	alias := func(v Verifier, q *tdx.Quote) (string, error) {
+		instanceAlias, errs := b.instanceAlias(ctx, v, q, b.multierror())
+		res, err := b.loginVerifier(ctx, v, "", instanceAlias, errs)
+		if err != nil {
+			return "", err
+		}
+		return res.Auth.Alias.Name, nil
+	}
+
+	var (
+		ppidA = []byte("platform a ppid.")
+		ppidB = []byte("platform b ppid.")
+	)
+
+	for path, data := range map[string]map[string]interface{}{
+		"tdx/shared":   {},
+		"tdx/instance": {"instance_alias": "ppid"},
+	} {
+		res, err := handle(t, b, storage, "", logical.CreateOperation, path, data)
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	{ // single alias for the whole domain
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "shared")
+		require.NoError(t, err)
+
+		aliasA, err := alias(v, quote(ppidA))
+		require.NoError(t, err)
+		aliasB, err := alias(v, quote(ppidB))
+		require.NoError(t, err)
+		assert.Equal(t, "tdx/shared", aliasA)
+		assert.Equal(t, aliasA, aliasB)
+	}
+
+	{ // every platform gets its own alias
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "instance")
+		require.NoError(t, err)
+
+		aliasA, err := alias(v, quote(ppidA))
+		require.NoError(t, err)
+		aliasB, err := alias(v, quote(ppidB))
+		require.NoError(t, err)
+		assert.Equal(t, "tdx/instance/"+hex.EncodeToString(ppidA), aliasA)
+		assert.Equal(t, "tdx/instance/"+hex.EncodeToString(ppidB), aliasB)
+		assert.NotEqual(t, aliasA, aliasB)
+
+		again, err := alias(v, quote(ppidA)) // same platform, another quote
+		require.NoError(t, err)
+		assert.Equal(t, aliasA, again)
+
+		_, err = alias(v, quote(nil)) // pck certificate without ppid
+		assert.Error(t, err)
+	}
+}
+
+func TestInstanceAliasAK(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	// alias returns the name of the identity alias the login with the
+	// evidence gets
+	alias := func(v Verifier, evidence interface{}) string {
+		instanceAlias, errs := b.instanceAlias(ctx, v, evidence, b.multierror())
+		res, err := b.loginVerifier(ctx, v, "", instanceAlias, errs)
+		require.NoError(t, err)
+		return res.Auth.Alias.Name
+	}
+
+	for _, path := range []string{"tpm2/vm", "tdxtpm2/vm"} { // the domain pins the ak
+		_, err := handle(t, b, storage, "", logical.CreateOperation, path, map[string]interface{}{
+			"tpm2_ak_public": "AAAA",
+			"instance_alias": "ak",
+		})
+		assert.ErrorIs(t, err, errInstanceAliasInvalid, path)
+	}
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "azure-cvm/cvm", map[string]interface{}{
+		"instance_alias": "ak",
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	{ // every cvm brings its own ak with its hcl report
+		v, err := b.loadVerifier(ctx, storage, verifierTypeAzureCVM, "cvm")
+		require.NoError(t, err)
+
+		akA, akB := []byte("ak of instance a"), []byte("ak of instance b")
+		aliasA := alias(v, &azurecvmEvidence{attestation: &attest.PlatformParameters{Public: akA}})
+		aliasB := alias(v, &azurecvmEvidence{attestation: &attest.PlatformParameters{Public: akB}})
+		assert.Equal(t, "azure-cvm/cvm/"+tpm2.AKFingerprint(akA), aliasA)
+		assert.Equal(t, "azure-cvm/cvm/"+tpm2.AKFingerprint(akB), aliasB)
+		assert.NotEqual(t, aliasA, aliasB)
+	}
+
+	res, err = handle(t, b, storage, "", logical.CreateOperation, "tpm2/vm", map[string]interface{}{
+		"tpm2_ak_public": "AAAA",
+		"instance_alias": "ek",
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	{ // tpm2 instances are told apart by their eks
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTPM2, "vm")
+		require.NoError(t, err)
+
+		ak := &attest.PlatformParameters{Public: []byte{0, 0, 0}}
+		ekA, ekB := []byte("ek of instance a"), []byte("ek of instance b")
+		aliasA := alias(v, &tpm2Evidence{attestation: ak, ekPublic: ekA})
+		aliasB := alias(v, &tpm2Evidence{attestation: ak, ekPublic: ekB})
+		assert.Equal(t, "tpm2/vm/"+tpm2.EKFingerprint(ekA), aliasA)
+		assert.Equal(t, "tpm2/vm/"+tpm2.EKFingerprint(ekB), aliasB)
+		assert.NotEqual(t, aliasA, aliasB)
+
+		_, errs := b.instanceAlias(ctx, v, &tpm2Evidence{attestation: ak}, b.multierror())
+		assert.ErrorIs(t, errs.ErrorOrNil(), errInstanceAliasNoEK)
+	}
+}
+
+// countingGetter counts the requests to intel pcs.
+type countingGetter struct {
+	tdxtrust.HTTPSGetter
+	count int
+}
+
+func (g *countingGetter) Get(url string) (map[string][]string, []byte, error) {
+	g.count++
+	return g.HTTPSGetter.Get(url)
+}
+
+func TestTDXTCBStatusClaim(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	p := tdxtest.NewPKI(t, time.Now(), []byte("platform a ppid."))
+	b.tdxRoots = p.Roots
+
+	pcs := &countingGetter{HTTPSGetter: tdxtest.NewPCS(t, p, time.Now(),
+		tdxtest.TCBLevel(tdxpcs.TcbComponentStatusUpToDate, 5),
+		tdxtest.TCBLevel(tdxpcs.TcbComponentStatusOutOfDate, 3),
+	)}
+	b.pcsGetter = pcs
+
+	// quote returns the quote of the tdx module with the tee_tcb_svn
+	quote := func(svn byte) *tdx.Quote {
+		body := make([]byte, 648)
+		body[0] = svn
+		q, err := tdx.ParseQuote(tdxtest.NewQuoteV5(t, p, tdx.BodyTypeTD15, body))
+		require.NoError(t, err)
+		return q
+	}
+
+	for path, data := range map[string]map[string]interface{}{
+		"tdx/current": {"policy": `claims.tdx.tcb_status == "UpToDate"`},
+		"tdx/other":   {"policy": `claims.tdx.mr_td != ""`},
+	} {
+		res, err := handle(t, b, storage, "", logical.CreateOperation, path, data)
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	{ // tcb status is fetched and evaluated
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "current")
+		require.NoError(t, err)
+
+		assert.NoError(t, b.evaluatePolicy(ctx, v, quote(5), b.multierror()).ErrorOrNil())
+		assert.Error(t, b.evaluatePolicy(ctx, v, quote(4), b.multierror()).ErrorOrNil())
+		assert.Equal(t, 2, pcs.count)
+	}
+
+	{ // policy that does not refer to tcb status does not fetch it
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "other")
+		require.NoError(t, err)
+
+		assert.NoError(t, b.evaluatePolicy(ctx, v, quote(4), b.multierror()).ErrorOrNil())
+		assert.Equal(t, 2, pcs.count)
+	}
+}
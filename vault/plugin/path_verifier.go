@@ -0,0 +1,351 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/tokenutil"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpVerifierSynopsys = `
+Manage %s trusted domains that are allowed to authenticate.
+`
+
+const helpVerifierDescription = `
+This endpoint allows you to create, read, update, and delete %s
+trusted domains that are allowed to authenticate.
+`
+
+func pathVerifier(b *backend, vt *verifierType) *framework.Path {
+	path := &framework.Path{
+		Pattern:         vt.attestationType + "/" + framework.GenericNameRegex("name"),
+		HelpSynopsis:    fmt.Sprintf(helpVerifierSynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierDescription, vt.title),
+
+		ExistenceCheck: b.pathVerifierExists(vt),
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			// TOTP
+
+			"totp_secret": {
+				Type:        framework.TypeString,
+				Description: "Secret used to generate TOTP codes",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "TOTP secret",
+					Description: "Secret used to generate TOTP codes (can only be set, and is never shown in the UI)",
+					Sensitive:   true,
+				},
+			},
+
+			// Policy
+
+			"policy": {
+				Type:        framework.TypeString,
+				Description: "CEL expression over the attestation claims that must evaluate to true (empty value removes the policy)",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Policy",
+					Description: "CEL expression over the attestation claims (e.g. `claims.tdx.rtmr[3] in allowed_rtmr3`) that must evaluate to true",
+					EditType:    "textarea",
+				},
+			},
+
+			"policy_values": {
+				Type:        framework.TypeKVPairs,
+				Description: "Named lists of comma-separated values that policy expression can refer to",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Policy values",
+					Description: "Named lists of comma-separated values (e.g. `allowed_rtmr3=<base64>,<base64>`) that policy expression can refer to",
+				},
+			},
+
+			// Template
+
+			"template": {
+				Type:        framework.TypeString,
+				Description: "Name of the template that the domain inherits the values of the fields from (empty value removes it)",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Template",
+					Description: "Name of the template that the domain inherits the values of the fields from (the fields set by the domain override the template)",
+				},
+			},
+
+			"inherit": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "Fields that the domain stops overriding (and inherits from the template again)",
+			},
+
+			// Login restrictions
+
+			"login_bound_cidrs": {
+				Type:        framework.TypeCommaStringSlice,
+				Description: "CIDR blocks that the nonce and login requests of the domain are accepted from (empty value removes the restriction)",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Login bound CIDRs",
+					Description: "CIDR blocks that the nonce and login requests of the domain are accepted from (the requests from other addresses are rejected before any TOTP or attestation checks)",
+				},
+			},
+
+			// Identity
+
+			"instance_alias": {
+				Type:        framework.TypeString,
+				Description: "Source of the per-instance identifier that the identity alias is derived from (domain, instance_key, ppid, or ak)",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Instance alias",
+					Description: "Source of the per-instance identifier that the identity alias is derived from: domain (single alias for all instances), instance_key (id of enrolled TDX instance key), ppid (platform provisioning id of TDX platform), or ak (fingerprint of vTPM attestation key of Azure CVM)",
+				},
+			},
+
+			// Token delivery
+
+			"token_delivery": {
+				Type:        framework.TypeString,
+				Description: "Way the token is delivered to the client upon login (cleartext, or wrapped)",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Token delivery",
+					Description: "Way the token is delivered to the client upon login: cleartext (as-is), or wrapped (in the single-use response-wrapping token that is valid for one minute)",
+				},
+			},
+
+			"max_nonces": {
+				Type:        framework.TypeInt,
+				Description: fmt.Sprintf("Limit of the outstanding nonces of the domain (zero means the default of %d, at most %d)", globals.MaxDomainNonces, globals.MaxDomainNoncesLimit),
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Max nonces",
+					Description: fmt.Sprintf("Limit of the outstanding nonces of the domain, when it's reached the oldest nonce is evicted (zero means the default of %d, at most %d)", globals.MaxDomainNonces, globals.MaxDomainNoncesLimit),
+				},
+			},
+
+			// Manifests
+
+			"manifest_signer": {
+				Type:        framework.TypeString,
+				Description: "Public key of the signer of reference-value manifests that the domain trusts (empty value removes it)",
+
+				DisplayAttrs: &framework.DisplayAttributes{
+					Name:        "Manifest signer",
+					Description: "Public key of the signer of reference-value manifests that the domain trusts (base64-encoded ed25519 key)",
+				},
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: vt.attestationType + "-op-prefix",
+			OperationSuffix: vt.attestationType,
+			Action:          "Create",
+			ItemType:        vt.itemType,
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.CreateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierUpsert(vt),
+			},
+
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierUpsert(vt),
+			},
+
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathVerifierRead(vt),
+			},
+
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathVerifierDelete(vt),
+			},
+		},
+	}
+
+	for k, v := range vt.new(b).Fields() {
+		path.Fields[k] = v
+	}
+
+	tokenutil.AddTokenFields(path.Fields)
+
+	return path
+}
+
+func pathVerifierList(b *backend, vt *verifierType) *framework.Path {
+	return &framework.Path{
+		Pattern:         vt.attestationType + "/?",
+		HelpSynopsis:    fmt.Sprintf(helpVerifierSynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierDescription, vt.title),
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathVerifierList(vt),
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: vt.attestationType + "-op-prefix",
+			OperationSuffix: vt.attestationType,
+			ItemType:        vt.itemType,
+			Navigation:      true,
+		},
+	}
+}
+
+func (b *backend) pathVerifierExists(
+	vt *verifierType,
+) framework.ExistenceFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (bool, error) {
+		v, err := b.loadVerifier(ctx, req.Storage, vt, data.Get("name").(string))
+		if err != nil {
+			return false, err
+		}
+		return v != nil, nil
+	}
+}
+
+func (b *backend) pathVerifierUpsert(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		current, err := b.loadVerifier(ctx, req.Storage, vt, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if current != nil {
+			current.SetName(name)
+		}
+
+		v, isNew, err := b.upsertVerifier(ctx, req, data, vt, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		if err := b.parseTokenFields(ctx, req, data, v); err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		if v.GetTOTPSecret() == "" {
+			if err := b.generateTOTPSecret(ctx, v); err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+		}
+
+		pending, err := b.proposeVerifier(ctx, req, current, v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if pending {
+			resp, err := b.pendingResponse(ctx, current, v)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			if isNew { // show totp secret only when creating
+				resp.Data["totp_secret"] = v.GetTOTPSecret()
+			}
+			return resp, nil
+		}
+
+		_data, err := b.encodeResolved(ctx, req, vt, v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if isNew { // show totp secret only when creating
+			_data["totp_secret"] = v.GetTOTPSecret()
+		}
+		return &logical.Response{
+			Data: _data,
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierRead(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		v, err := b.fetchVerifier(ctx, req, vt, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		_data, err := b.encodeResolved(ctx, req, vt, v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		return &logical.Response{
+			Data: _data,
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierDelete(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		if err := b.removeVerifier(ctx, req, vt, data.Get("name").(string)); err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *backend) pathVerifierList(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		tds, err := b.listVerifiers(ctx, req.Storage, vt)
+
+		if err != nil {
+			msg := "failed to list domains"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		return logical.ListResponse(tds), nil
+	}
+}
@@ -0,0 +1,279 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpVerifierHistorySynopsys = `
+Show the history of %s trusted domain configuration.
+`
+
+const helpVerifierHistoryDescription = `
+This endpoint lists the versions of %s trusted domain configuration (with the
+time of the change, and the entity that requested it), shows the
+configuration of a specific version, or the difference between two versions.
+`
+
+const helpVerifierRollbackSynopsys = `
+Restore the configuration of %s trusted domain from its history.
+`
+
+const helpVerifierRollbackDescription = `
+This endpoint restores the configuration of %s trusted domain as it was in
+the specified version (the rollback itself is recorded as a new version).
+`
+
+func pathVerifierHistory(b *backend, vt *verifierType) *framework.Path {
+	return &framework.Path{
+		Pattern:         vt.attestationType + "/" + framework.GenericNameRegex("name") + "/history",
+		HelpSynopsis:    fmt.Sprintf(helpVerifierHistorySynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierHistoryDescription, vt.title),
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			"version": {
+				Type:        framework.TypeInt,
+				Description: "Version to show",
+				Query:       true,
+			},
+
+			"from": {
+				Type:        framework.TypeInt,
+				Description: "Version to show the difference from",
+				Query:       true,
+			},
+
+			"to": {
+				Type:        framework.TypeInt,
+				Description: "Version to show the difference to",
+				Query:       true,
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: vt.attestationType + "-op-prefix",
+			OperationSuffix: vt.attestationType + "-history",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathVerifierHistoryRead(vt),
+			},
+		},
+	}
+}
+
+func pathVerifierRollback(b *backend, vt *verifierType) *framework.Path {
+	return &framework.Path{
+		Pattern:         vt.attestationType + "/" + framework.GenericNameRegex("name") + "/rollback",
+		HelpSynopsis:    fmt.Sprintf(helpVerifierRollbackSynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierRollbackDescription, vt.title),
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			"version": {
+				Type:        framework.TypeInt,
+				Description: "Version to restore",
+				Required:    true,
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: vt.attestationType + "-op-prefix",
+			OperationSuffix: vt.attestationType + "-rollback",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierRollback(vt),
+			},
+		},
+	}
+}
+
+func (b *backend) pathVerifierHistoryRead(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		td := vt.new(b)
+		td.SetName(name)
+
+		if version := data.Get("version").(int); version > 0 {
+			stored, v, err := b.fetchVersion(ctx, req, vt, td, version)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			domain, err := b.encodeVersion(ctx, v)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			_data := encodeVersionInfo(stored)
+			_data["domain"] = domain
+			return &logical.Response{
+				Data: _data,
+			}, nil
+		}
+
+		from, to := data.Get("from").(int), data.Get("to").(int)
+		if from > 0 || to > 0 {
+			_, vFrom, err := b.fetchVersion(ctx, req, vt, td, from)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			_, vTo, err := b.fetchVersion(ctx, req, vt, td, to)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			encodedFrom, err := b.encodeVersion(ctx, vFrom)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			encodedTo, err := b.encodeVersion(ctx, vTo)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			return &logical.Response{
+				Data: map[string]interface{}{
+					"from": from,
+					"to":   to,
+					"diff": diffVersions(encodedFrom, encodedTo),
+				},
+			}, nil
+		}
+
+		versions, err := b.listVersions(ctx, req.Storage, td)
+		if err != nil {
+			msg := "failed to list versions"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", name,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		_versions := make([]map[string]interface{}, 0, len(versions))
+		for _, version := range versions {
+			stored, err := b.loadVersion(ctx, req.Storage, td, version)
+			if err != nil {
+				msg := "failed to fetch version from storage"
+				l.Error(msg,
+					"attestation_type", vt.attestationType,
+					"domain", name,
+					"version", version,
+					"error", err,
+				)
+				return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+			}
+			if stored != nil {
+				_versions = append(_versions, encodeVersionInfo(stored))
+			}
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"versions": _versions,
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierRollback(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		// the domain must still exist
+		current, err := b.fetchVerifier(ctx, req, vt, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		td := vt.new(b)
+		td.SetName(name)
+
+		version := data.Get("version").(int)
+		_, v, err := b.fetchVersion(ctx, req, vt, td, version)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		// history does not keep totp secrets
+		v.SetTOTPSecret(current.GetTOTPSecret())
+
+		l.Info("rolling back domain",
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"version", version,
+			"entity_id", req.EntityID,
+		)
+
+		pending, err := b.proposeVerifier(ctx, req, current, v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if pending {
+			resp, err := b.pendingResponse(ctx, current, v)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+			return resp, nil
+		}
+
+		_data, err := b.encodeVersion(ctx, v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		return &logical.Response{
+			Data: _data,
+		}, nil
+	}
+}
+
+func encodeVersionInfo(v *verifierVersion) map[string]interface{} {
+	createdAt := ""
+	if !v.CreatedAt.IsZero() {
+		createdAt = v.CreatedAt.Format(time.RFC3339)
+	}
+
+	return map[string]interface{}{
+		"version":      v.Version,
+		"created_at":   createdAt,
+		"entity_id":    v.EntityID,
+		"display_name": v.DisplayName,
+		"path":         v.Path,
+	}
+}
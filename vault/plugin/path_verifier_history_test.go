@@ -0,0 +1,180 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTOTPSecret = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+
+// assertNoTOTPSecretInHistory checks that none of the stored versions of the
+// domain carry the totp secret.
+func assertNoTOTPSecretInHistory(t *testing.T, storage logical.Storage, td TD) {
+	ctx := context.Background()
+
+	keys, err := storage.List(ctx, historyPrefix(td))
+	require.NoError(t, err)
+	require.NotEmpty(t, keys)
+
+	for _, key := range keys {
+		entry, err := storage.Get(ctx, historyPrefix(td)+key)
+		require.NoError(t, err)
+		assert.NotContains(t, string(entry.Value), testTOTPSecret, key)
+		assert.NotContains(t, string(entry.Value), "totp_secret", key)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	mrtd := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{0x01}, 48))
+
+	for _, data := range []map[string]interface{}{
+		{"totp_secret": testTOTPSecret},
+		{"tdx_mr_td": mrtd},
+		{"tdx_check_debug": false},
+	} {
+		res, err := handle(t, b, storage, "admin", logical.UpdateOperation, "tdx/test", data)
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	td := verifierTypeTDX.new(b)
+	td.SetName("test")
+	assertNoTOTPSecretInHistory(t, storage, td)
+
+	{ // list
+		res, err := handle(t, b, storage, "", logical.ReadOperation, "tdx/test/history", nil)
+		require.NoError(t, err)
+		versions := res.Data["versions"].([]map[string]interface{})
+		require.Len(t, versions, 3)
+		for idx, version := range versions {
+			assert.Equal(t, idx+1, version["version"])
+			assert.Equal(t, "admin", version["entity_id"])
+			assert.Equal(t, "tdx/test", version["path"])
+			assert.NotEmpty(t, version["created_at"])
+		}
+	}
+
+	{ // version
+		res, err := handle(t, b, storage, "", logical.ReadOperation, "tdx/test/history", map[string]interface{}{
+			"version": 2,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 2, res.Data["version"])
+		domain := res.Data["domain"].(map[string]interface{})
+		assert.NotEmpty(t, domain["tdx_mr_td"])
+		assert.Equal(t, true, domain["tdx_check_debug"])
+		assert.NotContains(t, domain, "totp_secret")
+	}
+
+	{ // missing version
+		_, err := handle(t, b, storage, "", logical.ReadOperation, "tdx/test/history", map[string]interface{}{
+			"version": 42,
+		})
+		assert.ErrorIs(t, err, errVersionNotFound)
+	}
+
+	{ // diff
+		res, err := handle(t, b, storage, "", logical.ReadOperation, "tdx/test/history", map[string]interface{}{
+			"from": 1,
+			"to":   3,
+		})
+		require.NoError(t, err)
+		diff := res.Data["diff"].(map[string]interface{})
+		assert.Contains(t, diff, "tdx_mr_td")
+		assert.Contains(t, diff, "tdx_check_debug")
+		assert.Equal(t, map[string]interface{}{"from": true, "to": false}, diff["tdx_check_debug"])
+		assert.NotContains(t, diff, "tdx_check_sept_ve_disable")
+	}
+
+	{ // rollback
+		res, err := handle(t, b, storage, "admin", logical.UpdateOperation, "tdx/test/rollback", map[string]interface{}{
+			"version": 1,
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError())
+
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "test")
+		require.NoError(t, err)
+		assert.Nil(t, v.(*verifierTDX).MrTD)
+		assert.True(t, v.(*verifierTDX).CheckDebug)
+		assert.Equal(t, testTOTPSecret, v.GetTOTPSecret()) // secret is kept
+
+		versions, err := b.listVersions(ctx, storage, td)
+		require.NoError(t, err)
+		assert.Equal(t, []int{1, 2, 3, 4}, versions)
+		assertNoTOTPSecretInHistory(t, storage, td)
+	}
+
+	{ // rollback to missing version
+		_, err := handle(t, b, storage, "admin", logical.UpdateOperation, "tdx/test/rollback", map[string]interface{}{
+			"version": 42,
+		})
+		assert.ErrorIs(t, err, errVersionNotFound)
+	}
+
+	{ // delete purges history
+		_, err := handle(t, b, storage, "admin", logical.DeleteOperation, "tdx/test", nil)
+		require.NoError(t, err)
+
+		keys, err := storage.List(ctx, historyPrefix(td))
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	}
+}
+
+func TestHistorySize(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	for idx := 0; idx < globals.DomainHistorySize+5; idx++ {
+		res, err := handle(t, b, storage, "", logical.UpdateOperation, "tdx/test", map[string]interface{}{
+			"tdx_check_debug": idx%2 == 0,
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError())
+	}
+
+	td := verifierTypeTDX.new(b)
+	td.SetName("test")
+
+	versions, err := b.listVersions(ctx, storage, td)
+	require.NoError(t, err)
+	require.Len(t, versions, globals.DomainHistorySize)
+	assert.Equal(t, 6, versions[0])
+	assert.Equal(t, globals.DomainHistorySize+5, versions[len(versions)-1])
+}
+
+func TestHistoryLegacyDomain(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	// domain that was configured before the history was introduced
+	legacy := `{"name":"test","totp_secret":"` + testTOTPSecret + `","tdx_check_debug":true}`
+	require.NoError(t, storage.Put(ctx, &logical.StorageEntry{
+		Key:   "tdx/test",
+		Value: []byte(legacy),
+	}))
+
+	td := verifierTypeTDX.new(b)
+	td.SetName("test")
+	require.NoError(t, b.recordVersion(ctx, &logical.Request{Storage: storage}, td))
+
+	versions, err := b.listVersions(ctx, storage, td)
+	require.NoError(t, err)
+	assert.Equal(t, []int{1, 2}, versions)
+
+	stored, err := b.loadVersion(ctx, storage, td, 1)
+	require.NoError(t, err)
+	assert.Contains(t, string(stored.Domain), "tdx_check_debug")
+	assertNoTOTPSecretInHistory(t, storage, td)
+}
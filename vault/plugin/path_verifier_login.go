@@ -0,0 +1,138 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathVerifierLogin(b *backend, vt *verifierType) *framework.Path {
+	path := &framework.Path{
+		Pattern:         vt.attestationType + "/" + framework.GenericNameRegex("name") + "/login",
+		HelpSynopsis:    vt.helpLoginSynopsys,
+		HelpDescription: vt.helpLoginDescription,
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			"totp": {
+				Type:        framework.TypeString,
+				Description: "TOTP code",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierLogin(vt),
+			},
+			logical.AliasLookaheadOperation: &framework.PathOperation{
+				Callback: b.pathVerifierAliasLookahead(vt),
+			},
+		},
+	}
+
+	for k, v := range vt.new(b).LoginFields() {
+		path.Fields[k] = v
+	}
+
+	return path
+}
+
+func (b *backend) pathVerifierAliasLookahead(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		// per-instance aliases are only known once the evidence is verified
+		v, err := b.loadVerifier(ctx, req.Storage, vt, name)
+		if err == nil && v != nil && v.common().InstanceAlias != "" {
+			return nil, nil
+		}
+
+		return &logical.Response{
+			Auth: &logical.Auth{
+				Alias: &logical.Alias{Name: vt.attestationType + "/" + name},
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierLogin(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		return b.sanitise(func() (*logical.Response, error) {
+			name, err := b.getName(ctx, data)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			v, err := b.fetchResolvedVerifier(ctx, req, vt, name)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			err = b.checkLoginSource(ctx, req, v)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			instance, err := b.authenticate(ctx, req, data, v)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			evidence, nonce, err := v.ParseEvidence(ctx, req, data)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			err = b.validateNonce(ctx, b.nonces, v, nonce)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			if instance != "" { // there's no totp code to prevent the replays
+				err = b.consumeNonce(ctx, b.nonces, v, nonce)
+				if err != nil {
+					return logical.ErrorResponse(err.Error()), err
+				}
+			}
+
+			errs := v.Validate(ctx, evidence, nonce, b.multierror())
+			errs = b.matchVerifier(ctx, req, vt, v, evidence, errs)
+			errs = b.evaluatePolicy(ctx, v, evidence, errs)
+
+			clock, errs := b.checkTPM2Clock(ctx, req, v, evidence, errs)
+			alias, errs := b.instanceAlias(ctx, v, evidence, errs)
+
+			auth, err := b.loginVerifier(ctx, v, instance, alias, errs)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			err = b.recordTPM2Clock(ctx, req, v, clock)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			return b.wrapToken(v, auth), nil
+		})
+	}
+}
@@ -0,0 +1,281 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/manifest"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpVerifierManifestSynopsys = `
+Manage signed manifests of reference values of %s trusted domains.
+`
+
+const helpVerifierManifestDescription = `
+This endpoint allows you to upload, list, read, and delete the manifests of
+reference values (signed by the manifest signer that %s trusted domain
+trusts). Logins of the domain are matched against any valid, unexpired
+manifest.
+`
+
+func pathVerifierManifest(b *backend, vt *verifierType) *framework.Path {
+	return &framework.Path{
+		Pattern: vt.attestationType + "/" + framework.GenericNameRegex("name") + "/manifest/" +
+			framework.GenericNameRegex("image") + "/" + framework.GenericNameRegex("version"),
+		HelpSynopsis:    fmt.Sprintf(helpVerifierManifestSynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierManifestDescription, vt.title),
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			"image": {
+				Type:        framework.TypeString,
+				Description: "Image name of the manifest",
+			},
+
+			"version": {
+				Type:        framework.TypeString,
+				Description: "Image version of the manifest",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: vt.attestationType + "-op-prefix",
+			OperationSuffix: vt.attestationType + "-manifest",
+			ItemType:        vt.itemType + " manifest",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathVerifierManifestRead(vt),
+			},
+
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathVerifierManifestDelete(vt),
+			},
+		},
+	}
+}
+
+func pathVerifierManifestList(b *backend, vt *verifierType) *framework.Path {
+	return &framework.Path{
+		Pattern:         vt.attestationType + "/" + framework.GenericNameRegex("name") + "/manifest/?",
+		HelpSynopsis:    fmt.Sprintf(helpVerifierManifestSynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierManifestDescription, vt.title),
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			"manifest": {
+				Type:        framework.TypeString,
+				Description: "JSON-encoded manifest (base64-encoded)",
+			},
+
+			"signature": {
+				Type:        framework.TypeString,
+				Description: "Ed25519 signature of the manifest (base64-encoded)",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: vt.attestationType + "-op-prefix",
+			OperationSuffix: vt.attestationType + "-manifests",
+			ItemType:        vt.itemType + " manifest",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierManifestUpload(vt),
+			},
+
+			logical.ListOperation: &framework.PathOperation{
+				Callback: b.pathVerifierManifestList(vt),
+			},
+		},
+	}
+}
+
+func (b *backend) pathVerifierManifestUpload(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		v, err := b.fetchVerifier(ctx, req, vt, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		raw, err := base64.StdEncoding.DecodeString(data.Get("manifest").(string))
+		if err != nil {
+			err = fmt.Errorf("manifest is not encoded as base64 string: %w", err)
+			return logical.ErrorResponse(err.Error()), err
+		}
+		signature, err := base64.StdEncoding.DecodeString(data.Get("signature").(string))
+		if err != nil {
+			err = fmt.Errorf("signature is not encoded as base64 string: %w", err)
+			return logical.ErrorResponse(err.Error()), err
+		}
+		signed := &manifest.Signed{
+			Manifest:  raw,
+			Signature: signature,
+		}
+
+		m, _, err := b.openManifest(ctx, vt, v, signed)
+		if err != nil {
+			msg := "invalid manifest"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", name,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		if err := b.saveManifest(ctx, req.Storage, v, m.ID(), signed); err != nil {
+			msg := "failed to push manifest into storage"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", name,
+				"manifest", m.ID(),
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		return &logical.Response{
+			Data: encodeManifest(m),
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierManifestRead(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		v, err := b.fetchVerifier(ctx, req, vt, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		id := data.Get("image").(string) + "/" + data.Get("version").(string)
+
+		signed, err := b.loadManifest(ctx, req.Storage, v, id)
+		if err != nil {
+			msg := "failed to fetch manifest from storage"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", name,
+				"manifest", id,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+		if signed == nil {
+			return nil, nil
+		}
+
+		m, _, err := b.openManifest(ctx, vt, v, signed)
+		if err != nil {
+			msg := "invalid manifest"
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		return &logical.Response{
+			Data: encodeManifest(m),
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierManifestDelete(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		td := vt.new(b)
+		td.SetName(data.Get("name").(string))
+
+		id := data.Get("image").(string) + "/" + data.Get("version").(string)
+
+		l.Debug("deleting manifest",
+			"attestation_type", vt.attestationType,
+			"domain", td.GetName(),
+			"manifest", id,
+		)
+
+		if err := b.deleteManifest(ctx, req.Storage, td, id); err != nil {
+			msg := "failed to delete manifest"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", td.GetName(),
+				"manifest", id,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		return nil, nil
+	}
+}
+
+func (b *backend) pathVerifierManifestList(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		td := vt.new(b)
+		td.SetName(data.Get("name").(string))
+
+		ids, err := b.listManifests(ctx, req.Storage, td)
+		if err != nil {
+			msg := "failed to list manifests"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", td.GetName(),
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		return logical.ListResponse(ids), nil
+	}
+}
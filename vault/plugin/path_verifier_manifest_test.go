@@ -0,0 +1,76 @@
+package plugin
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"testing"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/manifest"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManifestReferenceValues(t *testing.T) {
+	t.Parallel()
+
+	b, storage := newTestBackend(t)
+
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/app", map[string]interface{}{
+		"manifest_signer": base64.StdEncoding.EncodeToString(public),
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	// upload signs the manifest with the reference values and uploads it
+	upload := func(version string, values map[string]interface{}) (*logical.Response, error) {
+		signed, err := manifest.Sign(&manifest.Manifest{
+			Image:           "app",
+			Version:         version,
+			ExpiresAt:       time.Now().Add(time.Hour),
+			ReferenceValues: values,
+		}, private)
+		require.NoError(t, err)
+
+		return handle(t, b, storage, "", logical.UpdateOperation, "tdx/app/manifest", map[string]interface{}{
+			"manifest":  base64.StdEncoding.EncodeToString(signed.Manifest),
+			"signature": base64.StdEncoding.EncodeToString(signed.Signature),
+		})
+	}
+
+	{ // measurements
+		res, err := upload("1.0.0", map[string]interface{}{
+			"tdx_mr_td": base64.StdEncoding.EncodeToString(make([]byte, 48)),
+			"tdx_rtmr1": base64.StdEncoding.EncodeToString(make([]byte, 48)),
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	{ // manifest can not relax the checks of the policy
+		res, err := upload("1.0.1", map[string]interface{}{
+			"tdx_mr_td":       base64.StdEncoding.EncodeToString(make([]byte, 48)),
+			"tdx_check_debug": false,
+		})
+		assert.ErrorIs(t, err, errReferenceValueNotMeasurement)
+		if assert.NotNil(t, res) {
+			assert.True(t, res.IsError())
+		}
+
+		res, err = handle(t, b, storage, "", logical.ListOperation, "tdx/app/manifest", nil)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"app/1.0.0"}, res.Data["keys"])
+	}
+
+	{ // unknown fields
+		_, err := upload("1.0.2", map[string]interface{}{
+			"tdx_mr_unknown": "",
+		})
+		assert.ErrorIs(t, err, errReferenceValueNotMeasurement)
+	}
+}
@@ -0,0 +1,125 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpVerifierNonceSynopsys = `
+Generate %s attestation nonce.
+`
+
+const helpVerifierNonceDescription = `
+Request vault to generate a %s attestation nonce that client will need to
+include into the attestation evidence in order to complete the authentication
+sequence.
+`
+
+func pathVerifierNonce(b *backend, vt *verifierType) *framework.Path {
+	path := &framework.Path{
+		Pattern:         vt.attestationType + "/" + framework.GenericNameRegex("name") + "/nonce",
+		HelpSynopsis:    fmt.Sprintf(helpVerifierNonceSynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierNonceDescription, vt.title),
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			"totp": {
+				Type:        framework.TypeString,
+				Description: "TOTP code",
+			},
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.CreateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierNonceGenerate(vt),
+			},
+
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierNonceGenerate(vt),
+			},
+		},
+
+		ExistenceCheck: func(ctx context.Context, r *logical.Request, fd *framework.FieldData) (bool, error) {
+			return false, nil
+		},
+	}
+
+	if iv, ok := vt.new(b).(instanceVerifier); ok {
+		for k, v := range iv.NonceFields() {
+			path.Fields[k] = v
+		}
+	}
+
+	return path
+}
+
+func (b *backend) pathVerifierNonceGenerate(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		return b.sanitise(func() (*logical.Response, error) {
+			name, err := b.getName(ctx, data)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			v, err := b.fetchResolvedVerifier(ctx, req, vt, name)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			err = b.checkLoginSource(ctx, req, v)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			nonces, limit := b.nonces, v.common().nonceLimit()
+
+			// enrolled instances authenticate with their keys instead of totp
+			// codes, while the ones that are about to enroll have nothing to
+			// authenticate with (so their nonces are kept apart, and can
+			// only be used for the enrollment)
+			if iv, ok := v.(instanceVerifier); ok && iv.IsInstanceRequest(data) {
+				instance, err := iv.AuthenticateNonceRequest(ctx, req, data)
+				if err != nil {
+					return logical.ErrorResponse(err.Error()), err
+				}
+				if instance == "" {
+					nonces, limit = b.enrollNonces, globals.MaxDomainEnrollNonces
+				}
+			} else {
+				err = b.validateTOTP(ctx, data, v)
+				if err != nil {
+					return logical.ErrorResponse(err.Error()), err
+				}
+			}
+
+			nonce, err := b.generateNonce(ctx, nonces, v, v.NonceSize(), limit)
+			if err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+
+			_data := v.NonceData()
+			if _data == nil {
+				_data = make(map[string]interface{}, 1)
+			}
+			_data["nonce"] = nonce
+
+			return &logical.Response{
+				Data: _data,
+			}, nil
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpVerifierPendingSynopsys = `
+Review, approve, or reject the pending change of %s trusted domain.
+`
+
+const helpVerifierPendingDescription = `
+When the mount requires approval, the changes of measurements and of other
+pre-auth settings of %s trusted domain are kept pending until another entity
+approves them. This endpoint shows the pending change (and what it changes,
+together with its digest), approves it (on write, with the digest of the
+reviewed change), or rejects it (on delete).
+`
+
+func pathVerifierPending(b *backend, vt *verifierType) *framework.Path {
+	return &framework.Path{
+		Pattern:         vt.attestationType + "/" + framework.GenericNameRegex("name") + "/pending",
+		HelpSynopsis:    fmt.Sprintf(helpVerifierPendingSynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierPendingDescription, vt.title),
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			"digest": {
+				Type:        framework.TypeString,
+				Description: "Digest of the reviewed pending change (as shown on read), required on approval",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: vt.attestationType + "-op-prefix",
+			OperationSuffix: vt.attestationType + "-pending",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathVerifierPendingRead(vt),
+			},
+
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierPendingApprove(vt),
+			},
+
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathVerifierPendingReject(vt),
+			},
+		},
+	}
+}
+
+func (b *backend) pathVerifierPendingRead(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		p, v, err := b.fetchPending(ctx, req, vt, name)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		stale, current, err := b.isPendingStale(ctx, req, vt, name, p)
+		if err != nil {
+			msg := "failed to fetch domain from storage"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", name,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		changes, err := b.pendingChanges(ctx, current, v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		digest, err := p.digest()
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"created_at":   p.CreatedAt.Format(time.RFC3339),
+				"entity_id":    p.EntityID,
+				"display_name": p.DisplayName,
+				"path":         p.Path,
+				"stale":        stale,
+				"changes":      changes,
+				"digest":       digest,
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierPendingApprove(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		v, err := b.approvePending(ctx, req, vt, name, data.Get("digest").(string))
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		_data, err := b.encodeVersion(ctx, v)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		return &logical.Response{
+			Data: _data,
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierPendingReject(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		td := vt.new(b)
+		td.SetName(name)
+
+		if err := b.purgePending(ctx, req, td); err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		l.Info("rejected change of domain",
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"entity_id", req.EntityID,
+		)
+
+		return nil, nil
+	}
+}
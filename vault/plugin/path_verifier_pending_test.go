@@ -0,0 +1,224 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// requireApproval switches the approval of the changes on (or off).
+func requireApproval(t *testing.T, b *backend, storage logical.Storage, on bool) {
+	res, err := handle(t, b, storage, "", logical.UpdateOperation, "config", map[string]interface{}{
+		"require_approval": on,
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError())
+}
+
+// pendingDigest returns the digest of the pending change shown on read.
+func pendingDigest(t *testing.T, b *backend, storage logical.Storage, path string) string {
+	res, err := handle(t, b, storage, "bob", logical.ReadOperation, path, nil)
+	require.NoError(t, err)
+	digest, ok := res.Data["digest"].(string)
+	require.True(t, ok)
+	require.NotEmpty(t, digest)
+	return digest
+}
+
+func TestPendingVerifier(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	requireApproval(t, b, storage, true)
+
+	checkDebug := func() *bool {
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "test")
+		require.NoError(t, err)
+		if v == nil {
+			return nil
+		}
+		res := v.(*verifierTDX).CheckDebug
+		return &res
+	}
+
+	propose := func(entityID string, data map[string]interface{}) {
+		res, err := handle(t, b, storage, entityID, logical.UpdateOperation, "tdx/test", data)
+		require.NoError(t, err)
+		require.Equal(t, true, res.Data["pending"])
+	}
+
+	approve := func(entityID, digest string) error {
+		_, err := handle(t, b, storage, entityID, logical.UpdateOperation, "tdx/test/pending", map[string]interface{}{
+			"digest": digest,
+		})
+		return err
+	}
+
+	propose("alice", map[string]interface{}{"tdx_check_debug": false})
+	assert.Nil(t, checkDebug()) // creation waits for approval too
+
+	digest := pendingDigest(t, b, storage, "tdx/test/pending")
+
+	{ // self-approval
+		assert.ErrorIs(t, approve("alice", digest), errPendingSameEntity)
+		assert.Nil(t, checkDebug())
+	}
+
+	{ // token without entity
+		assert.ErrorIs(t, approve("", digest), errPendingNoEntity)
+		assert.Nil(t, checkDebug())
+	}
+
+	{ // no digest
+		assert.Error(t, approve("bob", ""))
+		assert.Nil(t, checkDebug())
+	}
+
+	{ // change is replaced between the review and the approval
+		propose("alice", map[string]interface{}{"tdx_check_debug": true})
+		assert.ErrorIs(t, approve("bob", digest), errPendingReplaced)
+		assert.Nil(t, checkDebug())
+	}
+
+	{ // approval of the reviewed change
+		digest := pendingDigest(t, b, storage, "tdx/test/pending")
+		require.NoError(t, approve("bob", digest))
+		require.NotNil(t, checkDebug())
+		assert.True(t, *checkDebug())
+
+		_, err := handle(t, b, storage, "bob", logical.ReadOperation, "tdx/test/pending", nil)
+		assert.ErrorIs(t, err, errPendingNotFound)
+	}
+
+	{ // domain is changed after the change was requested
+		propose("alice", map[string]interface{}{"tdx_check_debug": false})
+		digest := pendingDigest(t, b, storage, "tdx/test/pending")
+
+		requireApproval(t, b, storage, false)
+		res, err := handle(t, b, storage, "carol", logical.UpdateOperation, "tdx/test", map[string]interface{}{
+			"tdx_check_sept_ve_disable": false,
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError())
+		requireApproval(t, b, storage, true)
+
+		res, err = handle(t, b, storage, "bob", logical.ReadOperation, "tdx/test/pending", nil)
+		require.NoError(t, err)
+		assert.Equal(t, true, res.Data["stale"])
+
+		assert.ErrorIs(t, approve("bob", digest), errPendingStale)
+		assert.True(t, *checkDebug())
+	}
+
+	{ // rejection
+		_, err := handle(t, b, storage, "bob", logical.DeleteOperation, "tdx/test/pending", nil)
+		require.NoError(t, err)
+
+		_, err = handle(t, b, storage, "bob", logical.ReadOperation, "tdx/test/pending", nil)
+		assert.ErrorIs(t, err, errPendingNotFound)
+	}
+}
+
+func TestPendingTemplate(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+	requireApproval(t, b, storage, true)
+
+	propose := func(entityID string, checkDebug bool) {
+		res, err := handle(t, b, storage, entityID, logical.UpdateOperation, "template/firmware", map[string]interface{}{
+			"attestation_type": "tdx",
+			"tdx_check_debug":  checkDebug,
+		})
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+	}
+
+	approve := func(entityID, digest string) error {
+		_, err := handle(t, b, storage, entityID, logical.UpdateOperation, "template/firmware/pending", map[string]interface{}{
+			"digest": digest,
+		})
+		return err
+	}
+
+	template := func() *domainTemplate {
+		tmpl, err := b.loadTemplate(ctx, storage, "firmware")
+		require.NoError(t, err)
+		return tmpl
+	}
+
+	propose("alice", false)
+	assert.Nil(t, template())
+
+	digest := pendingDigest(t, b, storage, "template/firmware/pending")
+
+	assert.ErrorIs(t, approve("alice", digest), errPendingSameEntity)
+	assert.ErrorIs(t, approve("", digest), errPendingNoEntity)
+	assert.Error(t, approve("bob", ""))
+
+	propose("alice", true)
+	assert.ErrorIs(t, approve("bob", digest), errPendingReplaced)
+	assert.Nil(t, template())
+
+	digest = pendingDigest(t, b, storage, "template/firmware/pending")
+	require.NoError(t, approve("bob", digest))
+	require.NotNil(t, template())
+	assert.Equal(t, true, template().Values["tdx_check_debug"])
+}
+
+func TestPendingTokenParams(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/test", nil)
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	requireApproval(t, b, storage, true)
+
+	update := func(data map[string]interface{}) bool {
+		res, err := handle(t, b, storage, "alice", logical.UpdateOperation, "tdx/test", data)
+		require.NoError(t, err)
+		require.False(t, res.IsError(), res.Error())
+		return res.Data["pending"] == true
+	}
+	stored := func() *verifierTDX {
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "test")
+		require.NoError(t, err)
+		require.NotNil(t, v)
+		return v.(*verifierTDX)
+	}
+
+	{ // token parameters only
+		assert.False(t, update(map[string]interface{}{"token_policies": "app"}))
+		assert.Equal(t, []string{"app"}, stored().TokenPolicies)
+	}
+
+	{ // token parameters together with the measurements
+		assert.True(t, update(map[string]interface{}{
+			"tdx_check_debug": false,
+			"token_ttl":       "1h",
+		}))
+		assert.Equal(t, time.Hour, stored().TokenTTL)
+		assert.True(t, stored().CheckDebug)
+	}
+
+	{ // token parameters do not make the pending change stale
+		assert.False(t, update(map[string]interface{}{"token_policies": "app,db"}))
+
+		res, err := handle(t, b, storage, "bob", logical.ReadOperation, "tdx/test/pending", nil)
+		require.NoError(t, err)
+		assert.Equal(t, false, res.Data["stale"])
+
+		_, err = handle(t, b, storage, "bob", logical.UpdateOperation, "tdx/test/pending", map[string]interface{}{
+			"digest": pendingDigest(t, b, storage, "tdx/test/pending"),
+		})
+		require.NoError(t, err)
+
+		assert.False(t, stored().CheckDebug)
+		assert.Equal(t, []string{"app", "db"}, stored().TokenPolicies)
+		assert.Equal(t, time.Hour, stored().TokenTTL)
+	}
+}
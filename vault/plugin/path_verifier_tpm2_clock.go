@@ -0,0 +1,207 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpVerifierTPM2ClockSynopsys = `
+Manage the TPM clock observed on the logins of %s trusted domain.
+`
+
+const helpVerifierTPM2ClockDescription = `
+This endpoint shows the clocks of TPMs (with their reset and restart counts)
+as they were reported on the last successful logins of %s trusted domain
+with each attestation key, together with the reboots that are waiting for
+the approval (if any). Write approves such reboot, and delete forgets the
+observed clock altogether. The attestation key is selected with its
+fingerprint (ak), without it all of them are shown (or forgotten), and the
+only pending reboot is approved.
+`
+
+func pathVerifierTPM2Clock(b *backend, vt *verifierType) *framework.Path {
+	return &framework.Path{
+		Pattern:         vt.attestationType + "/" + framework.GenericNameRegex("name") + "/tpm2-clock",
+		HelpSynopsis:    fmt.Sprintf(helpVerifierTPM2ClockSynopsys, vt.title),
+		HelpDescription: fmt.Sprintf(helpVerifierTPM2ClockDescription, vt.title),
+
+		Fields: map[string]*framework.FieldSchema{
+			"name": {
+				Type:        framework.TypeString,
+				Description: vt.title + " trusted domain name",
+			},
+
+			"ak": {
+				Type:        framework.TypeString,
+				Description: "Fingerprint of the attestation key (as shown on read, and as used by `ak` instance alias)",
+			},
+		},
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			OperationPrefix: vt.attestationType + "-op-prefix",
+			OperationSuffix: vt.attestationType + "-tpm2-clock",
+		},
+
+		Operations: map[logical.Operation]framework.OperationHandler{
+			logical.ReadOperation: &framework.PathOperation{
+				Callback: b.pathVerifierTPM2ClockRead(vt),
+			},
+
+			logical.UpdateOperation: &framework.PathOperation{
+				Callback: b.pathVerifierTPM2ClockApprove(vt),
+			},
+
+			logical.DeleteOperation: &framework.PathOperation{
+				Callback: b.pathVerifierTPM2ClockDelete(vt),
+			},
+		},
+	}
+}
+
+func (b *backend) pathVerifierTPM2ClockRead(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		ak, err := getTPM2ClockAK(data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		td := vt.new(b)
+		td.SetName(name)
+
+		if ak != "" {
+			r, err := b.loadTPM2Clock(ctx, req.Storage, td, ak)
+			if err != nil {
+				msg := "failed to fetch tpm2 clock from storage"
+				l.Error(msg,
+					"attestation_type", vt.attestationType,
+					"domain", name,
+					"ak", ak,
+					"error", err,
+				)
+				return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+			}
+			if r == nil {
+				return nil, nil
+			}
+
+			return &logical.Response{
+				Data: encodeTPM2Clock(r),
+			}, nil
+		}
+
+		clocks, err := b.fetchTPM2Clocks(ctx, req, td)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+		if len(clocks) == 0 {
+			return nil, nil
+		}
+
+		_clocks := make(map[string]interface{}, len(clocks))
+		for ak, r := range clocks {
+			_clocks[ak] = encodeTPM2Clock(r)
+		}
+		return &logical.Response{
+			Data: map[string]interface{}{
+				"clocks": _clocks,
+			},
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierTPM2ClockApprove(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		ak, err := getTPM2ClockAK(data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		td := vt.new(b)
+		td.SetName(name)
+
+		r, err := b.approveTPM2Reboot(ctx, req, td, ak)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		return &logical.Response{
+			Data: encodeTPM2Clock(r),
+		}, nil
+	}
+}
+
+func (b *backend) pathVerifierTPM2ClockDelete(
+	vt *verifierType,
+) framework.OperationFunc {
+	return func(
+		ctx context.Context,
+		req *logical.Request,
+		data *framework.FieldData,
+	) (*logical.Response, error) {
+		l := b.Logger()
+
+		name, err := b.getName(ctx, data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		ak, err := getTPM2ClockAK(data)
+		if err != nil {
+			return logical.ErrorResponse(err.Error()), err
+		}
+
+		td := vt.new(b)
+		td.SetName(name)
+
+		if ak == "" {
+			if err := b.purgeTPM2Clocks(ctx, req, td); err != nil {
+				return logical.ErrorResponse(err.Error()), err
+			}
+		} else if err := b.deleteTPM2Clock(ctx, req.Storage, td, ak); err != nil {
+			msg := "failed to delete tpm2 clock"
+			l.Error(msg,
+				"attestation_type", vt.attestationType,
+				"domain", name,
+				"ak", ak,
+				"error", err,
+			)
+			return logical.ErrorResponse("%s: %s", msg, err), fmt.Errorf("%s: %w", msg, err)
+		}
+
+		l.Info("deleted tpm2 clock",
+			"attestation_type", vt.attestationType,
+			"domain", name,
+			"ak", ak,
+			"entity_id", req.EntityID,
+		)
+
+		return nil, nil
+	}
+}
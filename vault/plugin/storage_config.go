@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// backendConfig holds the settings of the mount.
+type backendConfig struct {
+	// RequireApproval makes the changes of measurements and of other
+	// pre-auth settings of the trusted domains wait for the approval by
+	// another entity.
+	RequireApproval bool `json:"require_approval"`
+}
+
+func (b *backend) loadConfig(
+	ctx context.Context,
+	storage logical.Storage,
+) (*backendConfig, error) {
+	entry, err := storage.Get(ctx, "config")
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &backendConfig{}
+	if entry == nil {
+		return cfg, nil
+	}
+
+	if err := entry.DecodeJSON(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+func (b *backend) saveConfig(
+	ctx context.Context,
+	storage logical.Storage,
+	cfg *backendConfig,
+) error {
+	entry, err := logical.StorageEntryJSON("config", cfg)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
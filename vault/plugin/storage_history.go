@@ -0,0 +1,107 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// verifierVersion is the snapshot of trusted domain configuration that was
+// saved by an update.
+type verifierVersion struct {
+	// Version is the sequential number of the version (starting with 1).
+	Version int `json:"version"`
+
+	// CreatedAt is the time when the version was saved.
+	CreatedAt time.Time `json:"created_at"`
+
+	// EntityID is the id of the entity that requested the change.
+	EntityID string `json:"entity_id"`
+
+	// DisplayName is the display name of the token that requested the change.
+	DisplayName string `json:"display_name"`
+
+	// Path is the path of the request that made the change.
+	Path string `json:"path"`
+
+	// Domain is the stored configuration of the domain.
+	Domain json.RawMessage `json:"domain"`
+}
+
+func historyPrefix(td TD) string {
+	return "history/" + td.AttestationType() + "/" + td.GetName() + "/"
+}
+
+func (b *backend) loadVersion(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	version int,
+) (*verifierVersion, error) {
+	entry, err := storage.Get(ctx, historyPrefix(td)+fmt.Sprintf("%010d", version))
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	v := &verifierVersion{}
+	if err := entry.DecodeJSON(v); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+func (b *backend) saveVersion(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	v *verifierVersion,
+) error {
+	entry, err := logical.StorageEntryJSON(historyPrefix(td)+fmt.Sprintf("%010d", v.Version), v)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *backend) deleteVersion(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	version int,
+) error {
+	return storage.Delete(ctx, historyPrefix(td)+fmt.Sprintf("%010d", version))
+}
+
+// listVersions returns the numbers of the stored versions in ascending order.
+func (b *backend) listVersions(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+) ([]int, error) {
+	keys, err := storage.List(ctx, historyPrefix(td))
+	if err != nil {
+		return nil, err
+	}
+
+	versions := make([]int, 0, len(keys))
+	for _, key := range keys {
+		version, err := strconv.Atoi(key)
+		if err != nil {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	return versions, nil
+}
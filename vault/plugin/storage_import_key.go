@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// importKey is the rsa key of the mount that the secrets of the exported
+// domains are encrypted to (so that they can only be decrypted by the mount
+// that imports them).
+type importKey struct {
+	// PrivateKey is the pkcs#8 der-encoded private key.
+	PrivateKey types.Bytes `json:"private_key"`
+}
+
+func (b *backend) loadImportKey(
+	ctx context.Context,
+	storage logical.Storage,
+) (*importKey, error) {
+	entry, err := storage.Get(ctx, "import/key")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	k := &importKey{}
+	if err := entry.DecodeJSON(k); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (b *backend) saveImportKey(
+	ctx context.Context,
+	storage logical.Storage,
+	k *importKey,
+) error {
+	entry, err := logical.StorageEntryJSON("import/key", k)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
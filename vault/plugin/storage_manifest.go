@@ -0,0 +1,86 @@
+package plugin
+
+import (
+	"context"
+	"strings"
+
+	"github.com/flashbots/vault-auth-plugin-attest/manifest"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func (b *backend) loadManifest(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	id string,
+) (*manifest.Signed, error) {
+	entry, err := storage.Get(ctx, "manifest/"+td.AttestationType()+"/"+td.GetName()+"/"+id)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	signed := &manifest.Signed{}
+	if err := entry.DecodeJSON(signed); err != nil {
+		return nil, err
+	}
+
+	return signed, nil
+}
+
+func (b *backend) saveManifest(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	id string,
+	signed *manifest.Signed,
+) error {
+	entry, err := logical.StorageEntryJSON("manifest/"+td.AttestationType()+"/"+td.GetName()+"/"+id, signed)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *backend) deleteManifest(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	id string,
+) error {
+	return storage.Delete(ctx, "manifest/"+td.AttestationType()+"/"+td.GetName()+"/"+id)
+}
+
+// listManifests returns the ids (`<image>/<version>`) of the manifests stored
+// for the domain.
+func (b *backend) listManifests(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+) ([]string, error) {
+	prefix := "manifest/" + td.AttestationType() + "/" + td.GetName() + "/"
+
+	images, err := storage.List(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(images))
+	for _, image := range images {
+		if !strings.HasSuffix(image, "/") {
+			continue
+		}
+		versions, err := storage.List(ctx, prefix+image)
+		if err != nil {
+			return nil, err
+		}
+		for _, version := range versions {
+			ids = append(ids, image+version)
+		}
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,108 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// pendingChange is the change of trusted domain configuration that waits for
+// the approval.
+type pendingChange struct {
+	// CreatedAt is the time when the change was requested.
+	CreatedAt time.Time `json:"created_at"`
+
+	// EntityID is the id of the entity that requested the change.
+	EntityID string `json:"entity_id"`
+
+	// DisplayName is the display name of the token that requested the change.
+	DisplayName string `json:"display_name"`
+
+	// Path is the path of the request that made the change.
+	Path string `json:"path"`
+
+	// Current is the stored configuration of the domain (or of the template)
+	// at the time when the change was requested (empty for the new ones).
+	Current json.RawMessage `json:"current,omitempty"`
+
+	// Domain is the requested configuration of the domain (or of the
+	// template).
+	Domain json.RawMessage `json:"domain"`
+
+	// SecretChanged is set when the change replaces the totp secret of the
+	// domain (the requested secret is kept at pendingSecretKey).
+	SecretChanged bool `json:"secret_changed,omitempty"`
+}
+
+// digest identifies the pending change, so that the approval applies to the
+// change that was reviewed (and not to another one that replaced it since).
+func (p *pendingChange) digest() (string, error) {
+	raw, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func pendingKey(td TD) string {
+	return "pending/" + td.AttestationType() + "/" + td.GetName()
+}
+
+func templatePendingKey(name string) string {
+	return "pending/template/" + name
+}
+
+func (b *backend) loadPending(
+	ctx context.Context,
+	storage logical.Storage,
+	key string,
+) (*pendingChange, error) {
+	entry, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	p := &pendingChange{}
+	if err := entry.DecodeJSON(p); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+func (b *backend) savePending(
+	ctx context.Context,
+	storage logical.Storage,
+	key string,
+	p *pendingChange,
+) error {
+	entry, err := logical.StorageEntryJSON(key, p)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+// deletePending removes the pending change together with the totp secret
+// that it requested (if any).
+func (b *backend) deletePending(
+	ctx context.Context,
+	storage logical.Storage,
+	key string,
+) error {
+	if err := storage.Delete(ctx, "secret/"+key); err != nil {
+		return err
+	}
+
+	return storage.Delete(ctx, key)
+}
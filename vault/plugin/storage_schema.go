@@ -0,0 +1,48 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// storageSchema records the schema version that the storage of the mount
+// was migrated to.
+type storageSchema struct {
+	// Version is the schema version of the stored entries.
+	Version int `json:"version"`
+}
+
+func (b *backend) loadSchema(
+	ctx context.Context,
+	storage logical.Storage,
+) (*storageSchema, error) {
+	entry, err := storage.Get(ctx, "schema")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &storageSchema{}
+	if entry == nil {
+		return s, nil
+	}
+
+	if err := entry.DecodeJSON(s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (b *backend) saveSchema(
+	ctx context.Context,
+	storage logical.Storage,
+	s *storageSchema,
+) error {
+	entry, err := logical.StorageEntryJSON("schema", s)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
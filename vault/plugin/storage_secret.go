@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// secretsKey is the key of the mount that the totp secrets are encrypted with
+// (the secrets and the key are kept in the seal-wrapped storage).
+type secretsKey struct {
+	// Key is the aes-256 key.
+	Key types.Bytes `json:"key"`
+}
+
+// sealedSecret is the encrypted totp secret of the domain.
+type sealedSecret struct {
+	// Ciphertext is the aes-gcm nonce followed by the encrypted secret.
+	Ciphertext types.Bytes `json:"ciphertext"`
+}
+
+func totpSecretKey(attestationType, name string) string {
+	return "secret/totp/" + attestationType + "/" + name
+}
+
+func pendingSecretKey(td TD) string {
+	return "secret/" + pendingKey(td)
+}
+
+func (b *backend) loadSecretsKey(
+	ctx context.Context,
+	storage logical.Storage,
+) (*secretsKey, error) {
+	entry, err := storage.Get(ctx, "secret/key")
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	k := &secretsKey{}
+	if err := entry.DecodeJSON(k); err != nil {
+		return nil, err
+	}
+
+	return k, nil
+}
+
+func (b *backend) saveSecretsKey(
+	ctx context.Context,
+	storage logical.Storage,
+	k *secretsKey,
+) error {
+	entry, err := logical.StorageEntryJSON("secret/key", k)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *backend) loadSecret(
+	ctx context.Context,
+	storage logical.Storage,
+	key string,
+) (*sealedSecret, error) {
+	entry, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	s := &sealedSecret{}
+	if err := entry.DecodeJSON(s); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (b *backend) saveSecret(
+	ctx context.Context,
+	storage logical.Storage,
+	key string,
+	s *sealedSecret,
+) error {
+	entry, err := logical.StorageEntryJSON(key, s)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *backend) deleteSecret(
+	ctx context.Context,
+	storage logical.Storage,
+	key string,
+) error {
+	return storage.Delete(ctx, key)
+}
@@ -0,0 +1,81 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTOTPSecretStorage(t *testing.T) {
+	ctx := context.Background()
+	b, storage := newTestBackend(t)
+
+	const (
+		secret  = "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"
+		rotated = "KRSXG5CTMVRXEZLUKRSXG5CTMVRXEZLU"
+	)
+
+	res, err := handle(t, b, storage, "", logical.CreateOperation, "tdx/app", map[string]interface{}{
+		"totp_secret": secret,
+	})
+	require.NoError(t, err)
+	require.False(t, res.IsError(), res.Error())
+
+	{ // the secret is kept sealed under the seal-wrapped prefix only
+		entry, err := storage.Get(ctx, "tdx/app")
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		assert.NotContains(t, string(entry.Value), secret)
+
+		key := totpSecretKey("tdx", "app")
+		s, err := b.loadSecret(ctx, storage, key)
+		require.NoError(t, err)
+		require.NotNil(t, s)
+		unsealed, err := b.unsealTOTPSecret(ctx, storage, key, s)
+		require.NoError(t, err)
+		assert.Equal(t, secret, unsealed)
+
+		assert.Contains(t, b.Backend.PathsSpecial.SealWrapStorage, "secret/")
+	}
+
+	requireApproval(t, b, storage, true)
+
+	res, err = handle(t, b, storage, "alice", logical.UpdateOperation, "tdx/app", map[string]interface{}{
+		"totp_secret": rotated,
+	})
+	require.NoError(t, err)
+	require.Equal(t, true, res.Data["pending"])
+
+	{ // the requested secret is not kept in the pending change
+		entry, err := storage.Get(ctx, "pending/tdx/app")
+		require.NoError(t, err)
+		require.NotNil(t, entry)
+		assert.NotContains(t, string(entry.Value), rotated)
+
+		s, err := b.loadSecret(ctx, storage, "secret/pending/tdx/app")
+		require.NoError(t, err)
+		require.NotNil(t, s)
+		unsealed, err := b.unsealTOTPSecret(ctx, storage, "secret/pending/tdx/app", s)
+		require.NoError(t, err)
+		assert.Equal(t, rotated, unsealed)
+	}
+
+	{ // approval moves the secret over
+		digest := pendingDigest(t, b, storage, "tdx/app/pending")
+		_, err := handle(t, b, storage, "bob", logical.UpdateOperation, "tdx/app/pending", map[string]interface{}{
+			"digest": digest,
+		})
+		require.NoError(t, err)
+
+		v, err := b.loadVerifier(ctx, storage, verifierTypeTDX, "app")
+		require.NoError(t, err)
+		assert.Equal(t, rotated, v.GetTOTPSecret())
+
+		s, err := b.loadSecret(ctx, storage, "secret/pending/tdx/app")
+		require.NoError(t, err)
+		assert.Nil(t, s)
+	}
+}
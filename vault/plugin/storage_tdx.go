@@ -7,12 +7,13 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 )
 
-func (b *backend) loadTDX(
+func (b *backend) loadTDXInstance(
 	ctx context.Context,
 	storage logical.Storage,
 	name string,
-) (*tdx.TDX, error) {
-	entry, err := storage.Get(ctx, "tdx/"+name)
+	id string,
+) (*tdx.Instance, error) {
+	entry, err := storage.Get(ctx, "instance/tdx/"+name+"/"+id)
 	if err != nil {
 		return nil, err
 	}
@@ -20,20 +21,22 @@ func (b *backend) loadTDX(
 		return nil, nil
 	}
 
-	tdx := &tdx.TDX{}
-	if err := entry.DecodeJSON(tdx); err != nil {
+	instance := &tdx.Instance{}
+	if err := entry.DecodeJSON(instance); err != nil {
 		return nil, err
 	}
+	instance.ID = id
 
-	return tdx, nil
+	return instance, nil
 }
 
-func (b *backend) saveTDX(
+func (b *backend) saveTDXInstance(
 	ctx context.Context,
 	storage logical.Storage,
-	tdx *tdx.TDX,
+	name string,
+	instance *tdx.Instance,
 ) error {
-	entry, err := logical.StorageEntryJSON("tdx/"+tdx.Name, tdx)
+	entry, err := logical.StorageEntryJSON("instance/tdx/"+name+"/"+instance.ID, instance)
 	if err != nil {
 		return err
 	}
@@ -41,17 +44,19 @@ func (b *backend) saveTDX(
 	return storage.Put(ctx, entry)
 }
 
-func (b *backend) deleteTDX(
+func (b *backend) deleteTDXInstance(
 	ctx context.Context,
 	storage logical.Storage,
 	name string,
+	id string,
 ) error {
-	return storage.Delete(ctx, "tdx/"+name)
+	return storage.Delete(ctx, "instance/tdx/"+name+"/"+id)
 }
 
-func (b *backend) listTDX(
+func (b *backend) listTDXInstances(
 	ctx context.Context,
 	storage logical.Storage,
+	name string,
 ) ([]string, error) {
-	return storage.List(ctx, "tdx/")
+	return storage.List(ctx, "instance/tdx/"+name+"/")
 }
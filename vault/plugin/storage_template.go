@@ -0,0 +1,75 @@
+package plugin
+
+import (
+	"context"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// domainTemplate holds the values of the fields that the trusted domains
+// referencing the template inherit (unless they override them).
+type domainTemplate struct {
+	// AttestationType is the attestation type of the domains that can
+	// reference the template.
+	AttestationType string `json:"attestation_type"`
+
+	// SchemaVersion is the version of the schema that the template is stored
+	// with.
+	SchemaVersion int `json:"schema_version,omitempty"`
+
+	// Values are the values of the fields (as they were provided in the
+	// request).
+	Values map[string]interface{} `json:"values"`
+}
+
+func (b *backend) loadTemplate(
+	ctx context.Context,
+	storage logical.Storage,
+	name string,
+) (*domainTemplate, error) {
+	entry, err := storage.Get(ctx, "template/"+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	t := &domainTemplate{}
+	if err := entry.DecodeJSON(t); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func (b *backend) saveTemplate(
+	ctx context.Context,
+	storage logical.Storage,
+	name string,
+	t *domainTemplate,
+) error {
+	t.SchemaVersion = latestSchemaVersion()
+
+	entry, err := logical.StorageEntryJSON("template/"+name, t)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *backend) deleteTemplate(
+	ctx context.Context,
+	storage logical.Storage,
+	name string,
+) error {
+	return storage.Delete(ctx, "template/"+name)
+}
+
+func (b *backend) listTemplates(
+	ctx context.Context,
+	storage logical.Storage,
+) ([]string, error) {
+	return storage.List(ctx, "template/")
+}
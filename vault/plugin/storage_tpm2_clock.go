@@ -0,0 +1,90 @@
+package plugin
+
+import (
+	"context"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// tpm2ClockRecord is the clock of the tpm of the domain as observed on the
+// last successful login with the attestation key (the domains can be logged
+// into from several machines, each with the key of its own).
+type tpm2ClockRecord struct {
+	// AKPublic is the attestation key that signed the quotes.
+	AKPublic types.Bytes `json:"ak_public"`
+
+	// Clock is the clock reported on the last login.
+	Clock *tpm2.Clock `json:"clock"`
+
+	// ObservedAt is the time of the last login.
+	ObservedAt time.Time `json:"observed_at"`
+
+	// Reboot is the clock reported by the login after the reboot that is
+	// waiting for the approval.
+	Reboot *tpm2.Clock `json:"reboot,omitempty"`
+
+	// RebootObservedAt is the time of the login after the reboot.
+	RebootObservedAt time.Time `json:"reboot_observed_at,omitempty"`
+}
+
+// tpm2ClockPrefix is the prefix of the clock records of the domain (one
+// record per attestation key).
+func tpm2ClockPrefix(td TD) string {
+	return "tpm2clock/" + td.AttestationType() + "/" + td.GetName() + "/"
+}
+
+func (b *backend) loadTPM2Clock(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	ak string,
+) (*tpm2ClockRecord, error) {
+	entry, err := storage.Get(ctx, tpm2ClockPrefix(td)+ak)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	r := &tpm2ClockRecord{}
+	if err := entry.DecodeJSON(r); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+func (b *backend) saveTPM2Clock(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	r *tpm2ClockRecord,
+) error {
+	entry, err := logical.StorageEntryJSON(tpm2ClockPrefix(td)+tpm2.AKFingerprint(r.AKPublic), r)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, entry)
+}
+
+func (b *backend) listTPM2Clocks(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+) ([]string, error) {
+	return storage.List(ctx, tpm2ClockPrefix(td))
+}
+
+func (b *backend) deleteTPM2Clock(
+	ctx context.Context,
+	storage logical.Storage,
+	td TD,
+	ak string,
+) error {
+	return storage.Delete(ctx, tpm2ClockPrefix(td)+ak)
+}
@@ -0,0 +1,114 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// loadVerifier returns the stored domain together with its totp secret.
+//
+// The domains that were not migrated yet (e.g. where the storage is
+// read-only) still carry the totp secret inline.
+func (b *backend) loadVerifier(
+	ctx context.Context,
+	storage logical.Storage,
+	vt *verifierType,
+	name string,
+) (Verifier, error) {
+	entry, err := storage.Get(ctx, vt.attestationType+"/"+name)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return nil, nil
+	}
+
+	v := vt.new(b)
+	if err := entry.DecodeJSON(v); err != nil {
+		return nil, err
+	}
+	v.SetName(name)
+
+	if v.GetTOTPSecret() != "" {
+		return v, nil
+	}
+
+	key := totpSecretKey(vt.attestationType, name)
+	s, err := b.loadSecret(ctx, storage, key)
+	if err != nil {
+		return nil, err
+	}
+	if s != nil {
+		secret, err := b.unsealTOTPSecret(ctx, storage, key, s)
+		if err != nil {
+			return nil, err
+		}
+		v.SetTOTPSecret(secret)
+	}
+
+	return v, nil
+}
+
+// saveVerifier stores the domain, and its totp secret (if it is set)
+// separately from it.
+func (b *backend) saveVerifier(
+	ctx context.Context,
+	storage logical.Storage,
+	v Verifier,
+) error {
+	if secret := v.GetTOTPSecret(); secret != "" {
+		key := totpSecretKey(v.AttestationType(), v.GetName())
+		s, err := b.sealTOTPSecret(ctx, storage, key, secret)
+		if err != nil {
+			return err
+		}
+		if err := b.saveSecret(ctx, storage, key, s); err != nil {
+			return err
+		}
+	}
+
+	domain, err := marshalDomain(v)
+	if err != nil {
+		return err
+	}
+
+	return storage.Put(ctx, &logical.StorageEntry{
+		Key:   v.AttestationType() + "/" + v.GetName(),
+		Value: domain,
+	})
+}
+
+func (b *backend) deleteVerifier(
+	ctx context.Context,
+	storage logical.Storage,
+	vt *verifierType,
+	name string,
+) error {
+	if err := b.deleteSecret(ctx, storage, totpSecretKey(vt.attestationType, name)); err != nil {
+		return err
+	}
+
+	return storage.Delete(ctx, vt.attestationType+"/"+name)
+}
+
+func (b *backend) listVerifiers(
+	ctx context.Context,
+	storage logical.Storage,
+	vt *verifierType,
+) ([]string, error) {
+	return storage.List(ctx, vt.attestationType+"/")
+}
+
+// marshalDomain returns the stored form of the domain, that is without its
+// totp secret and with the latest schema version.
+func marshalDomain(v Verifier) ([]byte, error) {
+	v.common().SchemaVersion = latestSchemaVersion()
+
+	secret := v.GetTOTPSecret()
+	v.SetTOTPSecret("")
+	defer v.SetTOTPSecret(secret)
+
+	return json.Marshal(v)
+}
@@ -8,10 +8,12 @@ import (
 type TD interface {
 	AttestationType() string
 	GetName() string
+	SetName(string)
 
 	GetTOTPSecret() string
 	SetTOTPSecret(string)
 
 	ParseTokenFields(*logical.Request, *framework.FieldData) error
 	PopulateTokenData(map[string]interface{})
+	PopulateTokenAuth(*logical.Auth)
 }
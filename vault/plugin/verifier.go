@@ -0,0 +1,268 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/flashbots/vault-auth-plugin-attest/types"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/go-sockaddr"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// Verifier is the trusted domain that knows how to configure its policy, and
+// how to verify the attestation evidence against it.
+//
+// The backend generates `<type>/<name>`, `<type>/<name>/nonce` and
+// `<type>/<name>/login` paths (as well as the storage) for every verifier
+// registered in verifierTypes.
+type Verifier interface {
+	TD
+
+	// Fields returns the schema of the fields that configure the policy.
+	Fields() map[string]*framework.FieldSchema
+
+	// MeasurementFields returns the names of the fields that hold the
+	// measurements (the only fields that manifests and imported reference
+	// values may set).
+	MeasurementFields() []string
+
+	// Apply updates the policy with the fields provided in the request (or
+	// configures it from scratch, if isNew is set).
+	Apply(ctx context.Context, data *framework.FieldData, isNew bool) error
+
+	// Encode returns the policy in the form that is shown on read.
+	Encode(ctx context.Context) (map[string]interface{}, error)
+
+	// NonceSize is the size of the nonce (in bytes) that is issued to the
+	// client before login.
+	NonceSize() int
+
+	// NonceData returns extra data that is sent to the client together with
+	// the nonce.
+	NonceData() map[string]interface{}
+
+	// LoginFields returns the schema of the fields that carry the evidence.
+	LoginFields() map[string]*framework.FieldSchema
+
+	// ParseEvidence parses the evidence provided on login, and returns it
+	// together with the nonce that the evidence is bound to.
+	ParseEvidence(
+		ctx context.Context, req *logical.Request, data *framework.FieldData,
+	) (interface{}, string, error)
+
+	// Validate verifies the genuineness of the evidence.
+	Validate(
+		ctx context.Context, evidence interface{}, nonce string, errs *multierror.Error,
+	) *multierror.Error
+
+	// Match verifies that the evidence satisfies the policy.
+	Match(
+		ctx context.Context, evidence interface{}, errs *multierror.Error,
+	) *multierror.Error
+
+	// Claims extracts the claims of the evidence that policy expression is
+	// evaluated against.
+	Claims(evidence interface{}) *policy.Claims
+
+	// common returns the settings that are shared by all attestation types.
+	common() *verifierCommon
+}
+
+// verifierCommon holds the settings of the trusted domain that do not depend
+// on the attestation type (they are stored next to the type-specific policy,
+// and are embedded by every verifier).
+type verifierCommon struct {
+	// PolicyExpression is the policy expression over attestation claims.
+	PolicyExpression *policy.Policy `json:"policy,omitempty"`
+
+	// ManifestSigner is the ed25519 public key that signs the manifests of
+	// reference values trusted by the domain.
+	ManifestSigner types.Bytes `json:"manifest_signer,omitempty"`
+
+	// Template is the name of the template that the domain inherits the
+	// values of the fields from.
+	Template string `json:"template,omitempty"`
+
+	// Overrides are the fields that the domain does not inherit from the
+	// template.
+	Overrides []string `json:"overrides,omitempty"`
+
+	// LoginBoundCIDRs are the cidr blocks that the nonce and login requests
+	// of the domain are accepted from.
+	LoginBoundCIDRs []*sockaddr.SockAddrMarshaler `json:"login_bound_cidrs,omitempty"`
+
+	// InstanceAlias is the source of the per-instance identifier that the
+	// identity alias is derived from (empty means the alias of the domain).
+	InstanceAlias string `json:"instance_alias,omitempty"`
+
+	// TokenDelivery is the way the token is delivered to the client upon
+	// login (empty means in cleartext).
+	TokenDelivery string `json:"token_delivery,omitempty"`
+
+	// MaxNonces is the limit of the outstanding nonces of the domain (zero
+	// means the default limit).
+	MaxNonces int `json:"max_nonces,omitempty"`
+
+	// SchemaVersion is the version of the schema that the domain is stored
+	// with (see storageMigrations).
+	SchemaVersion int `json:"schema_version,omitempty"`
+}
+
+func (c *verifierCommon) common() *verifierCommon {
+	return c
+}
+
+// nonceLimit returns the limit of the outstanding nonces of the domain.
+func (c *verifierCommon) nonceLimit() int {
+	if c.MaxNonces > 0 {
+		return min(c.MaxNonces, globals.MaxDomainNoncesLimit)
+	}
+	return globals.MaxDomainNonces
+}
+
+// instanceVerifier is implemented by the verifiers that allow enrolled
+// instances to authenticate with their keys instead of totp codes.
+type instanceVerifier interface {
+	Verifier
+
+	// IsInstanceRequest reports whether the request comes from an instance
+	// (as opposed to the client that holds totp secret).
+	IsInstanceRequest(data *framework.FieldData) bool
+
+	// NonceFields returns the schema of the fields that the instance
+	// authenticates its nonce request with.
+	NonceFields() map[string]*framework.FieldSchema
+
+	// AuthenticateNonceRequest authenticates the nonce request of the
+	// instance and returns its id (or an empty string, if the instance is
+	// about to enroll and therefore has nothing to authenticate with yet).
+	AuthenticateNonceRequest(
+		ctx context.Context, req *logical.Request, data *framework.FieldData,
+	) (string, error)
+
+	// AuthenticateInstance authenticates the instance and returns its id.
+	AuthenticateInstance(
+		ctx context.Context, req *logical.Request, data *framework.FieldData,
+	) (string, error)
+
+	// PurgeInstances removes all instances enrolled with the domain.
+	PurgeInstances(ctx context.Context, req *logical.Request) error
+}
+
+// tpm2Verifier is implemented by the verifiers whose evidence carries tpm2
+// attestation (and, therefore, the clock of the tpm).
+type tpm2Verifier interface {
+	Verifier
+
+	// TPM2Policy returns the tpm2 part of the policy.
+	TPM2Policy() *tpm2.TPM2
+
+	// TPM2Attestation returns the tpm2 attestation of the evidence.
+	TPM2Attestation(evidence interface{}) *attest.PlatformParameters
+}
+
+// tdxQuoteVerifier is implemented by the verifiers whose evidence carries tdx
+// quote.
+type tdxQuoteVerifier interface {
+	Verifier
+
+	// TDXQuote returns the tdx quote of the evidence (or nil, if that
+	// particular evidence has none).
+	TDXQuote(evidence interface{}) *tdx.Quote
+}
+
+// instanceAliasVerifier is implemented by the verifiers that can tell the
+// individual instances of the domain apart (so that each of them gets its own
+// identity alias).
+type instanceAliasVerifier interface {
+	Verifier
+
+	// InstanceAliasSources returns the sources of the per-instance
+	// identifiers that the verifier supports.
+	InstanceAliasSources() []string
+
+	// InstanceAlias returns the identifier of the instance that produced the
+	// evidence.
+	InstanceAlias(source string, evidence interface{}) (string, error)
+}
+
+const (
+	tokenDeliveryCleartext = "cleartext" // token is returned as-is
+	tokenDeliveryWrapped   = "wrapped"   // token is returned response-wrapped
+)
+
+const (
+	// tokenDeliveryWrapTTL is the ttl of the response-wrapping token that
+	// the token of the domain with the wrapped delivery is returned in.
+	tokenDeliveryWrapTTL = time.Minute
+)
+
+var (
+	errTokenDeliveryInvalid = errors.New("unsupported token delivery")
+)
+
+const (
+	aliasSourceDomain      = "domain"       // single alias for the whole domain
+	aliasSourceInstanceKey = "instance_key" // id of the enrolled instance key
+	aliasSourcePPID        = "ppid"         // platform provisioning id of tdx platform
+	aliasSourceAK          = "ak"           // fingerprint of tpm2 attestation key (where it is not pinned)
+	aliasSourceEK          = "ek"           // fingerprint of tpm2 endorsement key (as reported by the instance)
+)
+
+var (
+	errInstanceAliasInvalid       = errors.New("unsupported instance alias source")
+	errInstanceAliasNoInstanceKey = errors.New("login was not made with the key of enrolled instance")
+	errInstanceAliasNoEK          = errors.New("login did not report tpm2 endorsement key")
+)
+
+// verifierType describes the attestation type that is registered with the
+// backend.
+type verifierType struct {
+	// attestationType is the name of the attestation type (it is also used
+	// as the prefix of the paths and of the storage entries).
+	attestationType string
+
+	// title is the human-readable name of the attestation type.
+	title string
+
+	// itemType is the item type shown in the ui.
+	itemType string
+
+	helpLoginSynopsys    string
+	helpLoginDescription string
+
+	// new creates an empty verifier.
+	new func(b *backend) Verifier
+}
+
+// verifierTypes is the registry of the attestation types supported by the
+// backend.
+var verifierTypes = []*verifierType{
+	verifierTypeTDX,
+	verifierTypeTPM2,
+	verifierTypeTDXTPM2,
+	verifierTypeSEVSNP,
+	verifierTypeSGX,
+	verifierTypeCCA,
+	verifierTypeNitro,
+	verifierTypeAzureCVM,
+}
+
+// lookupVerifierType returns the registered attestation type by its name (or
+// nil, if there is no such type).
+func lookupVerifierType(attestationType string) *verifierType {
+	for _, vt := range verifierTypes {
+		if vt.attestationType == attestationType {
+			return vt
+		}
+	}
+	return nil
+}
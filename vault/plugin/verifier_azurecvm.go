@@ -0,0 +1,225 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/flashbots/vault-auth-plugin-attest/azurecvm"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpAzureCVMLoginSynopsys = `
+Log in with TOTP code, HCL report and TPM 2.0 attestation report.
+`
+
+const helpAzureCVMLoginDescription = `
+This endpoint authenticates using TOTP code, HCL report of Azure paravisor
+(together with TDX quote, on TDX CVMs) and TPM 2.0 attestation report generated
+with the attestation key of vTPM.
+`
+
+var verifierTypeAzureCVM = &verifierType{
+	attestationType:      "azure-cvm",
+	title:                "Azure CVM",
+	itemType:             "Azure CVM",
+	helpLoginSynopsys:    helpAzureCVMLoginSynopsys,
+	helpLoginDescription: helpAzureCVMLoginDescription,
+
+	new: func(b *backend) Verifier {
+		return &verifierAzureCVM{AzureCVM: &azurecvm.AzureCVM{}, b: b}
+	},
+}
+
+type verifierAzureCVM struct {
+	*azurecvm.AzureCVM
+	verifierCommon
+
+	b *backend
+}
+
+// azurecvmEvidence is the hardware report of azure cvm together with tpm2
+// attestation of its vtpm.
+type azurecvmEvidence struct {
+	report      *azurecvm.HardwareReport
+	attestation *attest.PlatformParameters
+}
+
+func (v *verifierAzureCVM) Fields() map[string]*framework.FieldSchema {
+	fields := sevsnpFields()
+	for k, f := range tdxFields() {
+		fields[k] = f
+	}
+	for k, f := range tpm2Fields() {
+		fields[k] = f
+	}
+	delete(fields, "tdx_tls_binding") // not supported by azure cvms
+	delete(fields, "tpm2_ak_public")  // comes from hcl report
+
+	return fields
+}
+
+func (v *verifierAzureCVM) MeasurementFields() []string {
+	return slices.Concat(sevsnpMeasurementFields(), tdxMeasurementFields(), tpm2MeasurementFields())
+}
+
+func (v *verifierAzureCVM) Apply(
+	ctx context.Context,
+	data *framework.FieldData,
+	isNew bool,
+) error {
+	if isNew {
+		v.b.Logger().Debug("creating domain",
+			"attestation_type", v.AttestationType(),
+			"domain", v.Name,
+		)
+		v.TPM2 = &tpm2.TPM2{} // attestation key comes from hcl report
+	}
+
+	policySEVSNP, _, err := v.b.applySEVSNPFields(ctx, data, v.Name, v.SEVSNP)
+	if err != nil {
+		return err
+	}
+	policyTDX, _, err := v.b.applyTDXFieldsWithOptions(ctx, v.AttestationType(), data, v.Name, v.TDX, tdxFieldsOptions{})
+	if err != nil {
+		return err
+	}
+	policyTPM2, _, err := v.b.applyTPM2FieldsWithOptions(ctx, data, v.Name, v.TPM2, tpm2FieldsOptions{})
+	if err != nil {
+		return err
+	}
+
+	v.SEVSNP = policySEVSNP
+	v.TDX = policyTDX
+	v.TPM2 = policyTPM2
+
+	return nil
+}
+
+func (v *verifierAzureCVM) Encode(ctx context.Context) (map[string]interface{}, error) {
+	return v.b.encodeAzureCVM(ctx, v.AzureCVM)
+}
+
+func (v *verifierAzureCVM) NonceSize() int {
+	return globals.TPM2NonceSize
+}
+
+func (v *verifierAzureCVM) NonceData() map[string]interface{} {
+	return nil
+}
+
+func (v *verifierAzureCVM) LoginFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"hcl_report": {
+			Type:        framework.TypeString,
+			Description: "HCL report (as read from vTPM NV)",
+		},
+
+		"quote": {
+			Type:        framework.TypeString,
+			Description: "TDX attestation quote generated from TDREPORT of HCL report (on TDX CVMs only)",
+		},
+
+		"attestation": {
+			Type:        framework.TypeString,
+			Description: "TPM 2.0 attestation report",
+		},
+
+		"nonce": {
+			Type:        framework.TypeString,
+			Description: "Nonce used when generating TPM 2.0 attestation report",
+		},
+	}
+}
+
+func (v *verifierAzureCVM) ParseEvidence(
+	ctx context.Context,
+	_ *logical.Request,
+	data *framework.FieldData,
+) (interface{}, string, error) {
+	hcl, err := v.b.parseAzureCVMHCLReport(ctx, data, v.AzureCVM)
+	if err != nil {
+		return nil, "", err
+	}
+
+	attestation, err := v.b.parseAzureCVMAttestation(ctx, data, v.AzureCVM, hcl)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce, err := v.b.getNonce(ctx, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	report, err := v.b.parseAzureCVMHardwareReport(ctx, data, v.AzureCVM, hcl)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &azurecvmEvidence{report: report, attestation: attestation}, nonce, nil
+}
+
+func (v *verifierAzureCVM) Validate(
+	ctx context.Context,
+	evidence interface{},
+	nonce string,
+	errs *multierror.Error,
+) *multierror.Error {
+	e := evidence.(*azurecvmEvidence)
+
+	errs = v.b.validateAzureCVMHardwareReport(ctx, v.AzureCVM, e.report, errs)
+	return v.b.validateTPM2Attestation(ctx, v.TPM2, e.attestation, nonce, errs)
+}
+
+func (v *verifierAzureCVM) Match(
+	ctx context.Context,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	e := evidence.(*azurecvmEvidence)
+
+	return v.b.verifyAzureCVM(ctx, v.AzureCVM, e.report, e.attestation, errs)
+}
+
+func (v *verifierAzureCVM) Claims(evidence interface{}) *policy.Claims {
+	e := evidence.(*azurecvmEvidence)
+
+	return &policy.Claims{
+		SEVSNP: policy.FromSEVSNPAttestation(e.report.SEVSNP),
+		TDX:    policy.FromTDXQuote(e.report.TDX),
+		TPM2:   policy.FromTPM2Attestation(e.attestation),
+	}
+}
+
+func (v *verifierAzureCVM) TDXQuote(evidence interface{}) *tdx.Quote {
+	return evidence.(*azurecvmEvidence).report.TDX
+}
+
+func (v *verifierAzureCVM) TPM2Policy() *tpm2.TPM2 {
+	return v.TPM2
+}
+
+func (v *verifierAzureCVM) TPM2Attestation(evidence interface{}) *attest.PlatformParameters {
+	return evidence.(*azurecvmEvidence).attestation
+}
+
+// InstanceAliasSources offers the attestation key, since every cvm brings
+// the key of its own vtpm with its hcl report.
+func (v *verifierAzureCVM) InstanceAliasSources() []string {
+	return []string{aliasSourceAK}
+}
+
+func (v *verifierAzureCVM) InstanceAlias(source string, evidence interface{}) (string, error) {
+	if source == aliasSourceAK {
+		return tpm2.AKFingerprint(evidence.(*azurecvmEvidence).attestation.Public), nil
+	}
+	return "", fmt.Errorf("%w: %s", errInstanceAliasInvalid, source)
+}
@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/flashbots/vault-auth-plugin-attest/cca"
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpCCALoginSynopsys = `
+Log in with TOTP code and CCA attestation token.
+`
+
+const helpCCALoginDescription = `
+This endpoint authenticates using TOTP code and CCA attestation token.
+`
+
+var verifierTypeCCA = &verifierType{
+	attestationType:      "cca",
+	title:                "Arm CCA",
+	itemType:             "CCA",
+	helpLoginSynopsys:    helpCCALoginSynopsys,
+	helpLoginDescription: helpCCALoginDescription,
+
+	new: func(b *backend) Verifier {
+		return &verifierCCA{CCA: &cca.CCA{}, b: b}
+	},
+}
+
+type verifierCCA struct {
+	*cca.CCA
+	verifierCommon
+
+	b *backend
+}
+
+// ccaFields returns the schema of the fields that configure cca policy.
+func ccaFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		// RIM
+
+		"cca_rim": {
+			Type:        framework.TypeString,
+			Description: "Expected realm initial measurement",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "RIM",
+				Description: "Initial measurement of the realm calculated by RMM at realm activation (base64-encoded digest)",
+			},
+		},
+
+		// REM
+
+		"cca_rem0": {
+			Type:        framework.TypeString,
+			Description: "Expected realm extensible measurement #0",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "REM[0]",
+				Description: "Extensible measurement #0 of the realm (base64-encoded digest)",
+			},
+		},
+
+		"cca_rem1": {
+			Type:        framework.TypeString,
+			Description: "Expected realm extensible measurement #1",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "REM[1]",
+				Description: "Extensible measurement #1 of the realm (base64-encoded digest)",
+			},
+		},
+
+		"cca_rem2": {
+			Type:        framework.TypeString,
+			Description: "Expected realm extensible measurement #2",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "REM[2]",
+				Description: "Extensible measurement #2 of the realm (base64-encoded digest)",
+			},
+		},
+
+		"cca_rem3": {
+			Type:        framework.TypeString,
+			Description: "Expected realm extensible measurement #3",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "REM[3]",
+				Description: "Extensible measurement #3 of the realm (base64-encoded digest)",
+			},
+		},
+
+		// RPV
+
+		"cca_personalization_value": {
+			Type:        framework.TypeString,
+			Description: "Expected realm personalization value",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "RPV",
+				Description: "Personalization value provided by the host at realm creation (base64-encoded 64 byte array)",
+			},
+		},
+
+		// PLATFORM IMPLEMENTATION ID
+
+		"cca_platform_implementation_id": {
+			Type:        framework.TypeString,
+			Description: "Expected implementation id of the CCA platform",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Platform implementation ID",
+				Description: "Implementation id of the CCA platform (base64-encoded 32 byte array)",
+			},
+		},
+
+		// CPAK
+
+		"cca_cpaks": {
+			Type:        framework.TypeString,
+			Description: "PEM-encoded CPAKs to verify the platform token against",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "CPAKs",
+				Description: "PEM-encoded bundle of CCA platform attestation keys (public keys or certificates endorsing them) that are trusted to sign the platform token",
+				EditType:    "textarea",
+			},
+		},
+	}
+}
+
+// ccaMeasurementFields returns the names of the cca fields that hold the
+// measurements of the realm.
+func ccaMeasurementFields() []string {
+	return []string{
+		"cca_rim",
+		"cca_rem0",
+		"cca_rem1",
+		"cca_rem2",
+		"cca_rem3",
+		"cca_personalization_value",
+	}
+}
+
+func (v *verifierCCA) Fields() map[string]*framework.FieldSchema {
+	return ccaFields()
+}
+
+func (v *verifierCCA) MeasurementFields() []string {
+	return ccaMeasurementFields()
+}
+
+func (v *verifierCCA) Apply(
+	ctx context.Context,
+	data *framework.FieldData,
+	isNew bool,
+) error {
+	td := v.CCA
+	if isNew {
+		td = nil
+	}
+
+	td, _, err := v.b.applyCCAFields(ctx, data, v.Name, td)
+	if err != nil {
+		return err
+	}
+	v.CCA = td
+
+	return nil
+}
+
+func (v *verifierCCA) Encode(ctx context.Context) (map[string]interface{}, error) {
+	return v.b.encodeTD(ctx, v.CCA)
+}
+
+func (v *verifierCCA) NonceSize() int {
+	return globals.CCANonceSize
+}
+
+func (v *verifierCCA) NonceData() map[string]interface{} {
+	return nil
+}
+
+func (v *verifierCCA) LoginFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"token": {
+			Type:        framework.TypeString,
+			Description: "CCA attestation token (collection of the platform and realm tokens)",
+		},
+	}
+}
+
+func (v *verifierCCA) ParseEvidence(
+	ctx context.Context,
+	_ *logical.Request,
+	data *framework.FieldData,
+) (interface{}, string, error) {
+	token, err := v.b.parseCCAToken(ctx, data, v.CCA)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return token, base64.StdEncoding.EncodeToString(token.Realm.Challenge), nil
+}
+
+func (v *verifierCCA) Validate(
+	ctx context.Context,
+	evidence interface{},
+	_ string,
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.validateCCAToken(ctx, v.CCA, evidence.(*cca.Token), errs)
+}
+
+func (v *verifierCCA) Match(
+	ctx context.Context,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.verifyCCAToken(ctx, v.CCA, evidence.(*cca.Token), errs)
+}
+
+func (v *verifierCCA) Claims(evidence interface{}) *policy.Claims {
+	return &policy.Claims{
+		CCA: policy.FromCCAToken(evidence.(*cca.Token)),
+	}
+}
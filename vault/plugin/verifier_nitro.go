@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/nitro"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpNitroLoginSynopsys = `
+Log in with TOTP code and AWS Nitro attestation document.
+`
+
+const helpNitroLoginDescription = `
+This endpoint authenticates using TOTP code and AWS Nitro attestation document.
+`
+
+var verifierTypeNitro = &verifierType{
+	attestationType:      "nitro",
+	title:                "AWS Nitro",
+	itemType:             "Nitro",
+	helpLoginSynopsys:    helpNitroLoginSynopsys,
+	helpLoginDescription: helpNitroLoginDescription,
+
+	new: func(b *backend) Verifier {
+		return &verifierNitro{Nitro: &nitro.Nitro{}, b: b}
+	},
+}
+
+type verifierNitro struct {
+	*nitro.Nitro
+	verifierCommon
+
+	b *backend
+}
+
+// nitroFields returns the schema of the fields that configure nitro policy.
+func nitroFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		// PCR
+
+		"nitro_pcr0": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR0",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR0",
+				Description: "Measurement of the enclave image file (base64-encoded SHA384)",
+			},
+		},
+
+		"nitro_pcr1": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR1",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR1",
+				Description: "Measurement of the linux kernel and bootstrap (base64-encoded SHA384)",
+			},
+		},
+
+		"nitro_pcr2": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR2",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR2",
+				Description: "Measurement of the application (base64-encoded SHA384)",
+			},
+		},
+
+		"nitro_pcr3": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR3",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR3",
+				Description: "Measurement of the IAM role assigned to the parent instance (base64-encoded SHA384)",
+			},
+		},
+
+		"nitro_pcr4": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR4",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR4",
+				Description: "Measurement of the instance ID of the parent instance (base64-encoded SHA384)",
+			},
+		},
+
+		"nitro_pcr5": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR5",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR5",
+				Description: "Platform configuration register #5 (base64-encoded SHA384)",
+			},
+		},
+
+		"nitro_pcr6": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR6",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR6",
+				Description: "Platform configuration register #6 (base64-encoded SHA384)",
+			},
+		},
+
+		"nitro_pcr7": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR7",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR7",
+				Description: "Platform configuration register #7 (base64-encoded SHA384)",
+			},
+		},
+
+		"nitro_pcr8": {
+			Type:        framework.TypeString,
+			Description: "Expected value of PCR8",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "PCR8",
+				Description: "Measurement of the enclave image file signing certificate (base64-encoded SHA384)",
+			},
+		},
+	}
+}
+
+// nitroMeasurementFields returns the names of the nitro fields that hold the
+// measurements of the enclave.
+func nitroMeasurementFields() []string {
+	fields := make([]string, 0, 9)
+	for idx := 0; idx < 9; idx++ {
+		fields = append(fields, fmt.Sprintf("nitro_pcr%d", idx))
+	}
+
+	return fields
+}
+
+func (v *verifierNitro) Fields() map[string]*framework.FieldSchema {
+	return nitroFields()
+}
+
+func (v *verifierNitro) MeasurementFields() []string {
+	return nitroMeasurementFields()
+}
+
+func (v *verifierNitro) Apply(
+	ctx context.Context,
+	data *framework.FieldData,
+	isNew bool,
+) error {
+	td := v.Nitro
+	if isNew {
+		td = nil
+	}
+
+	td, _, err := v.b.applyNitroFields(ctx, data, v.Name, td)
+	if err != nil {
+		return err
+	}
+	v.Nitro = td
+
+	return nil
+}
+
+func (v *verifierNitro) Encode(ctx context.Context) (map[string]interface{}, error) {
+	return v.b.encodeTD(ctx, v.Nitro)
+}
+
+func (v *verifierNitro) NonceSize() int {
+	return globals.NitroNonceSize
+}
+
+func (v *verifierNitro) NonceData() map[string]interface{} {
+	return nil
+}
+
+func (v *verifierNitro) LoginFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"document": {
+			Type:        framework.TypeString,
+			Description: "AWS Nitro Enclaves attestation document (COSE_Sign1 as returned by NSM)",
+		},
+	}
+}
+
+func (v *verifierNitro) ParseEvidence(
+	ctx context.Context,
+	_ *logical.Request,
+	data *framework.FieldData,
+) (interface{}, string, error) {
+	doc, err := v.b.parseNitroDocument(ctx, data, v.Nitro)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return doc, base64.StdEncoding.EncodeToString(doc.Nonce), nil
+}
+
+func (v *verifierNitro) Validate(
+	ctx context.Context,
+	evidence interface{},
+	_ string,
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.validateNitroDocument(ctx, v.Nitro, evidence.(*nitro.Document), errs)
+}
+
+func (v *verifierNitro) Match(
+	ctx context.Context,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.verifyNitroDocument(ctx, v.Nitro, evidence.(*nitro.Document), errs)
+}
+
+func (v *verifierNitro) Claims(evidence interface{}) *policy.Claims {
+	return &policy.Claims{
+		Nitro: policy.FromNitroDocument(evidence.(*nitro.Document)),
+	}
+}
@@ -0,0 +1,257 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/sevsnp"
+	snppb "github.com/google/go-sev-guest/proto/sevsnp"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpSEVSNPLoginSynopsys = `
+Log in with TOTP code and SEV-SNP attestation report.
+`
+
+const helpSEVSNPLoginDescription = `
+This endpoint authenticates using TOTP code and SEV-SNP attestation report.
+`
+
+var verifierTypeSEVSNP = &verifierType{
+	attestationType:      "sevsnp",
+	title:                "AMD SEV-SNP",
+	itemType:             "SEV-SNP",
+	helpLoginSynopsys:    helpSEVSNPLoginSynopsys,
+	helpLoginDescription: helpSEVSNPLoginDescription,
+
+	new: func(b *backend) Verifier {
+		return &verifierSEVSNP{SEVSNP: &sevsnp.SEVSNP{}, b: b}
+	},
+}
+
+type verifierSEVSNP struct {
+	*sevsnp.SEVSNP
+	verifierCommon
+
+	b *backend
+}
+
+// sevsnpFields returns the schema of the fields that configure sevsnp policy.
+func sevsnpFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		// MEASUREMENT
+
+		"sevsnp_measurement": {
+			Type:        framework.TypeString,
+			Description: "Expected launch digest of the guest",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "MEASUREMENT",
+				Description: "Launch digest of the guest calculated by the firmware (base64-encoded SHA384)",
+			},
+		},
+
+		// HOST_DATA
+
+		"sevsnp_host_data": {
+			Type:        framework.TypeString,
+			Description: "Expected data provided by the hypervisor at launch",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "HOST_DATA",
+				Description: "Data provided by the hypervisor at launch (base64-encoded 32 byte array)",
+			},
+		},
+
+		// ID_KEY_DIGEST
+
+		"sevsnp_id_key_digest": {
+			Type:        framework.TypeString,
+			Description: "Expected digest of the ID key that signed the ID block",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "ID_KEY_DIGEST",
+				Description: "Digest of the public ID key that signed the ID block provided at launch (base64-encoded SHA384)",
+			},
+		},
+
+		// POLICY.DEBUG
+
+		"sevsnp_check_debug": {
+			Type:        framework.TypeBool,
+			Description: "Verify that POLICY.DEBUG bit is unset",
+			Default:     true,
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Check POLICY.DEBUG",
+				Description: "Verify that guest policy does not allow the host to debug the guest (if it does then guest should not be trusted and thus should not be provisioned with production secrets)",
+			},
+		},
+
+		// POLICY.MIGRATE_MA
+
+		"sevsnp_check_migrate_ma": {
+			Type:        framework.TypeBool,
+			Description: "Verify that POLICY.MIGRATE_MA bit is unset",
+			Default:     true,
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Check POLICY.MIGRATE_MA",
+				Description: "Verify that guest policy does not allow association with a migration agent",
+			},
+		},
+
+		// REPORTED_TCB
+
+		"sevsnp_min_tcb_bootloader": {
+			Type:        framework.TypeInt,
+			Description: "Minimum bootloader SPL of the reported TCB",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Min REPORTED_TCB.BOOT_LOADER",
+				Description: "Minimum security patch level of the bootloader in the reported TCB",
+			},
+		},
+
+		"sevsnp_min_tcb_tee": {
+			Type:        framework.TypeInt,
+			Description: "Minimum TEE SPL of the reported TCB",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Min REPORTED_TCB.TEE",
+				Description: "Minimum security patch level of the PSP OS in the reported TCB",
+			},
+		},
+
+		"sevsnp_min_tcb_snp": {
+			Type:        framework.TypeInt,
+			Description: "Minimum SNP firmware SPL of the reported TCB",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Min REPORTED_TCB.SNP",
+				Description: "Minimum security patch level of the SNP firmware in the reported TCB",
+			},
+		},
+
+		"sevsnp_min_tcb_microcode": {
+			Type:        framework.TypeInt,
+			Description: "Minimum microcode SPL of the reported TCB",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Min REPORTED_TCB.MICROCODE",
+				Description: "Minimum security patch level of the CPU microcode in the reported TCB",
+			},
+		},
+
+		// ASK/ARK
+
+		"sevsnp_ask_ark": {
+			Type:        framework.TypeString,
+			Description: "PEM-encoded ASK (or ASVK) and ARK certificates to verify VCEK (or VLEK) against",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "ASK/ARK",
+				Description: "PEM-encoded ASK (or ASVK) and ARK certificates as served by AMD KDS cert_chain endpoint (when empty, the AMD roots embedded into the plugin are used)",
+				EditType:    "textarea",
+			},
+		},
+	}
+}
+
+// sevsnpMeasurementFields returns the names of the sevsnp fields that hold
+// the measurements of the guest.
+func sevsnpMeasurementFields() []string {
+	return []string{
+		"sevsnp_measurement",
+		"sevsnp_host_data",
+		"sevsnp_id_key_digest",
+	}
+}
+
+func (v *verifierSEVSNP) Fields() map[string]*framework.FieldSchema {
+	return sevsnpFields()
+}
+
+func (v *verifierSEVSNP) MeasurementFields() []string {
+	return sevsnpMeasurementFields()
+}
+
+func (v *verifierSEVSNP) Apply(
+	ctx context.Context,
+	data *framework.FieldData,
+	isNew bool,
+) error {
+	td := v.SEVSNP
+	if isNew {
+		td = nil
+	}
+
+	td, _, err := v.b.applySEVSNPFields(ctx, data, v.Name, td)
+	if err != nil {
+		return err
+	}
+	v.SEVSNP = td
+
+	return nil
+}
+
+func (v *verifierSEVSNP) Encode(ctx context.Context) (map[string]interface{}, error) {
+	return v.b.encodeTD(ctx, v.SEVSNP)
+}
+
+func (v *verifierSEVSNP) NonceSize() int {
+	return globals.SEVSNPNonceSize
+}
+
+func (v *verifierSEVSNP) NonceData() map[string]interface{} {
+	return nil
+}
+
+func (v *verifierSEVSNP) LoginFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"attestation": {
+			Type:        framework.TypeString,
+			Description: "SEV-SNP attestation report followed by the certificate table (as returned by the quote provider)",
+		},
+	}
+}
+
+func (v *verifierSEVSNP) ParseEvidence(
+	ctx context.Context,
+	_ *logical.Request,
+	data *framework.FieldData,
+) (interface{}, string, error) {
+	attestation, err := v.b.parseSEVSNPAttestation(ctx, data, v.SEVSNP)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return attestation, base64.StdEncoding.EncodeToString(attestation.Report.ReportData), nil
+}
+
+func (v *verifierSEVSNP) Validate(
+	ctx context.Context,
+	evidence interface{},
+	_ string,
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.validateSEVSNPAttestation(ctx, v.SEVSNP, evidence.(*snppb.Attestation), errs)
+}
+
+func (v *verifierSEVSNP) Match(
+	ctx context.Context,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.verifySEVSNPAttestation(ctx, v.SEVSNP, evidence.(*snppb.Attestation), errs)
+}
+
+func (v *verifierSEVSNP) Claims(evidence interface{}) *policy.Claims {
+	return &policy.Claims{
+		SEVSNP: policy.FromSEVSNPAttestation(evidence.(*snppb.Attestation)),
+	}
+}
@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"context"
+	"encoding/base64"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/sgx"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpSGXLoginSynopsys = `
+Log in with TOTP code and SGX quote.
+`
+
+const helpSGXLoginDescription = `
+This endpoint authenticates using TOTP code and SGX quote.
+`
+
+var verifierTypeSGX = &verifierType{
+	attestationType:      "sgx",
+	title:                "Intel SGX",
+	itemType:             "SGX",
+	helpLoginSynopsys:    helpSGXLoginSynopsys,
+	helpLoginDescription: helpSGXLoginDescription,
+
+	new: func(b *backend) Verifier {
+		return &verifierSGX{SGX: &sgx.SGX{}, b: b}
+	},
+}
+
+type verifierSGX struct {
+	*sgx.SGX
+	verifierCommon
+
+	b *backend
+}
+
+// sgxFields returns the schema of the fields that configure sgx policy.
+func sgxFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		// MRENCLAVE
+
+		"sgx_mr_enclave": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Allowed measurements of the enclave",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "MRENCLAVE",
+				Description: "Allow-list of enclave measurements (base64-encoded SHA256, any enclave is allowed when empty)",
+			},
+		},
+
+		// MRSIGNER
+
+		"sgx_mr_signer": {
+			Type:        framework.TypeCommaStringSlice,
+			Description: "Allowed signers of the enclave",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "MRSIGNER",
+				Description: "Allow-list of hashes of the keys that signed the enclave (base64-encoded SHA256, any signer is allowed when empty)",
+			},
+		},
+
+		// ISVPRODID
+
+		"sgx_isv_prod_id": {
+			Type:        framework.TypeInt,
+			Description: "Expected product id of the enclave",
+			Default:     -1,
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "ISVPRODID",
+				Description: "Product id assigned to the enclave by its signer (negative value disables the check)",
+			},
+		},
+
+		// ISVSVN
+
+		"sgx_min_isv_svn": {
+			Type:        framework.TypeInt,
+			Description: "Minimum security version of the enclave",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Min ISVSVN",
+				Description: "Minimum security version number assigned to the enclave by its signer",
+			},
+		},
+
+		// ATTRIBUTES.DEBUG
+
+		"sgx_check_debug": {
+			Type:        framework.TypeBool,
+			Description: "Verify that ATTRIBUTES.DEBUG bit is unset",
+			Default:     true,
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Check ATTRIBUTES.DEBUG",
+				Description: "Verify that the enclave is not a debug one (if it is then its memory can be inspected, and thus it should not be provisioned with production secrets)",
+			},
+		},
+	}
+}
+
+// sgxMeasurementFields returns the names of the sgx fields that hold the
+// measurements of the enclave.
+func sgxMeasurementFields() []string {
+	return []string{
+		"sgx_mr_enclave",
+		"sgx_mr_signer",
+	}
+}
+
+func (v *verifierSGX) Fields() map[string]*framework.FieldSchema {
+	return sgxFields()
+}
+
+func (v *verifierSGX) MeasurementFields() []string {
+	return sgxMeasurementFields()
+}
+
+func (v *verifierSGX) Apply(
+	ctx context.Context,
+	data *framework.FieldData,
+	isNew bool,
+) error {
+	td := v.SGX
+	if isNew {
+		td = nil
+	}
+
+	td, _, err := v.b.applySGXFields(ctx, data, v.Name, td)
+	if err != nil {
+		return err
+	}
+	v.SGX = td
+
+	return nil
+}
+
+func (v *verifierSGX) Encode(ctx context.Context) (map[string]interface{}, error) {
+	return v.b.encodeTD(ctx, v.SGX)
+}
+
+func (v *verifierSGX) NonceSize() int {
+	return globals.SGXNonceSize
+}
+
+func (v *verifierSGX) NonceData() map[string]interface{} {
+	return nil
+}
+
+func (v *verifierSGX) LoginFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"quote": {
+			Type:        framework.TypeString,
+			Description: "SGX DCAP quote (version 3) with embedded PCK certificate chain",
+		},
+	}
+}
+
+func (v *verifierSGX) ParseEvidence(
+	ctx context.Context,
+	_ *logical.Request,
+	data *framework.FieldData,
+) (interface{}, string, error) {
+	quote, err := v.b.parseSGXQuote(ctx, data, v.SGX)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return quote, base64.StdEncoding.EncodeToString(quote.Body.ReportData), nil
+}
+
+func (v *verifierSGX) Validate(
+	ctx context.Context,
+	evidence interface{},
+	_ string,
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.validateSGXQuote(ctx, v.SGX, evidence.(*sgx.Quote), errs)
+}
+
+func (v *verifierSGX) Match(
+	ctx context.Context,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.verifySGXQuote(ctx, v.SGX, evidence.(*sgx.Quote), errs)
+}
+
+func (v *verifierSGX) Claims(evidence interface{}) *policy.Claims {
+	return &policy.Claims{
+		SGX: policy.FromSGXQuote(evidence.(*sgx.Quote)),
+	}
+}
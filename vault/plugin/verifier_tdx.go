@@ -0,0 +1,443 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpTDXLoginSynopsys = `
+Log in with TOTP code and TDX attestation quote.
+`
+
+const helpTDXLoginDescription = `
+This endpoint authenticates using TOTP code and TDX attestation quote.
+`
+
+var verifierTypeTDX = &verifierType{
+	attestationType:      "tdx",
+	title:                "TDX",
+	itemType:             "TDX",
+	helpLoginSynopsys:    helpTDXLoginSynopsys,
+	helpLoginDescription: helpTDXLoginDescription,
+
+	new: func(b *backend) Verifier {
+		return &verifierTDX{TDX: &tdx.TDX{}, b: b}
+	},
+}
+
+type verifierTDX struct {
+	*tdx.TDX
+	verifierCommon
+
+	b *backend
+
+	// instance is the enrolled instance that authenticated the login (if
+	// any).
+	instance *tdx.Instance
+}
+
+// tdxFields returns the schema of the fields that configure tdx policy.
+func tdxFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		// MROWNER
+
+		"tdx_mr_owner": {
+			Type:        framework.TypeString,
+			Description: "Expected software-defined ID for the TD's owner",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "MROWNER",
+				Description: "Software-defined ID for the TD's owner (base64-encoded 48 byte array)",
+			},
+		},
+
+		// MROWNERCONFIG
+
+		"tdx_mr_owner_config": {
+			Type:        framework.TypeString,
+			Description: "Expected software-defined ID for owner-defined configuration of the TD",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "MROWNERCONFIG",
+				Description: "Software-defined ID for owner-defined configuration of the TD, e.g., specific to the workload rather than the runtime or OS (base64-encoded 48 byte array)",
+			},
+		},
+
+		// MRCONFIGID
+
+		"tdx_mr_config_id": {
+			Type:        framework.TypeString,
+			Description: "Expected software-defined ID for non-owner-defined configuration of the TD",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "MRCONFIGID",
+				Description: "Software-defined ID for non-owner-defined configuration of the TD, e.g., runtime or OS configuration (base64-encoded 48 byte array)",
+			},
+		},
+
+		// MRTD
+
+		"tdx_mr_td": {
+			Type:        framework.TypeString,
+			Description: "Expected measurement of initial contents of the TD",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "MRTD",
+				Description: "Measurement of the initial contents of the TD (base64-encoded SHA384)",
+			},
+		},
+
+		// RTMR0
+
+		"tdx_rtmr0": {
+			Type:        framework.TypeString,
+			Description: "Expected runtime-extendable measurement register #0",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "RTMR[0]",
+				Description: "Runtime extendable measurement register #0 (base64-encoded SHA384). By convention, RTMR[0] is updated by the TD virtual firmware/BIOS",
+			},
+		},
+
+		// RTMR1
+
+		"tdx_rtmr1": {
+			Type:        framework.TypeString,
+			Description: "Expected runtime-extendable measurement register #1",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "RTMR[1]",
+				Description: "Runtime extendable measurement register #1 (base64-encoded SHA384). By convention, RTMR[1] is updated by the TD virtual firmware/BIOS",
+			},
+		},
+
+		// RTMR2
+
+		"tdx_rtmr2": {
+			Type:        framework.TypeString,
+			Description: "Expected runtime-extendable measurement register #2",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "RTMR[2]",
+				Description: "Runtime extendable measurement register #2 (base64-encoded SHA384). By convention, RTMR[2] measurements are generated by the OS",
+			},
+		},
+
+		// RTMR3
+
+		"tdx_rtmr3": {
+			Type:        framework.TypeString,
+			Description: "Expected runtime-extendable measurement register #3",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "RTMR[3]",
+				Description: "Runtime extendable measurement register #3 (base64-encoded SHA384). By convention, RTMR[3] measurements are generated by runtime code",
+			},
+		},
+
+		// MRSERVICETD
+
+		"tdx_mr_service_td": {
+			Type:        framework.TypeString,
+			Description: "Expected measurement of service TDs (requires TD 1.5 report body)",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "MRSERVICETD",
+				Description: "Measurement of the service TDs bound to the TD, e.g. migration TD (base64-encoded SHA384). Only reported with TD 1.5 report bodies (quote v5), so when set the quotes with TD 1.0 bodies are rejected",
+			},
+		},
+
+		// TEE_TCB_SVN2
+
+		"tdx_min_tee_tcb_svn2": {
+			Type:        framework.TypeString,
+			Description: "Minimum expected TEE_TCB_SVN2 (requires TD 1.5 report body)",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Min TEE_TCB_SVN2",
+				Description: "Minimum security version of the TDX module after TD-preserving update (base64-encoded 16 bytes, verified per component). Only reported with TD 1.5 report bodies (quote v5), so when set the quotes with TD 1.0 bodies are rejected",
+			},
+		},
+
+		// TDATTIBUTES.TUD
+
+		"tdx_check_debug": {
+			Type:        framework.TypeBool,
+			Description: "Verify that TUD.DEBUG attribute is unset",
+			Default:     true,
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Check TDATTIBUTES.TUD",
+				Description: "Verify that TD Under Debug flag is set to zero (if it's not zero then TD should not be trusted and thus should not be provisioned with production secrets)",
+			},
+		},
+
+		// SEC.SEPT_VE_DISABLE
+
+		"tdx_check_sept_ve_disable": {
+			Type:        framework.TypeBool,
+			Description: "Verify that SEC.SEPT_VE_DISABLE attribute is set",
+			Default:     true,
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Check SEC.SEPT_VE_DISABLE",
+				Description: "Verify that EPT violation conversion to #VE on TD access of PENDING pages is disabled",
+			},
+		},
+
+		// TLS binding
+
+		"tdx_tls_binding": {
+			Type:        framework.TypeBool,
+			Description: "Require the quote to be bound to the client TLS certificate",
+			Default:     false,
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "TLS binding",
+				Description: "Require the report data of the quote to be SHA512(nonce || public key of the client TLS certificate), so that the quote can not be relayed through another connection",
+			},
+		},
+	}
+}
+
+// tdxMeasurementFields returns the names of the tdx fields that hold the
+// measurements of the td.
+func tdxMeasurementFields() []string {
+	fields := []string{
+		"tdx_mr_owner",
+		"tdx_mr_owner_config",
+		"tdx_mr_config_id",
+		"tdx_mr_td",
+		"tdx_mr_service_td",
+	}
+	for idx := 0; idx < 4; idx++ {
+		fields = append(fields, fmt.Sprintf("tdx_rtmr%d", idx))
+	}
+
+	return fields
+}
+
+func (v *verifierTDX) Fields() map[string]*framework.FieldSchema {
+	fields := tdxFields()
+
+	// Instance enrollment
+
+	fields["instance_enrollment"] = &framework.FieldSchema{
+		Type:        framework.TypeBool,
+		Description: "Allow TD instances to enroll their own keys with attested first contact (without TOTP)",
+		Default:     false,
+
+		DisplayAttrs: &framework.DisplayAttributes{
+			Name:        "Instance enrollment",
+			Description: "Allow TD instances to enroll their own keys with attested first contact (without TOTP), and then use those keys instead of TOTP codes for the subsequent logins",
+		},
+	}
+
+	return fields
+}
+
+func (v *verifierTDX) MeasurementFields() []string {
+	return tdxMeasurementFields()
+}
+
+func (v *verifierTDX) Apply(
+	ctx context.Context,
+	data *framework.FieldData,
+	isNew bool,
+) error {
+	td := v.TDX
+	if isNew {
+		td = nil
+	}
+
+	td, _, err := v.b.applyTDXFields(ctx, v.AttestationType(), data, v.Name, td)
+	if err != nil {
+		return err
+	}
+	v.TDX = td
+
+	if instanceEnrollment, ok := data.GetOk("instance_enrollment"); ok {
+		v.InstanceEnrollment = instanceEnrollment.(bool)
+	}
+
+	return nil
+}
+
+func (v *verifierTDX) Encode(ctx context.Context) (map[string]interface{}, error) {
+	return v.b.encodeTD(ctx, v.TDX)
+}
+
+func (v *verifierTDX) NonceSize() int {
+	return globals.TDXNonceSize
+}
+
+func (v *verifierTDX) NonceData() map[string]interface{} {
+	return nil
+}
+
+func (v *verifierTDX) LoginFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"quote": {
+			Type:        framework.TypeString,
+			Description: "TDX attestation quote",
+		},
+
+		"nonce": {
+			Type:        framework.TypeString,
+			Description: "Nonce used when generating TDX attestation quote (required when report data is not the nonce itself)",
+		},
+
+		"public_key": {
+			Type:        framework.TypeString,
+			Description: "Public key of the enrolled TD instance (used instead of TOTP code)",
+		},
+
+		"signature": {
+			Type:        framework.TypeString,
+			Description: "Signature of the nonce made with the private key of the enrolled TD instance",
+		},
+	}
+}
+
+func (v *verifierTDX) ParseEvidence(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (interface{}, string, error) {
+	var bindings [][]byte
+	if v.instance != nil {
+		bindings = append(bindings, v.instance.PublicKey)
+	}
+
+	tlsBinding, err := v.b.getTDXTLSBinding(ctx, v.AttestationType(), req, v.TDX)
+	if err != nil {
+		return nil, "", err
+	}
+	if tlsBinding != nil {
+		bindings = append(bindings, tlsBinding)
+	}
+
+	quote, err := v.b.parseTDXQuote(ctx, v.AttestationType(), data, v.TDX)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce, err := v.b.validateTDXReportData(ctx, v.AttestationType(), data, v.TDX, quote, bindings...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return quote, nonce, nil
+}
+
+func (v *verifierTDX) Validate(
+	ctx context.Context,
+	evidence interface{},
+	_ string,
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.validateTDXQuote(ctx, v.AttestationType(), v.TDX, evidence.(*tdx.Quote), errs)
+}
+
+func (v *verifierTDX) Match(
+	ctx context.Context,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.verifyTDXQuote(ctx, v.AttestationType(), v.TDX, evidence.(*tdx.Quote), errs)
+}
+
+func (v *verifierTDX) IsInstanceRequest(data *framework.FieldData) bool {
+	return v.InstanceEnrollment && data.Get("totp").(string) == ""
+}
+
+func (v *verifierTDX) NonceFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"public_key": {
+			Type:        framework.TypeString,
+			Description: "Public key of the enrolled TD instance (omitted by the instances that are about to enroll)",
+		},
+
+		"timestamp": {
+			Type:        framework.TypeInt,
+			Description: "Time of the request (unix seconds) signed by the enrolled TD instance",
+		},
+
+		"signature": {
+			Type:        framework.TypeString,
+			Description: "Signature of the timestamp made with the private key of the enrolled TD instance",
+		},
+	}
+}
+
+func (v *verifierTDX) AuthenticateNonceRequest(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (string, error) {
+	if data.Get("public_key").(string) == "" { // first contact
+		return "", nil
+	}
+
+	instance, err := v.b.authenticateTDXNonceRequest(ctx, req, data, v.TDX)
+	if err != nil {
+		return "", err
+	}
+
+	return instance.ID, nil
+}
+
+func (v *verifierTDX) AuthenticateInstance(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (string, error) {
+	instance, err := v.b.authenticateTDXInstance(ctx, req, data, v.TDX)
+	if err != nil {
+		return "", err
+	}
+	v.instance = instance
+
+	return instance.ID, nil
+}
+
+func (v *verifierTDX) PurgeInstances(
+	ctx context.Context,
+	req *logical.Request,
+) error {
+	return v.b.purgeTDXInstances(ctx, req, v.Name)
+}
+
+func (v *verifierTDX) Claims(evidence interface{}) *policy.Claims {
+	return &policy.Claims{
+		TDX: policy.FromTDXQuote(evidence.(*tdx.Quote)),
+	}
+}
+
+func (v *verifierTDX) TDXQuote(evidence interface{}) *tdx.Quote {
+	return evidence.(*tdx.Quote)
+}
+
+func (v *verifierTDX) InstanceAliasSources() []string {
+	return []string{aliasSourceInstanceKey, aliasSourcePPID}
+}
+
+func (v *verifierTDX) InstanceAlias(source string, evidence interface{}) (string, error) {
+	switch source {
+	case aliasSourceInstanceKey:
+		if v.instance == nil {
+			return "", errInstanceAliasNoInstanceKey
+		}
+		return v.instance.ID, nil
+	case aliasSourcePPID:
+		return evidence.(*tdx.Quote).PPID()
+	}
+	return "", fmt.Errorf("%w: %s", errInstanceAliasInvalid, source)
+}
@@ -0,0 +1,214 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/tdx"
+	"github.com/flashbots/vault-auth-plugin-attest/tdxtpm2"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpTDXTPM2LoginSynopsys = `
+Log in with TOTP code, TDX attestation quote and TPM 2.0 attestation report.
+`
+
+const helpTDXTPM2LoginDescription = `
+This endpoint authenticates using TOTP code, TDX attestation quote and TPM 2.0
+attestation report (both bound to the same nonce).
+`
+
+var verifierTypeTDXTPM2 = &verifierType{
+	attestationType:      "tdxtpm2",
+	title:                "TDX+vTPM",
+	itemType:             "TDXTPM2",
+	helpLoginSynopsys:    helpTDXTPM2LoginSynopsys,
+	helpLoginDescription: helpTDXTPM2LoginDescription,
+
+	new: func(b *backend) Verifier {
+		return &verifierTDXTPM2{TDXTPM2: &tdxtpm2.TDXTPM2{}, b: b}
+	},
+}
+
+type verifierTDXTPM2 struct {
+	*tdxtpm2.TDXTPM2
+	verifierCommon
+
+	b *backend
+}
+
+// tdxtpm2Evidence is the pair of tdx quote and tpm2 attestation that are
+// bound to the same nonce.
+type tdxtpm2Evidence struct {
+	quote       *tdx.Quote
+	attestation *attest.PlatformParameters
+}
+
+func (v *verifierTDXTPM2) Fields() map[string]*framework.FieldSchema {
+	fields := tdxFields()
+	for k, f := range tpm2Fields() {
+		fields[k] = f
+	}
+
+	return fields
+}
+
+func (v *verifierTDXTPM2) MeasurementFields() []string {
+	return slices.Concat(tdxMeasurementFields(), tpm2MeasurementFields())
+}
+
+func (v *verifierTDXTPM2) Apply(
+	ctx context.Context,
+	data *framework.FieldData,
+	isNew bool,
+) error {
+	if isNew {
+		v.b.Logger().Debug("creating domain",
+			"attestation_type", v.AttestationType(),
+			"domain", v.Name,
+		)
+	}
+
+	policyTDX, _, err := v.b.applyTDXFields(ctx, v.AttestationType(), data, v.Name, v.TDX)
+	if err != nil {
+		return err
+	}
+	policyTPM2, _, err := v.b.applyTPM2Fields(ctx, data, v.Name, v.TPM2)
+	if err != nil {
+		return err
+	}
+
+	v.TDX = policyTDX
+	v.TPM2 = policyTPM2
+
+	return nil
+}
+
+func (v *verifierTDXTPM2) Encode(ctx context.Context) (map[string]interface{}, error) {
+	return v.b.encodeTDXTPM2(ctx, v.TDXTPM2)
+}
+
+func (v *verifierTDXTPM2) NonceSize() int {
+	return globals.TPM2NonceSize
+}
+
+func (v *verifierTDXTPM2) NonceData() map[string]interface{} {
+	return map[string]interface{}{
+		"ak_public": v.TPM2.AKPublic.String(),
+	}
+}
+
+func (v *verifierTDXTPM2) LoginFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"quote": {
+			Type:        framework.TypeString,
+			Description: "TDX attestation quote",
+		},
+
+		"attestation": {
+			Type:        framework.TypeString,
+			Description: "TPM 2.0 attestation report",
+		},
+
+		"nonce": {
+			Type:        framework.TypeString,
+			Description: "Nonce used when generating TPM 2.0 attestation report and TDX attestation quote",
+		},
+	}
+}
+
+func (v *verifierTDXTPM2) ParseEvidence(
+	ctx context.Context,
+	req *logical.Request,
+	data *framework.FieldData,
+) (interface{}, string, error) {
+	bindings := [][]byte{v.TPM2.AKPublic} // binds vtpm to the td
+
+	tlsBinding, err := v.b.getTDXTLSBinding(ctx, v.AttestationType(), req, v.TDX)
+	if err != nil {
+		return nil, "", err
+	}
+	if tlsBinding != nil {
+		bindings = append(bindings, tlsBinding)
+	}
+
+	quote, err := v.b.parseTDXQuote(ctx, v.AttestationType(), data, v.TDX)
+	if err != nil {
+		return nil, "", err
+	}
+
+	attestation, err := v.b.parseTPM2Attestation(ctx, data, v.TPM2)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce, err := v.b.validateTDXReportData(ctx, v.AttestationType(), data, v.TDX, quote, bindings...)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &tdxtpm2Evidence{quote: quote, attestation: attestation}, nonce, nil
+}
+
+func (v *verifierTDXTPM2) Validate(
+	ctx context.Context,
+	evidence interface{},
+	nonce string,
+	errs *multierror.Error,
+) *multierror.Error {
+	e := evidence.(*tdxtpm2Evidence)
+
+	errs = v.b.validateTDXQuote(ctx, v.AttestationType(), v.TDX, e.quote, errs)
+	return v.b.validateTPM2Attestation(ctx, v.TPM2, e.attestation, nonce, errs)
+}
+
+func (v *verifierTDXTPM2) Match(
+	ctx context.Context,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	e := evidence.(*tdxtpm2Evidence)
+
+	return v.b.verifyTDXTPM2(ctx, v.TDXTPM2, e.quote, e.attestation, errs)
+}
+
+func (v *verifierTDXTPM2) Claims(evidence interface{}) *policy.Claims {
+	e := evidence.(*tdxtpm2Evidence)
+
+	return &policy.Claims{
+		TDX:  policy.FromTDXQuote(e.quote),
+		TPM2: policy.FromTPM2Attestation(e.attestation),
+	}
+}
+
+func (v *verifierTDXTPM2) TDXQuote(evidence interface{}) *tdx.Quote {
+	return evidence.(*tdxtpm2Evidence).quote
+}
+
+func (v *verifierTDXTPM2) TPM2Policy() *tpm2.TPM2 {
+	return v.TPM2
+}
+
+func (v *verifierTDXTPM2) TPM2Attestation(evidence interface{}) *attest.PlatformParameters {
+	return evidence.(*tdxtpm2Evidence).attestation
+}
+
+// InstanceAliasSources does not offer the attestation key, since the domain
+// pins it (so all of its instances would share the same alias).
+func (v *verifierTDXTPM2) InstanceAliasSources() []string {
+	return []string{aliasSourcePPID}
+}
+
+func (v *verifierTDXTPM2) InstanceAlias(source string, evidence interface{}) (string, error) {
+	if source == aliasSourcePPID {
+		return evidence.(*tdxtpm2Evidence).quote.PPID()
+	}
+	return "", fmt.Errorf("%w: %s", errInstanceAliasInvalid, source)
+}
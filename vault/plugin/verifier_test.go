@@ -0,0 +1,99 @@
+package plugin
+
+import (
+	"context"
+	"testing"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerifierTypes(t *testing.T) {
+	b, _ := newTestBackend(t)
+
+	seen := make(map[string]bool)
+	for _, vt := range verifierTypes {
+		t.Run(vt.attestationType, func(t *testing.T) {
+			assert.False(t, seen[vt.attestationType], "duplicate attestation type")
+			seen[vt.attestationType] = true
+
+			assert.Same(t, vt, lookupVerifierType(vt.attestationType))
+
+			v := vt.new(b)
+			assert.Equal(t, vt.attestationType, v.AttestationType())
+			assert.NotEmpty(t, v.Fields())
+			assert.NotEmpty(t, v.LoginFields())
+			assert.Positive(t, v.NonceSize())
+
+			v.SetName("test")
+			assert.Equal(t, "test", v.GetName())
+
+			for _, path := range []string{
+				vt.attestationType + "/test",
+				vt.attestationType + "/test/nonce",
+				vt.attestationType + "/test/login",
+			} {
+				assert.NotNil(t, b.Route(path), path)
+			}
+		})
+	}
+
+	assert.Nil(t, lookupVerifierType("unknown"))
+}
+
+func TestVerifierLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	// fields that have to be provided when the domain is created
+	required := map[string]map[string]interface{}{
+		verifierTypeTPM2.attestationType:    {"tpm2_ak_public": "AAAA"},
+		verifierTypeTDXTPM2.attestationType: {"tpm2_ak_public": "AAAA"},
+	}
+
+	for _, vt := range verifierTypes {
+		t.Run(vt.attestationType, func(t *testing.T) {
+			b, storage := newTestBackend(t)
+			path := vt.attestationType + "/test"
+
+			data := map[string]interface{}{"totp_secret": "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP"}
+			for k, v := range required[vt.attestationType] {
+				data[k] = v
+			}
+			res, err := handle(t, b, storage, "", logical.CreateOperation, path, data)
+			require.NoError(t, err)
+			require.False(t, res.IsError(), res.Error())
+
+			{ // stored under the attestation type
+				v, err := b.loadVerifier(ctx, storage, vt, "test")
+				require.NoError(t, err)
+				require.NotNil(t, v)
+				assert.Equal(t, vt.attestationType, v.AttestationType())
+				assert.Equal(t, "test", v.GetName())
+				assert.Equal(t, "JBSWY3DPEHPK3PXPJBSWY3DPEHPK3PXP", v.GetTOTPSecret())
+			}
+
+			{ // read
+				res, err := handle(t, b, storage, "", logical.ReadOperation, path, nil)
+				require.NoError(t, err)
+				require.NotNil(t, res)
+				assert.Contains(t, res.Data, "token_policies")
+			}
+
+			{ // list
+				res, err := handle(t, b, storage, "", logical.ListOperation, vt.attestationType+"/", nil)
+				require.NoError(t, err)
+				assert.Equal(t, []string{"test"}, res.Data["keys"])
+			}
+
+			{ // delete
+				_, err := handle(t, b, storage, "", logical.DeleteOperation, path, nil)
+				require.NoError(t, err)
+
+				v, err := b.loadVerifier(ctx, storage, vt, "test")
+				require.NoError(t, err)
+				assert.Nil(t, v)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/flashbots/vault-auth-plugin-attest/globals"
+	"github.com/flashbots/vault-auth-plugin-attest/policy"
+	"github.com/flashbots/vault-auth-plugin-attest/tpm2"
+	"github.com/google/go-attestation/attest"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const helpTPM2LoginSynopsys = `
+Log in with TOTP code and TPM 2.0 attestation report.
+`
+
+const helpTPM2LoginDescription = `
+This endpoint authenticates using TOTP code and TPM 2.0 attestation
+report.
+`
+
+var verifierTypeTPM2 = &verifierType{
+	attestationType:      "tpm2",
+	title:                "TPM 2.0",
+	itemType:             "TPM2",
+	helpLoginSynopsys:    helpTPM2LoginSynopsys,
+	helpLoginDescription: helpTPM2LoginDescription,
+
+	new: func(b *backend) Verifier {
+		return &verifierTPM2{TPM2: &tpm2.TPM2{}, b: b}
+	},
+}
+
+type verifierTPM2 struct {
+	*tpm2.TPM2
+	verifierCommon
+
+	b *backend
+}
+
+// tpm2Fields returns the schema of the fields that configure tpm2 policy.
+func tpm2Fields() map[string]*framework.FieldSchema {
+	fields := map[string]*framework.FieldSchema{
+		// AK
+
+		"tpm2_ak_public": {
+			Type:        framework.TypeString,
+			Description: "Public part of the attestation key used to generate TPM 2.0 attestations/quotes",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "AK",
+				Description: "Public part of the attestation key used to generate TPM 2.0 attestations/quotes (base64-encoded)",
+				EditType:    "textarea",
+			},
+		},
+
+		// Clock
+
+		"tpm2_clock_check": {
+			Type:        framework.TypeBool,
+			Description: "Reject the logins where TPM clock went backwards, or advanced more than the time that has passed since the previous login",
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Clock check",
+				Description: "Reject the logins where TPM reset count, restart count, or clock went backwards since the previous login with the same attestation key (that is, the logins from another TPM), or where the clock advanced more than the time that has passed since then",
+			},
+		},
+
+		"tpm2_reboot_action": {
+			Type:          framework.TypeString,
+			Description:   "What to do when the machine has rebooted since the previous login (none, alert, or reapprove)",
+			AllowedValues: []interface{}{tpm2.RebootActionNone, tpm2.RebootActionAlert, tpm2.RebootActionReapprove},
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        "Reboot action",
+				Description: "What to do when the machine has rebooted since the previous login: only record it (none), log a warning (alert), or reject the logins until the reboot is approved at `tpm2-clock` endpoint of the domain (reapprove)",
+			},
+		},
+	}
+
+	for idx := 0; idx < 24; idx++ {
+		fields[fmt.Sprintf("tpm2_pcr%02d", idx)] = &framework.FieldSchema{
+			Type:        framework.TypeString,
+			Description: fmt.Sprintf("Expected measurement of platform configuration register #%d", idx),
+
+			DisplayAttrs: &framework.DisplayAttributes{
+				Name:        fmt.Sprintf("PCR[%d]", idx),
+				Description: fmt.Sprintf("Expected measurement of platform configuration register #%d", idx),
+			},
+		}
+	}
+
+	return fields
+}
+
+// tpm2MeasurementFields returns the names of the tpm2 fields that hold the
+// measurements (the expected values of pcrs).
+func tpm2MeasurementFields() []string {
+	fields := make([]string, 0, 24)
+	for idx := 0; idx < 24; idx++ {
+		fields = append(fields, fmt.Sprintf("tpm2_pcr%02d", idx))
+	}
+
+	return fields
+}
+
+// encodeTPM2PCRs adds expected pcr values to the encoded policy (they are
+// kept in an array, and therefore are skipped by mapstructure).
+func encodeTPM2PCRs(td *tpm2.TPM2, res map[string]interface{}) {
+	for idx, pcr := range td.PCRs {
+		if pcr != nil {
+			res[fmt.Sprintf("tpm2_pcr%02d", idx)] = pcr.String()
+		}
+	}
+}
+
+func (v *verifierTPM2) Fields() map[string]*framework.FieldSchema {
+	return tpm2Fields()
+}
+
+func (v *verifierTPM2) MeasurementFields() []string {
+	return tpm2MeasurementFields()
+}
+
+func (v *verifierTPM2) Apply(
+	ctx context.Context,
+	data *framework.FieldData,
+	isNew bool,
+) error {
+	td := v.TPM2
+	if isNew {
+		td = nil
+	}
+
+	td, _, err := v.b.applyTPM2Fields(ctx, data, v.Name, td)
+	if err != nil {
+		return err
+	}
+	v.TPM2 = td
+
+	return nil
+}
+
+func (v *verifierTPM2) Encode(ctx context.Context) (map[string]interface{}, error) {
+	res, err := v.b.encodeTD(ctx, v.TPM2)
+	if err != nil {
+		return nil, err
+	}
+	encodeTPM2PCRs(v.TPM2, res)
+
+	return res, nil
+}
+
+// tpm2Evidence is the attestation of tpm2 together with the endorsement key
+// that the instance reported with it.
+type tpm2Evidence struct {
+	attestation *attest.PlatformParameters
+	ekPublic    []byte
+}
+
+func (v *verifierTPM2) NonceSize() int {
+	return globals.TPM2NonceSize
+}
+
+func (v *verifierTPM2) NonceData() map[string]interface{} {
+	return map[string]interface{}{
+		"ak_public": v.AKPublic.String(),
+	}
+}
+
+func (v *verifierTPM2) LoginFields() map[string]*framework.FieldSchema {
+	return map[string]*framework.FieldSchema{
+		"attestation": {
+			Type:        framework.TypeString,
+			Description: "TPM 2.0 attestation report",
+		},
+
+		"nonce": {
+			Type:        framework.TypeString,
+			Description: "Nonce used when generating TPM 2.0 attestation report",
+		},
+
+		"ek_public": {
+			Type:        framework.TypeString,
+			Description: "Public part of TPM 2.0 endorsement key (DER-encoded SubjectPublicKeyInfo), required by the domains with instance_alias=ek",
+		},
+	}
+}
+
+func (v *verifierTPM2) ParseEvidence(
+	ctx context.Context,
+	_ *logical.Request,
+	data *framework.FieldData,
+) (interface{}, string, error) {
+	attestation, err := v.b.parseTPM2Attestation(ctx, data, v.TPM2)
+	if err != nil {
+		return nil, "", err
+	}
+
+	ekPublic, err := v.b.parseTPM2EK(ctx, data, v.TPM2)
+	if err != nil {
+		return nil, "", err
+	}
+
+	nonce, err := v.b.getNonce(ctx, data)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return &tpm2Evidence{attestation: attestation, ekPublic: ekPublic}, nonce, nil
+}
+
+func (v *verifierTPM2) Validate(
+	ctx context.Context,
+	evidence interface{},
+	nonce string,
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.validateTPM2Attestation(ctx, v.TPM2, evidence.(*tpm2Evidence).attestation, nonce, errs)
+}
+
+func (v *verifierTPM2) Match(
+	ctx context.Context,
+	evidence interface{},
+	errs *multierror.Error,
+) *multierror.Error {
+	return v.b.verifyTPM2Attestation(ctx, v.TPM2, evidence.(*tpm2Evidence).attestation, errs)
+}
+
+func (v *verifierTPM2) Claims(evidence interface{}) *policy.Claims {
+	return &policy.Claims{
+		TPM2: policy.FromTPM2Attestation(evidence.(*tpm2Evidence).attestation),
+	}
+}
+
+func (v *verifierTPM2) TPM2Policy() *tpm2.TPM2 {
+	return v.TPM2
+}
+
+func (v *verifierTPM2) TPM2Attestation(evidence interface{}) *attest.PlatformParameters {
+	return evidence.(*tpm2Evidence).attestation
+}
+
+// InstanceAliasSources does not offer the attestation key, since the domain
+// pins it (so all of its instances would share the same alias). The
+// endorsement key is offered instead.
+func (v *verifierTPM2) InstanceAliasSources() []string {
+	return []string{aliasSourceEK}
+}
+
+func (v *verifierTPM2) InstanceAlias(source string, evidence interface{}) (string, error) {
+	if source == aliasSourceEK {
+		ekPublic := evidence.(*tpm2Evidence).ekPublic
+		if ekPublic == nil {
+			return "", errInstanceAliasNoEK
+		}
+		return tpm2.EKFingerprint(ekPublic), nil
+	}
+	return "", fmt.Errorf("%w: %s", errInstanceAliasInvalid, source)
+}